@@ -0,0 +1,174 @@
+// Package protocol holds the JSON-RPC 2.0 framing MCP uses over stdio: the
+// message types, and reading and writing newline-delimited messages.
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Request is an incoming request or notification. ID keeps the raw JSON so
+// it can be echoed back byte for byte: decoding numbers into interface{}
+// would round large integers through float64. A notification has no ID at
+// all; an explicit null ID is still a request.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response always carries an id; a nil ID is sent as null, as required for
+// errors on messages whose id couldn't be read.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is the error object of a failed Response.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Notification is a message sent without an id, which gets no response.
+type Notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// IsBatch reports whether a line holds a batch, a JSON array of messages,
+// rather than a single message.
+func IsBatch(line []byte) bool {
+	trimmed := bytes.TrimLeft(line, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// IsObject reports whether a message is a JSON object, the only shape a
+// single request, notification or response may take.
+func IsObject(message []byte) bool {
+	trimmed := bytes.TrimLeft(message, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// ValidID reports whether a request id has a type JSON-RPC allows: a
+// string, a number or null.
+func ValidID(id json.RawMessage) bool {
+	decoder := json.NewDecoder(bytes.NewReader(id))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return false
+	}
+	// Nothing may follow the value
+	if _, err := decoder.Token(); err != io.EOF {
+		return false
+	}
+	switch value.(type) {
+	case string, json.Number, nil:
+		return true
+	}
+	return false
+}
+
+// ErrMessageTooLarge is returned by ReadLine for lines over its limit.
+var ErrMessageTooLarge = errors.New("message too large")
+
+// ReadLine reads the next newline-terminated message from r. A line longer
+// than maxSize bytes is consumed and discarded, and ErrMessageTooLarge
+// returned, so reading can carry on with the next message.
+func ReadLine(r *bufio.Reader, maxSize int) ([]byte, error) {
+	var line []byte
+	tooLarge := false
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if !tooLarge && len(line)+len(chunk) > maxSize {
+			tooLarge = true
+			line = nil
+		}
+		if !tooLarge {
+			line = append(line, chunk...)
+		}
+		if !isPrefix {
+			break
+		}
+	}
+	if tooLarge {
+		return nil, ErrMessageTooLarge
+	}
+	return line, nil
+}
+
+// Writer writes newline-delimited messages for any number of goroutines at
+// once: each message is written whole, as one line, and flushed before the
+// next starts, so messages never interleave. Once a write has failed,
+// nothing more is written and every later call returns that error.
+type Writer struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	err error
+}
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// WriteMessage encodes v as JSON and writes it as one line. A
+// json.RawMessage is written as it is; it must already be valid JSON on a
+// single line.
+func (w *Writer) WriteMessage(v interface{}) error {
+	data, ok := v.(json.RawMessage)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+	line := make([]byte, 0, len(data)+1)
+	line = append(append(line, data...), '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	// Flush even when the write fails, so a partial line never lingers in
+	// the buffer to be glued onto the next message
+	_, err := w.w.Write(line)
+	if flushErr := w.w.Flush(); err == nil {
+		err = flushErr
+	}
+	w.err = err
+	return err
+}
+
+// Flush writes out anything still buffered. It returns the error that
+// stopped writing, if one did.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.w.Flush()
+	return w.err
+}
+
+// Err returns the error that stopped writing, or nil.
+func (w *Writer) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
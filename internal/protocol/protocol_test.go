@@ -0,0 +1,158 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func FuzzReadLine(f *testing.F) {
+	f.Add([]byte("{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"ping\"}\n"), 64)
+	f.Add([]byte("a\r\nb\nc"), 4)
+	f.Add([]byte("\n\n\n"), 1)
+	f.Add(bytes.Repeat([]byte("x"), 5000), 16)
+
+	f.Fuzz(func(t *testing.T, data []byte, maxSize int) {
+		if maxSize < 1 || maxSize > 1<<20 {
+			t.Skip()
+		}
+		// A small buffer makes long lines arrive in several chunks
+		r := bufio.NewReaderSize(bytes.NewReader(data), 16)
+		lines := 0
+		for {
+			line, err := ReadLine(r, maxSize)
+			if err == io.EOF {
+				break
+			}
+			if err != nil && !errors.Is(err, ErrMessageTooLarge) {
+				t.Fatalf("ReadLine: %v", err)
+			}
+			if len(line) > maxSize {
+				t.Fatalf("got a %d byte line over the %d byte limit", len(line), maxSize)
+			}
+			if bytes.IndexByte(line, '\n') >= 0 {
+				t.Fatalf("line %q holds a newline", line)
+			}
+			// Each call consumes a line, so reading always ends
+			if lines++; lines > bytes.Count(data, []byte("\n"))+1 {
+				t.Fatalf("read %d lines from %d newlines", lines, bytes.Count(data, []byte("\n")))
+			}
+		}
+	})
+}
+
+func FuzzValidID(f *testing.F) {
+	for _, id := range []string{`1`, `"abc"`, `null`, `-1.5e3`, `9007199254740993`, `"é"`, `{}`, `[1]`, `true`, `1 2`, ``} {
+		f.Add([]byte(id))
+	}
+
+	f.Fuzz(func(t *testing.T, id []byte) {
+		if !ValidID(id) {
+			return
+		}
+		if !json.Valid(id) {
+			t.Fatalf("ValidID accepts %q, which isn't JSON", id)
+		}
+		switch trimmed := bytes.TrimLeft(id, " \t\r\n"); trimmed[0] {
+		case '{', '[', 't', 'f':
+			t.Fatalf("ValidID accepts %q, which isn't a string, number or null", id)
+		}
+	})
+}
+
+// chunkWriter passes writes on a few bytes at a time, as a pipe might, so
+// unsynchronized writers would interleave mid-line.
+type chunkWriter struct{ w io.Writer }
+
+func (c chunkWriter) Write(p []byte) (int, error) {
+	for written := 0; written < len(p); {
+		n, err := c.w.Write(p[written:min(written+7, len(p))])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return len(p), nil
+}
+
+func TestWriterConcurrentMessages(t *testing.T) {
+	const writers, perWriter = 50, 40
+	reader, pipe := io.Pipe()
+	w := NewWriter(chunkWriter{pipe})
+
+	// The reader checks each line as it arrives, while writes go on
+	seen := make(chan map[string]int)
+	go func() {
+		counts := map[string]int{}
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var message struct {
+				Writer  string `json:"writer"`
+				Padding string `json:"padding"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+				t.Errorf("line %.80q isn't a JSON message: %v", scanner.Bytes(), err)
+				continue
+			}
+			counts[message.Writer]++
+		}
+		seen <- counts
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perWriter; j++ {
+				// Some messages are larger than the buffer, so they are
+				// written in several pieces
+				message := map[string]interface{}{"writer": strconv.Itoa(i), "padding": strings.Repeat("x", (i*j*131)%9000)}
+				var err error
+				if j%2 == 0 {
+					data, _ := json.Marshal(message)
+					err = w.WriteMessage(json.RawMessage(data))
+				} else {
+					err = w.WriteMessage(message)
+				}
+				if err != nil {
+					t.Errorf("WriteMessage: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	pipe.Close()
+
+	counts := <-seen
+	if len(counts) != writers {
+		t.Errorf("got messages from %d writers, want %d", len(counts), writers)
+	}
+	for writer, n := range counts {
+		if n != perWriter {
+			t.Errorf("writer %s: got %d messages, want %d", writer, n, perWriter)
+		}
+	}
+}
+
+func TestWriterStopsAfterFailure(t *testing.T) {
+	reader, pipe := io.Pipe()
+	reader.Close()
+	w := NewWriter(pipe)
+	if err := w.WriteMessage(map[string]int{"id": 1}); !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("WriteMessage to a closed pipe = %v", err)
+	}
+	if err := w.WriteMessage(map[string]int{"id": 2}); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("a later WriteMessage = %v, want the first error", err)
+	}
+	if err := w.Flush(); !errors.Is(err, io.ErrClosedPipe) || !errors.Is(w.Err(), io.ErrClosedPipe) {
+		t.Errorf("Flush = %v, Err = %v", err, w.Err())
+	}
+}
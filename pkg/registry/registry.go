@@ -0,0 +1,240 @@
+// Package registry describes the API keys a server knows: where each one is
+// read from and how it is presented.
+package registry
+
+import "strings"
+
+// APIKeyConfig describes one key: the environment variable it is read from
+// and how it is listed.
+type APIKeyConfig struct {
+	EnvVar      string `json:"env_var"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	// Restricted keys need the user's confirmation before they are
+	// revealed, when the client supports asking for it.
+	Restricted bool `json:"restricted,omitempty"`
+	// Reveal set to false keeps the value server-side: it can be checked,
+	// fingerprinted and used by the server's own helpers, such as webhook
+	// signature checks, but no tool returns it. Unset means true.
+	Reveal *bool `json:"reveal,omitempty"`
+	// EnvVarAliases are read, in order, when EnvVar isn't set, for keys
+	// that tools know under more than one name.
+	EnvVarAliases []string `json:"env_var_aliases,omitempty"`
+	// Members make this a composite key, read from several variables that
+	// are only useful together; EnvVar is then empty.
+	Members []CompositeMember `json:"members,omitempty"`
+	// ValueKind says what the variable holds: the secret itself when
+	// empty, or ValueKindFilePath for the path of a credential file.
+	ValueKind string `json:"value_kind,omitempty"`
+}
+
+// ValueKindFilePath marks a key whose variable holds the path of a
+// credential file, such as GOOGLE_APPLICATION_CREDENTIALS, rather than the
+// secret itself.
+const ValueKindFilePath = "file_path"
+
+// CompositeMember is one variable of a composite key, such as the endpoint
+// of an Azure OpenAI deployment.
+type CompositeMember struct {
+	Role   string `json:"role"`
+	EnvVar string `json:"env_var"`
+}
+
+// IsComposite reports whether the key is made of several variables that
+// are only useful together, rather than a single one.
+func (c APIKeyConfig) IsComposite() bool {
+	return len(c.Members) > 0
+}
+
+// IsFilePath reports whether the key's variable holds the path of a
+// credential file.
+func (c APIKeyConfig) IsFilePath() bool {
+	return c.ValueKind == ValueKindFilePath
+}
+
+// Revealable reports whether tools may return the key's value, unless
+// policy says otherwise.
+func (c APIKeyConfig) Revealable() bool {
+	return c.Reveal == nil || *c.Reveal
+}
+
+// EnvVars returns the environment variables a key is read from.
+func (c APIKeyConfig) EnvVars() []string {
+	if !c.IsComposite() {
+		return []string{c.EnvVar}
+	}
+	names := make([]string, len(c.Members))
+	for i, member := range c.Members {
+		names[i] = member.EnvVar
+	}
+	return names
+}
+
+// EnvLabel names a key's environment variables for messages.
+func (c APIKeyConfig) EnvLabel() string {
+	return strings.Join(c.EnvVars(), ", ")
+}
+
+// Defaults returns the built-in keys by name. Each call returns a new map,
+// so callers may add to it or remove from it freely.
+func Defaults() map[string]APIKeyConfig {
+	return map[string]APIKeyConfig{
+		// LLM APIs
+		"openai": {
+			EnvVar:      "OPENAI_API_KEY",
+			Description: "OpenAI API key for GPT models",
+			Category:    "llm",
+		},
+		"anthropic": {
+			EnvVar:      "ANTHROPIC_API_KEY",
+			Description: "Anthropic API key for Claude models",
+			Category:    "llm",
+		},
+		"google_ai": {
+			EnvVar:      "GOOGLE_AI_API_KEY",
+			Description: "Google AI API key for Gemini models",
+			Category:    "llm",
+		},
+		"azure_openai": {
+			Description: "Azure OpenAI endpoint, key, deployment and API version",
+			Category:    "llm",
+			Members: []CompositeMember{
+				{Role: "endpoint", EnvVar: "AZURE_OPENAI_ENDPOINT"},
+				{Role: "api_key", EnvVar: "AZURE_OPENAI_API_KEY"},
+				{Role: "deployment", EnvVar: "AZURE_OPENAI_DEPLOYMENT"},
+				{Role: "api_version", EnvVar: "AZURE_OPENAI_API_VERSION"},
+			},
+		},
+		"cohere": {
+			EnvVar:      "COHERE_API_KEY",
+			Description: "Cohere API key",
+			Category:    "llm",
+		},
+		// SaaS APIs
+		"stripe": {
+			EnvVar:      "STRIPE_API_KEY",
+			Description: "Stripe API key for payments",
+			Category:    "saas",
+			Restricted:  true,
+		},
+		"stripe_webhook": {
+			EnvVar:      "STRIPE_WEBHOOK_SECRET",
+			Description: "Stripe webhook signing secret",
+			Category:    "saas",
+		},
+		"twilio_sid": {
+			EnvVar:      "TWILIO_ACCOUNT_SID",
+			Description: "Twilio Account SID",
+			Category:    "saas",
+		},
+		"twilio_token": {
+			EnvVar:      "TWILIO_AUTH_TOKEN",
+			Description: "Twilio Auth Token",
+			Category:    "saas",
+		},
+		"sendgrid": {
+			EnvVar:      "SENDGRID_API_KEY",
+			Description: "SendGrid API key for emails",
+			Category:    "saas",
+		},
+		"slack_bot_token": {
+			EnvVar:      "SLACK_BOT_TOKEN",
+			Description: "Slack bot token (xoxb-)",
+			Category:    "saas",
+		},
+		"slack_app_token": {
+			EnvVar:      "SLACK_APP_TOKEN",
+			Description: "Slack app-level token (xapp-)",
+			Category:    "saas",
+		},
+		"slack_signing_secret": {
+			EnvVar:      "SLACK_SIGNING_SECRET",
+			Description: "Slack request signing secret",
+			Category:    "saas",
+		},
+		"aws_access_key": {
+			EnvVar:      "AWS_ACCESS_KEY_ID",
+			Description: "AWS Access Key ID",
+			Category:    "saas",
+		},
+		"aws_secret_key": {
+			EnvVar:      "AWS_SECRET_ACCESS_KEY",
+			Description: "AWS Secret Access Key",
+			Category:    "saas",
+			Restricted:  true,
+		},
+		"aws_session_token": {
+			EnvVar:      "AWS_SESSION_TOKEN",
+			Description: "AWS session token for temporary credentials",
+			Category:    "saas",
+			Restricted:  true,
+		},
+		"gcp_credentials": {
+			EnvVar:      "GOOGLE_APPLICATION_CREDENTIALS",
+			Description: "Google Cloud service account key file",
+			Category:    "saas",
+			ValueKind:   ValueKindFilePath,
+		},
+		"aws_region": {
+			EnvVar:        "AWS_REGION",
+			Description:   "AWS region",
+			Category:      "saas",
+			EnvVarAliases: []string{"AWS_DEFAULT_REGION"},
+		},
+		// Canva
+		"canva_client_id": {
+			EnvVar:      "CANVA_CLIENT_ID",
+			Description: "Canva OAuth Client ID",
+			Category:    "canva",
+		},
+		"canva_client_secret": {
+			EnvVar:      "CANVA_CLIENT_SECRET",
+			Description: "Canva OAuth Client Secret",
+			Category:    "canva",
+		},
+		"canva_app_id": {
+			EnvVar:      "CANVA_APP_ID",
+			Description: "Canva App ID",
+			Category:    "canva",
+		},
+		// Version control
+		"github_token": {
+			EnvVar:        "GITHUB_TOKEN",
+			Description:   "GitHub personal access token",
+			Category:      "vcs",
+			EnvVarAliases: []string{"GH_TOKEN"},
+		},
+		"gitlab_token": {
+			EnvVar:      "GITLAB_TOKEN",
+			Description: "GitLab personal access token",
+			Category:    "vcs",
+		},
+		"github_webhook_secret": {
+			EnvVar:      "GITHUB_WEBHOOK_SECRET",
+			Description: "GitHub webhook secret",
+			Category:    "vcs",
+		},
+		// Custom/Internal
+		"database_url": {
+			EnvVar:      "DATABASE_URL",
+			Description: "Database connection string",
+			Category:    "internal",
+		},
+		"redis_url": {
+			EnvVar:      "REDIS_URL",
+			Description: "Redis connection URL",
+			Category:    "internal",
+		},
+		"jwt_secret": {
+			EnvVar:      "JWT_SECRET",
+			Description: "JWT signing secret",
+			Category:    "internal",
+			Restricted:  true,
+		},
+		"app_secret": {
+			EnvVar:      "APP_SECRET",
+			Description: "Application secret key",
+			Category:    "internal",
+		},
+	}
+}
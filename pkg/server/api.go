@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/registry"
+)
+
+// ErrKeyExists is returned by RegisterKey for a name that is already
+// registered.
+var ErrKeyExists = errors.New("a key with that name already exists")
+
+// RegisterTool adds a tool to those the server offers, so the server can be
+// embedded in a larger one. Tools must be registered before ServeStdio or
+// Handle is first called, and their names must not clash with any other
+// tool's.
+func (s *Server) RegisterTool(tool Tool, handler HandlerFunc) error {
+	return s.tools.Register(tool, handler)
+}
+
+// RegisterKey adds a key the server serves alongside the built-in ones,
+// under name. Each Server has its own keys, and RegisterKey may be called
+// while the server is serving; the tool schemas pick the key up.
+func (s *Server) RegisterKey(name string, config registry.APIKeyConfig) error {
+	if name == "" {
+		return errors.New("key needs a name")
+	}
+	if config.Category == "all" || !validCategory(config.Category) {
+		return fmt.Errorf("key %s: unknown category %q", name, config.Category)
+	}
+	if config.IsComposite() {
+		return s.keys.registerComposite(map[string]registry.APIKeyConfig{name: config})
+	}
+	if config.EnvVar == "" {
+		return fmt.Errorf("key %s: needs an env_var", name)
+	}
+	if config.ValueKind != "" && !config.IsFilePath() {
+		return fmt.Errorf("key %s: unknown value_kind %q", name, config.ValueKind)
+	}
+	if err := s.keys.add(name, config); err != nil {
+		return err
+	}
+	// Resolve it now so its value is redacted like every other key's
+	s.keys.lookup(name)
+	return nil
+}
+
+// ServeStdio serves requests from the server's input, stdin for a server
+// from NewStdio, until it is closed or ctx is done, then shuts down, letting
+// running requests finish. It returns nil on a clean EOF, ctx's error when
+// ctx ended it, and otherwise the read, write or shutdown error that
+// stopped it.
+func (s *Server) ServeStdio(ctx context.Context) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- s.serve()
+	}()
+
+	var err error
+	select {
+	case err = <-served:
+	case <-ctx.Done():
+		// The read loop stays blocked reading the input; nothing it reads from now
+		// on is handled, as the server is shutting down
+		err = ctx.Err()
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if shutdownErr := s.Shutdown(shutdownCtx); err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+// Handle processes one message, a single JSON-RPC message or a batch as
+// read from one line of the stdio transport, and returns the encoded reply,
+// or nil when there is none. Requests are handled before Handle returns;
+// notifications the server sends meanwhile, such as log messages, still go
+// to the output. So do its requests to the client, such as a confirmation
+// prompt, which wait for the client's answer to be passed to another
+// Handle call.
+func (s *Server) Handle(message []byte) []byte {
+	s.recorder.record(directionIn, message)
+	reply := s.handleLine(message, false)
+	if reply == nil {
+		return nil
+	}
+	data, err := s.marshalMessage(reply)
+	if err != nil {
+		return nil
+	}
+	s.recorder.record(directionOut, data)
+	return data
+}
@@ -0,0 +1,442 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/registry"
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+	"github.com/yourusername/mcp-api-keys-server/version"
+)
+
+var internalToolsKey = registry.APIKeyConfig{
+	EnvVar:      "INTERNAL_TOOLS_TOKEN",
+	Description: "Token for the internal tools API",
+	Category:    "internal",
+}
+
+// keyNames returns the names list_api_keys reports.
+func keyNames(t *testing.T, c *testmcp.Client) []string {
+	t.Helper()
+	result, err := c.CallTool("list_api_keys", map[string]interface{}{})
+	if err != nil || result.IsError {
+		t.Fatalf("list_api_keys = %+v, %v", result, err)
+	}
+	var listed struct {
+		Keys []struct {
+			Name string `json:"name"`
+		} `json:"keys"`
+	}
+	data, _ := json.Marshal(result.StructuredContent)
+	if err := json.Unmarshal(data, &listed); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, key := range listed.Keys {
+		names = append(names, key.Name)
+	}
+	return names
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRegisterKeyIsPerServer(t *testing.T) {
+	testmcp.ClearKeys(t)
+	first := testmcp.New(server.WithLogger(discardLogger))
+	second := testmcp.New(server.WithLogger(discardLogger))
+	first.RegisterKey(t, "internal_tools", internalToolsKey, "it-0123456789abcdefghij")
+	for _, c := range []*testmcp.Client{first, second} {
+		if _, err := c.Initialize(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !contains(keyNames(t, first), "internal_tools") {
+		t.Error("the server the key was registered on doesn't list it")
+	}
+	if contains(keyNames(t, second), "internal_tools") {
+		t.Error("another server lists the key")
+	}
+	result, err := second.CallTool("check_api_key_exists", map[string]interface{}{"key_name": "internal_tools"})
+	if err != nil || !result.IsError {
+		t.Errorf("another server knows the key: %+v, %v", result, err)
+	}
+}
+
+func TestRegisterKeyRejects(t *testing.T) {
+	s := server.New(strings.NewReader(""), &bytes.Buffer{}, server.WithLogger(discardLogger))
+	if err := s.RegisterKey("openai", internalToolsKey); !errors.Is(err, server.ErrKeyExists) {
+		t.Errorf("registering a built-in name = %v, want ErrKeyExists", err)
+	}
+	for name, config := range map[string]registry.APIKeyConfig{
+		"":                 internalToolsKey,
+		"no_env_var":       {Description: "x", Category: "internal"},
+		"unknown_category": {EnvVar: "UNKNOWN_CATEGORY_KEY", Category: "nonsense"},
+		"all_category":     {EnvVar: "ALL_CATEGORY_KEY", Category: "all"},
+		"bad_value_kind":   {EnvVar: "BAD_VALUE_KIND_KEY", Category: "internal", ValueKind: "blob"},
+	} {
+		if err := s.RegisterKey(name, config); err == nil {
+			t.Errorf("RegisterKey(%q) succeeded", name)
+		}
+	}
+}
+
+// TestRegisterKeyWhileServing registers keys while tools are listed and
+// called; run it with -race.
+func TestRegisterKeyWhileServing(t *testing.T) {
+	testmcp.ClearKeys(t)
+	c := testmcp.New(server.WithLogger(discardLogger))
+	if _, err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			config := internalToolsKey
+			config.EnvVar = "INTERNAL_TOOLS_TOKEN_" + string(rune('A'+i))
+			if err := c.Server.RegisterKey("internal_tools_"+string(rune('a'+i)), config); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if _, err := c.ListTools(); err != nil {
+				t.Error(err)
+			}
+			if _, err := c.CallTool("list_api_keys", map[string]interface{}{}); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	wg.Wait()
+
+	names := keyNames(t, c)
+	for i := 0; i < 20; i++ {
+		if name := "internal_tools_" + string(rune('a'+i)); !contains(names, name) {
+			t.Errorf("%s isn't listed", name)
+		}
+	}
+}
+
+func TestRegisterTool(t *testing.T) {
+	c := testmcp.New(server.WithLogger(discardLogger))
+	echo := server.Tool{
+		Name:        "echo",
+		Description: "Echoes its text",
+		InputSchema: server.InputSchema{Type: "object", Properties: map[string]server.Property{"text": {Type: "string"}}},
+	}
+	err := c.Server.RegisterTool(echo, func(ctx context.Context, args map[string]interface{}) server.CallToolResult {
+		text, _ := args["text"].(string)
+		return server.CallToolResult{Content: []server.ContentBlock{{Type: "text", Text: text}}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Server.RegisterTool(server.Tool{Name: "get_api_key"}, func(context.Context, map[string]interface{}) server.CallToolResult {
+		return server.CallToolResult{}
+	}); err == nil {
+		t.Error("a tool shadowing a built-in one was registered")
+	}
+	if _, err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.CallTool("echo", map[string]interface{}{"text": "hello"})
+	if err != nil || testmcp.Text(result) != "hello" {
+		t.Errorf("echo = %+v, %v", result, err)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	s := server.New(strings.NewReader(""), &bytes.Buffer{}, server.WithLogger(discardLogger))
+	reply := s.Handle([]byte(initializeLine))
+	var response struct {
+		ID     string          `json:"id"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(reply, &response); err != nil || response.ID != "init" || response.Result == nil {
+		t.Errorf("Handle(initialize) = %s, %v", reply, err)
+	}
+	if reply := s.Handle([]byte(initializedLine)); reply != nil {
+		t.Errorf("Handle(notification) = %s, want nil", reply)
+	}
+}
+
+// execute runs the command with args after the program name, returning its
+// exit code and output.
+func execute(t *testing.T, ctx context.Context, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := server.Execute(ctx, append([]string{"mcp-api-keys-server"}, args...), strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestExecute(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-executetest0123456789"})
+	ctx := context.Background()
+
+	if code, stdout, _ := execute(t, ctx, "", "--version"); code != 0 || !strings.HasPrefix(stdout, "api-keys-server ") {
+		t.Errorf("--version = %d, %q", code, stdout)
+	}
+	if code, _, stderr := execute(t, ctx, "", "--no-such-flag"); code != 2 || !strings.Contains(stderr, "no-such-flag") {
+		t.Errorf("an unknown flag = %d, %q", code, stderr)
+	}
+	if code, _, _ := execute(t, ctx, "", "--help"); code != 0 {
+		t.Errorf("--help = %d", code)
+	}
+	if code, stdout, _ := execute(t, ctx, "", "check", "openai"); code != 0 || strings.Contains(stdout, "executetest") {
+		t.Errorf("check openai = %d, %q", code, stdout)
+	}
+
+	// Without a command it serves stdin until EOF
+	code, stdout, _ := execute(t, ctx, initializeLine+"\n", "--log-level", "error", "--watch-env=false")
+	if code != 0 || !strings.Contains(stdout, `"id":"init"`) {
+		t.Errorf("serving = %d, %q", code, stdout)
+	}
+	if code, _, stderr := execute(t, ctx, "", "--config", "testdata/no-such-config.json"); code != 1 || !strings.Contains(stderr, "config") {
+		t.Errorf("a missing config file = %d, %q", code, stderr)
+	}
+}
+
+func TestExecuteStopsWhenContextIsDone(t *testing.T) {
+	testmcp.ClearKeys(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// The input never ends, as a client's pipe wouldn't
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	var stdout, stderr bytes.Buffer
+	if code := server.Execute(ctx, []string{"mcp-api-keys-server", "--watch-env=false"}, reader, &stdout, &stderr); code != 0 {
+		t.Errorf("Execute = %d, %s", code, stderr.String())
+	}
+}
+
+func TestStdoutCarriesOnlyJSONRPC(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-stdouttest0123456789"})
+	stdin := strings.Join([]string{
+		initializeLine,
+		initializedLine,
+		`{"jsonrpc":"2.0","id":1,"method":"logging/setLevel","params":{"level":"debug"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list","params":{}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"get_api_key","arguments":{"key_name":"openai"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"get_api_key","arguments":{"key_name":"anthropic"}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"no/such/method"}`,
+		`not json`,
+		`{"jsonrpc":"2.0","id":6,"method":"resources/list","params":{}}`,
+	}, "\n") + "\n"
+
+	code, stdout, stderr := execute(t, context.Background(), stdin, "--log-level", "debug", "--watch-env=false")
+	if code != 0 {
+		t.Fatalf("Execute = %d, %s", code, stderr)
+	}
+	lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	for _, line := range lines {
+		var message struct {
+			JSONRPC string `json:"jsonrpc"`
+		}
+		if err := json.Unmarshal([]byte(line), &message); err != nil || message.JSONRPC != "2.0" {
+			t.Errorf("stdout holds a line that isn't JSON-RPC: %q", line)
+		}
+	}
+	if len(lines) < 8 {
+		t.Errorf("got %d lines on stdout, want a response to each of 7 requests and the parse error", len(lines))
+	}
+	// Diagnostics go to stderr instead
+	if !strings.Contains(stderr, "api-keys-server") {
+		t.Errorf("no startup banner on stderr: %q", stderr)
+	}
+}
+
+func TestResponseFlushedAtEOF(t *testing.T) {
+	stdin := strings.Join([]string{
+		initializeLine,
+		initializedLine,
+		`{"jsonrpc":"2.0","id":"slow","method":"tools/call","params":{"name":"slow","arguments":{}}}`,
+	}, "\n") + "\n"
+	var stdout bytes.Buffer
+	s := server.New(strings.NewReader(stdin), &stdout, server.WithLogger(discardLogger))
+	slow := server.Tool{Name: "slow", Description: "Answers after the input has ended", InputSchema: server.InputSchema{Type: "object"}}
+	err := s.RegisterTool(slow, func(context.Context, map[string]interface{}) server.CallToolResult {
+		time.Sleep(100 * time.Millisecond)
+		return server.CallToolResult{Content: []server.ContentBlock{{Type: "text", Text: "done"}}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The input ends while the call is still running
+	if err := s.ServeStdio(context.Background()); err != nil {
+		t.Fatalf("ServeStdio = %v", err)
+	}
+	if !strings.HasSuffix(stdout.String(), "\n") || !strings.Contains(stdout.String(), `"id":"slow","result":{"content":[{"type":"text","text":"done"}]`) {
+		t.Errorf("the response wasn't flushed before ServeStdio returned: %q", stdout.String())
+	}
+}
+
+func TestVersionIsConsistent(t *testing.T) {
+	saved := [3]string{version.Version, version.Commit, version.Date}
+	t.Cleanup(func() { version.Version, version.Commit, version.Date = saved[0], saved[1], saved[2] })
+	version.Version, version.Commit, version.Date = "9.8.7", "abc1234", "2026-01-02T03:04:05Z"
+
+	code, stdout, _ := execute(t, context.Background(), "", "--version")
+	if code != 0 || !strings.Contains(stdout, version.String()) {
+		t.Errorf("--version = %d, %q, want %q", code, stdout, version.String())
+	}
+
+	c := testmcp.New(server.WithLogger(discardLogger))
+	initialized, err := c.Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if initialized.ServerInfo.Version != "9.8.7" {
+		t.Errorf("initialize serverInfo.version = %q, want 9.8.7", initialized.ServerInfo.Version)
+	}
+
+	result, err := c.CallTool("server_info", map[string]interface{}{})
+	if err != nil || result.IsError {
+		t.Fatalf("server_info = %+v, %v", result, err)
+	}
+	var info struct {
+		Version   string `json:"version"`
+		Commit    string `json:"commit"`
+		BuildDate string `json:"build_date"`
+	}
+	data, _ := json.Marshal(result.StructuredContent)
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "9.8.7" || info.Commit != "abc1234" || info.BuildDate != "2026-01-02T03:04:05Z" {
+		t.Errorf("server_info = %+v, want the build metadata --version prints", info)
+	}
+}
+
+func TestShutdownRequestIsAnsweredLast(t *testing.T) {
+	stdin := strings.Join([]string{
+		initializeLine,
+		initializedLine,
+		`{"jsonrpc":"2.0","id":"slow","method":"tools/call","params":{"name":"slow","arguments":{}}}`,
+		`{"jsonrpc":"2.0","id":"bye","method":"shutdown"}`,
+		`{"jsonrpc":"2.0","id":"late","method":"ping"}`,
+	}, "\n") + "\n"
+	var stdout bytes.Buffer
+	s := server.New(strings.NewReader(stdin), &stdout, server.WithLogger(discardLogger))
+	slow := server.Tool{Name: "slow", Description: "Answers after the shutdown request has arrived", InputSchema: server.InputSchema{Type: "object"}}
+	err := s.RegisterTool(slow, func(context.Context, map[string]interface{}) server.CallToolResult {
+		time.Sleep(100 * time.Millisecond)
+		return server.CallToolResult{Content: []server.ContentBlock{{Type: "text", Text: "done"}}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Run(); err != nil {
+		t.Fatalf("Run = %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	if last := lines[len(lines)-1]; last != `{"jsonrpc":"2.0","id":"bye","result":{}}` {
+		t.Errorf("the last line is %s, want the shutdown response", last)
+	}
+	if !strings.Contains(stdout.String(), `"id":"slow","result":{"content":[{"type":"text","text":"done"}]`) {
+		t.Errorf("the running call didn't respond before shutdown: %s", stdout.String())
+	}
+	if strings.Contains(stdout.String(), `"late"`) {
+		t.Errorf("a request after shutdown was answered: %s", stdout.String())
+	}
+}
+
+func TestShutdownWhileReading(t *testing.T) {
+	inReader, in := io.Pipe()
+	var stdout bytes.Buffer
+	var closes int32
+	s := server.New(inReader, &stdout, server.WithLogger(discardLogger), server.WithCountingAuditSink(&closes))
+	slow := server.Tool{Name: "slow", Description: "Answers while more requests arrive", InputSchema: server.InputSchema{Type: "object"}}
+	err := s.RegisterTool(slow, func(context.Context, map[string]interface{}) server.CallToolResult {
+		time.Sleep(5 * time.Millisecond)
+		return server.CallToolResult{Content: []server.ContentBlock{{Type: "text", Text: "done"}}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests, single and batched, keep arriving while the server shuts down
+	go func() {
+		io.WriteString(in, initializeLine+"\n"+initializedLine+"\n")
+		for i := 0; ; i++ {
+			call := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"slow","arguments":{}}}`, i)
+			if i%2 == 1 {
+				call = "[" + call + "]"
+			}
+			if _, err := io.WriteString(in, call+"\n"); err != nil {
+				return
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Shutdown may be called again, even while it is still running
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			time.Sleep(25 * time.Millisecond)
+			errs <- s.Shutdown(context.Background())
+		}()
+	}
+	if err := s.ServeStdio(ctx); !errors.Is(err, context.DeadlineExceeded) && err != nil {
+		t.Errorf("ServeStdio = %v", err)
+	}
+	inReader.Close()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Shutdown = %v", err)
+		}
+	}
+	if closes != 1 {
+		t.Errorf("the audit sink was closed %d times, want once", closes)
+	}
+}
+
+func TestShutdownClosesAuditLog(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-shutdowntest0123456789"})
+	for name, end := range map[string]string{
+		"shutdown request": `{"jsonrpc":"2.0","id":"bye","method":"shutdown"}` + "\n",
+		"end of input":     "",
+	} {
+		auditPath := filepath.Join(t.TempDir(), "audit.log")
+		stdin := strings.Join([]string{initializeLine, initializedLine, getAPIKeyLine(1, "")}, "\n") + "\n" + end
+		code, stdout, stderr := execute(t, context.Background(), stdin, "--watch-env=false", "--log-level", "error", "--audit-log", auditPath)
+		if code != 0 {
+			t.Fatalf("%s: Execute = %d, %s", name, code, stderr)
+		}
+		if !strings.Contains(stdout, `"id":1,"result"`) {
+			t.Errorf("%s: the tool call wasn't answered: %s", name, stdout)
+		}
+		if end != "" && !strings.HasSuffix(stdout, `{"jsonrpc":"2.0","id":"bye","result":{}}`+"\n") {
+			t.Errorf("%s: the shutdown response isn't the last line: %s", name, stdout)
+		}
+		if entries := auditEntries(t, auditPath); len(entries) != 1 || entries[0]["outcome"] != "revealed" {
+			t.Errorf("%s: audit entries = %v, want the reveal", name, entries)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// auditHMACKeyEnv names the variable holding the key that signs the audit
+// log with --sign-audit-log and that verify-audit-log checks it with.
+const auditHMACKeyEnv = "MCP_AUDIT_HMAC_KEY"
+
+// auditHMACKey returns the audit log signing key from the environment.
+func auditHMACKey() ([]byte, error) {
+	key := os.Getenv(auditHMACKeyEnv)
+	if key == "" {
+		return nil, fmt.Errorf("%s is not set", auditHMACKeyEnv)
+	}
+	return []byte(key), nil
+}
+
+// lineHash is the hash of an audit log line, without its newline, that the
+// next entry's prev holds.
+func lineHash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// signEntry encodes entry chained to prev, the hash of the line before it,
+// with an HMAC over the encoding without the HMAC. Editing, removing or
+// reordering entries breaks either an HMAC or a later entry's prev, and
+// forging a replacement needs the key.
+func signEntry(entry auditEntry, prev string, key []byte) ([]byte, error) {
+	entry.Prev, entry.HMAC = prev, ""
+	unsigned, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(unsigned)
+	entry.HMAC = hex.EncodeToString(mac.Sum(nil))
+	return json.Marshal(entry)
+}
+
+// sign makes the log sign every entry from now on, chained to the last
+// line already written, so the chain carries on across restarts.
+func (l *auditLog) sign(key []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, path := range []string{l.path, l.path + ".1"} {
+		last, err := lastLine(path)
+		if err != nil {
+			return err
+		}
+		if last != nil {
+			l.head = lineHash(last)
+			break
+		}
+	}
+	l.hmacKey = key
+	return nil
+}
+
+// lastLine returns the last non-empty line of a file, or nil when the file
+// is empty or doesn't exist.
+func lastLine(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if last := bytes.TrimSpace(lines[len(lines)-1]); len(last) > 0 {
+		return last, nil
+	}
+	return nil, nil
+}
+
+// brokenLink is where verifyAuditLog found the chain broken.
+type brokenLink struct {
+	Path   string
+	Line   int
+	Reason string
+}
+
+func (b *brokenLink) Error() string {
+	return fmt.Sprintf("%s:%d: %s", b.Path, b.Line, b.Reason)
+}
+
+// verifyAuditLog walks a signed audit log, the rotated file first, and
+// returns how many entries it checked, or the first broken link. The first
+// entry's prev can't be checked when the file before it was rotated away.
+func verifyAuditLog(path string, key []byte) (int, error) {
+	verified := 0
+	head := ""
+	first := true
+	for _, name := range []string{path + ".1", path} {
+		file, err := os.Open(name)
+		if os.IsNotExist(err) && name != path {
+			continue
+		}
+		if err != nil {
+			return verified, err
+		}
+		err = verifyAuditFile(file, name, key, &head, &first, &verified)
+		file.Close()
+		if err != nil {
+			return verified, err
+		}
+	}
+	return verified, nil
+}
+
+func verifyAuditFile(r io.Reader, name string, key []byte, head *string, first *bool, verified *int) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), defaultMaxMessageSize)
+	for number := 1; scanner.Scan(); number++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry auditEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return &brokenLink{name, number, "not a valid entry"}
+		}
+		if entry.HMAC == "" {
+			return &brokenLink{name, number, "entry is not signed"}
+		}
+		if !*first && entry.Prev != *head {
+			return &brokenLink{name, number, "prev doesn't match the entry before it; an entry was removed, added or reordered"}
+		}
+		signed, err := signEntry(entry, entry.Prev, key)
+		if err != nil {
+			return err
+		}
+		var expected auditEntry
+		json.Unmarshal(signed, &expected)
+		if !hmac.Equal([]byte(expected.HMAC), []byte(entry.HMAC)) {
+			return &brokenLink{name, number, "HMAC doesn't match; the entry was changed or signed with another key"}
+		}
+		*head = lineHash(line)
+		*first = false
+		*verified++
+	}
+	return scanner.Err()
+}
+
+func runVerifyAuditLog(keys *keyRegistry, args []string, stdout, stderr io.Writer) int {
+	flags := newCommandFlags("verify-audit-log", "verify-audit-log <path>", stderr)
+	if err := flags.Parse(args); err != nil {
+		return exitUsageErr
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsageErr
+	}
+	key, err := auditHMACKey()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsageErr
+	}
+
+	verified, err := verifyAuditLog(flags.Arg(0), key)
+	var broken *brokenLink
+	if errors.As(err, &broken) {
+		fmt.Fprintf(stdout, "Broken link at %s (%d entries before it verified)\n", broken, verified)
+		return exitFailure
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	fmt.Fprintf(stdout, "%d entries verified; the chain is intact\n", verified)
+	return exitOK
+}
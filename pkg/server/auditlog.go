@@ -0,0 +1,316 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultAuditLogMaxSize is the size at which the audit log is rotated
+// unless overridden with --audit-log-max-size.
+const defaultAuditLogMaxSize = 10 << 20
+
+// defaultAuditReadLimit is how many entries read_audit_log returns when the
+// caller doesn't say.
+const defaultAuditReadLimit = 20
+
+// Outcomes of a secret access recorded in the audit log.
+const (
+	auditRevealed = "revealed"
+	auditDenied   = "denied"
+	auditMissing  = "missing"
+	auditLimited  = "rate_limited"
+)
+
+// auditEntry is one line of the audit log. It never holds a key value.
+type auditEntry struct {
+	Time          time.Time       `json:"time"`
+	Tool          string          `json:"tool"`
+	Key           string          `json:"key"`
+	Outcome       string          `json:"outcome"`
+	Reason        string          `json:"reason,omitempty"`
+	Masked        string          `json:"masked,omitempty"`
+	Fingerprint   string          `json:"fingerprint,omitempty"`
+	Client        string          `json:"client,omitempty"`
+	ClientVersion string          `json:"client_version,omitempty"`
+	RequestID     json.RawMessage `json:"request_id,omitempty"`
+	// Tenant is the tenant the session is bound to, with --tenants.
+	Tenant string `json:"tenant,omitempty"`
+	// Justification is why a break-glass reveal was needed.
+	Justification string `json:"justification,omitempty"`
+	// Prev and HMAC chain the entries of a signed log; see signEntry.
+	Prev string `json:"prev,omitempty"`
+	HMAC string `json:"hmac,omitempty"`
+}
+
+// auditLog appends entries as JSON lines to a file, moving it aside to
+// path + ".1" once it grows past maxSize.
+type auditLog struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+
+	// hmacKey, when set, makes the log tamper-evident: every entry is
+	// signed and chained to head, the hash of the line before it.
+	hmacKey []byte
+	head    string
+}
+
+func openAuditLog(path string, maxSize int64) (*auditLog, error) {
+	l := &auditLog{path: path, maxSize: maxSize}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *auditLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// Write appends an entry. Each entry is written with a single unbuffered
+// write, so it is on disk before Write returns.
+func (l *auditLog) Write(entry auditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return fmt.Errorf("audit log %s is closed", l.path)
+	}
+
+	var data []byte
+	var err error
+	if l.hmacKey != nil {
+		data, err = signEntry(entry, l.head, l.hmacKey)
+	} else {
+		data, err = json.Marshal(entry)
+	}
+	if err != nil {
+		return err
+	}
+	line := data
+	data = append(data, '\n')
+
+	if l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err == nil && l.hmacKey != nil {
+		l.head = lineHash(line)
+	}
+	return err
+}
+
+func (l *auditLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// Tail returns the last n entries, oldest first, reaching into the rotated
+// file when the current one has fewer.
+func (l *auditLog) Tail(n int) ([]auditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var lines []string
+	for _, path := range []string{l.path + ".1", l.path} {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	entries := make([]auditEntry, 0, len(lines))
+	for _, line := range lines {
+		var entry auditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (l *auditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// requestIDKey carries the JSON-RPC id of a tool call in its context, so
+// audit entries can name the request.
+type requestIDKey struct{}
+
+// callAudit collects what a tool call reports for the audit trail.
+// auditToolCall writes it once the call returns, so handlers only say what
+// happened and never write to the sinks themselves.
+type callAudit struct {
+	mu    sync.Mutex
+	notes []auditNote
+}
+
+// auditNote is one report: an audit entry, when entry.Key is set, and a
+// message for the client's audit log, when message is set.
+type auditNote struct {
+	entry auditEntry
+	// value is only used for the masked preview and fingerprint.
+	value          string
+	level, message string
+}
+
+// callAuditKey carries a tool call's callAudit in its context.
+type callAuditKey struct{}
+
+// note adds a report to the call's audit, or, outside a tool call, such as
+// when a lease expires, writes it at once.
+func (s *Server) note(ctx context.Context, note auditNote) {
+	if audit, ok := ctx.Value(callAuditKey{}).(*callAudit); ok {
+		audit.mu.Lock()
+		audit.notes = append(audit.notes, note)
+		audit.mu.Unlock()
+		return
+	}
+	s.writeNote(ctx, note)
+}
+
+// noteAccess reports an access to a key by the current tool call. value is
+// only used for the masked preview and fingerprint.
+func (s *Server) noteAccess(ctx context.Context, keyName, outcome, reason, value string) {
+	s.note(ctx, auditNote{entry: auditEntry{Key: keyName, Outcome: outcome, Reason: reason}, value: value})
+}
+
+// noteAudit reports an event of the current tool call to the client's audit
+// log.
+func (s *Server) noteAudit(ctx context.Context, level, message string) {
+	s.note(ctx, auditNote{level: level, message: message})
+}
+
+// writeNote sends a report to the client's audit log and the audit sinks.
+func (s *Server) writeNote(ctx context.Context, note auditNote) {
+	if note.message != "" {
+		s.audit(note.level, note.message)
+	}
+	if note.entry.Key != "" {
+		s.writeAudit(ctx, note.entry, note.value)
+	}
+}
+
+// auditToolCall writes what the call reported for the audit trail once it
+// returns, with entries attributed to the tool unless they name another.
+func auditToolCall(s *Server, tool Tool, next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, args map[string]interface{}) CallToolResult {
+		audit := &callAudit{}
+		result := next(context.WithValue(ctx, callAuditKey{}, audit), args)
+		audit.mu.Lock()
+		notes := audit.notes
+		audit.mu.Unlock()
+		for _, note := range notes {
+			if note.entry.Tool == "" {
+				note.entry.Tool = tool.Name
+			}
+			s.writeNote(ctx, note)
+		}
+		return result
+	}
+}
+
+// writeAudit fills in the time, client and request of entry and writes it
+// to every audit sink.
+func (s *Server) writeAudit(ctx context.Context, entry auditEntry, value string) {
+	if entry.Outcome == auditRevealed || entry.Outcome == auditBreakGlass {
+		if _, known := s.keys.config(entry.Key); known {
+			s.metrics.countReveal(entry.Key)
+		}
+	}
+	spanFromContext(ctx).setAttribute("mcp.access.outcome", entry.Outcome)
+	if len(s.auditSinks) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	clientInfo := s.clientInfo
+	s.mu.Unlock()
+
+	entry.Time = time.Now().UTC()
+	entry.Client, entry.ClientVersion = clientInfo.Name, clientInfo.Version
+	entry.Tenant = s.keys.tenantName()
+	if value != "" {
+		entry.Masked = s.keys.maskSecret(value)
+		entry.Fingerprint = shortFingerprint(value)
+	}
+	if id, ok := ctx.Value(requestIDKey{}).(json.RawMessage); ok {
+		entry.RequestID = id
+	}
+	for _, sink := range s.auditSinks {
+		if err := sink.Write(entry); err != nil {
+			s.logger.Error("failed to write audit entry", "sink", sink.Name(), "error", err)
+		}
+	}
+}
+
+func (s *Server) handleReadAuditLog(ctx context.Context, args map[string]interface{}) CallToolResult {
+	limit := defaultAuditReadLimit
+	if n, ok := args["limit"].(float64); ok && n > 0 {
+		limit = int(n)
+	}
+
+	entries, err := s.auditLog.Tail(limit)
+	if err != nil {
+		return failure(codeBackendUnavailable, fmt.Sprintf("Error: failed to read audit log: %v", err), nil)
+	}
+	if len(entries) == 0 {
+		return CallToolResult{
+			Content: []ContentBlock{{Type: "text", Text: "The audit log is empty."}},
+		}
+	}
+
+	var text strings.Builder
+	for _, entry := range entries {
+		data, _ := json.Marshal(entry)
+		text.Write(data)
+		text.WriteString("\n")
+	}
+	return CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text.String()}},
+	}
+}
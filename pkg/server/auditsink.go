@@ -0,0 +1,197 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Audit outputs for --audit-output.
+const (
+	auditOutputFile         = "file"
+	auditOutputSyslog       = "syslog"
+	auditOutputWindowsEvent = "windows-eventlog"
+)
+
+// auditSink is somewhere audit entries go: the --audit-log file, syslog or
+// the reveal webhook. Each handles its own failures, and none may hold up
+// the tool call recording the access for longer than a local write.
+type auditSink interface {
+	// Name says what the sink writes to, for diagnostics.
+	Name() string
+	Write(entry auditEntry) error
+	Close() error
+}
+
+// Name says which file the audit log writes to.
+func (l *auditLog) Name() string {
+	return "file " + l.path
+}
+
+// parseAuditOutputs splits --audit-output into the outputs it names.
+func parseAuditOutputs(value string) ([]string, error) {
+	var outputs []string
+	for _, output := range splitPatterns(value) {
+		switch output {
+		case auditOutputFile, auditOutputSyslog, auditOutputWindowsEvent:
+			outputs = append(outputs, output)
+		default:
+			return nil, fmt.Errorf("unknown audit output %q: use %s, %s or %s", output, auditOutputFile, auditOutputSyslog, auditOutputWindowsEvent)
+		}
+	}
+	return outputs, nil
+}
+
+// auditSeverity is how serious an audit outcome is, for outputs that rank
+// messages, such as syslog.
+type auditSeverity int
+
+const (
+	severityInfo auditSeverity = iota
+	severityNotice
+	severityWarning
+	severityAlert
+)
+
+// severityOf returns the severity an outcome is reported at: reveals are
+// notable, refusals a warning, break-glass reveals an alert, and everything
+// else information.
+func severityOf(outcome string) auditSeverity {
+	switch outcome {
+	case auditBreakGlass:
+		return severityAlert
+	case auditRevealed:
+		return severityNotice
+	case auditDenied, auditLimited:
+		return severityWarning
+	}
+	return severityInfo
+}
+
+// auditQueueSize is how many entries an asynchronous sink holds before it
+// starts dropping them.
+const auditQueueSize = 256
+
+// queuedSink writes entries to a slower sink in the background, so the
+// tool call never waits on it. When the queue is full, entries are dropped
+// and counted rather than blocking; failures are logged.
+type queuedSink struct {
+	sink    auditSink
+	logger  *slog.Logger
+	entries chan auditEntry
+	done    chan struct{}
+
+	// mu guards dropped and closed, and sending on entries, which is
+	// closed once closed is set.
+	mu        sync.Mutex
+	dropped   int
+	closed    bool
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newQueuedSink(sink auditSink, logger *slog.Logger) *queuedSink {
+	q := &queuedSink{
+		sink:    sink,
+		logger:  logger,
+		entries: make(chan auditEntry, auditQueueSize),
+		done:    make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+func (q *queuedSink) run() {
+	defer close(q.done)
+	for entry := range q.entries {
+		if err := q.sink.Write(entry); err != nil {
+			q.logger.Error("failed to write audit entry", "sink", q.sink.Name(), "error", err)
+		}
+	}
+}
+
+func (q *queuedSink) Name() string {
+	return q.sink.Name()
+}
+
+// Write queues entry, dropping it if the queue is full.
+func (q *queuedSink) Write(entry auditEntry) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return errors.New("closed")
+	}
+	select {
+	case q.entries <- entry:
+		return nil
+	default:
+		q.dropped++
+		return fmt.Errorf("queue full, %d entries dropped so far", q.dropped)
+	}
+}
+
+// Close writes what is queued, giving up after shutdownTimeout, then closes
+// the sink. Later calls return the first one's result.
+func (q *queuedSink) Close() error {
+	q.closeOnce.Do(func() {
+		q.mu.Lock()
+		q.closed = true
+		close(q.entries)
+		q.mu.Unlock()
+		select {
+		case <-q.done:
+			q.closeErr = q.sink.Close()
+		case <-time.After(shutdownTimeout):
+			q.closeErr = fmt.Errorf("gave up writing %d queued audit entries to %s", len(q.entries), q.sink.Name())
+		}
+	})
+	return q.closeErr
+}
+
+// webhookSink sends reveals of the keys the reveal webhook covers to it,
+// and every break-glass reveal.
+type webhookSink struct {
+	webhook *revealWebhook
+	keys    *keyRegistry
+}
+
+func (w webhookSink) Name() string {
+	return "reveal webhook " + w.webhook.url
+}
+
+// Write sends entry if it is a real reveal, not a dry-run one, of a
+// covered key, or a break-glass one of any key. Delivery happens in the
+// background.
+func (w webhookSink) Write(entry auditEntry) error {
+	config, exists := w.keys.config(entry.Key)
+	if !exists || entry.Reason == "dry run" {
+		return nil
+	}
+	event := "key_revealed"
+	switch {
+	case entry.Outcome == auditBreakGlass:
+		event = "key_break_glass"
+	case entry.Outcome != auditRevealed || !w.webhook.covers(config):
+		return nil
+	}
+	w.webhook.send(revealEvent{
+		Event:         event,
+		Time:          entry.Time,
+		Key:           entry.Key,
+		Category:      config.Category,
+		Restricted:    config.Restricted,
+		Masked:        entry.Masked,
+		Client:        entry.Client,
+		ClientVersion: entry.ClientVersion,
+		RequestID:     entry.RequestID,
+		Justification: entry.Justification,
+	})
+	return nil
+}
+
+// Close is a no-op; Shutdown waits for deliveries in progress.
+func (w webhookSink) Close() error {
+	return nil
+}
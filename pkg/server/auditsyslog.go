@@ -0,0 +1,46 @@
+//go:build !windows && !plan9
+
+package server
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+// syslogSink writes audit entries as JSON to the local syslog daemon, under
+// the auth facility, at a priority that follows the outcome.
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func newSyslogSink() (auditSink, error) {
+	writer, err := syslog.New(syslog.LOG_AUTH|syslog.LOG_INFO, serverName)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+func (s *syslogSink) Name() string {
+	return "syslog"
+}
+
+func (s *syslogSink) Write(entry auditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	switch severityOf(entry.Outcome) {
+	case severityAlert:
+		return s.writer.Alert(string(data))
+	case severityWarning:
+		return s.writer.Warning(string(data))
+	case severityNotice:
+		return s.writer.Notice(string(data))
+	}
+	return s.writer.Info(string(data))
+}
+
+func (s *syslogSink) Close() error {
+	return s.writer.Close()
+}
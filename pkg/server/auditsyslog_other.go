@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package server
+
+import "errors"
+
+func newSyslogSink() (auditSink, error) {
+	return nil, errors.New("syslog isn't available on this platform")
+}
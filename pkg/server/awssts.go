@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stsURLFormat is the regional STS endpoint validate_aws_credentials calls,
+// with %s replaced by the region.
+var stsURLFormat = "https://sts.%s.amazonaws.com/"
+
+// defaultAWSRegion is used when aws_region isn't configured.
+const defaultAWSRegion = "us-east-1"
+
+// awsRegionName matches region names such as us-east-1 or us-gov-west-1.
+var awsRegionName = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+
+const getCallerIdentityBody = "Action=GetCallerIdentity&Version=2011-06-15"
+
+// awsIdentity is the result of validate_aws_credentials.
+type awsIdentity struct {
+	Valid   bool   `json:"valid"`
+	Account string `json:"account,omitempty"`
+	Arn     string `json:"arn,omitempty"`
+	UserID  string `json:"user_id,omitempty"`
+	Region  string `json:"region"`
+	// Error classifies a failure: invalid_key, invalid_secret,
+	// expired_token, clock_skew, access_denied or error.
+	Error  string `json:"error,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// awsIdentitySchema describes awsIdentity for the tool's output schema.
+var awsIdentitySchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"valid":   {Type: "boolean", Description: "Whether AWS accepted the credentials"},
+		"account": {Type: "string", Description: "AWS account ID the credentials belong to"},
+		"arn":     {Type: "string", Description: "ARN of the IAM user or assumed role"},
+		"user_id": {Type: "string", Description: "Unique ID of the calling identity"},
+		"region":  {Type: "string", Description: "Region whose STS endpoint was called"},
+		"error": {
+			Type:        "string",
+			Description: "Why the credentials were rejected",
+			Enum:        []string{"invalid_key", "invalid_secret", "expired_token", "clock_skew", "access_denied", "error"},
+		},
+		"detail": {Type: "string", Description: "AWS's message, or why the check couldn't run"},
+	},
+	Required: []string{"valid", "region"},
+}
+
+// awsCredentials are what a request is signed with.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// signAWSRequest returns the headers that sign a POST of body to endpoint
+// for service with Signature Version 4, as of now.
+func signAWSRequest(creds awsCredentials, service, endpoint, body string, now time.Time) (map[string]string, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	headers := map[string]string{
+		"content-type": "application/x-www-form-urlencoded; charset=utf-8",
+		"host":         parsed.Host,
+		"x-amz-date":   amzDate,
+	}
+	if creds.SessionToken != "" {
+		headers["x-amz-security-token"] = creds.SessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := parsed.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{http.MethodPost, path, parsed.RawQuery, canonicalHeaders.String(), signedHeaders, sha256Hex(body)}, "\n")
+	scope := strings.Join([]string{date, creds.Region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex(canonicalRequest)}, "\n")
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, creds.Region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	headers["authorization"] = fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", creds.AccessKeyID, scope, signedHeaders, signature)
+	// Go sets Host from the URL
+	delete(headers, "host")
+	return headers, nil
+}
+
+// classifyAWSError maps an STS error code, and for signature errors the
+// message, to the error reported by validate_aws_credentials.
+func classifyAWSError(code, message string) string {
+	switch code {
+	case "InvalidClientTokenId", "UnrecognizedClientException":
+		return "invalid_key"
+	case "SignatureDoesNotMatch":
+		if strings.Contains(message, "Signature expired") {
+			return "clock_skew"
+		}
+		return "invalid_secret"
+	case "ExpiredToken", "ExpiredTokenException", "TokenRefreshRequired":
+		return "expired_token"
+	case "RequestExpired", "RequestTimeTooSkewed":
+		return "clock_skew"
+	case "AccessDenied", "AccessDeniedException":
+		return "access_denied"
+	}
+	return "error"
+}
+
+// getCallerIdentity calls sts:GetCallerIdentity, which any valid
+// credentials may call, to learn whose they are.
+func getCallerIdentity(ctx context.Context, creds awsCredentials) (awsIdentity, error) {
+	identity := awsIdentity{Region: creds.Region}
+	endpoint := fmt.Sprintf(stsURLFormat, creds.Region)
+	headers, err := signAWSRequest(creds, "sts", endpoint, getCallerIdentityBody, time.Now())
+	if err != nil {
+		return identity, err
+	}
+	response, body, err := providerPost(ctx, endpoint, headers, getCallerIdentityBody)
+	if err != nil {
+		return identity, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var failure struct {
+			Error struct {
+				Code    string `xml:"Code"`
+				Message string `xml:"Message"`
+			} `xml:"Error"`
+		}
+		if err := xml.Unmarshal(body, &failure); err != nil || failure.Error.Code == "" {
+			return identity, fmt.Errorf("STS returned %s", response.Status)
+		}
+		identity.Error = classifyAWSError(failure.Error.Code, failure.Error.Message)
+		identity.Detail = fmt.Sprintf("%s: %s", failure.Error.Code, failure.Error.Message)
+		return identity, nil
+	}
+
+	var success struct {
+		Result struct {
+			Arn     string `xml:"Arn"`
+			UserID  string `xml:"UserId"`
+			Account string `xml:"Account"`
+		} `xml:"GetCallerIdentityResult"`
+	}
+	if err := xml.Unmarshal(body, &success); err != nil {
+		return identity, fmt.Errorf("unexpected response from STS: %w", err)
+	}
+	identity.Valid = true
+	identity.Account = success.Result.Account
+	identity.Arn = success.Result.Arn
+	identity.UserID = success.Result.UserID
+	return identity, nil
+}
+
+func (s *Server) handleValidateAWSCredentials(ctx context.Context, args map[string]interface{}) CallToolResult {
+	var missing []string
+	values := map[string]string{}
+	for _, name := range []string{"aws_access_key", "aws_secret_key", "aws_session_token", "aws_region"} {
+		config, value, _ := s.keys.lookup(name)
+		values[name] = value
+		if value == "" && (name == "aws_access_key" || name == "aws_secret_key") {
+			missing = append(missing, s.keys.unsetLabel(config))
+		}
+	}
+	if len(missing) > 0 {
+		return failure(codeNotConfigured, fmt.Sprintf("Error: AWS credentials are not configured. Set %s.", strings.Join(missing, " and ")), nil)
+	}
+	creds := awsCredentials{
+		AccessKeyID:     values["aws_access_key"],
+		SecretAccessKey: values["aws_secret_key"],
+		SessionToken:    values["aws_session_token"],
+		Region:          values["aws_region"],
+	}
+	if creds.Region == "" {
+		creds.Region = defaultAWSRegion
+	}
+	// The region becomes part of the endpoint's host name
+	if !awsRegionName.MatchString(creds.Region) {
+		return failure(codeValidationFailed, fmt.Sprintf("Error: %q is not an AWS region name such as us-east-1", creds.Region), nil)
+	}
+
+	identity, err := getCallerIdentity(ctx, creds)
+	if err != nil {
+		identity.Error = "error"
+		identity.Detail = fmt.Sprintf("could not check: %v", s.keys.secrets.scrubError(err))
+	}
+
+	var text string
+	if identity.Valid {
+		text = fmt.Sprintf("%s AWS credentials are valid.\nAccount: %s\nARN: %s\nUser ID: %s", s.markers.status(true), identity.Account, identity.Arn, identity.UserID)
+	} else {
+		text = fmt.Sprintf("%s AWS credentials were not accepted (%s): %s", s.markers.status(false), identity.Error, identity.Detail)
+	}
+	toolResult := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text}},
+	}
+	if s.supportsStructuredContent() {
+		toolResult.StructuredContent = identity
+	}
+	return toolResult
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// auditBreakGlass is the audit outcome of a reveal that overrode the access
+// policy with a justification.
+const auditBreakGlass = "break_glass"
+
+const (
+	// defaultBreakGlassMinLength is the shortest justification accepted
+	// unless --break-glass-min-length says otherwise.
+	defaultBreakGlassMinLength = 20
+	// maxJustificationLength keeps a justification to what fits in an
+	// audit entry and a notification.
+	maxJustificationLength = 1000
+)
+
+// breakGlass lets get_api_key reveal a key the access policy denies when
+// the caller says why. It is off unless --break-glass-enabled is set, and
+// never overrides a key's reveal: false setting.
+type breakGlass struct {
+	enabled bool
+	// minLength is the fewest characters a justification must have.
+	minLength int
+}
+
+// justification returns the trimmed justification get_api_key was called
+// with, or "" when there is none.
+func justification(args map[string]interface{}) string {
+	text, _ := args["justification"].(string)
+	return strings.TrimSpace(text)
+}
+
+// checkBreakGlass decides whether a justification lets keyName be revealed
+// despite the access policy. It returns a failure, already audited, when it
+// doesn't.
+func (s *Server) checkBreakGlass(ctx context.Context, keyName, text, value string) (CallToolResult, bool) {
+	switch length := utf8.RuneCountInString(text); {
+	case !s.breakGlass.enabled:
+		s.noteAudit(ctx, "warning", fmt.Sprintf("Break-glass reveal of API key '%s' was refused: break-glass is not enabled", keyName))
+		s.noteAccess(ctx, keyName, auditDenied, "break-glass not enabled", value)
+		return failure(codePolicyDenied, fmt.Sprintf("API key '%s' is blocked by the server's reveal policy, and a justification can't override it: break-glass reveals are not enabled on this server (--break-glass-enabled).", keyName), keyDetails(keyName)), false
+	case length < s.breakGlass.minLength:
+		s.noteAccess(ctx, keyName, auditDenied, "justification too short", value)
+		return failure(codeValidationFailed, fmt.Sprintf("Error: the justification must be at least %d characters: say who needs the key and why it can't wait.", s.breakGlass.minLength), map[string]interface{}{"key_name": keyName, "min_length": s.breakGlass.minLength}), false
+	case length > maxJustificationLength:
+		return failure(codeValidationFailed, fmt.Sprintf("Error: the justification must be at most %d characters", maxJustificationLength), nil), false
+	}
+	return CallToolResult{}, true
+}
+
+// unconfirmableMessage explains why a restricted key isn't revealed to a
+// client that can't ask the user to confirm, and how to get it anyway.
+func (s *Server) unconfirmableMessage(keyName string) string {
+	override := "call get_api_key again with a justification for a break-glass reveal"
+	if !s.breakGlass.enabled {
+		override = "restart the server with --break-glass-enabled and call get_api_key with a justification for a break-glass reveal"
+	}
+	return fmt.Sprintf("API key '%s' is restricted: each reveal needs the user's confirmation, and this client can't ask for it because it doesn't support MCP elicitation. Use a client that does, or %s.", keyName, override)
+}
+
+// recordBreakGlass audits a break-glass reveal at the highest severity the
+// server uses: an alert to the client and an audit entry holding the
+// justification, which also goes to the reveal webhook.
+func (s *Server) recordBreakGlass(ctx context.Context, keyName, text, reason, value string) {
+	s.note(ctx, auditNote{
+		level:   "alert",
+		message: fmt.Sprintf("BREAK-GLASS: API key '%s' was revealed despite the access policy. Justification: %s", keyName, text),
+		entry: auditEntry{
+			Key:           keyName,
+			Outcome:       auditBreakGlass,
+			Reason:        reason,
+			Justification: text,
+		},
+		value: value,
+	})
+}
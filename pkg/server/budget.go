@@ -0,0 +1,92 @@
+package server
+
+import "fmt"
+
+// revealBudget caps how many distinct keys one session may reveal. Fetching
+// a key that was already revealed doesn't use more of it. A stdio session is
+// the life of the process.
+type revealBudget struct {
+	// limit is the most distinct keys that may be revealed; 0 means no limit.
+	limit    int
+	revealed map[string]int // key name -> times revealed
+	calls    int
+	// breakGlass counts break-glass reveals, each of which uses one more
+	// unit of the budget than the key it reveals.
+	breakGlass int
+}
+
+// used is how much of the budget has been spent.
+func (b revealBudget) used() int {
+	return len(b.revealed) + b.breakGlass
+}
+
+// budgetStatus summarizes budget use for diagnostics.
+type budgetStatus struct {
+	Limit      int `json:"limit"`
+	UniqueKeys int `json:"unique_keys"`
+	TotalCalls int `json:"total_calls"`
+	BreakGlass int `json:"break_glass_reveals,omitempty"`
+	Remaining  int `json:"remaining"`
+}
+
+// reserveRevealBudget takes what revealing keyName costs out of the
+// session's budget, or returns an error message if that would exceed it. A
+// break-glass reveal counts double. Checking and taking happen under one
+// lock, so calls that then wait, such as on a confirmation prompt, can't
+// share the last of the budget. release gives the reservation back for a
+// reveal that is refused after all.
+func (s *Server) reserveRevealBudget(keyName string, breakGlass bool) (release func(), message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	budget := &s.revealBudget
+	cost := 0
+	if budget.revealed[keyName] == 0 {
+		cost++
+	}
+	if breakGlass {
+		cost++
+	}
+	if budget.limit > 0 && budget.used()+cost > budget.limit {
+		switch {
+		case breakGlass:
+			message = fmt.Sprintf("Error: the reveal budget for this session can't cover a break-glass reveal of '%s', which counts double: %d of %d used. Restart the server, or raise the budget with --reveal-budget.", keyName, budget.used(), budget.limit)
+		case budget.breakGlass > 0:
+			message = fmt.Sprintf("Error: the reveal budget for this session is used up: %d of %d used, with break-glass reveals counting double. Keys already revealed can still be fetched. To reveal '%s', restart the server, or raise the budget with --reveal-budget.", budget.used(), budget.limit, keyName)
+		default:
+			message = fmt.Sprintf("Error: the reveal budget for this session is used up: %d distinct keys have been revealed, the most allowed. Keys already revealed can still be fetched. To reveal '%s', restart the server, or raise the budget with --reveal-budget.", budget.limit, keyName)
+		}
+		return func() {}, message
+	}
+
+	budget.revealed[keyName]++
+	budget.calls++
+	if breakGlass {
+		budget.breakGlass++
+	}
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if budget.revealed[keyName]--; budget.revealed[keyName] <= 0 {
+			delete(budget.revealed, keyName)
+		}
+		budget.calls--
+		if breakGlass {
+			budget.breakGlass--
+		}
+	}, ""
+}
+
+func (s *Server) revealBudgetStatus() budgetStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := budgetStatus{
+		Limit:      s.revealBudget.limit,
+		UniqueKeys: len(s.revealBudget.revealed),
+		TotalCalls: s.revealBudget.calls,
+		BreakGlass: s.revealBudget.breakGlass,
+	}
+	if status.Limit > 0 {
+		status.Remaining = max(0, status.Limit-s.revealBudget.used())
+	}
+	return status
+}
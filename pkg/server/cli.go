@@ -0,0 +1,383 @@
+package server
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Exit codes of the CLI subcommands.
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitUsageErr = 2
+)
+
+// commands are the subcommands that answer from the shell instead of
+// serving MCP. Each gets a key registry set up from the environment and
+// .env, and the arguments after its name, and returns the exit code. Running the binary without one starts the MCP server.
+var commands = map[string]func(keys *keyRegistry, args []string, stdout, stderr io.Writer) int{
+	"list":                   runList,
+	"check":                  runCheck,
+	"get":                    runGet,
+	"doctor":                 runDoctor,
+	"generate-client-config": runGenerateClientConfig,
+	"init":                   runInit,
+	"import":                 runImport,
+	"setup":                  runSetup,
+	"encrypt-env":            runEncryptEnv,
+	"decrypt-env":            runDecryptEnv,
+	"verify-audit-log":       runVerifyAuditLog,
+	"replay":                 runReplay,
+}
+
+// commandUsage is printed after the server flags by --help.
+const commandUsage = `
+Commands (run without one to start the MCP server on stdin/stdout):
+  list [--category name] [--json]   List API keys and whether they are configured
+  check <key_name>                  Exit 0 if the key is configured, 1 if not
+  get [--masked] <key_name>         Print the key value, or a masked preview
+  doctor                            Diagnose the .env file and configured keys
+  init [--config file] [--with-values] [--force]
+                                    Write a .env.example (or .env) template for every key
+  import [--write] [template]       Compare .env.example (or template) with .env; --write copies
+                                    defaults and adds stubs for missing keys
+  setup [--category name] [--only key1,key2] [--from-stdin-json]
+                                    Ask for each unconfigured key, with typing hidden,
+                                    and save it to .env (or --target)
+  encrypt-env [--remove] [file]     Encrypt .env (or file) to .env.enc with a passphrase
+  decrypt-env [--stdout] [file]     Decrypt .env.enc (or file) back to .env
+  verify-audit-log <path>           Check a signed audit log's chain with MCP_AUDIT_HMAC_KEY
+  replay <path>                     Send the requests of a --record file to a fresh server
+                                    and report responses that differ from the recording
+  generate-client-config [--write] <client> [server flags...]
+                                    Print the configuration that registers this server
+                                    with claude-desktop, cursor, vscode or a generic client
+`
+
+// runCommand runs the subcommand named by args[0], if there is one. It
+// reports false when args don't start with a subcommand.
+func runCommand(args []string, stdout, stderr io.Writer) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		return 0, false
+	}
+
+	keys := newKeyRegistry()
+	if err := keys.loadDotEnv(); err != nil {
+		fmt.Fprintf(stderr, "Warning: failed to load .env: %v\n", err)
+	}
+	if err := keys.mask.configureFromEnv(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsageErr, true
+	}
+	keys.sanitizeValues = sanitizeFromEnv()
+	return command(keys, args[1:], stdout, stderr), true
+}
+
+// newCommandFlags returns a flag set for a subcommand that reports parse
+// errors instead of exiting.
+func newCommandFlags(name, usage string, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s %s\n", os.Args[0], usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+func runList(keys *keyRegistry, args []string, stdout, stderr io.Writer) int {
+	flags := newCommandFlags("list", "list [--category name] [--json]", stderr)
+	category := flags.String("category", "all", "Only list keys in this category: "+strings.Join(categoryNames, ", "))
+	asJSON := flags.Bool("json", false, "Print the keys as a JSON array")
+	if err := flags.Parse(args); err != nil {
+		return exitUsageErr
+	}
+	if !validCategory(*category) {
+		fmt.Fprintf(stderr, "Invalid category: %s\n", *category)
+		return exitUsageErr
+	}
+
+	listed := keys.list(*category)
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(listed)
+		return exitOK
+	}
+	for _, key := range listed {
+		configured := "missing"
+		switch {
+		case key.Placeholder:
+			configured = "placeholder"
+		case len(key.EmptyEnvVars) > 0:
+			configured = "empty"
+		case key.Configured:
+			configured = "configured"
+		}
+		fmt.Fprintf(stdout, "%-22s %-11s %-28s %s\n", key.Name, configured, key.EnvVar, key.Description)
+	}
+	return exitOK
+}
+
+func runCheck(keys *keyRegistry, args []string, stdout, stderr io.Writer) int {
+	flags := newCommandFlags("check", "check <key_name>", stderr)
+	if err := flags.Parse(args); err != nil {
+		return exitUsageErr
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsageErr
+	}
+
+	keyName, exists := keys.resolveName(flags.Arg(0))
+	if !exists {
+		message, _ := keys.unknownKeyMessage(flags.Arg(0), keys.names())
+		fmt.Fprintln(stderr, message)
+		return exitUsageErr
+	}
+	config, value, _ := keys.lookup(keyName)
+	if value == "" {
+		if empty := keys.emptyEnvVars(config); len(empty) > 0 && !config.IsComposite() {
+			fmt.Fprintf(stdout, "%s is NOT configured: %s\n", keyName, emptyHint(empty))
+			return exitFailure
+		}
+		fmt.Fprintf(stdout, "%s is NOT configured. Set %s.\n", keyName, config.EnvLabel())
+		return exitFailure
+	}
+	fmt.Fprintf(stdout, "%s is configured (value: %s)\n", keyName, keys.maskSecret(value))
+	return exitOK
+}
+
+func runGet(keys *keyRegistry, args []string, stdout, stderr io.Writer) int {
+	flags := newCommandFlags("get", "get [--masked] <key_name>", stderr)
+	masked := flags.Bool("masked", false, "Print a masked preview instead of the value")
+	if err := flags.Parse(args); err != nil {
+		return exitUsageErr
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsageErr
+	}
+
+	keyName, exists := keys.resolveName(flags.Arg(0))
+	if !exists {
+		message, _ := keys.unknownKeyMessage(flags.Arg(0), keys.names())
+		fmt.Fprintln(stderr, message)
+		return exitUsageErr
+	}
+	config, value, _ := keys.lookup(keyName)
+	if value == "" {
+		fmt.Fprintf(stderr, "%s is not configured. Set %s.\n", keyName, config.EnvLabel())
+		return exitFailure
+	}
+	if *masked {
+		value = keys.maskSecret(value)
+	}
+	fmt.Fprintln(stdout, value)
+	return exitOK
+}
+
+// diagnosis is one finding of the doctor command.
+type diagnosis struct {
+	Level   string // "ok", "warning" or "error"
+	Message string
+}
+
+// diagnose looks for common configuration mistakes: a .env file that fails
+// to parse, values with stray whitespace or quotes, which providers reject
+// with confusing authentication errors, and placeholder values.
+func diagnose(keys *keyRegistry) []diagnosis {
+	var findings []diagnosis
+
+	switch _, err := os.Stat(".env"); {
+	case os.IsNotExist(err):
+		findings = append(findings, diagnosis{"ok", "No .env file in the working directory; using the environment only"})
+	case err != nil:
+		findings = append(findings, diagnosis{"error", fmt.Sprintf("Cannot read .env: %v", err)})
+	default:
+		if err := keys.loadDotEnv(); err != nil {
+			findings = append(findings, diagnosis{"error", fmt.Sprintf("Failed to load .env: %v", err)})
+		} else {
+			findings = append(findings, diagnosis{"ok", "Loaded .env"})
+		}
+	}
+
+	configured := 0
+	for _, name := range keys.names() {
+		config, value, _ := keys.lookup(name)
+		if value == "" {
+			if empty := keys.emptyEnvVars(config); len(empty) > 0 {
+				findings = append(findings, diagnosis{"warning", fmt.Sprintf("%s: %s", name, emptyHint(empty))})
+			}
+			continue
+		}
+		configured++
+		for _, envVar := range keyEnvVars(config) {
+			if _, set := keys.lookupEnv(envVar); !set {
+				continue
+			}
+			if note := keys.shadowNoteFor(envVar); note != "" {
+				findings = append(findings, diagnosis{"warning", fmt.Sprintf("%s: %s", name, note)})
+			} else {
+				source, _ := keys.sources.source(envVar)
+				findings = append(findings, diagnosis{"ok", fmt.Sprintf("%s: %s comes from %s", name, envVar, describeSource(source))})
+			}
+		}
+		envVar, stripped, suspicious := keys.valueFindings(config)
+		if len(stripped) > 0 {
+			findings = append(findings, diagnosis{"warning", fmt.Sprintf("%s (%s) has %s, which the server strips; fix it at the source", name, envVar, strings.Join(stripped, " and "))})
+		}
+		if len(suspicious) > 0 {
+			findings = append(findings, diagnosis{"warning", fmt.Sprintf("%s (%s) has %s", name, envVar, strings.Join(suspicious, ", "))})
+		}
+		if keys.looksLikePlaceholder(value) {
+			findings = append(findings, diagnosis{"warning", fmt.Sprintf("%s (%s) looks like a placeholder, not a real key", name, config.EnvLabel())})
+		}
+	}
+	findings = append(findings, diagnosis{"ok", fmt.Sprintf("%d of %d API keys configured", configured, keys.count())})
+	for _, message := range collisionMessages(keys) {
+		findings = append(findings, diagnosis{"warning", message})
+	}
+
+	if readOnlyFromEnv() {
+		findings = append(findings, diagnosis{"ok", "Read-only mode is on (MCP_READ_ONLY=1): the server won't reveal key values"})
+	} else {
+		findings = append(findings, diagnosis{"ok", "Read-only mode is off: get_api_key can reveal key values (set MCP_READ_ONLY=1 or pass --read-only to disable it)"})
+	}
+	return findings
+}
+
+func runDoctor(keys *keyRegistry, args []string, stdout, stderr io.Writer) int {
+	flags := newCommandFlags("doctor", "doctor [--config file] [--state-file file] [--policy file] [--reveal-allow list] [--reveal-deny list] [--reveal-budget n] [--enable-tools list] [--disable-tools list] [--read-only]", stderr)
+	configPath := flags.String("config", "", "Server configuration file, for its placeholder patterns, composite keys, never_reveal keys, reveal policy and rotation settings")
+	stateFilePath := flags.String("state-file", os.Getenv("MCP_STATE_FILE"), "Server state file, for the rotation dates recorded by mark_key_rotated")
+	policyPath := flags.String("policy", "", "Policy file to show the effective access of every key under")
+	revealAllow := flags.String("reveal-allow", "", "The server's --reveal-allow, to show the effective access of every key under")
+	revealDeny := flags.String("reveal-deny", "", "The server's --reveal-deny, to show the effective access of every key under")
+	revealBudget := flags.Int("reveal-budget", 0, "Reveal budget the server is started with, to report against the configured keys")
+	enableTools := flags.String("enable-tools", "", "The server's --enable-tools, to list the tools it offers")
+	disableTools := flags.String("disable-tools", "", "The server's --disable-tools, to list the tools it offers")
+	readOnly := flags.Bool("read-only", readOnlyFromEnv(), "Whether the server runs in read-only mode, to list the tools it offers")
+	if err := flags.Parse(args); err != nil {
+		return exitUsageErr
+	}
+
+	var config fileConfig
+	if *configPath != "" {
+		var err error
+		config, err = loadFileConfig(*configPath)
+		if err == nil {
+			err = keys.addPlaceholderPatterns(config.PlaceholderPatterns)
+		}
+		if err == nil {
+			err = keys.registerComposite(config.CompositeKeys)
+		}
+		if err == nil {
+			err = keys.markNeverReveal(config.NeverReveal)
+		}
+		if err == nil {
+			err = keys.rotations.configure(keys, config)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+	}
+	if *stateFilePath != "" {
+		if err := keys.rotations.load(*stateFilePath); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+	}
+	revealPolicy, err := newRevealPolicy(
+		append(config.RevealAllow, splitPatterns(*revealAllow)...),
+		append(config.RevealDeny, splitPatterns(*revealDeny)...),
+	)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsageErr
+	}
+
+	filter, err := newToolFilter(
+		append(config.EnableTools, splitPatterns(*enableTools)...),
+		append(config.DisableTools, splitPatterns(*disableTools)...),
+	)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsageErr
+	}
+
+	var policy accessPolicy
+	if *policyPath != "" {
+		var err error
+		if policy, err = loadAccessPolicy(keys, *policyPath); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+	}
+
+	code := exitOK
+	for _, finding := range diagnose(keys) {
+		fmt.Fprintf(stdout, "[%s] %s\n", finding.Level, finding.Message)
+		if finding.Level != "ok" {
+			code = exitFailure
+		}
+	}
+
+	if overdue := overdueKeys(keys, time.Now()); len(overdue) > 0 {
+		summary := make([]string, 0, len(overdue))
+		for _, info := range overdue {
+			summary = append(summary, fmt.Sprintf("%s (%d days, max %d)", info.Key, info.AgeDays, info.MaxAgeDays))
+		}
+		fmt.Fprintf(stdout, "[warning] %d API keys are overdue for rotation: %s\n", len(overdue), strings.Join(summary, ", "))
+		code = exitFailure
+	} else {
+		fmt.Fprintf(stdout, "[ok] No configured API key is overdue for rotation\n")
+	}
+
+	// The budget is spent within a server session, which doctor can't see;
+	// server_info reports the live numbers
+	if *revealBudget > 0 {
+		fmt.Fprintf(stdout, "[ok] Reveal budget: 0 of %d distinct keys used per session, %d remaining at start (server_info reports live use)\n", *revealBudget, *revealBudget)
+	} else {
+		fmt.Fprintf(stdout, "[ok] Reveal budget: unlimited (pass --reveal-budget to the server to cap distinct keys revealed per session)\n")
+	}
+
+	fmt.Fprintf(stdout, "\nEffective access policy:\n")
+	for _, name := range keys.names() {
+		config, _ := keys.config(name)
+		fmt.Fprintf(stdout, "  %-22s %-10s %s\n", name, config.Category, effectiveAccess(policy.decide(name, config), revealPolicy, name, config))
+	}
+	for _, client := range policy.Clients {
+		fmt.Fprintf(stdout, "\nFor clients named %q:\n", client.Name)
+		for _, name := range keys.names() {
+			config, _ := keys.config(name)
+			fmt.Fprintf(stdout, "  %-22s %-10s %s\n", name, config.Category, effectiveAccess(policy.decideWith(client, name, config), revealPolicy, name, config))
+		}
+	}
+
+	// Tools registered by an embedding program aren't known here
+	s := New(strings.NewReader(""), io.Discard, WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	s.readOnly = *readOnly
+	s.tools.setFilter(filter)
+	fmt.Fprintf(stdout, "\nTools:\n")
+	for _, tool := range s.toolStates() {
+		fmt.Fprintf(stdout, "  %-30s %s\n", tool.Name, tool.State)
+	}
+	for _, pattern := range filter.unmatched(s.tools.names()) {
+		fmt.Fprintf(stdout, "[warning] Tool pattern %q matches no tool\n", pattern)
+		code = exitFailure
+	}
+	return code
+}
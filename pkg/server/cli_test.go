@@ -0,0 +1,126 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+func TestCommandExitCodes(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-clitest0123456789abcdef"})
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		args     []string
+		code     int
+		stdout   string
+		noStdout string
+	}{
+		{[]string{"list"}, 0, "openai", ""},
+		{[]string{"list", "--category", "vcs"}, 0, "github", "openai"},
+		{[]string{"list", "--category", "nope"}, 2, "", ""},
+		{[]string{"list", "--no-such-flag"}, 2, "", ""},
+		{[]string{"check", "openai"}, 0, "openai is configured", "clitest"},
+		{[]string{"check", "anthropic"}, 1, "NOT configured", ""},
+		{[]string{"check", "no_such_key"}, 2, "", ""},
+		{[]string{"check"}, 2, "", ""},
+		{[]string{"check", "openai", "anthropic"}, 2, "", ""},
+		{[]string{"get", "openai"}, 0, "sk-proj-clitest0123456789abcdef\n", ""},
+		{[]string{"get", "--masked", "openai"}, 0, "sk-p", "clitest"},
+		{[]string{"get", "anthropic"}, 1, "", ""},
+		{[]string{"get", "no_such_key"}, 2, "", ""},
+		{[]string{"get"}, 2, "", ""},
+	} {
+		code, stdout, stderr := execute(t, ctx, "", test.args...)
+		if code != test.code {
+			t.Errorf("%s = %d, want %d (stderr %q)", strings.Join(test.args, " "), code, test.code, stderr)
+		}
+		if !strings.Contains(stdout, test.stdout) || (test.noStdout != "" && strings.Contains(stdout, test.noStdout)) {
+			t.Errorf("%s prints %q, want %q without %q", strings.Join(test.args, " "), stdout, test.stdout, test.noStdout)
+		}
+	}
+
+	// A placeholder value is a doctor warning, and warnings fail the command
+	testmcp.SetKeys(t, map[string]string{"openai": "changeme"})
+	if code, stdout, _ := execute(t, ctx, "", "doctor"); code != 1 || !strings.Contains(stdout, "[warning] openai (OPENAI_API_KEY) looks like a placeholder") {
+		t.Errorf("doctor = %d, %q", code, stdout)
+	}
+}
+
+func TestListJSON(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-clitest0123456789abcdef"})
+	code, stdout, stderr := execute(t, context.Background(), "", "list", "--json", "--category", "llm")
+	if code != 0 {
+		t.Fatalf("list --json = %d, %s", code, stderr)
+	}
+	var keys []struct {
+		Name       string `json:"name"`
+		EnvVar     string `json:"env_var"`
+		Category   string `json:"category"`
+		Configured bool   `json:"configured"`
+		Masked     string `json:"masked"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &keys); err != nil {
+		t.Fatalf("list --json output isn't a JSON array: %v\n%s", err, stdout)
+	}
+	if len(keys) == 0 {
+		t.Fatal("list --json --category llm lists no keys")
+	}
+	for _, key := range keys {
+		if key.Category != "llm" {
+			t.Errorf("%s is listed in category %s", key.Name, key.Category)
+		}
+		if configured := key.Name == "openai"; key.Configured != configured {
+			t.Errorf("%s configured = %t, want %t", key.Name, key.Configured, configured)
+		}
+	}
+	if strings.Contains(stdout, "clitest") {
+		t.Errorf("list --json reveals a key value: %s", stdout)
+	}
+}
+
+func TestInitWithConfig(t *testing.T) {
+	testmcp.ClearKeys(t)
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	config := `{"composite_keys": {"supabase": {"category": "internal", "description": "Supabase project URL and keys", "members": [
+		{"role": "url", "env_var": "SUPABASE_URL"},
+		{"role": "anon_key", "env_var": "SUPABASE_ANON_KEY"}
+	]}}}`
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "with-config.example")
+	if code, _, stderr := execute(t, context.Background(), "", "init", "--config", configPath, "--output", output); code != 0 {
+		t.Fatalf("init --config = %d, %s", code, stderr)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil || !strings.Contains(string(data), "# Supabase project URL and keys\nSUPABASE_URL=\nSUPABASE_ANON_KEY=\n") {
+		t.Errorf("init --config wrote %q, %v", data, err)
+	}
+
+	output = filepath.Join(dir, "without-config.example")
+	if code, _, stderr := execute(t, context.Background(), "", "init", "--output", output); code != 0 {
+		t.Fatalf("init = %d, %s", code, stderr)
+	}
+	if data, err := os.ReadFile(output); err != nil || strings.Contains(string(data), "SUPABASE_ANON_KEY") {
+		t.Errorf("init without --config wrote %q, %v", data, err)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"composite_keys": {"openai": {"category": "llm", "members": []}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	output = filepath.Join(dir, "bad-config.example")
+	if code, _, stderr := execute(t, context.Background(), "", "init", "--config", configPath, "--output", output); code != 1 || !strings.Contains(stderr, "composite key openai") {
+		t.Errorf("init with a bad config = %d, %s", code, stderr)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("init with a bad config wrote %s: %v", output, err)
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// clientConfigTargets are the MCP clients generate-client-config knows the
+// configuration format of.
+var clientConfigTargets = []string{"claude-desktop", "cursor", "vscode", "generic"}
+
+// clientConfigServerName is the name the server is registered under in
+// generated client configurations.
+const clientConfigServerName = "api-keys"
+
+// clientServerEntry launches this server over stdio.
+type clientServerEntry struct {
+	Type    string   `json:"type,omitempty"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+// buildClientConfig returns the configuration snippet that registers the
+// server with target, and where to put it.
+func buildClientConfig(target, command string, args []string) (interface{}, string, error) {
+	if args == nil {
+		args = []string{}
+	}
+	entry := clientServerEntry{Command: command, Args: args}
+
+	switch target {
+	case "claude-desktop":
+		return map[string]interface{}{"mcpServers": map[string]clientServerEntry{clientConfigServerName: entry}},
+			fmt.Sprintf("Merge this into the \"mcpServers\" object of %s, then restart Claude Desktop.", claudeDesktopConfigPath()), nil
+	case "cursor":
+		return map[string]interface{}{"mcpServers": map[string]clientServerEntry{clientConfigServerName: entry}},
+			"Merge this into ~/.cursor/mcp.json for all projects, or .cursor/mcp.json in a project.", nil
+	case "vscode":
+		entry.Type = "stdio"
+		return map[string]interface{}{"servers": map[string]clientServerEntry{clientConfigServerName: entry}},
+			"Merge this into .vscode/mcp.json in your workspace, or the \"mcp\" section of your user settings.", nil
+	case "generic":
+		entry.Type = "stdio"
+		return entry, "Register this stdio command with your MCP client.", nil
+	}
+	return nil, "", fmt.Errorf("Unknown client %q: use one of %s", target, strings.Join(clientConfigTargets, ", "))
+}
+
+// claudeDesktopConfigPath is where Claude Desktop reads its configuration on
+// this platform.
+func claudeDesktopConfigPath() string {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support", "Claude", "claude_desktop_config.json")
+	case "windows":
+		return filepath.Join(os.Getenv("APPDATA"), "Claude", "claude_desktop_config.json")
+	}
+	return filepath.Join(home, ".config", "Claude", "claude_desktop_config.json")
+}
+
+// serverCommand returns the absolute path of the running binary.
+func serverCommand() string {
+	executable, err := os.Executable()
+	if err != nil {
+		return os.Args[0]
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	return executable
+}
+
+// mergeClaudeDesktopConfig adds the server entry to the Claude Desktop
+// configuration at path, keeping every other setting and server. An existing
+// file is copied to path + ".bak" first.
+func mergeClaudeDesktopConfig(path string, entry clientServerEntry) error {
+	config := map[string]json.RawMessage{}
+	mode := os.FileMode(0600)
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("%s is not valid JSON: %w", path, err)
+		}
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := os.WriteFile(path+".bak", data, mode); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	case os.IsNotExist(err):
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	servers := map[string]json.RawMessage{}
+	if existing, ok := config["mcpServers"]; ok {
+		if err := json.Unmarshal(existing, &servers); err != nil {
+			return fmt.Errorf("mcpServers in %s is not an object: %w", path, err)
+		}
+	}
+	if servers[clientConfigServerName], err = json.Marshal(entry); err != nil {
+		return err
+	}
+	if config["mcpServers"], err = json.Marshal(servers); err != nil {
+		return err
+	}
+
+	merged, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(merged, '\n'), mode)
+}
+
+func runGenerateClientConfig(keys *keyRegistry, args []string, stdout, stderr io.Writer) int {
+	flags := newCommandFlags("generate-client-config", "generate-client-config [--write] [--config-path file] <"+strings.Join(clientConfigTargets, "|")+"> [server flags...]", stderr)
+	write := flags.Bool("write", false, "Merge the entry into the Claude Desktop configuration file instead of printing it (claude-desktop only)")
+	configPath := flags.String("config-path", claudeDesktopConfigPath(), "Claude Desktop configuration file used by --write")
+	if err := flags.Parse(args); err != nil {
+		return exitUsageErr
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitUsageErr
+	}
+
+	// Anything after the target is passed to the server when the client
+	// starts it
+	target, serverArgs := flags.Arg(0), flags.Args()[1:]
+	snippet, instructions, err := buildClientConfig(target, serverCommand(), serverArgs)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsageErr
+	}
+
+	if *write {
+		if target != "claude-desktop" {
+			fmt.Fprintln(stderr, "--write is only supported for claude-desktop")
+			return exitUsageErr
+		}
+		entry := clientServerEntry{Command: serverCommand(), Args: serverArgs}
+		if entry.Args == nil {
+			entry.Args = []string{}
+		}
+		if err := mergeClaudeDesktopConfig(*configPath, entry); err != nil {
+			fmt.Fprintf(stderr, "Failed to update %s: %v\n", *configPath, err)
+			return exitFailure
+		}
+		fmt.Fprintf(stdout, "Added %q to %s. Restart Claude Desktop to pick it up.\n", clientConfigServerName, *configPath)
+		return exitOK
+	}
+
+	data, _ := json.MarshalIndent(snippet, "", "  ")
+	fmt.Fprintln(stdout, string(data))
+	// Keep stdout pasteable; the hint goes to stderr
+	fmt.Fprintln(stderr, instructions)
+	return exitOK
+}
+
+func (s *Server) handleGenerateClientConfig(ctx context.Context, args map[string]interface{}) CallToolResult {
+	target, _ := args["target"].(string)
+
+	// The client should start the server the same way this one was started
+	snippet, instructions, err := buildClientConfig(target, serverCommand(), os.Args[1:])
+	if err != nil {
+		return errorFailure(err, codeValidationFailed, nil)
+	}
+
+	data, _ := json.MarshalIndent(snippet, "", "  ")
+	return CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: fmt.Sprintf("%s\n\n%s", data, instructions)}},
+	}
+}
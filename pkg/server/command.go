@@ -0,0 +1,333 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yourusername/mcp-api-keys-server/version"
+)
+
+// Execute runs the mcp-api-keys-server command with args, the program name
+// first: one of the CLI commands when the arguments name one, and otherwise
+// the server on stdin and stdout, configured by the command-line flags,
+// until stdin is closed or ctx is done. It returns the process's exit code;
+// exiting and signal handling are left to the caller.
+func Execute(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if code, ok := runCommand(args[1:], stdout, stderr); ok {
+		return code
+	}
+
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	pageSize := flags.Int("page-size", defaultPageSize, "Number of entries per page in tools/list and resources/list")
+	maxMessageSize := flags.Int("max-message-size", defaultMaxMessageSize, "Largest message accepted from the client, in bytes")
+	maxConcurrency := flags.Int("max-concurrency", defaultMaxConcurrency, "Maximum number of requests handled at the same time")
+	instructionsFile := flags.String("instructions-file", "", "File whose contents replace the default instructions sent to clients (empty file sends none)")
+	requestTimeout := flags.Duration("request-timeout", defaultRequestTimeout, "Longest a single request may run before it fails with a timeout")
+	auditLogPath := flags.String("audit-log", "", "Append a JSON line to this file for every secret access")
+	auditOutput := flags.String("audit-output", "", "Comma-separated audit outputs: file (the --audit-log file, the default when it is set), syslog and windows-eventlog")
+	auditLogMaxSize := flags.Int64("audit-log-max-size", defaultAuditLogMaxSize, "Size in bytes at which the audit log is moved to <path>.1 and started afresh")
+	exposeAuditLog := flags.Bool("expose-audit-log", false, "Offer the read_audit_log tool so clients can read the audit log")
+	signAuditLog := flags.Bool("sign-audit-log", false, "Chain and sign audit log entries with the key in MCP_AUDIT_HMAC_KEY, so verify-audit-log can detect tampering")
+	configPath := flags.String("config", "", "JSON configuration file")
+	watchEnv := flags.Bool("watch-env", true, "Reload .env when it changes, so keys added while the server runs are seen")
+	watchEnvAll := flags.Bool("watch-env-all", false, "Apply every variable from a reloaded .env, not just those of registered keys")
+	stateFilePath := flags.String("state-file", os.Getenv("MCP_STATE_FILE"), "JSON file where state that outlives the server, such as key rotation dates, is kept (default from MCP_STATE_FILE)")
+	tenantsPath := flags.String("tenants", "", "JSON file mapping the tokens clients send in initialize to tenants, each with its own env prefix or env file; sessions without a valid token are refused")
+	policyPath := flags.String("policy", "", "JSON policy file setting reveal, check_only or hidden per category and key")
+	revealAllow := flags.String("reveal-allow", "", "Comma-separated key names or glob patterns that may be revealed; all others are check-only")
+	revealDeny := flags.String("reveal-deny", "", "Comma-separated key names or glob patterns that may never be revealed; wins over --reveal-allow")
+	revealRate := flags.String("reveal-rate", "", "Most reveals of each key, such as 10/min; per-key rates can be set in the config file (default unlimited)")
+	revealBudget := flags.Int("reveal-budget", 0, "Most distinct keys one session may reveal (default unlimited)")
+	readOnly := flags.Bool("read-only", readOnlyFromEnv(), "Disable every tool that reveals key values (default from MCP_READ_ONLY=1)")
+	enableTools := flags.String("enable-tools", "", "Comma-separated tool names or glob patterns to offer; all others are left out as if they didn't exist")
+	disableTools := flags.String("disable-tools", "", "Comma-separated tool names or glob patterns to leave out as if they didn't exist; wins over --enable-tools")
+	revealWebhook := flags.String("reveal-webhook", "", "URL to POST an event to when a sensitive key is revealed, signed with MCP_REVEAL_WEBHOOK_SECRET")
+	revealWebhookOn := flags.String("reveal-webhook-on", webhookOnRestricted, "Which reveals are sent to --reveal-webhook: restricted or all")
+	allowNetwork := flags.Bool("allow-network", false, "Offer tools that contact providers and services, such as check_token_scopes and check_database_connection")
+	breakGlassEnabled := flags.Bool("break-glass-enabled", false, "Let get_api_key reveal a key the access policy denies when called with a justification, audited at alert level")
+	breakGlassMinLength := flags.Int("break-glass-min-length", defaultBreakGlassMinLength, "Fewest characters a break-glass justification must have")
+	blockLiveReveal := flags.Bool("block-live-reveal", false, "Refuse to reveal production keys, such as Stripe sk_live_ keys, unless get_api_key is called with confirm_live")
+	jwtMaxExpiry := flags.Duration("jwt-max-expiry", defaultJWTMaxExpiry, "Longest lifetime mint_test_jwt may give a token")
+	metricsListen := flags.String("metrics-listen", "", "Serve Prometheus metrics at /metrics on this address, such as 127.0.0.1:9464 (default off)")
+	upstream := flags.String("upstream", "", "MCP server to ask about keys this one doesn't know: a command run over stdio, or an http(s) URL")
+	allowWrites := flags.Bool("allow-writes", false, "Let tools change files such as .env when asked to")
+	allowExec := flags.Bool("allow-exec", false, "Let tools run external commands such as the gh CLI when asked to")
+	dryRun := flags.Bool("dry-run", dryRunFromEnv(), "Return stable fake values from get_api_key instead of real keys (default from MCP_DRY_RUN=1)")
+	maskStyle := flags.String("mask-style", "", "How value previews look: prefix (the default), suffix, none (always ****) or fixed (--mask-chars asterisks); default from MCP_MASK_STYLE")
+	recordPath := flags.String("record", "", "Append every message read and written to this file as JSON lines, with key values redacted, for the replay command")
+	sanitize := flags.Bool("sanitize-values", sanitizeFromEnv(), "Strip surrounding whitespace and wrapping quotes from key values as they are read (default from MCP_SANITIZE_VALUES, on unless 0)")
+	maskChars := flags.Int("mask-chars", 0, fmt.Sprintf("Most characters a prefix or suffix preview shows, or the asterisks of a fixed one (default %d, or MCP_MASK_CHARS)", defaultMaskChars))
+	plainOutput := flags.Bool("plain-output", os.Getenv("MCP_PLAIN_OUTPUT") == "1", "Use [ok]/[missing] markers and plain headings instead of emoji in tool output (default from MCP_PLAIN_OUTPUT=1)")
+	showVersion := flags.Bool("version", false, "Print the version and build information and exit")
+	selfTest := flags.Bool("self-test", false, "Run a scripted session against the server in dry-run mode, print a pass/fail report and exit")
+	selfTestJSON := flags.Bool("self-test-json", false, "Like --self-test, but print the report as JSON")
+	logLevel := flags.String("log-level", "info", "Minimum level of diagnostics written to stderr: debug, info, warn or error")
+	logFormat := flags.String("log-format", "text", "Format of diagnostics written to stderr: text or json")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s [flags] | <command> [arguments]\n\nFlags:\n", args[0])
+		flags.PrintDefaults()
+		fmt.Fprint(stderr, commandUsage)
+	}
+	if err := flags.Parse(args[1:]); errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	} else if err != nil {
+		return exitUsageErr
+	}
+
+	if *showVersion {
+		fmt.Fprintf(stdout, "%s %s\n", serverName, version.String())
+		return exitOK
+	}
+
+	logger, err := newDiagnosticLogger(stderr, *logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsageErr
+	}
+
+	if *selfTest || *selfTestJSON {
+		return runSelfTest(logger, stdout, *selfTestJSON)
+	}
+
+	server := New(stdin, stdout, WithLogger(logger))
+	logger = server.logger
+	if server.keys.sanitizeValues != *sanitize {
+		server.keys.sanitizeValues = *sanitize
+		server.keys.resolveAll()
+	}
+	if *pageSize > 0 {
+		server.pageSize = *pageSize
+	}
+	if *maxMessageSize > 0 {
+		server.maxMessageSize = *maxMessageSize
+	}
+	if *maxConcurrency > 0 {
+		server.workers = make(chan struct{}, *maxConcurrency)
+	}
+	server.readOnly = *readOnly
+	server.dryRun = *dryRun
+	server.allowExec = *allowExec
+	server.allowNetwork = *allowNetwork
+	server.allowWrites = *allowWrites
+	if *upstream != "" {
+		server.upstream = newUpstreamClient(*upstream)
+	}
+	server.blockLiveReveal = *blockLiveReveal
+	if *breakGlassMinLength < 1 {
+		logger.Error("invalid break-glass settings: --break-glass-min-length must be at least 1")
+		return exitFailure
+	}
+	server.breakGlass = breakGlass{enabled: *breakGlassEnabled, minLength: *breakGlassMinLength}
+	if *jwtMaxExpiry > 0 {
+		server.jwtMaxExpiry = *jwtMaxExpiry
+	}
+
+	var config fileConfig
+	if *configPath != "" {
+		if config, err = loadFileConfig(*configPath); err != nil {
+			logger.Error("failed to load config file", "error", err)
+			return exitFailure
+		}
+	}
+	if err := server.keys.addPlaceholderPatterns(config.PlaceholderPatterns); err != nil {
+		logger.Error("invalid config file", "error", err)
+		return exitFailure
+	}
+	if err := server.keys.registerComposite(config.CompositeKeys); err != nil {
+		logger.Error("invalid config file", "error", err)
+		return exitFailure
+	}
+	if err := server.keys.markNeverReveal(config.NeverReveal); err != nil {
+		logger.Error("invalid config file", "error", err)
+		return exitFailure
+	}
+	if err := addKeyGuides(server.keys, config.KeyGuides); err != nil {
+		logger.Error("invalid config file", "error", err)
+		return exitFailure
+	}
+	if err := addHTTPValidations(server.keys, config.Validations); err != nil {
+		logger.Error("invalid config file", "error", err)
+		return exitFailure
+	}
+	if err := server.keys.addKeyInferences(config.KeyInference); err != nil {
+		logger.Error("invalid config file", "error", err)
+		return exitFailure
+	}
+	// The flags win over the config file, which wins over the environment
+	for _, configure := range []func() error{
+		server.keys.mask.configureFromEnv,
+		func() error { return server.keys.mask.configure(config.MaskStyle, config.MaskChars) },
+		func() error { return server.keys.mask.configure(*maskStyle, *maskChars) },
+	} {
+		if err := configure(); err != nil {
+			logger.Error("invalid masking settings", "error", err)
+			return exitFailure
+		}
+	}
+	server.warnEnvConflicts()
+	if err := server.keys.rotations.configure(server.keys, config); err != nil {
+		logger.Error("invalid config file", "error", err)
+		return exitFailure
+	}
+	if *stateFilePath != "" {
+		if err := server.keys.rotations.load(*stateFilePath); err != nil {
+			logger.Error("failed to load state file", "error", err)
+			return exitFailure
+		}
+		server.snapshotDir = filepath.Join(filepath.Dir(*stateFilePath), "snapshots")
+	}
+	policy, err := newRevealPolicy(
+		append(config.RevealAllow, splitPatterns(*revealAllow)...),
+		append(config.RevealDeny, splitPatterns(*revealDeny)...),
+	)
+	if err != nil {
+		logger.Error("invalid reveal policy", "error", err)
+		return exitFailure
+	}
+	server.revealPolicy = policy
+	filter, err := newToolFilter(
+		append(config.EnableTools, splitPatterns(*enableTools)...),
+		append(config.DisableTools, splitPatterns(*disableTools)...),
+	)
+	if err != nil {
+		logger.Error("invalid tool filter", "error", err)
+		return exitFailure
+	}
+	server.tools.setFilter(filter)
+	for _, pattern := range filter.unmatched(server.tools.names()) {
+		logger.Warn("tool pattern matches no tool", "pattern", pattern)
+	}
+	if *revealBudget > 0 {
+		server.revealBudget.limit = *revealBudget
+	}
+	if *revealRate != "" || len(config.RevealRates) > 0 {
+		limiter, err := newRevealLimiterFromConfig(server.keys, *revealRate, config.RevealRates)
+		if err != nil {
+			logger.Error("invalid reveal rate", "error", err)
+			return exitFailure
+		}
+		server.revealLimiter = limiter
+	}
+	if *policyPath != "" {
+		if server.accessPolicy, err = loadAccessPolicy(server.keys, *policyPath); err != nil {
+			logger.Error("failed to load policy file", "error", err)
+			return exitFailure
+		}
+		server.keys.hide(server.accessPolicy)
+	}
+	if *tenantsPath != "" {
+		if server.tenants, err = loadTenants(*tenantsPath); err != nil {
+			logger.Error("failed to load tenants file", "error", err)
+			return exitFailure
+		}
+	}
+	if *revealWebhook != "" {
+		if server.revealWebhook, err = newRevealWebhook(*revealWebhook, *revealWebhookOn, webhookSecretFromEnv(), logger); err != nil {
+			logger.Error("invalid reveal webhook", "error", err)
+			return exitFailure
+		}
+		server.auditSinks = append(server.auditSinks, webhookSink{server.revealWebhook, server.keys})
+	}
+	if *plainOutput {
+		server.markers = plainMarkers
+	}
+	outputs := map[string]bool{auditOutputFile: *auditLogPath != ""}
+	if *auditOutput != "" {
+		names, err := parseAuditOutputs(*auditOutput)
+		if err != nil {
+			logger.Error("invalid audit output", "error", err)
+			return exitFailure
+		}
+		outputs = map[string]bool{}
+		for _, name := range names {
+			outputs[name] = true
+		}
+	}
+	if outputs[auditOutputFile] != (*auditLogPath != "") {
+		logger.Error("invalid audit output: --audit-log and the file output in --audit-output go together")
+		return exitFailure
+	}
+	if outputs[auditOutputSyslog] {
+		sink, err := newSyslogSink()
+		if err != nil {
+			logger.Error("failed to connect to syslog", "error", err)
+			return exitFailure
+		}
+		server.auditSinks = append(server.auditSinks, newQueuedSink(sink, logger))
+	}
+	if outputs[auditOutputWindowsEvent] {
+		logger.Error("invalid audit output: windows-eventlog isn't supported by this build")
+		return exitFailure
+	}
+	if *auditLogPath != "" {
+		auditLog, err := openAuditLog(*auditLogPath, *auditLogMaxSize)
+		if err != nil {
+			logger.Error("failed to open audit log", "path", *auditLogPath, "error", err)
+			return exitFailure
+		}
+		if *signAuditLog {
+			key, err := auditHMACKey()
+			if err == nil {
+				err = auditLog.sign(key)
+			}
+			if err != nil {
+				logger.Error("failed to sign audit log", "path", *auditLogPath, "error", err)
+				return exitFailure
+			}
+		}
+		server.auditLog = auditLog
+		server.auditSinks = append(server.auditSinks, auditLog)
+		server.exposeAuditLog = *exposeAuditLog
+	}
+	if *recordPath != "" {
+		recorder, err := openRecorder(server.keys, *recordPath)
+		if err != nil {
+			logger.Error("failed to open recording", "path", *recordPath, "error", err)
+			return exitFailure
+		}
+		server.recorder = recorder
+	}
+	if *requestTimeout > 0 {
+		server.requestTimeout = *requestTimeout
+	}
+	if *instructionsFile != "" {
+		data, err := os.ReadFile(*instructionsFile)
+		if err != nil {
+			logger.Error("failed to read instructions file", "path", *instructionsFile, "error", err)
+			return exitFailure
+		}
+		server.instructions = strings.TrimSpace(string(data))
+	}
+
+	if *watchEnv {
+		server.envWatcher = newEnvWatcher(".env", server.keys, *watchEnvAll, logger, server.notifySubscribers)
+	}
+
+	server.tracer = newTracerFromEnv(logger)
+
+	if *metricsListen != "" {
+		server.metrics = newServerMetrics()
+		metricsServer, err := startMetricsServer(*metricsListen, server.metrics, logger)
+		if err != nil {
+			logger.Error("failed to serve metrics", "address", *metricsListen, "error", err)
+			return exitFailure
+		}
+		server.metricsServer = metricsServer
+	}
+
+	logger.Info("starting "+serverName, "version", version.Version, "commit", version.Commit, "keys", server.keys.count(), "read_only", server.readOnly, "dry_run", server.dryRun)
+	if err := server.ServeStdio(ctx); errors.Is(err, context.Canceled) {
+		logger.Info("shut down", "reason", "signal")
+	} else if err != nil {
+		logger.Error("server stopped", "error", err)
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/yourusername/mcp-api-keys-server/internal/protocol"
+)
+
+// maxCompletionValues is the most values a completion result may carry.
+const maxCompletionValues = 100
+
+// CompleteParams are the params of completion/complete.
+type CompleteParams struct {
+	Ref      CompletionRef      `json:"ref"`
+	Argument CompletionArgument `json:"argument"`
+}
+
+// CompletionRef names what is being completed. The spec defines ref/prompt
+// and ref/resource; ref/tool is also accepted for clients that complete tool
+// arguments.
+type CompletionRef struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+	URI  string `json:"uri,omitempty"`
+}
+
+// CompletionArgument is the argument being completed and its partial value.
+type CompletionArgument struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Completion lists the suggested values for an argument.
+type Completion struct {
+	Values  []string `json:"values"`
+	Total   int      `json:"total,omitempty"`
+	HasMore bool     `json:"hasMore,omitempty"`
+}
+
+// CompleteResult is the result of completion/complete.
+type CompleteResult struct {
+	Completion Completion `json:"completion"`
+}
+
+// completionSources maps "<ref type>/<name>/<argument>" to the candidate
+// values for that argument.
+var completionSources = map[string]func(s *Server) []string{
+	"ref/tool/get_api_key/key_name":                  registeredKeyNames,
+	"ref/tool/check_api_key_exists/key_name":         registeredKeyNames,
+	"ref/tool/key_fingerprint/key_name":              registeredKeyNames,
+	"ref/tool/check_token_scopes/key_name":           func(*Server) []string { return scopeKeys },
+	"ref/tool/validate_api_key_live/key_name":        func(s *Server) []string { return s.keys.liveValidatedKeys() },
+	"ref/tool/provider_usage/key_name":               func(*Server) []string { return usageKeys() },
+	"ref/tool/check_database_connection/key_name":    registeredKeyNames,
+	"ref/tool/check_redis_connection/key_name":       registeredKeyNames,
+	"ref/tool/list_api_keys/category":                func(*Server) []string { return categoryNames },
+	"ref/tool/list_api_keys/format":                  func(*Server) []string { return listFormats },
+	"ref/tool/fill_template/escape":                  func(*Server) []string { return templateEscapes },
+	"ref/tool/generate_k8s_secret/category":          func(*Server) []string { return categoryNames },
+	"ref/tool/generate_compose_env/category":         func(*Server) []string { return categoryNames },
+	"ref/tool/generate_compose_env/format":           func(*Server) []string { return composeFormats },
+	"ref/tool/generate_gh_secrets_commands/category": func(*Server) []string { return categoryNames },
+	"ref/tool/generate_gh_secrets_commands/app":      func(*Server) []string { return ghSecretApps },
+	"ref/tool/verify_webhook_signature/provider":     func(*Server) []string { return webhookProviderNames },
+	"ref/tool/compute_webhook_signature/provider":    func(*Server) []string { return webhookProviderNames },
+	"ref/tool/rotation_status/category":              func(*Server) []string { return categoryNames },
+	"ref/tool/mark_key_rotated/key_name":             registeredKeyNames,
+	"ref/prompt/rotate_key_checklist/key_name":       registeredKeyNames,
+	"ref/prompt/setup_missing_keys/category":         func(*Server) []string { return categoryNames },
+}
+
+// registeredKeyNames completes key names from the server's registry.
+func registeredKeyNames(s *Server) []string {
+	return s.keys.names()
+}
+
+func (s *Server) handleComplete(id json.RawMessage, params CompleteParams) protocol.Response {
+	// Unknown refs get an empty completion rather than an error, so clients
+	// can ask about any argument.
+	completion := Completion{Values: []string{}}
+
+	source, ok := completionSources[params.Ref.Type+"/"+params.Ref.Name+"/"+params.Argument.Name]
+	if ok {
+		prefix := strings.ToLower(params.Argument.Value)
+		for _, candidate := range source(s) {
+			if strings.HasPrefix(strings.ToLower(candidate), prefix) {
+				completion.Values = append(completion.Values, candidate)
+			}
+		}
+		completion.Total = len(completion.Values)
+		if completion.Total > maxCompletionValues {
+			completion.Values = completion.Values[:maxCompletionValues]
+			completion.HasMore = true
+		}
+	}
+
+	return protocol.Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  CompleteResult{Completion: completion},
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// composeFormats are the ways generate_compose_env can pass keys to a
+// service.
+var composeFormats = []string{"environment", "env_file"}
+
+// composeQuote renders value as a double-quoted YAML scalar for a Compose
+// file. Compose interpolates "$" in values, so it is doubled to stay literal.
+func composeQuote(value string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	// A JSON string is a valid double-quoted YAML scalar
+	encoder.Encode(strings.ReplaceAll(value, "$", "$$"))
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func (s *Server) handleGenerateComposeEnv(ctx context.Context, args map[string]interface{}) CallToolResult {
+	format := "environment"
+	if f, ok := args["format"].(string); ok && f != "" {
+		format = f
+	}
+	service, _ := args["service"].(string)
+	if service == "" {
+		service = "app"
+	}
+	includeValues, _ := args["include_values"].(bool)
+	withDotEnv, _ := args["dotenv"].(bool)
+
+	keyNames, err := s.keys.selectedKeys(args)
+	if err != nil {
+		return errorFailure(err, codeValidationFailed, nil)
+	}
+
+	// Values are only looked up when asked for, and then under the same
+	// rules as get_api_key; refused keys fall back to a placeholder
+	var envVars, skipped []string
+	values := map[string]string{}
+	revealed := 0
+	for _, keyName := range keyNames {
+		config, _ := s.keys.config(keyName)
+		if slices.Contains(envVars, config.EnvVars()[0]) {
+			continue
+		}
+		envVars = append(envVars, config.EnvVars()...)
+		if !includeValues {
+			continue
+		}
+		value, reason := s.revealForTool(ctx, keyName)
+		if reason != "" {
+			skipped = append(skipped, fmt.Sprintf("%s (%s): %s", keyName, config.EnvLabel(), reason))
+			continue
+		}
+		revealed++
+		for envVar, memberValue := range keyEnvValues(config, value) {
+			values[envVar] = memberValue
+		}
+	}
+	if revealed > 0 {
+		s.noteAudit(ctx, "info", fmt.Sprintf("generate_compose_env included the values of %d API keys", revealed))
+	}
+
+	var compose strings.Builder
+	compose.WriteString(fmt.Sprintf("services:\n  %s:\n", service))
+	switch format {
+	case "env_file":
+		compose.WriteString("    env_file:\n      - .env\n")
+	default:
+		compose.WriteString("    environment:\n")
+		for _, envVar := range envVars {
+			if value, ok := values[envVar]; ok {
+				compose.WriteString(fmt.Sprintf("      %s: %s\n", envVar, composeQuote(value)))
+			} else {
+				compose.WriteString(fmt.Sprintf("      %s: ${%s}\n", envVar, envVar))
+			}
+		}
+	}
+	if len(skipped) > 0 {
+		compose.WriteString("# Values not included:\n")
+		for _, line := range skipped {
+			compose.WriteString(fmt.Sprintf("#   %s\n", line))
+		}
+	}
+
+	result := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: compose.String()}},
+	}
+	// The .env file names the same variables, so the two stay in sync
+	if withDotEnv || format == "env_file" {
+		var dotEnv strings.Builder
+		for _, envVar := range envVars {
+			if value, ok := values[envVar]; ok {
+				dotEnv.WriteString(fmt.Sprintf("%s=%s\n", envVar, formatEnvValue(value, 0)))
+			} else {
+				dotEnv.WriteString(fmt.Sprintf("%s=\n", envVar))
+			}
+		}
+		result.Content = append(result.Content, ContentBlock{Type: "text", Text: dotEnv.String()})
+	}
+	if s.dryRun && len(values) > 0 {
+		result.Content = append([]ContentBlock{{Type: "text", Text: dryRunNotice}}, result.Content...)
+	}
+	return result
+}
@@ -0,0 +1,69 @@
+package server_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/joho/godotenv"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+func TestComposeQuote(t *testing.T) {
+	for _, test := range []struct {
+		value, want string
+	}{
+		{"plain", `"plain"`},
+		{"a$b", `"a$$b"`},
+		{"${HOME}", `"$${HOME}"`},
+		{"$$", `"$$$$"`},
+		{"host:port", `"host:port"`},
+		{"key: value", `"key: value"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"it's", `"it's"`},
+		{`back\slash`, `"back\\slash"`},
+		{"a #comment", `"a #comment"`},
+		{"- item", `"- item"`},
+		{" padded ", `" padded "`},
+		{"two\nlines", `"two\nlines"`},
+		{"tab\there", `"tab\there"`},
+		{"<&>", `"<&>"`},
+		{"yes", `"yes"`},
+		{"", `""`},
+		{"é", `"é"`},
+	} {
+		got := server.ComposeQuote(test.value)
+		if got != test.want {
+			t.Errorf("ComposeQuote(%q) = %s, want %s", test.value, got, test.want)
+		}
+		// A double-quoted YAML scalar without YAML-only escapes reads as a
+		// JSON string, and Compose turns $$ back into $
+		var decoded string
+		if err := json.Unmarshal([]byte(got), &decoded); err != nil || strings.ReplaceAll(decoded, "$$", "$") != test.value {
+			t.Errorf("ComposeQuote(%q) = %s reads back as %q, %v", test.value, got, decoded, err)
+		}
+	}
+}
+
+func TestComposeEnvQuotesValues(t *testing.T) {
+	value := `sk-proj-a$b:c"d'e#f\g`
+	testmcp.SetKeys(t, map[string]string{"openai": value})
+	c := newClient(t)
+
+	result, err := c.CallTool("generate_compose_env", map[string]interface{}{"keys": []string{"openai"}, "include_values": true, "dotenv": true})
+	if err != nil || result.IsError || len(result.Content) != 2 {
+		t.Fatalf("generate_compose_env = %+v, %v", result, err)
+	}
+	want := `      OPENAI_API_KEY: "sk-proj-a$$b:c\"d'e#f\\g"` + "\n"
+	if !strings.Contains(result.Content[0].Text, want) {
+		t.Errorf("compose file = %s, want a line %s", result.Content[0].Text, want)
+	}
+
+	// The .env file holds the same value
+	dotEnv, err := godotenv.Unmarshal(result.Content[1].Text)
+	if err != nil || dotEnv["OPENAI_API_KEY"] != value {
+		t.Errorf(".env file %q reads as %q, %v; want %q", result.Content[1].Text, dotEnv["OPENAI_API_KEY"], err, value)
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/registry"
+)
+
+// memberStatus is the configured state of one member of a composite key.
+type memberStatus struct {
+	Role       string `json:"role"`
+	EnvVar     string `json:"env_var"`
+	Configured bool   `json:"configured"`
+	// Empty is set when the variable is defined with no value.
+	Empty bool `json:"empty,omitempty"`
+}
+
+// unsetLabel names the environment variables of a key that still need a
+// value: all of them for a plain key, the missing members of a composite.
+func (k *keyRegistry) unsetLabel(c registry.APIKeyConfig) string {
+	if !c.IsComposite() {
+		return c.EnvVar
+	}
+	var unset []string
+	for _, member := range k.memberStatuses(c) {
+		if !member.Configured {
+			unset = append(unset, member.EnvVar)
+		}
+	}
+	return strings.Join(unset, ", ")
+}
+
+// compositeValue returns the value of a composite key: a JSON object of
+// every member's value by role, or "" unless all members are set. Each
+// member is redacted on its own.
+func (k *keyRegistry) compositeValue(name string, config registry.APIKeyConfig) string {
+	values := map[string]string{}
+	complete := true
+	for _, member := range config.Members {
+		value := k.resolvedEnv(member.EnvVar)
+		k.secrets.remember(name, value)
+		values[member.Role] = value
+		complete = complete && value != ""
+	}
+	if !complete {
+		return ""
+	}
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+// memberStatuses returns the configured state of each member of a
+// composite key, in registry order.
+func (k *keyRegistry) memberStatuses(config registry.APIKeyConfig) []memberStatus {
+	statuses := make([]memberStatus, len(config.Members))
+	for i, member := range config.Members {
+		_, set := k.lookupEnv(member.EnvVar)
+		value := k.resolvedEnv(member.EnvVar)
+		statuses[i] = memberStatus{Role: member.Role, EnvVar: member.EnvVar, Configured: value != "", Empty: set && value == ""}
+	}
+	return statuses
+}
+
+// keyEnvValues splits a value returned by keyRegistry.lookup into the value
+// of each environment variable the key is read from.
+func keyEnvValues(config registry.APIKeyConfig, value string) map[string]string {
+	if !config.IsComposite() {
+		return map[string]string{config.EnvVar: value}
+	}
+	var byRole map[string]string
+	json.Unmarshal([]byte(value), &byRole)
+	values := map[string]string{}
+	for _, member := range config.Members {
+		if v, ok := byRole[member.Role]; ok {
+			values[member.EnvVar] = v
+		}
+	}
+	return values
+}
+
+// registerComposite adds composite keys, such as those defined in the
+// config file, to the registry. Nothing is added unless every key is valid.
+func (k *keyRegistry) registerComposite(keys map[string]registry.APIKeyConfig) error {
+	for name, config := range keys {
+		if _, exists := k.config(name); exists {
+			return fmt.Errorf("composite key %s: %w", name, ErrKeyExists)
+		}
+		if config.Category == "all" || !validCategory(config.Category) {
+			return fmt.Errorf("composite key %s: unknown category %q", name, config.Category)
+		}
+		if config.EnvVar != "" || len(config.EnvVarAliases) > 0 {
+			return fmt.Errorf("composite key %s: set members instead of env_var", name)
+		}
+		if config.ValueKind != "" {
+			return fmt.Errorf("composite key %s: value_kind can't be set on a composite key", name)
+		}
+		if len(config.Members) < 2 {
+			return fmt.Errorf("composite key %s: needs at least two members", name)
+		}
+		roles := map[string]bool{}
+		for _, member := range config.Members {
+			if member.Role == "" || member.EnvVar == "" {
+				return fmt.Errorf("composite key %s: every member needs a role and an env_var", name)
+			}
+			if roles[member.Role] {
+				return fmt.Errorf("composite key %s: role %s appears twice", name, member.Role)
+			}
+			roles[member.Role] = true
+		}
+	}
+	for name, config := range keys {
+		if err := k.add(name, config); err != nil {
+			return fmt.Errorf("composite key %s: %w", name, ErrKeyExists)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/registry"
+)
+
+// fileConfig is the optional JSON configuration file given with --config.
+// Command-line flags add to what it sets.
+type fileConfig struct {
+	// RevealAllow and RevealDeny are key name patterns; see revealPolicy.
+	RevealAllow []string `json:"reveal_allow"`
+	RevealDeny  []string `json:"reveal_deny"`
+	// EnableTools and DisableTools are tool name patterns; see toolFilter.
+	EnableTools  []string `json:"enable_tools"`
+	DisableTools []string `json:"disable_tools"`
+	// RevealRates overrides --reveal-rate for individual keys, for example
+	// {"stripe": "2/min"}.
+	RevealRates map[string]string `json:"reveal_rates"`
+	// PlaceholderPatterns are regular expressions added to the defaults in
+	// defaultPlaceholderPatterns. Each must match a whole value.
+	PlaceholderPatterns []string `json:"placeholder_patterns"`
+	// CompositeKeys registers keys made of several variables, such as
+	// {"supabase": {"description": ..., "category": "internal", "members":
+	// [{"role": "url", "env_var": "SUPABASE_URL"}, ...]}}.
+	CompositeKeys map[string]registry.APIKeyConfig `json:"composite_keys"`
+	// NeverReveal sets reveal: false on registered keys, such as the
+	// built-in ones, whose config the file can't otherwise change.
+	NeverReveal []string `json:"never_reveal"`
+	// KeyGuides overrides or adds to the built-in guides how_to_obtain_key
+	// returns, field by field.
+	KeyGuides map[string]keyGuide `json:"key_guides"`
+	// Validations declares how validate_api_key_live checks keys against
+	// the operator's own services, such as {"internal_api": {"url":
+	// "https://api.internal/v1/whoami", "headers": {"X-API-Key":
+	// "{{value}}"}}}.
+	Validations map[string]httpValidation `json:"validations"`
+	// KeyInference adds name patterns, ahead of the built-in ones, that
+	// guess the category and description of unregistered variables, such
+	// as {"pattern": "ACME_*", "category": "internal", "description":
+	// "Acme platform credential"}.
+	KeyInference []keyInference `json:"key_inference"`
+	// MaskStyle and MaskChars set how values are previewed, unless
+	// --mask-style and --mask-chars say otherwise.
+	MaskStyle string `json:"mask_style"`
+	MaskChars int    `json:"mask_chars"`
+	// RotatedAt records when keys were last rotated, as dates such as
+	// "2026-01-31"; mark_key_rotated records later rotations in the state
+	// file.
+	RotatedAt map[string]string `json:"rotated_at"`
+	// MaxAgeDays is how long any key may go unrotated (default 90), and
+	// KeyMaxAgeDays overrides it per key.
+	MaxAgeDays    int            `json:"max_age_days"`
+	KeyMaxAgeDays map[string]int `json:"key_max_age_days"`
+}
+
+// loadFileConfig reads a configuration file, rejecting unknown fields so a
+// misspelled setting doesn't silently do nothing.
+func loadFileConfig(path string) (fileConfig, error) {
+	var config fileConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return config, nil
+}
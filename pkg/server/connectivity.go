@@ -0,0 +1,214 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// connectTimeout bounds the dial, and the Redis PING, of a connectivity
+// check.
+const connectTimeout = 5 * time.Second
+
+// databasePorts are the default ports of the database URL schemes
+// check_database_connection understands.
+var databasePorts = map[string]string{
+	"postgres":   "5432",
+	"postgresql": "5432",
+	"mysql":      "3306",
+	"mariadb":    "3306",
+	"sqlserver":  "1433",
+	"mongodb":    "27017",
+}
+
+// redisPorts are the default ports of the Redis URL schemes; rediss is
+// Redis over TLS.
+var redisPorts = map[string]string{
+	"redis":  "6379",
+	"rediss": "6379",
+}
+
+// connectionResult is the outcome of a connectivity check. Target is only
+// host:port, so credentials in the URL never reach the client.
+type connectionResult struct {
+	Key       string `json:"key"`
+	Target    string `json:"target,omitempty"`
+	Reachable bool   `json:"reachable"`
+	LatencyMS int64  `json:"latency_ms,omitempty"`
+	// Ping is the Redis server's reply to PING, when one was sent.
+	Ping   string `json:"ping,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// connectionResultSchema describes the structured result of the connection
+// checks.
+var connectionResultSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"key":        {Type: "string", Description: "Name of the key holding the URL"},
+		"target":     {Type: "string", Description: "host:port that was dialled"},
+		"reachable":  {Type: "boolean", Description: "Whether the server accepted the connection (and, for Redis with ping, answered PING)"},
+		"latency_ms": {Type: "integer", Description: "Time to connect, or to connect and PING, in milliseconds"},
+		"ping":       {Type: "string", Description: "The Redis server's reply to PING"},
+		"detail":     {Type: "string", Description: "Why the target is unreachable or couldn't be checked"},
+	},
+	Required: []string{"key", "reachable"},
+}
+
+// connectionTarget parses the URL held by a key into its scheme and
+// host:port. Parse errors quote the URL, password included, so they are
+// never passed on.
+func connectionTarget(value string, ports map[string]string) (*url.URL, string, error) {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Host == "" {
+		return nil, "", fmt.Errorf("the value is not a URL of the form scheme://host:port/...")
+	}
+	port, known := ports[parsed.Scheme]
+	if !known {
+		return nil, "", fmt.Errorf("unsupported scheme %q", parsed.Scheme)
+	}
+	if parsed.Port() != "" {
+		port = parsed.Port()
+	}
+	return parsed, net.JoinHostPort(parsed.Hostname(), port), nil
+}
+
+// dialTarget opens a TCP connection, over TLS when useTLS is set.
+func dialTarget(ctx context.Context, target string, useTLS bool) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	if useTLS {
+		host, _, _ := net.SplitHostPort(target)
+		return (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", target)
+	}
+	return dialer.DialContext(ctx, "tcp", target)
+}
+
+// respCommand encodes a Redis command in RESP.
+func respCommand(args ...string) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, arg := range args {
+		b.WriteString(fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg))
+	}
+	return b.String()
+}
+
+// redisPing authenticates with the URL's credentials, if any, and sends
+// PING, returning the server's reply.
+func redisPing(conn net.Conn, parsed *url.URL) (string, error) {
+	conn.SetDeadline(time.Now().Add(connectTimeout))
+	reader := bufio.NewReader(conn)
+	exchange := func(args ...string) (string, error) {
+		if _, err := conn.Write([]byte(respCommand(args...))); err != nil {
+			return "", err
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "-") {
+			return "", fmt.Errorf("Redis replied %s", strings.TrimPrefix(line, "-"))
+		}
+		return strings.TrimPrefix(line, "+"), nil
+	}
+
+	if password, ok := parsed.User.Password(); ok {
+		auth := []string{"AUTH", password}
+		if user := parsed.User.Username(); user != "" {
+			auth = []string{"AUTH", user, password}
+		}
+		if _, err := exchange(auth...); err != nil {
+			return "", err
+		}
+	}
+	return exchange("PING")
+}
+
+// checkConnection dials the URL held by keyName and, for Redis with ping
+// set, sends PING.
+func (s *Server) checkConnection(ctx context.Context, keyName string, ports map[string]string, ping bool) connectionResult {
+	config, value, exists := s.keys.lookup(keyName)
+	result := connectionResult{Key: keyName}
+	switch {
+	case !exists:
+		result.Detail = "unknown key"
+		return result
+	case value == "":
+		result.Detail = fmt.Sprintf("not configured, set %s", s.keys.unsetLabel(config))
+		return result
+	}
+	parsed, target, err := connectionTarget(value, ports)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	result.Target = target
+
+	start := time.Now()
+	conn, err := dialTarget(ctx, target, parsed.Scheme == "rediss")
+	if err != nil {
+		result.Detail = fmt.Sprintf("unreachable: %v", s.keys.secrets.scrubError(err))
+		return result
+	}
+	defer conn.Close()
+	if ping {
+		reply, err := redisPing(conn, parsed)
+		if err != nil {
+			result.Detail = fmt.Sprintf("connected, but PING failed: %v", s.keys.secrets.scrubError(err))
+			return result
+		}
+		result.Ping = reply
+	}
+	result.Reachable = true
+	result.LatencyMS = time.Since(start).Milliseconds()
+	return result
+}
+
+// connectionToolResult renders a connectivity check for the client.
+func (s *Server) connectionToolResult(result connectionResult) CallToolResult {
+	var text string
+	switch {
+	case result.Reachable && result.Ping != "":
+		text = fmt.Sprintf("%s %s: %s is reachable, PING answered %s in %dms", s.markers.status(true), result.Key, result.Target, result.Ping, result.LatencyMS)
+	case result.Reachable:
+		text = fmt.Sprintf("%s %s: %s is reachable (connected in %dms)", s.markers.status(true), result.Key, result.Target, result.LatencyMS)
+	case result.Target != "":
+		text = fmt.Sprintf("%s %s: %s %s", s.markers.status(false), result.Key, result.Target, result.Detail)
+	default:
+		text = fmt.Sprintf("%s %s: %s", s.markers.status(false), result.Key, result.Detail)
+	}
+
+	toolResult := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text}},
+	}
+	if s.supportsStructuredContent() {
+		toolResult.StructuredContent = result
+	}
+	return toolResult
+}
+
+func (s *Server) handleCheckDatabaseConnection(ctx context.Context, args map[string]interface{}) CallToolResult {
+	keyName, _ := args["key_name"].(string)
+	if keyName == "" {
+		keyName = "database_url"
+	}
+	return s.connectionToolResult(s.checkConnection(ctx, keyName, databasePorts, false))
+}
+
+func (s *Server) handleCheckRedisConnection(ctx context.Context, args map[string]interface{}) CallToolResult {
+	keyName, _ := args["key_name"].(string)
+	if keyName == "" {
+		keyName = "redis_url"
+	}
+	ping := true
+	if p, ok := args["ping"].(bool); ok {
+		ping = p
+	}
+	return s.connectionToolResult(s.checkConnection(ctx, keyName, redisPorts, ping))
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// envFileMu serializes edits to .env files made by this process, so two
+// concurrent writes can't both read the old file and lose one update.
+var envFileMu sync.Mutex
+
+// envEntry is one logical line of a .env file: an assignment, possibly
+// spanning several physical lines when a quoted value contains newlines, or
+// anything else (comments, blank lines), which is kept verbatim.
+type envEntry struct {
+	raw string
+	// For assignments: the text before the value ("export KEY=" including
+	// any spacing), the quote character used (0 if unquoted) and whatever
+	// follows the value, such as an inline comment.
+	name   string
+	prefix string
+	quote  byte
+	suffix string
+}
+
+var envAssignment = regexp.MustCompile(`^(\s*(?:export\s+)?([A-Za-z_][A-Za-z0-9_.]*)\s*[=:]\s*)(.*)$`)
+
+// setEnvFileValue sets name to value in the .env file at path, creating the
+// file if needed. Comments, blank lines, export prefixes, quoting style and
+// line endings are preserved; only the assignment to name changes, or a new
+// one is appended. The file is replaced atomically and keeps its mode; see
+// editEnvFile for a file that is encrypted.
+func setEnvFileValue(path, name, value string) error {
+	return editEnvFile(path, func(content string) string {
+		return updateEnvContent(content, name, value)
+	})
+}
+
+// envFileTarget returns the file edits to the .env file at path go to: its
+// encrypted counterpart, such as .env.enc for .env, while there is one,
+// since the keys then come from it, and path otherwise.
+func envFileTarget(path string) string {
+	if _, err := os.Stat(path + ".enc"); err == nil {
+		return path + ".enc"
+	}
+	return path
+}
+
+// editEnvFile replaces the content of the .env file at path with what edit
+// returns for it, creating the file if needed. An encrypted file is edited
+// in memory and encrypted again, so the plaintext is never written to disk.
+func editEnvFile(path string, edit func(content string) string) error {
+	envFileMu.Lock()
+	defer envFileMu.Unlock()
+
+	if target := envFileTarget(path); target != path {
+		return editEncryptedEnv(target, edit)
+	}
+
+	mode := os.FileMode(0600)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if info, statErr := os.Stat(path); statErr == nil {
+			mode = info.Mode().Perm()
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	return writeFileAtomic(path, []byte(edit(string(data))), mode)
+}
+
+// updateEnvContent returns content with name set to value.
+func updateEnvContent(content, name, value string) string {
+	newline := "\n"
+	if strings.Contains(content, "\r\n") {
+		newline = "\r\n"
+	}
+	trailingNewline := content == "" || strings.HasSuffix(content, "\n")
+
+	entries := parseEnvEntries(strings.TrimSuffix(strings.ReplaceAll(content, "\r\n", "\n"), "\n"))
+
+	// Like godotenv, the last assignment wins, so that is the one to update
+	target := -1
+	for i, entry := range entries {
+		if entry.name == name {
+			target = i
+		}
+	}
+
+	if target >= 0 {
+		entry := entries[target]
+		entries[target].raw = entry.prefix + formatEnvValue(value, entry.quote) + entry.suffix
+	} else {
+		if content == "" {
+			entries = nil
+		}
+		entries = append(entries, envEntry{raw: name + "=" + formatEnvValue(value, 0)})
+	}
+
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = entry.raw
+	}
+	result := strings.Join(lines, "\n")
+	// A file that ended without a newline gets one only if a line was
+	// appended, so the new assignment doesn't run into the last line
+	if trailingNewline || target < 0 {
+		result += "\n"
+	}
+	return strings.ReplaceAll(result, "\n", newline)
+}
+
+// parseEnvEntries splits .env content (with \n line endings) into entries.
+func parseEnvEntries(content string) []envEntry {
+	lines := strings.Split(content, "\n")
+	var entries []envEntry
+	for i := 0; i < len(lines); i++ {
+		match := envAssignment.FindStringSubmatch(lines[i])
+		if match == nil || strings.HasPrefix(strings.TrimSpace(lines[i]), "#") {
+			entries = append(entries, envEntry{raw: lines[i]})
+			continue
+		}
+
+		entry := envEntry{raw: lines[i], name: match[2], prefix: match[1]}
+		rest := match[3]
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			entry.quote = rest[0]
+			// A quoted value may run over several lines until its
+			// closing quote
+			end := closingQuote(rest, entry.quote)
+			for end < 0 && i+1 < len(lines) {
+				i++
+				entry.raw += "\n" + lines[i]
+				rest += "\n" + lines[i]
+				end = closingQuote(rest, entry.quote)
+			}
+			if end >= 0 {
+				entry.suffix = rest[end+1:]
+			}
+		} else if comment := strings.Index(rest, " #"); comment >= 0 {
+			entry.suffix = rest[comment:]
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// closingQuote returns the index of the quote closing the value that opens
+// at s[0], or -1 if it isn't closed. Double-quoted values may escape quotes.
+func closingQuote(s string, quote byte) int {
+	for i := 1; i < len(s); i++ {
+		if quote == '"' && s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+// formatEnvValue renders value for a .env file, keeping the quote style the
+// line already used where the value allows it.
+func formatEnvValue(value string, quote byte) string {
+	safe := value != "" && strings.IndexFunc(value, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_-./:+=@,~", r))
+	}) < 0
+
+	switch {
+	case quote == '\'' && !strings.ContainsAny(value, "'\n\r"):
+		return "'" + value + "'"
+	case quote == 0 && safe:
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// writeFileAtomic replaces path with data by writing a temporary file in the
+// same directory, syncing it and renaming it over the original, so readers
+// see either the old file or the new one and never a partial write.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+
+	// Persist the rename itself; not every platform can sync a directory
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
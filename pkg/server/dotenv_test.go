@@ -0,0 +1,124 @@
+package server_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joho/godotenv"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+func TestSetEnvFileValue(t *testing.T) {
+	for _, test := range []struct {
+		name, content, key, value, want string
+	}{
+		{"crlf update", "# keys\r\nA=1\r\nB=2\r\n", "A", "x", "# keys\r\nA=x\r\nB=2\r\n"},
+		{"crlf append", "A=1\r\n", "C", "z", "A=1\r\nC=z\r\n"},
+		{"quoted value with #", "A=\"va#lue\" # note\nB=2\n", "A", "new#val", "A=\"new#val\" # note\nB=2\n"},
+		{"single quoted with #", "export A='a#b'\n", "A", "c#d", "export A='c#d'\n"},
+		{"append without trailing newline", "A=1", "B", "2", "A=1\nB=2\n"},
+		{"update without trailing newline", "B=0\nA=1", "A", "2", "B=0\nA=2"},
+		{"new file", "", "A", "1", "A=1\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".env")
+			if test.content != "" {
+				if err := os.WriteFile(path, []byte(test.content), 0640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := server.SetEnvFileValue(path, test.key, test.value); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.want {
+				t.Errorf("got %q, want %q", data, test.want)
+			}
+			values, err := godotenv.Read(path)
+			if err != nil || values[test.key] != test.value {
+				t.Errorf("godotenv reads %s as %q, %v; want %q", test.key, values[test.key], err, test.value)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantMode := os.FileMode(0640)
+			if test.content == "" {
+				wantMode = 0600
+			}
+			if info.Mode().Perm() != wantMode {
+				t.Errorf("mode = %v, want %v", info.Mode().Perm(), wantMode)
+			}
+		})
+	}
+}
+
+func TestEncryptedEnvIsEditedEncrypted(t *testing.T) {
+	testmcp.ClearKeys(t)
+	// The commands load .env.enc, APP_PORT included, into the environment
+	t.Setenv("APP_PORT", "")
+	os.Unsetenv("APP_PORT")
+	chdir(t, t.TempDir())
+	t.Setenv("MCP_ENV_PASSPHRASE", "correct horse battery staple")
+	if err := os.WriteFile(".env", []byte("# keys\nOPENAI_API_KEY=sk-proj-encrypted0123456789\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, stderr := execute(t, context.Background(), "", "encrypt-env", "--remove"); code != 0 {
+		t.Fatalf("encrypt-env = %d, %s", code, stderr)
+	}
+
+	if err := server.SetEnvFileValue(".env", "ANTHROPIC_API_KEY", "sk-ant-encrypted0123456789"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(".env.example", []byte("APP_PORT=8080\nCOHERE_API_KEY=\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	code, stdout, stderr := execute(t, context.Background(), "", "import", "--write")
+	if code != 0 || !strings.Contains(stdout, "into .env.enc") {
+		t.Fatalf("import --write = %d, %s%s", code, stdout, stderr)
+	}
+	if _, err := os.Stat(".env"); !os.IsNotExist(err) {
+		t.Fatalf("a plaintext .env was written: %v", err)
+	}
+	data, err := os.ReadFile(".env.enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "encrypted0123456789") {
+		t.Fatal(".env.enc holds a value in the clear")
+	}
+
+	_, plaintext, _ := execute(t, context.Background(), "", "decrypt-env", "--stdout")
+	for _, want := range []string{"# keys\n", "OPENAI_API_KEY=sk-proj-encrypted0123456789\n", "ANTHROPIC_API_KEY=sk-ant-encrypted0123456789\n", "APP_PORT=8080\n", "# COHERE_API_KEY=  (cohere: add the value)\n"} {
+		if !strings.Contains(plaintext, want) {
+			t.Errorf("decrypted .env.enc lacks %q:\n%s", want, plaintext)
+		}
+	}
+
+	// Without the passphrase nothing is written, encrypted or not
+	t.Setenv("MCP_ENV_PASSPHRASE", "")
+	if err := server.SetEnvFileValue(".env", "OPENAI_API_KEY", "sk-proj-changed0123456789"); err == nil || !strings.Contains(err.Error(), "MCP_ENV_PASSPHRASE isn't set") {
+		t.Errorf("an edit without the passphrase = %v", err)
+	}
+	if _, err := os.Stat(".env"); !os.IsNotExist(err) {
+		t.Errorf("a plaintext .env was written without the passphrase: %v", err)
+	}
+	if after, _ := os.ReadFile(".env.enc"); string(after) != string(data) {
+		t.Error(".env.enc changed without the passphrase")
+	}
+
+	// A wrong passphrase leaves the file alone too
+	t.Setenv("MCP_ENV_PASSPHRASE", "wrong")
+	if err := server.SetEnvFileValue(".env", "OPENAI_API_KEY", "sk-proj-changed0123456789"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("an edit with the wrong passphrase = %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// dryRunNotice heads the output of every value-returning tool in dry-run
+// mode, so nobody mistakes a fake value for a real one.
+const dryRunNotice = "DRY RUN: this server returns fake values. The key below is not real."
+
+// dryRunInstructions is added to the initialize instructions in dry-run mode.
+const dryRunInstructions = "This server is running in dry-run mode: get_api_key returns stable fake values instead of real keys, while listings and checks reflect the real configuration."
+
+// dryRunFromEnv reports whether MCP_DRY_RUN asks for dry-run mode.
+func dryRunFromEnv() bool {
+	return os.Getenv("MCP_DRY_RUN") == "1"
+}
+
+// fakeSecret returns the value get_api_key hands out for keyName in dry-run
+// mode, such as FAKE_OPENAI_0f3a9c2e7b1d4a58. It depends only on the key
+// name, so repeated calls, and restarts, get the same value. Composite keys
+// get a fake for each member.
+func (k *keyRegistry) fakeSecret(keyName string) string {
+	if config, _ := k.config(keyName); config.IsComposite() {
+		values := map[string]string{}
+		for _, member := range config.Members {
+			values[member.Role] = k.fakeSecret(keyName + "_" + member.Role)
+		}
+		data, _ := json.Marshal(values)
+		return string(data)
+	}
+	sum := sha256.Sum256([]byte("dry-run:" + keyName))
+	return "FAKE_" + strings.ToUpper(keyName) + "_" + hex.EncodeToString(sum[:8])
+}
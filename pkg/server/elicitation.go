@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/yourusername/mcp-api-keys-server/internal/protocol"
+	"github.com/yourusername/mcp-api-keys-server/pkg/registry"
+)
+
+// elicitationTimeout bounds how long get_api_key waits for the user to
+// answer a confirmation prompt. The request itself gets this long on top of
+// the request timeout; see requestTimeoutFor.
+const elicitationTimeout = 2 * time.Minute
+
+// ClientCapabilities are the optional features the client declared in
+// initialize.
+type ClientCapabilities struct {
+	Elicitation json.RawMessage `json:"elicitation,omitempty"`
+}
+
+// clientResponse is a response from the client to a request the server sent.
+type clientResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *protocol.Error `json:"error,omitempty"`
+}
+
+// ElicitRequestParams are the params of an elicitation/create request sent
+// to the client.
+type ElicitRequestParams struct {
+	Message         string      `json:"message"`
+	RequestedSchema InputSchema `json:"requestedSchema"`
+}
+
+// ElicitResult is the client's answer to an elicitation/create request.
+type ElicitResult struct {
+	Action  string                 `json:"action"`
+	Content map[string]interface{} `json:"content,omitempty"`
+}
+
+// readLoopKey marks the context of a request handled on the read loop,
+// which can't wait for a response from the client: it is what reads them.
+type readLoopKey struct{}
+
+// isClientResponse reports whether a message answers one of our own
+// requests: it has no method but carries a result or an error.
+func isClientResponse(message []byte) bool {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return false
+	}
+	_, hasMethod := envelope["method"]
+	_, hasResult := envelope["result"]
+	_, hasError := envelope["error"]
+	return !hasMethod && (hasResult || hasError)
+}
+
+// handleClientResponse hands a client response to the goroutine waiting for
+// it. Responses to requests nobody is waiting for any more are dropped.
+func (s *Server) handleClientResponse(message []byte) {
+	var response clientResponse
+	if err := json.Unmarshal(message, &response); err != nil {
+		return
+	}
+
+	key := requestKey(response.ID)
+	s.mu.Lock()
+	waiting, ok := s.pendingRequests[key]
+	delete(s.pendingRequests, key)
+	s.mu.Unlock()
+
+	if ok {
+		waiting <- response
+	}
+}
+
+// sendRequest sends a request to the client and waits for its response,
+// which the read loop or a concurrent Handle call delivers. It fails at
+// once on the read loop itself, which would never see the response.
+func (s *Server) sendRequest(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	if ctx.Value(readLoopKey{}) != nil {
+		return nil, errors.New("the client can't be asked anything while the server waits on this request to read its next message")
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	id := json.RawMessage(strconv.FormatInt(atomic.AddInt64(&s.nextRequestID, 1), 10))
+	key := requestKey(id)
+	waiting := make(chan clientResponse, 1)
+
+	s.mu.Lock()
+	s.pendingRequests[key] = waiting
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pendingRequests, key)
+		s.mu.Unlock()
+	}()
+
+	if err := s.writeMessage(protocol.Request{
+		JSONRPC: "2.0",
+		ID:      id,
+		Method:  method,
+		Params:  data,
+	}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case response := <-waiting:
+		if response.Error != nil {
+			return nil, fmt.Errorf("client returned error %d: %s", response.Error.Code, response.Error.Message)
+		}
+		return response.Result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// supportsElicitation reports whether the client said it can show
+// elicitation/create prompts to the user.
+func (s *Server) supportsElicitation() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elicitation := string(s.clientCapabilities.Elicitation)
+	return s.protocolVersion >= "2025-06-18" && elicitation != "" && elicitation != "null"
+}
+
+// requestTimeoutFor returns how long request may run. A get_api_key call
+// from a client that can show confirmation prompts may wait on the user, so
+// it gets elicitationTimeout on top of the request timeout.
+func (s *Server) requestTimeoutFor(request protocol.Request) time.Duration {
+	if request.Method != "tools/call" || !s.supportsElicitation() {
+		return s.requestTimeout
+	}
+	var params struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(request.Params, &params) != nil || params.Name != "get_api_key" {
+		return s.requestTimeout
+	}
+	return s.requestTimeout + elicitationTimeout
+}
+
+// confirmReveal asks the user, through the client, whether a restricted key
+// may be revealed. It returns the reason when access is not granted.
+func (s *Server) confirmReveal(ctx context.Context, keyName string, config registry.APIKeyConfig) (bool, string) {
+	ctx, cancel := context.WithTimeout(ctx, elicitationTimeout)
+	defer cancel()
+
+	data, err := s.sendRequest(ctx, "elicitation/create", ElicitRequestParams{
+		Message: fmt.Sprintf("The assistant is asking to read the restricted API key '%s' (%s). Allow it?", keyName, config.EnvLabel()),
+		RequestedSchema: InputSchema{
+			Type: "object",
+			Properties: map[string]Property{
+				"confirm": {Type: "boolean", Description: fmt.Sprintf("Reveal %s to the assistant", config.EnvLabel())},
+			},
+			Required: []string{"confirm"},
+		},
+	})
+	if errors.Is(err, context.DeadlineExceeded) {
+		return false, "the confirmation prompt timed out"
+	}
+	if err != nil {
+		return false, fmt.Sprintf("confirmation failed: %v", err)
+	}
+
+	var result ElicitResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return false, "the client sent an invalid confirmation response"
+	}
+	if result.Action != "accept" {
+		return false, fmt.Sprintf("the user chose to %s", result.Action)
+	}
+	if confirm, _ := result.Content["confirm"].(bool); !confirm {
+		return false, "the user did not confirm"
+	}
+	return true, ""
+}
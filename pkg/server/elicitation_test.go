@@ -0,0 +1,309 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+const stripeTestKey = "sk_test_elicitation0123456789abcdef"
+
+// elicitingClient returns a client that told the server it can show
+// confirmation prompts.
+func elicitingClient(t *testing.T, opts ...server.Option) *testmcp.Client {
+	t.Helper()
+	c := testmcp.New(append([]server.Option{server.WithLogger(discardLogger)}, opts...)...)
+	params := server.InitializeParams{
+		ProtocolVersion: testmcp.ProtocolVersion,
+		Capabilities:    server.ClientCapabilities{Elicitation: json.RawMessage(`{}`)},
+		ClientInfo:      server.ClientInfo{Name: "elicitation-test", Version: "1"},
+	}
+	if err := c.Call("initialize", params, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Notify("notifications/initialized", nil); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// elicitation is an elicitation/create request the server sent.
+type elicitation struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params struct {
+		Message string `json:"message"`
+	} `json:"params"`
+}
+
+// nextElicitation waits for the server to send the prompt after the first
+// seen ones.
+func nextElicitation(t *testing.T, c *testmcp.Client, seen int) elicitation {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		var prompts []elicitation
+		for _, message := range c.Notifications() {
+			var prompt elicitation
+			if json.Unmarshal(message, &prompt) == nil && prompt.Method == "elicitation/create" {
+				prompts = append(prompts, prompt)
+			}
+		}
+		if len(prompts) > seen {
+			return prompts[seen]
+		}
+	}
+	t.Fatalf("the server sent no confirmation prompt after %d", seen)
+	return elicitation{}
+}
+
+// answer is the client's response to prompt.
+func answer(prompt elicitation, action string, confirm bool) []byte {
+	return []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":{"action":%q,"content":{"confirm":%t}}}`, prompt.ID, action, confirm))
+}
+
+// callAnswering calls a tool and answers each confirmation prompt it sends
+// with the next of answers, through Handle as an embedding client would.
+func callAnswering(t *testing.T, c *testmcp.Client, tool string, args map[string]interface{}, answers ...func(elicitation) []byte) (server.CallToolResult, []elicitation) {
+	t.Helper()
+	seen := 0
+	for _, message := range c.Notifications() {
+		if strings.Contains(string(message), `"elicitation/create"`) {
+			seen++
+		}
+	}
+	type call struct {
+		result server.CallToolResult
+		err    error
+	}
+	done := make(chan call, 1)
+	go func() {
+		result, err := c.CallTool(tool, args)
+		done <- call{result, err}
+	}()
+
+	var prompts []elicitation
+	for _, respond := range answers {
+		prompt := nextElicitation(t, c, seen+len(prompts))
+		prompts = append(prompts, prompt)
+		c.Server.Handle(respond(prompt))
+	}
+	select {
+	case got := <-done:
+		if got.err != nil {
+			t.Fatalf("%s = %v", tool, got.err)
+		}
+		return got.result, prompts
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s didn't return after %d answers", tool, len(answers))
+		return server.CallToolResult{}, nil
+	}
+}
+
+func accept(prompt elicitation) []byte  { return answer(prompt, "accept", true) }
+func decline(prompt elicitation) []byte { return answer(prompt, "decline", false) }
+
+func TestRestrictedKeyIsConfirmedThroughHandle(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"stripe": stripeTestKey})
+	c := elicitingClient(t)
+
+	result, prompts := callAnswering(t, c, "get_api_key", map[string]interface{}{"key_name": "stripe"}, accept)
+	if result.IsError || !strings.Contains(testmcp.Text(result), stripeTestKey) {
+		t.Errorf("get_api_key after accepting = %q", testmcp.Text(result))
+	}
+	if !strings.Contains(prompts[0].Params.Message, "'stripe'") || strings.Contains(prompts[0].Params.Message, stripeTestKey) {
+		t.Errorf("prompt = %q", prompts[0].Params.Message)
+	}
+
+	result, _ = callAnswering(t, c, "get_api_key", map[string]interface{}{"key_name": "stripe"}, decline)
+	if code, _ := failureOf(t, result); code != "policy_denied" || !strings.Contains(testmcp.Text(result), "the user chose to decline") || strings.Contains(testmcp.Text(result), stripeTestKey) {
+		t.Errorf("get_api_key after declining = %s, %q", code, testmcp.Text(result))
+	}
+}
+
+func TestRestrictedKeyPromptOutlastsRequestTimeout(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"stripe": stripeTestKey})
+	c := elicitingClient(t, server.WithRequestTimeout(50*time.Millisecond))
+
+	slowAccept := func(prompt elicitation) []byte {
+		time.Sleep(200 * time.Millisecond)
+		return accept(prompt)
+	}
+	result, _ := callAnswering(t, c, "get_api_key", map[string]interface{}{"key_name": "stripe"}, slowAccept)
+	if result.IsError || !strings.Contains(testmcp.Text(result), stripeTestKey) {
+		t.Errorf("get_api_key answered after the request timeout = %q", testmcp.Text(result))
+	}
+}
+
+func TestRestrictedKeyIsRefusedWithoutElicitation(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"stripe": stripeTestKey})
+	c := newClient(t)
+
+	result, err := c.CallTool("get_api_key", map[string]interface{}{"key_name": "stripe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := failureOf(t, result); code != "policy_denied" || strings.Contains(testmcp.Text(result), stripeTestKey) || !strings.Contains(testmcp.Text(result), "--break-glass-enabled") {
+		t.Errorf("get_api_key without elicitation = %s, %q", code, testmcp.Text(result))
+	}
+}
+
+func TestRestrictedKeyWithoutElicitationIsBreakGlass(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"stripe": stripeTestKey})
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	stdin := strings.Join([]string{
+		initializeLine,
+		initializedLine,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"get_api_key","arguments":{"key_name":"stripe"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"get_api_key","arguments":{"key_name":"stripe","justification":"production outage, incident 4711, rotating the key"}}}`,
+	}, "\n") + "\n"
+
+	code, stdout, stderr := execute(t, context.Background(), stdin, "--watch-env=false", "--log-level", "error", "--break-glass-enabled", "--audit-log", auditPath)
+	if code != 0 {
+		t.Fatalf("Execute = %d, %s", code, stderr)
+	}
+	if strings.Count(stdout, stripeTestKey) != 1 || !strings.Contains(stdout, "with a justification for a break-glass reveal") {
+		t.Errorf("want the plain call refused and the justified one revealed: %s", stdout)
+	}
+	if got := outcomes(auditEntries(t, auditPath)); got["denied"] != 1 || got["break_glass"] != 1 {
+		t.Errorf("audit outcomes = %v, want one denied and one break_glass", got)
+	}
+}
+
+func TestRevealBudgetIsReservedWhileConfirming(t *testing.T) {
+	const openaiKey = "sk-proj-elicitation0123456789abcdef"
+	testmcp.SetKeys(t, map[string]string{"stripe": stripeTestKey, "openai": openaiKey})
+	c := elicitingClient(t, server.WithRevealBudget(1))
+
+	// While stripe waits on its prompt, it holds the only unit of budget
+	var meanwhile server.CallToolResult
+	revealMeanwhile := func(respond func(elicitation) []byte) func(elicitation) []byte {
+		return func(prompt elicitation) []byte {
+			result, err := c.CallTool("get_api_key", map[string]interface{}{"key_name": "openai"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			meanwhile = result
+			return respond(prompt)
+		}
+	}
+
+	result, _ := callAnswering(t, c, "get_api_key", map[string]interface{}{"key_name": "stripe"}, revealMeanwhile(decline))
+	if code, _ := failureOf(t, meanwhile); code != "rate_limited" || strings.Contains(testmcp.Text(meanwhile), openaiKey) {
+		t.Errorf("openai while stripe is confirmed = %s, %q", code, testmcp.Text(meanwhile))
+	}
+	if code, _ := failureOf(t, result); code != "policy_denied" {
+		t.Errorf("stripe after declining = %s, %q", code, testmcp.Text(result))
+	}
+
+	// Declining gave the budget back
+	result, _ = callAnswering(t, c, "get_api_key", map[string]interface{}{"key_name": "stripe"}, revealMeanwhile(accept))
+	if result.IsError || !strings.Contains(testmcp.Text(result), stripeTestKey) {
+		t.Errorf("stripe after accepting = %q", testmcp.Text(result))
+	}
+	if code, _ := failureOf(t, meanwhile); code != "rate_limited" {
+		t.Errorf("openai while stripe is confirmed again = %s, %q", code, testmcp.Text(meanwhile))
+	}
+	result, err := c.CallTool("get_api_key", map[string]interface{}{"key_name": "openai"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := failureOf(t, result); code != "rate_limited" {
+		t.Errorf("openai after stripe was revealed = %s, %q", code, testmcp.Text(result))
+	}
+}
+
+func TestRestrictedBasicAuthUsernameIsRefused(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"stripe": stripeTestKey, "openai": "sk-proj-elicitation0123456789abcdef"})
+	c := elicitingClient(t)
+
+	result, err := c.CallTool("get_api_key", map[string]interface{}{"key_name": "openai", "transform": "basic_auth:stripe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := failureOf(t, result); code != "policy_denied" || strings.Contains(testmcp.Text(result), stripeTestKey) {
+		t.Errorf("basic_auth with a restricted username = %s, %q", code, testmcp.Text(result))
+	}
+}
+
+func TestRestrictedKeysInGeneratedOutput(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"stripe": stripeTestKey})
+	c := newClient(t)
+
+	for _, call := range []struct {
+		tool string
+		args map[string]interface{}
+	}{
+		{"fill_template", map[string]interface{}{"template": "STRIPE={{stripe}}"}},
+		{"generate_k8s_secret", map[string]interface{}{"keys": []interface{}{"stripe"}}},
+		{"generate_compose_env", map[string]interface{}{"keys": []interface{}{"stripe"}, "include_values": true}},
+		{"generate_gh_secrets_commands", map[string]interface{}{"keys": []interface{}{"stripe"}, "include_values": true}},
+	} {
+		result, err := c.CallTool(call.tool, call.args)
+		if err != nil || result.IsError {
+			t.Fatalf("%s = %+v, %v", call.tool, result, err)
+		}
+		if text := testmcp.Text(result); strings.Contains(text, stripeTestKey) || !strings.Contains(text, "restricted") {
+			t.Errorf("%s writes the restricted key:\n%s", call.tool, text)
+		}
+	}
+}
+
+func TestRestrictedKeyIsConfirmedInBatch(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"stripe": stripeTestKey})
+	inReader, in := io.Pipe()
+	out, outWriter := io.Pipe()
+	s := server.New(inReader, outWriter, server.WithLogger(discardLogger))
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	t.Cleanup(func() {
+		in.Close()
+		go io.Copy(io.Discard, out)
+		<-done
+	})
+
+	lines := bufio.NewScanner(out)
+	send := func(line string) {
+		t.Helper()
+		if _, err := io.WriteString(in, line+"\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	receive := func() string {
+		t.Helper()
+		if !lines.Scan() {
+			t.Fatalf("the server stopped writing: %v", lines.Err())
+		}
+		return lines.Text()
+	}
+
+	send(`{"jsonrpc":"2.0","id":"init","method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{"elicitation":{}},"clientInfo":{"name":"elicitation-test","version":"1"}}}`)
+	receive()
+	send(initializedLine)
+	send(`[{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"get_api_key","arguments":{"key_name":"stripe"}}},{"jsonrpc":"2.0","id":2,"method":"ping"}]`)
+
+	var prompt elicitation
+	if err := json.Unmarshal([]byte(receive()), &prompt); err != nil || prompt.Method != "elicitation/create" {
+		t.Fatalf("the batch didn't prompt the user: %+v, %v", prompt, err)
+	}
+	send(string(accept(prompt)))
+
+	var responses []struct {
+		ID     int                   `json:"id"`
+		Result server.CallToolResult `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(receive()), &responses); err != nil || len(responses) != 2 || responses[0].ID != 1 || responses[1].ID != 2 {
+		t.Fatalf("batch responses = %+v, %v", responses, err)
+	}
+	if text := testmcp.Text(responses[0].Result); !strings.Contains(text, stripeTestKey) {
+		t.Errorf("get_api_key in a batch = %q", text)
+	}
+}
@@ -0,0 +1,389 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// encryptedEnvFile is loaded at startup, after .env, when the passphrase is
+// in envPassphraseVar.
+const (
+	encryptedEnvFile = ".env.enc"
+	envPassphraseVar = "MCP_ENV_PASSPHRASE"
+)
+
+// An encrypted .env file is laid out as
+//
+//	magic | salt | iterations | check | nonce | AES-256-GCM ciphertext | checksum
+//
+// The key and a passphrase check are derived from the passphrase with
+// PBKDF2-HMAC-SHA256. The checksum is the SHA-256 of everything before it,
+// so a damaged file is told apart from a wrong passphrase, and the check
+// tells a wrong passphrase apart from altered contents.
+var envEncMagic = []byte("MCPENV\x00\x01")
+
+const (
+	envEncSaltSize   = 16
+	envEncCheckSize  = sha256.Size
+	envEncNonceSize  = 12
+	envEncIterations = 600000
+	// envEncMaxIterations bounds the work a damaged header can ask for.
+	envEncMaxIterations = 10000000
+	envEncHeaderSize    = 8 + envEncSaltSize + 4 + envEncCheckSize + envEncNonceSize
+)
+
+var (
+	errWrongPassphrase = errors.New("wrong passphrase")
+	errCorruptEnvFile  = errors.New("the encrypted file is corrupted")
+)
+
+// pbkdf2SHA256 derives keyLen bytes from password as in RFC 8018.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var derived []byte
+	u := make([]byte, 0, sha256.Size)
+	for block := uint32(1); len(derived) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		derived = prf.Sum(derived)
+		t := derived[len(derived)-sha256.Size:]
+		u = append(u[:0], t...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+	}
+	return derived[:keyLen]
+}
+
+// envEncKeys derives the encryption key and the passphrase check.
+func envEncKeys(passphrase string, salt []byte, iterations int) (key, check []byte) {
+	derived := pbkdf2SHA256([]byte(passphrase), salt, iterations, 64)
+	mac := hmac.New(sha256.New, derived[32:])
+	mac.Write([]byte("passphrase check"))
+	return derived[:32], mac.Sum(nil)
+}
+
+// encryptEnv encrypts the contents of a .env file under passphrase.
+func encryptEnv(plaintext []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, envEncSaltSize)
+	nonce := make([]byte, envEncNonceSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key, check := envEncKeys(passphrase, salt, envEncIterations)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Write(envEncMagic)
+	out.Write(salt)
+	binary.Write(&out, binary.BigEndian, uint32(envEncIterations))
+	out.Write(check)
+	out.Write(nonce)
+	header := append([]byte(nil), out.Bytes()...)
+	out.Write(gcm.Seal(nil, nonce, plaintext, header))
+	checksum := sha256.Sum256(out.Bytes())
+	out.Write(checksum[:])
+	return out.Bytes(), nil
+}
+
+// decryptEnv reverses encryptEnv. It returns an error wrapping
+// errCorruptEnvFile when data isn't an intact encrypted file, and
+// errWrongPassphrase when it is but passphrase doesn't open it.
+func decryptEnv(data []byte, passphrase string) ([]byte, error) {
+	if !bytes.HasPrefix(data, envEncMagic) {
+		return nil, fmt.Errorf("%w: it wasn't written by encrypt-env", errCorruptEnvFile)
+	}
+	if len(data) < envEncHeaderSize+16+sha256.Size {
+		return nil, fmt.Errorf("%w: it is truncated", errCorruptEnvFile)
+	}
+	body, checksum := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if sum := sha256.Sum256(body); !bytes.Equal(sum[:], checksum) {
+		return nil, fmt.Errorf("%w: its checksum doesn't match", errCorruptEnvFile)
+	}
+
+	rest := body[len(envEncMagic):]
+	salt, rest := rest[:envEncSaltSize], rest[envEncSaltSize:]
+	iterations, rest := binary.BigEndian.Uint32(rest[:4]), rest[4:]
+	check, rest := rest[:envEncCheckSize], rest[envEncCheckSize:]
+	nonce, ciphertext := rest[:envEncNonceSize], rest[envEncNonceSize:]
+	if iterations == 0 || iterations > envEncMaxIterations {
+		return nil, fmt.Errorf("%w: invalid header", errCorruptEnvFile)
+	}
+
+	key, expected := envEncKeys(passphrase, salt, int(iterations))
+	if !hmac.Equal(check, expected) {
+		return nil, errWrongPassphrase
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, body[:envEncHeaderSize])
+	if err != nil {
+		return nil, fmt.Errorf("%w: its contents fail authentication, so they were altered", errCorruptEnvFile)
+	}
+	return plaintext, nil
+}
+
+// loadEncryptedEnv decrypts the file at path in memory, if it exists, and
+// sets its variables like .env does: those already in the environment win.
+// The plaintext is never written to disk.
+func (k *keyRegistry) loadEncryptedEnv(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	passphrase := os.Getenv(envPassphraseVar)
+	if passphrase == "" {
+		return fmt.Errorf("%s exists but %s isn't set, so its keys weren't loaded", path, envPassphraseVar)
+	}
+	k.secrets.remember("env_passphrase", passphrase)
+
+	plaintext, err := decryptEnv(data, passphrase)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	values, err := godotenv.Unmarshal(string(plaintext))
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	k.sources.apply(path, values)
+	return nil
+}
+
+// editEncryptedEnv decrypts the file at path in memory, applies edit to the
+// plaintext and encrypts the result back under the same passphrase. It
+// refuses, rather than fall back to plaintext, when the passphrase isn't
+// in envPassphraseVar.
+func editEncryptedEnv(path string, edit func(content string) string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	passphrase := os.Getenv(envPassphraseVar)
+	if passphrase == "" {
+		return fmt.Errorf("%s holds the keys but %s isn't set, so it can't be updated; nothing was written", path, envPassphraseVar)
+	}
+	plaintext, err := decryptEnv(data, passphrase)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	encrypted, err := encryptEnv([]byte(edit(string(plaintext))), passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", path, err)
+	}
+	return writeFileAtomic(path, encrypted, info.Mode().Perm())
+}
+
+// openHiddenTTY opens the controlling terminal with echo turned off where
+// stty is available, so what is typed there isn't shown. restore turns echo
+// back on and closes it.
+func openHiddenTTY() (tty *os.File, restore func(), err error) {
+	tty, err = os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	echoOff := exec.Command("stty", "-echo")
+	echoOff.Stdin = tty
+	hidden := echoOff.Run() == nil
+	return tty, func() {
+		if hidden {
+			echoOn := exec.Command("stty", "echo")
+			echoOn.Stdin = tty
+			echoOn.Run()
+		}
+		tty.Close()
+	}, nil
+}
+
+// readPassphrase returns the passphrase from envPassphraseVar, or asks for
+// it on the terminal, twice when confirm is set. Typing is hidden where stty
+// is available.
+func readPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(envPassphraseVar); passphrase != "" {
+		return passphrase, nil
+	}
+	tty, restore, err := openHiddenTTY()
+	if err != nil {
+		return "", fmt.Errorf("no terminal to ask for the passphrase on: set %s", envPassphraseVar)
+	}
+	defer restore()
+
+	reader := bufio.NewReader(tty)
+	ask := func(prompt string) (string, error) {
+		fmt.Fprint(tty, prompt)
+		line, err := reader.ReadString('\n')
+		fmt.Fprintln(tty)
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	passphrase, err := ask("Passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("the passphrase must not be empty")
+	}
+	if confirm {
+		again, err := ask("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("the passphrases don't match")
+		}
+	}
+	return passphrase, nil
+}
+
+// writeNewFile writes data to path with mode 0600, refusing to replace an
+// existing file unless force is set.
+func writeNewFile(path string, data []byte, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s already exists; pass --force to replace it", path)
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+func runEncryptEnv(keys *keyRegistry, args []string, stdout, stderr io.Writer) int {
+	flags := newCommandFlags("encrypt-env", "encrypt-env [--output file] [--force] [--remove] [file]", stderr)
+	output := flags.String("output", "", "Where to write the encrypted file (default: the input file with .enc appended)")
+	force := flags.Bool("force", false, "Replace the output file if it exists")
+	remove := flags.Bool("remove", false, "Delete the plaintext file once it is encrypted")
+	if err := flags.Parse(args); err != nil {
+		return exitUsageErr
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return exitUsageErr
+	}
+	input := ".env"
+	if flags.NArg() == 1 {
+		input = flags.Arg(0)
+	}
+	if *output == "" {
+		*output = input + ".enc"
+	}
+
+	plaintext, err := os.ReadFile(input)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	passphrase, err := readPassphrase(true)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	data, err := encryptEnv(plaintext, passphrase)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to encrypt %s: %v\n", input, err)
+		return exitFailure
+	}
+	if err := writeNewFile(*output, data, *force); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	fmt.Fprintf(stdout, "Encrypted %s to %s.\n", input, *output)
+	if *remove {
+		if err := os.Remove(input); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+		fmt.Fprintf(stdout, "Removed %s.\n", input)
+	}
+	return exitOK
+}
+
+func runDecryptEnv(keys *keyRegistry, args []string, stdout, stderr io.Writer) int {
+	flags := newCommandFlags("decrypt-env", "decrypt-env [--output file | --stdout] [--force] [file]", stderr)
+	output := flags.String("output", "", "Where to write the plaintext (default: the input file without .enc)")
+	toStdout := flags.Bool("stdout", false, "Print the plaintext instead of writing a file")
+	force := flags.Bool("force", false, "Replace the output file if it exists")
+	if err := flags.Parse(args); err != nil {
+		return exitUsageErr
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return exitUsageErr
+	}
+	input := encryptedEnvFile
+	if flags.NArg() == 1 {
+		input = flags.Arg(0)
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(input, ".enc")
+		if *output == input {
+			*output = ".env"
+		}
+	}
+
+	data, err := os.ReadFile(input)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	passphrase, err := readPassphrase(false)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	plaintext, err := decryptEnv(data, passphrase)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to decrypt %s: %v\n", input, err)
+		return exitFailure
+	}
+	if *toStdout {
+		stdout.Write(plaintext)
+		return exitOK
+	}
+	if err := writeNewFile(*output, plaintext, *force); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	fmt.Fprintf(stdout, "Decrypted %s to %s.\n", input, *output)
+	return exitOK
+}
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// secretVarName matches variable names that hold secrets whatever their
+// example value, so import never copies their defaults.
+var secretVarName = regexp.MustCompile(`(?i)(key|secret|token|password|passwd|credential|private|auth)`)
+
+// importEntry is what importing a template means for one of its variables.
+type importEntry struct {
+	EnvVar string `json:"env_var"`
+	// Key is the registered key read from EnvVar, or "" when none is.
+	Key string `json:"key,omitempty"`
+	// Status is configured, missing or unregistered.
+	Status string `json:"status"`
+	// Action is what --write does: copy_default, stub or none.
+	Action string `json:"action"`
+	// Inferred guesses, for unregistered variables, what the variable is,
+	// from its name.
+	Inferred *inferredKey `json:"inferred,omitempty"`
+	// value is the template's default, copied for copy_default. It is
+	// never reported.
+	value string
+}
+
+// importPlan reconciles a template such as .env.example with a target .env.
+type importPlan struct {
+	Template string        `json:"template"`
+	Target   string        `json:"target"`
+	Entries  []importEntry `json:"entries"`
+}
+
+// importPlanSchema describes importPlan for the tool's output schema.
+var importPlanSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"template": {Type: "string"},
+		"target":   {Type: "string"},
+		"written":  {Type: "boolean", Description: "Whether the target file was changed"},
+		"entries": {
+			Type: "array",
+			Items: &Property{
+				Type: "object",
+				Properties: map[string]Property{
+					"env_var": {Type: "string"},
+					"key":     {Type: "string", Description: "Registered key read from the variable"},
+					"status":  {Type: "string", Enum: []string{"configured", "missing", "unregistered"}},
+					"action":  {Type: "string", Description: "What writing does: copy the template's default, add a commented stub, or nothing", Enum: []string{"copy_default", "stub", "none"}},
+					"inferred": {
+						Type:        "object",
+						Description: "For unregistered variables, a category and description guessed from the name, not registry metadata",
+						Properties: map[string]Property{
+							"category":    {Type: "string"},
+							"description": {Type: "string"},
+							"source":      {Type: "string", Description: "The name pattern the guess came from"},
+						},
+						Required: []string{"category", "description", "source"},
+					},
+				},
+				Required: []string{"env_var", "status", "action"},
+			},
+		},
+	},
+	Required: []string{"template", "target", "entries", "written"},
+}
+
+// envVarKeys maps every env var a registered key is read from to the key.
+func (k *keyRegistry) envVarKeys() map[string]string {
+	keys := map[string]string{}
+	for _, name := range k.names() {
+		config, _ := k.config(name)
+		for _, envVar := range append(config.EnvVars(), config.EnvVarAliases...) {
+			if _, taken := keys[envVar]; !taken {
+				keys[envVar] = name
+			}
+		}
+	}
+	return keys
+}
+
+// isNonSecretDefault reports whether a template value is a default that can
+// be copied as is, such as a region or a local Redis URL, rather than a
+// secret or a stand-in for one.
+func (k *keyRegistry) isNonSecretDefault(envVar, value string) bool {
+	if value == "" || k.looksLikePlaceholder(value) || secretVarName.MatchString(envVar) || len(k.scanForSecrets(value)) > 0 {
+		return false
+	}
+	// Connection URLs with a password carry a credential
+	if parsed, err := url.Parse(value); err == nil && parsed.User != nil {
+		if _, hasPassword := parsed.User.Password(); hasPassword {
+			return false
+		}
+	}
+	return true
+}
+
+// planEnvImport compares the variables in template with the environment and
+// target, in template order.
+func planEnvImport(keys *keyRegistry, template, target string) (importPlan, error) {
+	plan := importPlan{Template: template, Target: target, Entries: []importEntry{}}
+	data, err := os.ReadFile(template)
+	if err != nil {
+		return plan, err
+	}
+	values, err := godotenv.Unmarshal(string(data))
+	if err != nil {
+		return plan, fmt.Errorf("failed to parse %s: %w", template, err)
+	}
+	existing, err := godotenv.Read(target)
+	if err != nil && !os.IsNotExist(err) {
+		return plan, fmt.Errorf("failed to parse %s: %w", target, err)
+	}
+
+	owners := keys.envVarKeys()
+	seen := map[string]bool{}
+	for _, entry := range parseEnvEntries(strings.ReplaceAll(string(data), "\r\n", "\n")) {
+		if entry.name == "" || seen[entry.name] {
+			continue
+		}
+		seen[entry.name] = true
+		item := importEntry{EnvVar: entry.name, Key: owners[entry.name], Action: "none", value: values[entry.name]}
+
+		_, inTarget := existing[entry.name]
+		_, inEnv := keys.lookupEnv(entry.name)
+		switch {
+		case item.Key == "":
+			item.Status = "unregistered"
+			item.Inferred = keys.inferKey(entry.name)
+		case inTarget || inEnv:
+			item.Status = "configured"
+		default:
+			item.Status = "missing"
+		}
+		if !inTarget && !inEnv {
+			if keys.isNonSecretDefault(item.EnvVar, item.value) {
+				item.Action = "copy_default"
+			} else if item.Key != "" {
+				item.Action = "stub"
+			}
+		}
+		plan.Entries = append(plan.Entries, item)
+	}
+	return plan, nil
+}
+
+// applyEnvImport writes the plan's defaults and stubs into the target.
+func applyEnvImport(plan importPlan) error {
+	var stubs []string
+	for _, entry := range plan.Entries {
+		switch entry.Action {
+		case "copy_default":
+			if err := setEnvFileValue(plan.Target, entry.EnvVar, entry.value); err != nil {
+				return err
+			}
+		case "stub":
+			stubs = append(stubs, fmt.Sprintf("# %s=  (%s: add the value)", entry.EnvVar, entry.Key))
+		}
+	}
+	if len(stubs) == 0 {
+		return nil
+	}
+	return appendEnvFileLines(plan.Target, append([]string{"", fmt.Sprintf("# Missing keys from %s", plan.Template)}, stubs...))
+}
+
+// appendEnvFileLines adds lines to the end of the .env file at path,
+// creating it if needed.
+func appendEnvFileLines(path string, lines []string) error {
+	return editEnvFile(path, func(content string) string {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		return content + strings.Join(lines, "\n") + "\n"
+	})
+}
+
+// renderImportPlan describes a plan for people, naming variables but never
+// their values.
+func renderImportPlan(plan importPlan, written bool) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Import of %s into %s:\n", plan.Template, envFileTarget(plan.Target)))
+	var unregistered []string
+	for _, entry := range plan.Entries {
+		if entry.Status == "unregistered" {
+			unregistered = append(unregistered, entry.EnvVar)
+		}
+		var action string
+		switch entry.Action {
+		case "copy_default":
+			action = "copy the template's default"
+		case "stub":
+			action = "add a commented stub"
+		}
+		line := fmt.Sprintf("  %-28s %-12s", entry.EnvVar, entry.Status)
+		if entry.Key != "" {
+			line += " " + entry.Key
+		}
+		if entry.Inferred != nil {
+			line += fmt.Sprintf(" (probably %s: %s, guessed from %s)", entry.Inferred.Category, entry.Inferred.Description, entry.Inferred.Source)
+		}
+		if action != "" {
+			line += " -> " + action
+		}
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	if len(unregistered) > 0 {
+		b.WriteString(fmt.Sprintf("\nNot registered as API keys, candidates to add to the registry: %s\n", strings.Join(unregistered, ", ")))
+	}
+	if written {
+		b.WriteString(fmt.Sprintf("\nUpdated %s.\n", plan.Target))
+	} else {
+		b.WriteString("\nDry run: nothing was written.\n")
+	}
+	return b.String()
+}
+
+func (s *Server) handleImportEnvTemplate(ctx context.Context, args map[string]interface{}) CallToolResult {
+	template, _ := args["template"].(string)
+	if template == "" {
+		template = ".env.example"
+	}
+	target, _ := args["target"].(string)
+	if target == "" {
+		target = ".env"
+	}
+	for _, path := range []*string{&template, &target} {
+		inside, err := inWorkingDir(*path)
+		if err != nil {
+			return failure(codeValidationFailed, "Error: "+err.Error(), map[string]interface{}{"path": *path})
+		}
+		*path = inside
+	}
+	write, _ := args["write"].(bool)
+	if write && !s.allowWrites {
+		return failure(codePolicyDenied, "Error: write needs the server to be started with --allow-writes. Leave it out to see what would change.", nil)
+	}
+
+	plan, err := planEnvImport(s.keys, template, target)
+	if err != nil {
+		return errorFailure(err, codeBackendUnavailable, nil)
+	}
+	if write {
+		if err := applyEnvImport(plan); err != nil {
+			return failure(codeBackendUnavailable, fmt.Sprintf("Error: failed to update %s: %v", target, s.keys.secrets.scrubError(err)), nil)
+		}
+		s.noteAudit(ctx, "info", fmt.Sprintf("import_env_template updated %s from %s", target, template))
+	}
+
+	toolResult := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: renderImportPlan(plan, write)}},
+	}
+	if s.supportsStructuredContent() {
+		toolResult.StructuredContent = map[string]interface{}{
+			"template": plan.Template,
+			"target":   plan.Target,
+			"entries":  plan.Entries,
+			"written":  write,
+		}
+	}
+	return toolResult
+}
+
+func runImport(keys *keyRegistry, args []string, stdout, stderr io.Writer) int {
+	flags := newCommandFlags("import", "import [--write] [--target file] [template]", stderr)
+	write := flags.Bool("write", false, "Copy non-secret defaults and add stubs for missing keys to the target (default: only report)")
+	target := flags.String("target", ".env", "The .env file to reconcile with the template")
+	if err := flags.Parse(args); err != nil {
+		return exitUsageErr
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return exitUsageErr
+	}
+	template := ".env.example"
+	if flags.NArg() == 1 {
+		template = flags.Arg(0)
+	}
+
+	plan, err := planEnvImport(keys, template, *target)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	if *write {
+		if err := applyEnvImport(plan); err != nil {
+			fmt.Fprintf(stderr, "Failed to update %s: %v\n", *target, err)
+			return exitFailure
+		}
+	}
+	fmt.Fprint(stdout, renderImportPlan(plan, *write))
+	return exitOK
+}
+
+// inWorkingDir returns path relative to the working directory, or an error
+// if it leads out of it, through ".." or a symbolic link. Tools only read
+// and write files there, whatever path a client passes.
+func inWorkingDir(path string) (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	if wd, err = filepath.EvalSymlinks(wd); err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(wd, path)
+	}
+
+	// A file that doesn't exist yet is judged by its directory
+	resolved, err := filepath.EvalSymlinks(path)
+	if os.IsNotExist(err) {
+		var dir string
+		if dir, err = filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+			resolved = filepath.Join(dir, filepath.Base(path))
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(wd, resolved)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the working directory", filepath.Clean(path))
+	}
+	return rel, nil
+}
@@ -0,0 +1,52 @@
+package server_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+func TestImportEnvTemplateStaysInWorkingDir(t *testing.T) {
+	testmcp.ClearKeys(t)
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "env.example"), []byte("OPENAI_API_KEY=\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	chdir(t, dir)
+	if err := os.Mkdir("config", 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("config", "env.example"), []byte("OPENAI_API_KEY=\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, "linked"); err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t)
+
+	for _, args := range []map[string]interface{}{
+		{"template": filepath.Join(outside, "env.example")},
+		{"template": "../" + filepath.Base(outside) + "/env.example"},
+		{"template": "linked/env.example"},
+		{"template": "config/env.example", "target": filepath.Join(outside, ".env")},
+		{"template": "config/env.example", "target": "linked/.env"},
+		{"template": "config/env.example", "target": "config/.."},
+	} {
+		result, err := c.CallTool("import_env_template", args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code, _ := failureOf(t, result); code != "validation_failed" || !strings.Contains(testmcp.Text(result), "outside the working directory") {
+			t.Errorf("import_env_template %v = %q", args, testmcp.Text(result))
+		}
+	}
+
+	result, err := c.CallTool("import_env_template", map[string]interface{}{"template": "config/env.example", "target": "config/.env"})
+	if err != nil || result.IsError || !strings.Contains(testmcp.Text(result), "OPENAI_API_KEY") {
+		t.Errorf("a template in a subdirectory = %q, %v", testmcp.Text(result), err)
+	}
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/registry"
+)
+
+// sourceEnvironment is the source of variables no env file set: the
+// environment the server was started with.
+const sourceEnvironment = "environment"
+
+// envProvenance records where each variable's value came from, since a
+// value in os.Getenv can't say whether the shell or an env file set it, and
+// which env files hold a different value that lost.
+type envProvenance struct {
+	mu sync.Mutex
+	// files maps a variable to the env file that set it.
+	files map[string]string
+	// shadowed maps a variable to the env files whose different value for
+	// it was ignored because it was already set.
+	shadowed map[string]map[string]bool
+}
+
+// newEnvProvenance returns a record with no env files applied yet.
+func newEnvProvenance() *envProvenance {
+	return &envProvenance{
+		files:    map[string]string{},
+		shadowed: map[string]map[string]bool{},
+	}
+}
+
+// apply sets the values an env file holds, the way godotenv.Load does:
+// variables already set keep their value. It records the file as the
+// source of those it sets, and as shadowed for those it disagrees with.
+func (p *envProvenance) apply(path string, values map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, value := range values {
+		current, set := os.LookupEnv(name)
+		switch {
+		case !set:
+			os.Setenv(name, value)
+			p.files[name] = path
+		case current != value && p.files[name] != path:
+			p.shadowLocked(name, path)
+		}
+	}
+}
+
+// set records that path set name, as the env watcher does on reload.
+func (p *envProvenance) set(name, path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files[name] = path
+}
+
+// unset records that path no longer sets name.
+func (p *envProvenance) unset(name, path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.files[name] == path {
+		delete(p.files, name)
+	}
+}
+
+// setShadowed replaces the variables path is recorded as shadowed for.
+func (p *envProvenance) setShadowed(path string, names []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, files := range p.shadowed {
+		delete(files, path)
+		if len(files) == 0 {
+			delete(p.shadowed, name)
+		}
+	}
+	for _, name := range names {
+		p.shadowLocked(name, path)
+	}
+}
+
+func (p *envProvenance) shadowLocked(name, path string) {
+	if p.shadowed[name] == nil {
+		p.shadowed[name] = map[string]bool{}
+	}
+	p.shadowed[name][path] = true
+}
+
+// source returns where name's value came from, an env file or
+// sourceEnvironment, and the env files holding a different value that lost
+// to it.
+func (p *envProvenance) source(name string) (string, []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	source := sourceEnvironment
+	if file, ok := p.files[name]; ok {
+		source = file
+	}
+	var shadowed []string
+	for file := range p.shadowed[name] {
+		shadowed = append(shadowed, file)
+	}
+	sort.Strings(shadowed)
+	return source, shadowed
+}
+
+// keyEnvVars returns every variable a key is read from, aliases included.
+func keyEnvVars(config registry.APIKeyConfig) []string {
+	return append(config.EnvVars(), config.EnvVarAliases...)
+}
+
+// shadowNote describes the variables of a key whose value hides a
+// different one in an env file, or returns "" when none does.
+func (k *keyRegistry) shadowNote(config registry.APIKeyConfig) string {
+	var notes []string
+	for _, envVar := range keyEnvVars(config) {
+		if note := k.shadowNoteFor(envVar); note != "" {
+			notes = append(notes, note)
+		}
+	}
+	return strings.Join(notes, "; ")
+}
+
+// shadowNoteFor says which source of envVar won over a different value in
+// an env file, or returns "" when it hides none. The env files are the
+// server's own, so a tenant's keys have no such notes.
+func (k *keyRegistry) shadowNoteFor(envVar string) string {
+	if k.tenant.Load() != nil {
+		return ""
+	}
+	if _, set := os.LookupEnv(envVar); !set {
+		return ""
+	}
+	source, shadowed := k.sources.source(envVar)
+	if len(shadowed) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s comes from %s, which overrides a different value in %s", envVar, describeSource(source), strings.Join(shadowed, " and "))
+}
+
+// emptyEnvVars returns the variables of an unconfigured key that are
+// defined with no value, such as STRIPE_API_KEY= in a CI config, as opposed
+// to not defined at all. A value sanitize strips to nothing counts as empty. For a composite key they are its empty members.
+func (k *keyRegistry) emptyEnvVars(config registry.APIKeyConfig) []string {
+	candidates := keyEnvVars(config)
+	if config.IsComposite() {
+		candidates = nil
+		for _, member := range config.Members {
+			candidates = append(candidates, member.EnvVar)
+		}
+	}
+	var empty []string
+	for _, envVar := range candidates {
+		_, set := k.lookupEnv(envVar)
+		value := k.resolvedEnv(envVar)
+		if value != "" && !config.IsComposite() {
+			return nil
+		}
+		if set && value == "" {
+			empty = append(empty, envVar)
+		}
+	}
+	return empty
+}
+
+// emptyHint explains variables that are set to nothing.
+func emptyHint(envVars []string) string {
+	if len(envVars) > 1 {
+		return fmt.Sprintf("%s are set but empty, which usually means CI secrets or .env lines that were never filled in. Give them values, or remove them if the keys aren't needed.", strings.Join(envVars, " and "))
+	}
+	return fmt.Sprintf("%s is set but empty, which usually means a CI secret or .env line that was never filled in. Give it a value, or remove it if the key isn't needed.", envVars[0])
+}
+
+// describeSource renders a source for messages.
+func describeSource(source string) string {
+	if source == sourceEnvironment {
+		return "the environment"
+	}
+	return source
+}
+
+// envVarCollisions returns the variables more than one registered key is
+// read from, each with the keys that share it, sorted.
+func (k *keyRegistry) envVarCollisions() map[string][]string {
+	users := map[string][]string{}
+	for _, name := range k.names() {
+		config, _ := k.config(name)
+		seen := map[string]bool{}
+		for _, envVar := range keyEnvVars(config) {
+			if envVar != "" && !seen[envVar] {
+				seen[envVar] = true
+				users[envVar] = append(users[envVar], name)
+			}
+		}
+	}
+	for envVar, keys := range users {
+		if len(keys) < 2 {
+			delete(users, envVar)
+		}
+	}
+	return users
+}
+
+// collisionMessages describes each shared variable, sorted by name.
+func collisionMessages(keys *keyRegistry) []string {
+	collisions := keys.envVarCollisions()
+	messages := make([]string, 0, len(collisions))
+	for envVar, keys := range collisions {
+		messages = append(messages, fmt.Sprintf("%s is read by more than one key: %s", envVar, strings.Join(keys, ", ")))
+	}
+	sort.Strings(messages)
+	return messages
+}
+
+// warnEnvConflicts logs, at startup, the variables several keys share and
+// the key variables whose value hides a different one in an env file, and
+// queues the same warnings for the client. Values are never included.
+func (s *Server) warnEnvConflicts() {
+	messages := collisionMessages(s.keys)
+	var envVars []string
+	for envVar := range s.keys.envVarSet() {
+		envVars = append(envVars, envVar)
+	}
+	sort.Strings(envVars)
+	for _, envVar := range envVars {
+		if note := s.keys.shadowNoteFor(envVar); note != "" {
+			messages = append(messages, note)
+		}
+	}
+	for _, message := range messages {
+		s.logger.Warn(message)
+		s.startupLogs = append(s.startupLogs, LoggingMessageParams{
+			Level:  "warning",
+			Logger: "config",
+			Data:   message,
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// envTemplate renders a .env file with one section per category and an
+// empty assignment, headed by its description, for every registered key.
+// With withValues, keys configured in the environment get their values.
+func envTemplate(keys *keyRegistry, withValues bool) string {
+	var b strings.Builder
+	b.WriteString("# ===========================================\n")
+	b.WriteString("# MCP API Keys Server - Environment Variables\n")
+	b.WriteString("# ===========================================\n")
+	if !withValues {
+		b.WriteString("# Copy this file to .env and fill in your actual values\n")
+	}
+	b.WriteString("# NEVER commit .env to git - it contains secrets!\n")
+	b.WriteString("# ===========================================\n")
+
+	for _, cat := range keyCategories {
+		b.WriteString(fmt.Sprintf("\n# -----------------\n# %s\n# -----------------\n", cat.Title))
+		for _, name := range keys.names() {
+			config, value, _ := keys.lookup(name)
+			if config.Category != cat.Name {
+				continue
+			}
+			b.WriteString(fmt.Sprintf("# %s\n", config.Description))
+			values := keyEnvValues(config, value)
+			if config.IsComposite() && value == "" {
+				// Keep the members that are set
+				for _, member := range config.Members {
+					values[member.EnvVar] = keys.resolvedEnv(member.EnvVar)
+				}
+			}
+			for _, envVar := range config.EnvVars() {
+				if withValues && values[envVar] != "" {
+					b.WriteString(fmt.Sprintf("%s=%s\n", envVar, formatEnvValue(values[envVar], 0)))
+				} else {
+					b.WriteString(fmt.Sprintf("%s=\n", envVar))
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+func runInit(keys *keyRegistry, args []string, stdout, stderr io.Writer) int {
+	flags := newCommandFlags("init", "init [--config file] [--with-values] [--force] [--output file]", stderr)
+	configPath := flags.String("config", "", "Server configuration file, for the composite keys it adds to the template")
+	withValues := flags.Bool("with-values", false, "Fill in values from the current environment and write .env instead of .env.example")
+	force := flags.Bool("force", false, "Overwrite the output file if it exists")
+	output := flags.String("output", "", "File to write (default .env.example, or .env with --with-values)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsageErr
+	}
+
+	path := *output
+	if path == "" {
+		path = ".env.example"
+		if *withValues {
+			path = ".env"
+		}
+	}
+	// Example files get committed, so they must never hold real values
+	if *withValues && strings.HasSuffix(filepath.Base(path), ".example") {
+		fmt.Fprintf(stderr, "Refusing to write real values into %s\n", path)
+		return exitUsageErr
+	}
+	if _, err := os.Stat(path); err == nil && !*force {
+		fmt.Fprintf(stderr, "%s already exists; use --force to overwrite it\n", path)
+		return exitFailure
+	}
+
+	if *configPath != "" {
+		config, err := loadFileConfig(*configPath)
+		if err == nil {
+			err = keys.addPlaceholderPatterns(config.PlaceholderPatterns)
+		}
+		if err == nil {
+			err = keys.registerComposite(config.CompositeKeys)
+		}
+		if err == nil {
+			err = keys.rotations.configure(keys, config)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+	}
+
+	mode := os.FileMode(0644)
+	if *withValues {
+		mode = 0600
+	}
+	if err := writeFileAtomic(path, []byte(envTemplate(keys, *withValues)), mode); err != nil {
+		fmt.Fprintf(stderr, "Failed to write %s: %v\n", path, err)
+		return exitFailure
+	}
+	fmt.Fprintf(stdout, "Wrote %s with %d keys\n", path, keys.count())
+	return exitOK
+}
+
+func (s *Server) handleGenerateEnvTemplate(ctx context.Context, args map[string]interface{}) CallToolResult {
+	return CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: envTemplate(s.keys, false)}},
+	}
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// envWatchInterval is how often the watched .env file is checked for
+// changes, and envWatchDebounce how long it must stay unchanged before it is
+// reloaded, so an editor's burst of writes is applied once.
+const (
+	envWatchInterval = 500 * time.Millisecond
+	envWatchDebounce = 250 * time.Millisecond
+)
+
+// envWatcher reloads a .env file when it changes and applies the new values
+// to the process environment. It polls the file's metadata rather than
+// using OS notifications, which also covers editors that save by writing a
+// new file and renaming it over the old one.
+type envWatcher struct {
+	path   string
+	logger *slog.Logger
+	// registered, when set, limits updates to the env vars of its keys.
+	registered *keyRegistry
+	// sources records the variables the file sets.
+	sources *envProvenance
+	// onChange runs after values were applied.
+	onChange func()
+
+	// managed holds the variables this file set; variables set in the
+	// real environment win, as they do at startup, and are left alone.
+	managed   map[string]string
+	stat      os.FileInfo
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newEnvWatcher starts watching path for keys, treating the values it holds
+// now as already applied. With all, every variable in the file is applied,
+// not just those of registered keys.
+func newEnvWatcher(path string, keys *keyRegistry, all bool, logger *slog.Logger, onChange func()) *envWatcher {
+	w := &envWatcher{
+		path:     path,
+		logger:   logger,
+		sources:  keys.sources,
+		onChange: onChange,
+		managed:  map[string]string{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if !all {
+		w.registered = keys
+	}
+	w.stat, _ = os.Stat(path)
+	if values, err := godotenv.Read(path); err == nil {
+		for name, value := range values {
+			if current, set := os.LookupEnv(name); set && current == value {
+				w.managed[name] = value
+			}
+		}
+	}
+	go w.run()
+	return w
+}
+
+// envVarSet returns every env var a registered key is read from.
+func (k *keyRegistry) envVarSet() map[string]bool {
+	names := map[string]bool{}
+	for _, name := range k.names() {
+		config, _ := k.config(name)
+		for _, envVar := range config.EnvVars() {
+			names[envVar] = true
+		}
+		for _, alias := range config.EnvVarAliases {
+			names[alias] = true
+		}
+	}
+	return names
+}
+
+// changed reports whether the file differs from when it was last seen,
+// including being created, removed or replaced by a rename.
+func (w *envWatcher) changed(stat os.FileInfo) bool {
+	switch {
+	case stat == nil || w.stat == nil:
+		return (stat == nil) != (w.stat == nil)
+	case !os.SameFile(stat, w.stat):
+		return true
+	}
+	return !stat.ModTime().Equal(w.stat.ModTime()) || stat.Size() != w.stat.Size()
+}
+
+func (w *envWatcher) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(envWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		stat, _ := os.Stat(w.path)
+		if !w.changed(stat) {
+			continue
+		}
+		// Wait for the writes to settle
+		for {
+			w.stat = stat
+			select {
+			case <-w.stop:
+				return
+			case <-time.After(envWatchDebounce):
+			}
+			if stat, _ = os.Stat(w.path); !w.changed(stat) {
+				break
+			}
+		}
+		w.reload()
+	}
+}
+
+// reload applies the file's current values and unsets the managed
+// variables it no longer holds. Only names are logged, never values.
+func (w *envWatcher) reload() {
+	values := map[string]string{}
+	if w.stat != nil {
+		var err error
+		if values, err = godotenv.Read(w.path); err != nil {
+			w.logger.Warn("failed to reload env file, keeping the previous values", "path", w.path, "error", err)
+			return
+		}
+	}
+	var registered map[string]bool
+	if w.registered != nil {
+		registered = w.registered.envVarSet()
+	}
+
+	var set, removed, skipped []string
+	for name, value := range values {
+		if registered != nil && !registered[name] {
+			continue
+		}
+		previous, managed := w.managed[name]
+		if current, inEnv := os.LookupEnv(name); inEnv && !managed {
+			if current != value {
+				skipped = append(skipped, name)
+			}
+			continue
+		}
+		if managed && previous == value {
+			continue
+		}
+		os.Setenv(name, value)
+		w.sources.set(name, w.path)
+		w.managed[name] = value
+		set = append(set, name)
+	}
+	for name := range w.managed {
+		if _, kept := values[name]; !kept && (registered == nil || registered[name]) {
+			os.Unsetenv(name)
+			w.sources.unset(name, w.path)
+			delete(w.managed, name)
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(set)
+	sort.Strings(removed)
+	sort.Strings(skipped)
+	w.sources.setShadowed(w.path, skipped)
+
+	if len(skipped) > 0 {
+		w.logger.Info("env file sets variables already in the environment, which win", "path", w.path, "names", skipped)
+	}
+	if len(set) == 0 && len(removed) == 0 {
+		return
+	}
+	w.logger.Info("env file changed", "path", w.path, "set", set, "removed", removed)
+	if w.onChange != nil {
+		w.onChange()
+	}
+}
+
+// Close stops watching. It is safe to call more than once.
+func (w *envWatcher) Close() {
+	w.closeOnce.Do(func() { close(w.stop) })
+	<-w.done
+}
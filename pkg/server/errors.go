@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/yourusername/mcp-api-keys-server/internal/protocol"
+)
+
+// errorCode classifies a failure so clients can act on it without parsing
+// messages. Failed tool calls carry it in their structured content, and
+// JSON-RPC errors in their data. Codes are part of the server's interface:
+// once sent, a code keeps its meaning.
+type errorCode string
+
+const (
+	// codeUnknownKey: the key name isn't registered.
+	codeUnknownKey errorCode = "unknown_key"
+	// codeNotConfigured: the key is registered but has no value.
+	codeNotConfigured errorCode = "not_configured"
+	// codePolicyDenied: a policy, the user or a server mode refused.
+	codePolicyDenied errorCode = "policy_denied"
+	// codeRateLimited: the key was revealed too often; retry later.
+	codeRateLimited errorCode = "rate_limited"
+	// codeBackendUnavailable: a provider, command or file the tool relies
+	// on failed or couldn't be reached.
+	codeBackendUnavailable errorCode = "backend_unavailable"
+	// codeValidationFailed: the arguments or params were rejected.
+	codeValidationFailed errorCode = "validation_failed"
+	// codeTimeout: the request ran out of time.
+	codeTimeout errorCode = "timeout"
+	// codeNotFound: a tool, method, prompt, resource or snapshot doesn't
+	// exist.
+	codeNotFound errorCode = "not_found"
+	// codeInvalidRequest: the message isn't a valid JSON-RPC request.
+	codeInvalidRequest errorCode = "invalid_request"
+	// codeUnavailable: the session isn't in a state to take the request.
+	codeUnavailable errorCode = "unavailable"
+	// codeInternal: the server failed; the request may be fine.
+	codeInternal errorCode = "internal"
+)
+
+// codedError is an error that knows its code, for helpers whose errors
+// handlers report as tool failures.
+type codedError struct {
+	code errorCode
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// withCode attaches a code to err.
+func withCode(code errorCode, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+// codeOf returns the code attached to err, or fallback when it has none.
+func codeOf(err error, fallback errorCode) errorCode {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	return fallback
+}
+
+// toolFailure is the structured form of a failed tool call, sent under
+// "error" in its structured content.
+type toolFailure struct {
+	Code    errorCode              `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// failure returns an error result whose content is text and whose
+// structured content, for clients that take it, is the same failure with
+// its code and details. Details must only hold names and numbers, never
+// values.
+func failure(code errorCode, text string, details map[string]interface{}) CallToolResult {
+	return CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text}},
+		StructuredContent: map[string]interface{}{
+			"error": toolFailure{
+				Code:    code,
+				Message: strings.TrimPrefix(text, "Error: "),
+				Details: details,
+			},
+		},
+		IsError: true,
+	}
+}
+
+// errorFailure is failure for an error, using its code or fallback.
+func errorFailure(err error, fallback errorCode, details map[string]interface{}) CallToolResult {
+	return failure(codeOf(err, fallback), "Error: "+err.Error(), details)
+}
+
+// keyDetails are the details of a failure concerning one key.
+func keyDetails(keyName string) map[string]interface{} {
+	return map[string]interface{}{"key_name": keyName}
+}
+
+// structured drops a result's structured content for clients that can't
+// take it, which failures always set.
+func (s *Server) structured(result CallToolResult) CallToolResult {
+	if !s.supportsStructuredContent() {
+		result.StructuredContent = nil
+	}
+	return result
+}
+
+// errorData is the data of every JSON-RPC error the server sends.
+type errorData struct {
+	Code    errorCode              `json:"code"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// rpcErrorCodes gives the code sent in the data of each JSON-RPC error
+// code, for errors that don't name a more specific one.
+var rpcErrorCodes = map[int]errorCode{
+	-32700:            codeInvalidRequest,
+	-32600:            codeInvalidRequest,
+	-32601:            codeNotFound,
+	-32602:            codeValidationFailed,
+	-32603:            codeInternal,
+	errShuttingDown:   codeUnavailable,
+	errNotInitialized: codeUnavailable,
+}
+
+// errorResponse returns a JSON-RPC error, with the code in its data taken
+// from rpcErrorCodes.
+func errorResponse(id json.RawMessage, code int, message string) protocol.Response {
+	return errorResponseWithData(id, code, message, rpcErrorCodes[code], nil)
+}
+
+// errorResponseWithData is errorResponse with the error's code and details
+// spelled out.
+func errorResponseWithData(id json.RawMessage, code int, message string, errCode errorCode, details map[string]interface{}) protocol.Response {
+	return protocol.Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error: &protocol.Error{
+			Code:    code,
+			Message: message,
+			Data:    errorData{Code: errCode, Details: details},
+		},
+	}
+}
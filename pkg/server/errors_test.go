@@ -0,0 +1,119 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+// reply is a JSON-RPC response as the error code tests see it.
+type reply struct {
+	Error *struct {
+		Code int `json:"code"`
+		Data struct {
+			Code    string                 `json:"code"`
+			Details map[string]interface{} `json:"details"`
+		} `json:"data"`
+	} `json:"error"`
+	Result *struct {
+		IsError           bool `json:"isError"`
+		StructuredContent struct {
+			Error struct {
+				Code    string                 `json:"code"`
+				Message string                 `json:"message"`
+				Details map[string]interface{} `json:"details"`
+			} `json:"error"`
+		} `json:"structuredContent"`
+	} `json:"result"`
+}
+
+// Error codes are part of the server's interface, so each is pinned here
+// against a request that fails with it.
+func TestErrorCodes(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-errorcodes0123456789", "INTERNAL_TOOLS_TOKEN": "internal-errorcodes0123456789"})
+	s := server.New(strings.NewReader(""), &bytes.Buffer{}, server.WithLogger(discardLogger))
+	hidden := internalToolsKey
+	hidden.Reveal = new(bool)
+	if err := s.RegisterKey("internal_tools", hidden); err != nil {
+		t.Fatal(err)
+	}
+
+	// Before initialize
+	var early reply
+	if err := json.Unmarshal(s.Handle([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)), &early); err != nil || early.Error == nil || early.Error.Code != -32002 || early.Error.Data.Code != "unavailable" {
+		t.Errorf("tools/list before initialize = %+v, %v", early.Error, err)
+	}
+	s.Handle([]byte(initializeLine))
+	s.Handle([]byte(initializedLine))
+
+	call := func(tool, arguments string) string {
+		return `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"` + tool + `","arguments":` + arguments + `}}`
+	}
+	for _, test := range []struct {
+		name string
+		line string
+		// rpcCode is the JSON-RPC error code, or 0 for a failed tool call
+		rpcCode int
+		code    string
+		details map[string]interface{}
+	}{
+		{"parse error", `{bad`, -32700, "invalid_request", nil},
+		{"no method", `{"jsonrpc":"2.0","id":1}`, -32600, "invalid_request", nil},
+		{"unknown method", `{"jsonrpc":"2.0","id":1,"method":"nope"}`, -32601, "not_found", map[string]interface{}{"method": "nope"}},
+		{"unknown tool", call("nope", `{}`), -32601, "not_found", map[string]interface{}{"tool": "nope"}},
+		{"params not an object", `{"jsonrpc":"2.0","id":1,"method":"tools/list","params":"wrong"}`, -32602, "validation_failed", nil},
+		{"unknown resource", `{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"apikey://status/nope"}}`, -32002, "not_found", map[string]interface{}{"uri": "apikey://status/nope"}},
+		{"unknown prompt", `{"jsonrpc":"2.0","id":1,"method":"prompts/get","params":{"name":"nope"}}`, -32602, "not_found", map[string]interface{}{"prompt": "nope"}},
+		{"unknown key", call("get_api_key", `{"key_name":"no_such_key"}`), 0, "unknown_key", map[string]interface{}{"key_name": "no_such_key"}},
+		{"not configured", call("get_api_key", `{"key_name":"anthropic"}`), 0, "not_configured", map[string]interface{}{"key_name": "anthropic"}},
+		{"never revealed", call("get_api_key", `{"key_name":"internal_tools"}`), 0, "policy_denied", map[string]interface{}{"key_name": "internal_tools"}},
+		{"missing argument", call("get_api_key", `{}`), 0, "validation_failed", map[string]interface{}{"problems": []interface{}{"key_name: required"}}},
+		{"wrong argument type", call("get_api_key", `{"key_name":5}`), 0, "validation_failed", map[string]interface{}{"problems": []interface{}{"key_name: expected string, got number"}}},
+		{"bad enum", call("list_api_keys", `{"category":"nope"}`), 0, "validation_failed", nil},
+	} {
+		var got reply
+		raw := s.Handle([]byte(test.line))
+		if err := json.Unmarshal(raw, &got); err != nil {
+			t.Fatalf("%s: reply %s: %v", test.name, raw, err)
+		}
+		var code string
+		var details map[string]interface{}
+		switch {
+		case test.rpcCode != 0:
+			if got.Error == nil || got.Error.Code != test.rpcCode {
+				t.Errorf("%s = %s, want JSON-RPC error %d", test.name, raw, test.rpcCode)
+				continue
+			}
+			code, details = got.Error.Data.Code, got.Error.Data.Details
+		default:
+			if got.Result == nil || !got.Result.IsError {
+				t.Errorf("%s = %s, want a failed tool call", test.name, raw)
+				continue
+			}
+			code, details = got.Result.StructuredContent.Error.Code, got.Result.StructuredContent.Error.Details
+			if got.Result.StructuredContent.Error.Message == "" {
+				t.Errorf("%s has no message: %s", test.name, raw)
+			}
+		}
+		if code != test.code {
+			t.Errorf("%s: code = %q, want %q", test.name, code, test.code)
+		}
+		if test.details != nil && !jsonEqual(details, test.details) {
+			t.Errorf("%s: details = %v, want %v", test.name, details, test.details)
+		}
+		if strings.Contains(string(raw), "errorcodes0123456789") {
+			t.Errorf("%s reveals a value: %s", test.name, raw)
+		}
+	}
+}
+
+// jsonEqual reports whether a and b encode to the same JSON.
+func jsonEqual(a, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
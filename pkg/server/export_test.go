@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// WithTenantsFile binds each session to a tenant of the --tenants file at
+// path, as the flag does, so tests can run tenant sessions side by side in
+// one process.
+func WithTenantsFile(path string) Option {
+	return func(s *Server) {
+		tenants, err := loadTenants(path)
+		if err != nil {
+			panic(err)
+		}
+		s.tenants = tenants
+	}
+}
+
+// Logger is the logger s writes its diagnostics to, which redacts the
+// values s has resolved.
+func (s *Server) Logger() *slog.Logger {
+	return s.logger
+}
+
+// InvalidateToolsList drops the cached tools/list pages, as a change to
+// the keys would.
+func (s *Server) InvalidateToolsList() {
+	s.keys.version.Add(1)
+}
+
+// MaskSecret previews value with the default mask settings.
+func MaskSecret(value string) string {
+	return defaultMask.apply(value)
+}
+
+// NewMask returns a preview function with the default settings changed by
+// style and chars, as --mask-style and --mask-chars do, or by
+// MCP_MASK_STYLE and MCP_MASK_CHARS when fromEnv is set.
+func NewMask(fromEnv bool, style string, chars int) (func(string) string, error) {
+	mask := defaultMask
+	var err error
+	if fromEnv {
+		err = mask.configureFromEnv()
+	} else {
+		err = mask.configure(style, chars)
+	}
+	return mask.apply, err
+}
+
+// Sanitize and SuspiciousContent are sanitize and suspiciousContent, for
+// the sanitization tests.
+var (
+	Sanitize          = sanitize
+	SuspiciousContent = suspiciousContent
+)
+
+// WithSanitizeValues turns value sanitization on or off, as
+// --sanitize-values does.
+func WithSanitizeValues(on bool) Option {
+	return func(s *Server) { s.keys.sanitizeValues = on }
+}
+
+// ApplyTransform parses a transform argument as get_api_key does and
+// applies it to value, with username as the basic_auth username. It
+// returns the problem with a transform that doesn't parse.
+func ApplyTransform(transform, value, username string) (string, string) {
+	parsed, problem := parseTransform(map[string]interface{}{"transform": transform})
+	if problem != "" {
+		return "", problem
+	}
+	return parsed.apply(value, username), ""
+}
+
+// InferKey returns the category, description and pattern of the built-in
+// guess for envVar, or empty strings when no pattern matches.
+func InferKey(envVar string) (category, description, source string) {
+	return newKeyRegistry().inferKeyFields(envVar)
+}
+
+// NewKeyInferrer returns InferKey with the key_inference entries of a
+// config file, given as JSON, added.
+func NewKeyInferrer(inferences string) (func(envVar string) (category, description, source string), error) {
+	var parsed []keyInference
+	if err := json.Unmarshal([]byte(inferences), &parsed); err != nil {
+		return nil, err
+	}
+	keys := newKeyRegistry()
+	return keys.inferKeyFields, keys.addKeyInferences(parsed)
+}
+
+func (k *keyRegistry) inferKeyFields(envVar string) (category, description, source string) {
+	if inferred := k.inferKey(envVar); inferred != nil {
+		return inferred.Category, inferred.Description, inferred.Source
+	}
+	return "", "", ""
+}
+
+// SetEnvFileValue is setEnvFileValue, for the .env editing tests.
+var SetEnvFileValue = setEnvFileValue
+
+// RevealAllows reports whether a policy of --reveal-allow and --reveal-deny
+// patterns lets keyName be revealed.
+func RevealAllows(allow, deny []string, keyName string) (bool, error) {
+	policy, err := newRevealPolicy(allow, deny)
+	return policy.allows(keyName), err
+}
+
+// NewRevealLimiter returns the allow method of a limiter built from a
+// --reveal-rate and per-key rates, reading the time from now.
+func NewRevealLimiter(rate string, keyRates map[string]string, now func() time.Time) (func(keyName string) (bool, time.Duration), error) {
+	limiter, err := newRevealLimiterFromConfig(newKeyRegistry(), rate, keyRates)
+	if err != nil {
+		return nil, err
+	}
+	limiter.now = now
+	return limiter.allow, nil
+}
+
+// ComposeQuote is composeQuote, for the YAML quoting tests.
+var ComposeQuote = composeQuote
+
+// WithPlainOutput uses the plain markers, as --plain-output does.
+func WithPlainOutput() Option {
+	return func(s *Server) { s.markers = plainMarkers }
+}
+
+// WithAllowNetwork offers the tools that call provider APIs, as
+// --allow-network does.
+func WithAllowNetwork() Option {
+	return func(s *Server) { s.allowNetwork = true }
+}
+
+// countingSink is an audit sink that counts how often it is closed.
+type countingSink struct{ closes *int32 }
+
+func (countingSink) Name() string           { return "counter" }
+func (countingSink) Write(auditEntry) error { return nil }
+func (c countingSink) Close() error         { atomic.AddInt32(c.closes, 1); return nil }
+
+// WithCountingAuditSink adds an audit sink that counts its Close calls in
+// closes.
+func WithCountingAuditSink(closes *int32) Option {
+	return func(s *Server) { s.auditSinks = append(s.auditSinks, countingSink{closes}) }
+}
+
+// WithRequestTimeout bounds requests as --request-timeout does.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(s *Server) { s.requestTimeout = timeout }
+}
+
+// WithRevealBudget caps the distinct keys a session may reveal, as
+// --reveal-budget does.
+func WithRevealBudget(limit int) Option {
+	return func(s *Server) { s.revealBudget.limit = limit }
+}
+
+// WithToolFilter leaves tools out as --enable-tools and --disable-tools
+// do.
+func WithToolFilter(enable, disable []string) Option {
+	return func(s *Server) {
+		filter, err := newToolFilter(enable, disable)
+		if err != nil {
+			panic(err)
+		}
+		s.tools.setFilter(filter)
+	}
+}
+
+// ToolFilterAllows reports whether a filter of --enable-tools and
+// --disable-tools patterns keeps the tool name.
+func ToolFilterAllows(enable, disable []string, name string) (bool, error) {
+	filter, err := newToolFilter(enable, disable)
+	return filter.allows(name), err
+}
+
+// SetSTSURL points validate_aws_credentials at url, with %s standing for
+// the region, for the rest of the test.
+func SetSTSURL(t testing.TB, url string) {
+	saved := stsURLFormat
+	stsURLFormat = url
+	t.Cleanup(func() { stsURLFormat = saved })
+}
+
+// AddHTTPValidations adds the validations of a config file, given as
+// JSON, to s's live checks, as --config does.
+func AddHTTPValidations(s *Server, validations string) error {
+	var parsed map[string]httpValidation
+	if err := json.Unmarshal([]byte(validations), &parsed); err != nil {
+		return err
+	}
+	return addHTTPValidations(s.keys, parsed)
+}
+
+// ServeMetrics counts what s does and serves it at the returned /metrics
+// URL, as --metrics-listen does, until the test ends.
+func ServeMetrics(t testing.TB, s *Server) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	s.metrics = newServerMetrics()
+	metricsServer, err := startMetricsServer(addr, s.metrics, s.logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { metricsServer.Shutdown(context.Background()) })
+	return "http://" + addr + "/metrics"
+}
+
+// RecordSpans makes s keep the spans of its requests in memory instead of
+// exporting them, and returns a function listing those finished so far as
+// their OTLP JSON.
+func RecordSpans(s *Server) func() []map[string]interface{} {
+	done := make(chan struct{})
+	close(done)
+	s.tracer = &tracer{logger: s.logger, stop: make(chan struct{}), done: done}
+	return func() []map[string]interface{} {
+		s.tracer.mu.Lock()
+		data, _ := json.Marshal(s.tracer.pending)
+		s.tracer.mu.Unlock()
+		var spans []map[string]interface{}
+		json.Unmarshal(data, &spans)
+		return spans
+	}
+}
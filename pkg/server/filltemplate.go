@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// maxTemplateSize is the largest template fill_template accepts, in bytes.
+const maxTemplateSize = 64 << 10
+
+// templateEscapes are the contexts fill_template can escape values for.
+var templateEscapes = []string{"none", "json", "yaml", "shell"}
+
+// templatePlaceholder matches {{key_name}} and ${ENV_VAR} placeholders.
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}|\$\{([A-Za-z0-9_]+)\}`)
+
+// escapeTemplateValue makes value safe to splice into a template: inside a
+// double-quoted JSON or YAML string, or as a single-quoted shell word.
+func escapeTemplateValue(value, escape string) string {
+	switch escape {
+	case "json", "yaml":
+		// YAML double-quoted scalars accept JSON's escapes
+		data, _ := json.Marshal(value)
+		return string(data[1 : len(data)-1])
+	case "shell":
+		return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+	}
+	return value
+}
+
+// keyForEnvVar returns the registered key read from envVar, as its own
+// variable or an alias such as GH_TOKEN. Only registered keys can be filled
+// in, never arbitrary environment variables, and composite keys only as a
+// whole, by name.
+func (k *keyRegistry) keyForEnvVar(envVar string) (string, bool) {
+	for _, name := range k.names() {
+		if config, _ := k.config(name); !config.IsComposite() && slices.Contains(keyEnvVars(config), envVar) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (s *Server) handleFillTemplate(ctx context.Context, args map[string]interface{}) CallToolResult {
+	template, ok := args["template"].(string)
+	if !ok {
+		return failure(codeValidationFailed, "Error: template is required", nil)
+	}
+	if len(template) > maxTemplateSize {
+		return failure(codeValidationFailed, fmt.Sprintf("Error: template is %d bytes, more than the %d allowed", len(template), maxTemplateSize), nil)
+	}
+	escape := "none"
+	if e, ok := args["escape"].(string); ok && e != "" {
+		escape = e
+	}
+
+	// Each key is resolved once, however often it appears
+	values := map[string]string{}
+	failures := map[string]string{}
+	var unresolved []string
+	filled := templatePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		match := templatePlaceholder.FindStringSubmatch(placeholder)
+		keyName := match[1]
+		if match[2] != "" {
+			var ok bool
+			if keyName, ok = s.keys.keyForEnvVar(match[2]); !ok {
+				keyName = match[2]
+			}
+		}
+
+		if value, ok := values[keyName]; ok {
+			return value
+		}
+		reason, failed := failures[keyName]
+		if !failed {
+			var value string
+			if value, reason = s.revealForTool(ctx, keyName); reason == "" {
+				values[keyName] = escapeTemplateValue(value, escape)
+				return values[keyName]
+			}
+			failures[keyName] = reason
+			unresolved = append(unresolved, fmt.Sprintf("%s: %s", placeholder, reason))
+		}
+		return placeholder
+	})
+
+	if len(values) > 0 {
+		s.noteAudit(ctx, "info", fmt.Sprintf("fill_template filled in %d API keys", len(values)))
+	}
+	result := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: filled}},
+	}
+	if len(unresolved) > 0 {
+		result.Content = append(result.Content, ContentBlock{
+			Type: "text",
+			Text: "Unresolved placeholders, left as they were:\n- " + strings.Join(unresolved, "\n- "),
+		})
+	}
+	if s.dryRun && len(values) > 0 {
+		result.Content = append([]ContentBlock{{Type: "text", Text: dryRunNotice}}, result.Content...)
+	}
+	return result
+}
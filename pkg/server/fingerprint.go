@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+)
+
+// shortFingerprintLength is how many hex characters of the SHA-256 are shown
+// unless the full hash is asked for. 64 bits is plenty to tell keys apart.
+const shortFingerprintLength = 16
+
+// fingerprintSecret returns the hex SHA-256 of a key value. Comparing
+// fingerprints tells whether two environments hold the same key without
+// either value being shown; audit entries carry the short form so they can
+// be matched to key_fingerprint output.
+func fingerprintSecret(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// shortFingerprint returns the first shortFingerprintLength characters of
+// the fingerprint of value.
+func shortFingerprint(value string) string {
+	return fingerprintSecret(value)[:shortFingerprintLength]
+}
+
+// handleKeyFingerprint isn't subject to the reveal policy: the hash, length
+// and masked preview don't let anyone recover the value.
+func (s *Server) handleKeyFingerprint(ctx context.Context, args map[string]interface{}) CallToolResult {
+	keyName, ok := args["key_name"].(string)
+	if !ok {
+		return failure(codeValidationFailed, "Error: key_name is required", nil)
+	}
+	full, _ := args["full"].(bool)
+
+	config, value, exists := s.keys.lookup(keyName)
+	if !exists {
+		return s.keys.unknownKeyFailure(keyName, s.keys.names())
+	}
+	if value == "" {
+		return failure(codeNotConfigured, fmt.Sprintf("Error: API key '%s' is not configured. Please set the %s environment variable.", keyName, config.EnvLabel()), keyDetails(keyName))
+	}
+
+	fingerprint := shortFingerprint(value)
+	if full {
+		fingerprint = fingerprintSecret(value)
+	}
+	return CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: fmt.Sprintf("API key '%s'\nSHA-256: %s\nLength: %d characters\nPreview: %s",
+			keyName, fingerprint, utf8.RuneCountInString(value), s.keys.maskSecret(value))}},
+	}
+}
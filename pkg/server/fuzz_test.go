@@ -0,0 +1,143 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+// fuzzServer returns an initialized server for fuzz targets to share.
+func fuzzServer(f *testing.F) *server.Server {
+	testmcp.SetKeys(f, map[string]string{"openai": "sk-proj-fuzztest0123456789"})
+	s := server.New(strings.NewReader(""), &bytes.Buffer{}, server.WithLogger(discardLogger))
+	s.Handle([]byte(initializeLine))
+	s.Handle([]byte(initializedLine))
+	return s
+}
+
+// checkReply fails the test unless a reply to line is well formed, and
+// present whenever line is malformed or holds a request.
+func checkReply(t *testing.T, line, reply []byte) {
+	t.Helper()
+	if reply != nil && !json.Valid(reply) {
+		t.Fatalf("reply to %q isn't JSON: %q", line, reply)
+	}
+	if !json.Valid(line) {
+		var response struct {
+			Error struct {
+				Code int `json:"code"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(reply, &response) != nil || response.Error.Code != -32700 {
+			t.Fatalf("reply to malformed %q = %q, want a parse error", line, reply)
+		}
+		return
+	}
+	var request map[string]json.RawMessage
+	if json.Unmarshal(line, &request) != nil {
+		return
+	}
+	_, hasID := request["id"]
+	_, hasMethod := request["method"]
+	if hasID && hasMethod && reply == nil {
+		t.Fatalf("no reply to request %q", line)
+	}
+}
+
+func FuzzHandle(f *testing.F) {
+	for _, line := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"ping"}`,
+		`{"jsonrpc":"2.0","id":{"a":1},"method":"ping"}`,
+		`{"jsonrpc":"2.0","id":9007199254740993,"method":"tools/list","params":"wrong"}`,
+		`{"jsonrpc":"2.0","id":"x","method":"tools/call"}`,
+		`{"jsonrpc":"2.0","id":"x","method":"tools/call","params":null}`,
+		`{"jsonrpc":"2.0","id":2,"method":"resources/read","params":{"uri":7}}`,
+		`{"jsonrpc":"2.0","id":3,"result":{}}`,
+		`{"jsonrpc":"1.0","id":4,"method":"ping"}`,
+		`[{"jsonrpc":"2.0","id":5,"method":"ping"},{"jsonrpc":"2.0","method":"notifications/initialized"}]`,
+		`[]`,
+		`[1,"two",null]`,
+		`{"jsonrpc":"2.0",`,
+		`"` + strings.Repeat("x", 10000) + `"`,
+		``,
+	} {
+		f.Add([]byte(line))
+	}
+	s := fuzzServer(f)
+
+	f.Fuzz(func(t *testing.T, line []byte) {
+		checkReply(t, line, s.Handle(line))
+	})
+}
+
+func FuzzBatch(f *testing.F) {
+	f.Add([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`), []byte(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1}}`))
+	f.Add([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	f.Add([]byte(`[]`), []byte(`null`))
+	f.Add([]byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"get_api_key","arguments":{"key_name":["openai"]}}}`), []byte(`3`))
+	s := fuzzServer(f)
+
+	f.Fuzz(func(t *testing.T, first, second []byte) {
+		if !json.Valid(first) || !json.Valid(second) {
+			t.Skip()
+		}
+		line := []byte("[" + string(first) + "," + string(second) + "]")
+		reply := s.Handle(line)
+		if reply == nil {
+			// Only a batch of notifications and client responses goes unanswered
+			for _, message := range [][]byte{first, second} {
+				var request map[string]json.RawMessage
+				if json.Unmarshal(message, &request) != nil {
+					t.Fatalf("no reply to batch %q with a malformed entry", line)
+				}
+				if _, hasID := request["id"]; hasID {
+					if _, hasMethod := request["method"]; hasMethod {
+						t.Fatalf("no reply to batch %q with a request", line)
+					}
+				}
+			}
+			return
+		}
+		var responses []json.RawMessage
+		if err := json.Unmarshal(reply, &responses); err != nil || len(responses) == 0 || len(responses) > 2 {
+			t.Fatalf("reply to batch %q = %q, want one or two responses", line, reply)
+		}
+	})
+}
+
+func FuzzToolCallArguments(f *testing.F) {
+	for _, seed := range []struct{ name, arguments string }{
+		{"get_api_key", `{"key_name":"openai"}`},
+		{"get_api_key", `{"key_name":1}`},
+		{"get_api_key", `{"key_name":"openai","transform":{"a":[[[[[]]]]]}}`},
+		{"check_api_key_exists", `"openai"`},
+		{"list_api_keys", `{"category":null}`},
+		{"get_api_key", `{"key_name":"` + strings.Repeat("k", 5000) + `"}`},
+		{"no_such_tool", `{}`},
+		{"", `[]`},
+	} {
+		f.Add(seed.name, []byte(seed.arguments))
+	}
+	s := fuzzServer(f)
+
+	f.Fuzz(func(t *testing.T, name string, arguments []byte) {
+		if !json.Valid(arguments) {
+			t.Skip()
+		}
+		params, _ := json.Marshal(map[string]interface{}{"name": name, "arguments": json.RawMessage(arguments)})
+		line := []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":` + string(params) + `}`)
+		reply := s.Handle(line)
+		var response struct {
+			ID     json.RawMessage `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  json.RawMessage `json:"error"`
+		}
+		if err := json.Unmarshal(reply, &response); err != nil || string(response.ID) != "1" || (response.Result == nil) == (response.Error == nil) {
+			t.Fatalf("reply to %q = %q, want a result or an error for id 1", line, reply)
+		}
+	})
+}
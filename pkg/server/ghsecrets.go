@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// ghSecretApps are the secret stores gh secret set can write to.
+var ghSecretApps = []string{"actions", "dependabot", "codespaces"}
+
+var (
+	ghRepoName        = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+	ghEnvironmentName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// ghSecretArgs returns the arguments of gh that set the secret envVar, read
+// from stdin.
+func ghSecretArgs(envVar, app, repo, environment string) []string {
+	args := []string{"secret", "set", envVar}
+	if app != "actions" {
+		args = append(args, "--app", app)
+	}
+	if repo != "" {
+		args = append(args, "--repo", repo)
+	}
+	if environment != "" {
+		args = append(args, "--env", environment)
+	}
+	return args
+}
+
+// runGhSecretSet sets one secret with the gh CLI, passing the value on
+// stdin so it never appears in the process list.
+func runGhSecretSet(ctx context.Context, args []string, value string) error {
+	cmd := exec.CommandContext(ctx, "gh", args...)
+	cmd.Stdin = strings.NewReader(value)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return fmt.Errorf("%v: %s", err, message)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Server) handleGenerateGhSecretsCommands(ctx context.Context, args map[string]interface{}) CallToolResult {
+	app := "actions"
+	if a, ok := args["app"].(string); ok && a != "" {
+		app = a
+	}
+	repo, _ := args["repo"].(string)
+	environment, _ := args["environment"].(string)
+	includeValues, _ := args["include_values"].(bool)
+	execute, _ := args["execute"].(bool)
+
+	// Both end up as gh arguments, so they must not look like flags
+	switch {
+	case repo != "" && !ghRepoName.MatchString(repo):
+		return failure(codeValidationFailed, fmt.Sprintf("Error: %q is not a repository name of the form owner/name", repo), nil)
+	case environment != "" && !ghEnvironmentName.MatchString(environment):
+		return failure(codeValidationFailed, fmt.Sprintf("Error: %q is not a valid environment name", environment), nil)
+	case execute && !s.allowExec:
+		return failure(codePolicyDenied, "Error: execute needs the server to be started with --allow-exec. Run the commands yourself instead.", nil)
+	case execute && s.dryRun:
+		return failure(codePolicyDenied, "Error: execute is disabled in dry-run mode, which never sends key values anywhere.", nil)
+	}
+
+	keyNames, err := s.keys.selectedKeys(args)
+	if err != nil {
+		return errorFailure(err, codeValidationFailed, nil)
+	}
+
+	var commands, workflow, report []string
+	revealed := 0
+	for _, keyName := range keyNames {
+		config, _ := s.keys.config(keyName)
+		for _, envVar := range config.EnvVars() {
+			workflow = append(workflow, fmt.Sprintf("  %s: ${{ secrets.%s }}", envVar, envVar))
+		}
+
+		if !includeValues && !execute {
+			// Reads the value from the shell running the command
+			for _, envVar := range config.EnvVars() {
+				commands = append(commands, fmt.Sprintf("gh %s --body \"$%s\"", strings.Join(ghSecretArgs(envVar, app, repo, environment), " "), envVar))
+			}
+			continue
+		}
+		value, reason := s.revealForTool(ctx, keyName)
+		if reason != "" {
+			commands = append(commands, fmt.Sprintf("# %s: %s", config.EnvLabel(), reason))
+			report = append(report, fmt.Sprintf("%s %s: skipped, %s", s.markers.status(false), config.EnvLabel(), reason))
+			continue
+		}
+		revealed++
+		memberValues := keyEnvValues(config, value)
+		for _, envVar := range config.EnvVars() {
+			ghArgs := ghSecretArgs(envVar, app, repo, environment)
+			if !execute {
+				commands = append(commands, fmt.Sprintf("gh %s --body %s", strings.Join(ghArgs, " "), escapeTemplateValue(memberValues[envVar], "shell")))
+				continue
+			}
+			if err := runGhSecretSet(ctx, ghArgs, memberValues[envVar]); err != nil {
+				report = append(report, fmt.Sprintf("%s %s: failed: %v", s.markers.status(false), envVar, s.keys.secrets.scrubError(err)))
+			} else {
+				report = append(report, fmt.Sprintf("%s %s: set", s.markers.status(true), envVar))
+			}
+		}
+	}
+	if revealed > 0 {
+		s.noteAudit(ctx, "info", fmt.Sprintf("generate_gh_secrets_commands used the values of %d API keys", revealed))
+	}
+
+	snippet := "# In your workflow job or step:\nenv:\n" + strings.Join(workflow, "\n") + "\n"
+	if execute {
+		return CallToolResult{
+			Content: []ContentBlock{
+				{Type: "text", Text: "Ran gh secret set:\n" + strings.Join(report, "\n")},
+				{Type: "text", Text: snippet},
+			},
+		}
+	}
+	result := CallToolResult{
+		Content: []ContentBlock{
+			{Type: "text", Text: strings.Join(commands, "\n") + "\n"},
+			{Type: "text", Text: snippet},
+		},
+	}
+	if s.dryRun && revealed > 0 {
+		result.Content = append([]ContentBlock{{Type: "text", Text: dryRunNotice}}, result.Content...)
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// checkGolden compares got with testdata/golden/name, or rewrites the file
+// with -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v; run go test -run %s -update to create it", err, t.Name())
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from %s; run go test -run %s -update if the change is meant", name, path, t.Name())
+	}
+}
+
+// goldenPayloads returns the list_api_keys result and every tools/list page
+// of a fresh server with opts, as sent to the client.
+func goldenPayloads(t *testing.T, opts ...server.Option) (listing, tools []byte) {
+	t.Helper()
+	s := server.New(strings.NewReader(""), &bytes.Buffer{}, append([]server.Option{server.WithLogger(discardLogger)}, opts...)...)
+	s.Handle([]byte(initializeLine))
+	s.Handle([]byte(initializedLine))
+
+	listing = s.Handle([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"list_api_keys","arguments":{}}}`))
+	cursor := ""
+	for page := 2; ; page++ {
+		reply := s.Handle([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/list","params":{"cursor":%q}}`, page, cursor)))
+		tools = append(tools, reply...)
+		tools = append(tools, '\n')
+		var response struct {
+			Result server.ToolsListResult `json:"result"`
+		}
+		if err := json.Unmarshal(reply, &response); err != nil {
+			t.Fatalf("tools/list = %s", reply)
+		}
+		if cursor = response.Result.NextCursor; cursor == "" {
+			return append(listing, '\n'), tools
+		}
+	}
+}
+
+func TestGoldenPayloads(t *testing.T) {
+	testmcp.ClearKeys(t)
+	listing, tools := goldenPayloads(t)
+	checkGolden(t, "list_api_keys.json", listing)
+	checkGolden(t, "tools_list.jsonl", tools)
+
+	// And a second server sends the same bytes
+	againListing, againTools := goldenPayloads(t)
+	if !bytes.Equal(listing, againListing) || !bytes.Equal(tools, againTools) {
+		t.Error("two servers with the same keys send different payloads")
+	}
+}
+
+func TestGoldenPayloadsPlainOutput(t *testing.T) {
+	testmcp.ClearKeys(t)
+	listing, tools := goldenPayloads(t, server.WithPlainOutput())
+	checkGolden(t, "list_api_keys_plain.json", listing)
+	checkGolden(t, "tools_list_plain.jsonl", tools)
+	if bytes.ContainsAny(listing, "✅❌⚠️⭕") {
+		t.Errorf("the plain listing has emoji: %s", listing)
+	}
+}
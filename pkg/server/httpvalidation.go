@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// valuePlaceholder marks where a custom validation puts the key's value.
+const valuePlaceholder = "{{value}}"
+
+// httpValidation is a live check declared in the config file for a key the
+// built-in validators don't cover, such as an internal service's health
+// endpoint. The URL comes only from the operator's config; the value goes
+// only where {{value}} appears in a header or the query string.
+type httpValidation struct {
+	// Method is GET, HEAD or POST; GET when empty.
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// Headers are sent with the request, such as
+	// {"Authorization": "Bearer {{value}}"}.
+	Headers map[string]string `json:"headers"`
+	// ExpectStatus lists the status codes that mean the key is valid;
+	// [200] when empty.
+	ExpectStatus []int `json:"expect_status"`
+	// Field is an optional dotted path into a JSON response, such as
+	// "account.name", reported with the result.
+	Field string `json:"field"`
+
+	key string
+	// secrets is the registry's redactor, which learns the value as it
+	// appears in the URL.
+	secrets *redactor
+}
+
+// validate checks the definition for keyName when the config is loaded.
+func (v *httpValidation) validate(keyName string) error {
+	switch v.Method = strings.ToUpper(v.Method); v.Method {
+	case "":
+		v.Method = http.MethodGet
+	case http.MethodGet, http.MethodHead, http.MethodPost:
+	default:
+		return fmt.Errorf("validations: %s: method must be GET, HEAD or POST", keyName)
+	}
+
+	parsed, err := url.Parse(v.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("validations: %s: url must be an absolute http or https URL", keyName)
+	}
+	if beforeQuery, _, _ := strings.Cut(v.URL, "?"); strings.Contains(beforeQuery, valuePlaceholder) {
+		return fmt.Errorf("validations: %s: %s may only appear in a header or the query string, not the host or path", keyName, valuePlaceholder)
+	}
+	used := strings.Contains(parsed.RawQuery, valuePlaceholder)
+	for _, value := range v.Headers {
+		used = used || strings.Contains(value, valuePlaceholder)
+	}
+	if !used {
+		return fmt.Errorf("validations: %s: put %s in a header or the query string", keyName, valuePlaceholder)
+	}
+
+	if len(v.ExpectStatus) == 0 {
+		v.ExpectStatus = []int{http.StatusOK}
+	}
+	for _, status := range v.ExpectStatus {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("validations: %s: %d is not an HTTP status code", keyName, status)
+		}
+	}
+	return nil
+}
+
+// addHTTPValidations adds the config file's validations to the registry's
+// live checks, replacing a built-in one for the same key. The keys must be in the
+// registry.
+func addHTTPValidations(keys *keyRegistry, validations map[string]httpValidation) error {
+	for name, validation := range validations {
+		if _, exists := keys.config(name); !exists {
+			return fmt.Errorf("validations: unknown key %s", name)
+		}
+		if err := validation.validate(name); err != nil {
+			return err
+		}
+		validation.key = name
+		validation.secrets = keys.secrets
+		keys.validators[name] = liveValidator{Check: validation.check}
+	}
+	if len(validations) > 0 {
+		keys.version.Add(1)
+	}
+	return nil
+}
+
+// check sends the request with value in place of {{value}} and reports the
+// key valid when the status is one of those expected.
+func (v httpValidation) check(ctx context.Context, value string) (liveResult, error) {
+	// The escaped value is what would show up in an error quoting the URL
+	escaped := url.QueryEscape(value)
+	v.secrets.remember(v.key, escaped)
+	target := strings.ReplaceAll(v.URL, valuePlaceholder, escaped)
+	headers := make(map[string]string, len(v.Headers))
+	for name, header := range v.Headers {
+		headers[name] = strings.ReplaceAll(header, valuePlaceholder, value)
+	}
+
+	response, body, err := providerRequest(ctx, v.Method, target, headers, "")
+	if err != nil {
+		return liveResult{}, err
+	}
+	expected := false
+	for _, status := range v.ExpectStatus {
+		expected = expected || response.StatusCode == status
+	}
+	if !expected {
+		return liveResult{Detail: fmt.Sprintf("%s returned %s, expected %s", response.Request.URL.Host, response.Status, joinStatuses(v.ExpectStatus))}, nil
+	}
+
+	result := liveResult{Valid: true}
+	if v.Field != "" {
+		if field, ok := jsonField(body, v.Field); ok {
+			result.Info = map[string]string{v.Field: v.secrets.scrub(field)}
+		}
+	}
+	return result, nil
+}
+
+// jsonField follows a dotted path into a JSON document and returns what
+// it finds as text.
+func jsonField(body []byte, path string) (string, bool) {
+	var current interface{}
+	if err := json.Unmarshal(body, &current); err != nil {
+		return "", false
+	}
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if current, ok = object[part]; !ok {
+			return "", false
+		}
+	}
+	if text, ok := current.(string); ok {
+		return text, true
+	}
+	encoded, err := json.Marshal(current)
+	return string(encoded), err == nil
+}
+
+func joinStatuses(statuses []int) string {
+	parts := make([]string, len(statuses))
+	for i, status := range statuses {
+		parts[i] = strconv.Itoa(status)
+	}
+	return strings.Join(parts, " or ")
+}
@@ -0,0 +1,184 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+// whoamiServer answers like an internal service's health endpoint: 200
+// with the account for the token "good+token/=", or with the token itself
+// as the account name for tokens starting "echo-", and 401 for anything
+// else. It records every request.
+func whoamiServer(t *testing.T) (string, *[]*http.Request) {
+	t.Helper()
+	var requests []*http.Request
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = r.URL.Query().Get("key")
+		}
+		switch {
+		case strings.HasPrefix(token, "echo-"):
+			fmt.Fprintf(w, `{"account": {"name": %q}}`, token)
+		case token != "good+token/=":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Method == http.MethodHead:
+		default:
+			fmt.Fprint(w, `{"account": {"name": "acme", "seats": 12}}`)
+		}
+	}))
+	t.Cleanup(backend.Close)
+	return backend.URL, &requests
+}
+
+// liveResults calls validate_api_key_live for keyName and returns its
+// structured results.
+func liveResults(t *testing.T, c *testmcp.Client, keyName string) (string, []map[string]interface{}) {
+	t.Helper()
+	result, err := c.CallTool("validate_api_key_live", map[string]interface{}{"key_name": keyName})
+	if err != nil || result.IsError {
+		t.Fatalf("validate_api_key_live %s = %+v, %v", keyName, result, err)
+	}
+	var structured struct {
+		Results []map[string]interface{} `json:"results"`
+	}
+	data, _ := json.Marshal(result.StructuredContent)
+	if err := json.Unmarshal(data, &structured); err != nil {
+		t.Fatal(err)
+	}
+	return testmcp.Text(result), structured.Results
+}
+
+func TestHTTPValidation(t *testing.T) {
+	url, requests := whoamiServer(t)
+	testmcp.SetKeys(t, map[string]string{
+		"openai":    "good+token/=",
+		"anthropic": "good+token/=",
+		"cohere":    "bad-token0123456789",
+		"sendgrid":  "good+token/=",
+	})
+	c := awsClient(t)
+	validations := fmt.Sprintf(`{
+		"openai": {"url": %[1]q, "headers": {"Authorization": "Bearer {{value}}"}, "field": "account.name"},
+		"anthropic": {"url": "%[1]s/check?key={{value}}&verbose=1", "method": "head", "expect_status": [200, 204]},
+		"cohere": {"url": %[1]q, "method": "POST", "headers": {"Authorization": "Bearer {{value}}"}},
+		"sendgrid": {"url": %[1]q, "headers": {"Authorization": "Bearer {{value}}"}, "field": "account.seats"}
+	}`, url)
+	if err := server.AddHTTPValidations(c.Server, validations); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		key, method, text string
+		valid             bool
+	}{
+		{"openai", http.MethodGet, "openai: valid (account.name=acme)", true},
+		{"anthropic", http.MethodHead, "anthropic: valid", true},
+		{"cohere", http.MethodPost, "returned 401 Unauthorized, expected 200", false},
+		{"sendgrid", http.MethodGet, "sendgrid: valid (account.seats=12)", true},
+	} {
+		*requests = nil
+		text, results := liveResults(t, c, test.key)
+		if !strings.Contains(text, test.text) {
+			t.Errorf("%s: validate_api_key_live = %q, want %q", test.key, text, test.text)
+		}
+		if len(results) != 1 || results[0]["valid"] != test.valid {
+			t.Errorf("%s: results = %v, want valid %v", test.key, results, test.valid)
+		}
+		if len(*requests) != 1 || (*requests)[0].Method != test.method {
+			t.Fatalf("%s: requests = %v, want one %s", test.key, *requests, test.method)
+		}
+		if strings.Contains(text, "good+token") || strings.Contains(text, "bad-token") {
+			t.Errorf("%s: the result holds the value: %q", test.key, text)
+		}
+	}
+
+	// The value is escaped in the query, so the backend reads it back intact
+	*requests = nil
+	liveResults(t, c, "anthropic")
+	if query := (*requests)[0].URL.Query(); query.Get("key") != "good+token/=" || query.Get("verbose") != "1" {
+		t.Errorf("query = %v", query)
+	}
+
+	// A reported field that echoes the value is redacted
+	testmcp.SetKeys(t, map[string]string{"openai": "echo-0123456789abcdef"})
+	if text, _ := liveResults(t, c, "openai"); !strings.Contains(text, "account.name=[REDACTED:openai]") {
+		t.Errorf("an echoed value = %q, want it redacted", text)
+	}
+}
+
+func TestHTTPValidationErrorsAreRedacted(t *testing.T) {
+	// Nothing listens on a port that was just closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-unreachable/0123456789"})
+	c := awsClient(t)
+	if err := server.AddHTTPValidations(c.Server, fmt.Sprintf(`{"openai": {"url": "http://%s/?key={{value}}"}}`, address)); err != nil {
+		t.Fatal(err)
+	}
+	text, results := liveResults(t, c, "openai")
+	if !strings.Contains(text, "could not check") || len(results) != 1 || results[0]["valid"] != false {
+		t.Errorf("an unreachable service = %q, %v", text, results)
+	}
+	if strings.Contains(text, "unreachable") || !strings.Contains(text, "[REDACTED:openai]") {
+		t.Errorf("the error quotes the value: %q", text)
+	}
+}
+
+func TestHTTPValidationNeedsNetwork(t *testing.T) {
+	url, requests := whoamiServer(t)
+	testmcp.SetKeys(t, map[string]string{"openai": "good+token/="})
+	c := newClient(t)
+	if err := server.AddHTTPValidations(c.Server, fmt.Sprintf(`{"openai": {"url": %q, "headers": {"X-API-Key": "{{value}}"}}}`, url)); err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.CallTool("validate_api_key_live", map[string]interface{}{"key_name": "openai"})
+	if err == nil && !result.IsError {
+		t.Errorf("validate_api_key_live without --allow-network = %q", testmcp.Text(result))
+	}
+	if len(*requests) != 0 {
+		t.Errorf("%d requests were made without --allow-network", len(*requests))
+	}
+}
+
+func TestHTTPValidationsAreChecked(t *testing.T) {
+	dir := t.TempDir()
+	for _, test := range []struct {
+		validation, want string
+	}{
+		{`"nonexistent": {"url": "https://api.internal/?k={{value}}"}`, "unknown key nonexistent"},
+		{`"openai": {"url": "https://api.internal/?k={{value}}", "method": "DELETE"}`, "method must be GET, HEAD or POST"},
+		{`"openai": {"url": "ftp://api.internal/?k={{value}}"}`, "absolute http or https URL"},
+		{`"openai": {"url": "/whoami?k={{value}}"}`, "absolute http or https URL"},
+		{`"openai": {"url": "https://{{value}}.internal/"}`, "absolute http or https URL"},
+		{`"openai": {"url": "https://api.internal/{{value}}/whoami"}`, "not the host or path"},
+		{`"openai": {"url": "https://api.internal/whoami"}`, "put {{value}} in a header or the query string"},
+		{`"openai": {"url": "https://api.internal/whoami", "headers": {"X-Key": "{{value}}"}, "expect_status": [42]}`, "42 is not an HTTP status code"},
+	} {
+		path := filepath.Join(dir, "config.json")
+		if err := os.WriteFile(path, []byte(`{"validations": {`+test.validation+`}}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+		code, _, stderr := execute(t, context.Background(), "", "--watch-env=false", "--config", path)
+		if code != 1 || !strings.Contains(stderr, test.want) {
+			t.Errorf("%s: Execute = %d, %s; want %q", test.validation, code, stderr, test.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package server_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+// These tests drive the server only through pkg/testmcp, as a downstream
+// project would.
+
+// newClient returns an initialized client for a server with quiet logs.
+func newClient(t *testing.T, opts ...server.Option) *testmcp.Client {
+	t.Helper()
+	c := testmcp.New(append([]server.Option{server.WithLogger(discardLogger)}, opts...)...)
+	if _, err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestHarnessRefusesCallsBeforeInitialize(t *testing.T) {
+	c := testmcp.New(server.WithLogger(discardLogger))
+	_, err := c.CallTool("list_api_keys", map[string]interface{}{})
+	var rpcErr *testmcp.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32002 {
+		t.Errorf("tools/call before initialize = %v, want error -32002", err)
+	}
+}
+
+func TestHarnessUnknownTool(t *testing.T) {
+	c := newClient(t)
+	_, err := c.CallTool("no_such_tool", nil)
+	var rpcErr *testmcp.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32601 {
+		t.Errorf("an unknown tool = %v, want error -32601", err)
+	}
+}
+
+func TestHarnessSetKeys(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{
+		"openai":                "sk-proj-harnesstest0123456789",
+		"AZURE_OPENAI_ENDPOINT": "https://example.openai.azure.com",
+	})
+	c := newClient(t)
+
+	for keyName, want := range map[string]bool{
+		"openai":    true,
+		"anthropic": false,
+		// Only one of its members is set
+		"azure_openai": false,
+	} {
+		result, err := c.CallTool("check_api_key_exists", map[string]interface{}{"key_name": keyName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if configured := !strings.Contains(testmcp.Text(result), "NOT configured"); configured != want {
+			t.Errorf("check_api_key_exists(%s) = %q, want configured %v", keyName, testmcp.Text(result), want)
+		}
+	}
+
+	result, err := c.CallTool("get_api_key", map[string]interface{}{"key_name": "openai"})
+	if err != nil || result.IsError || !strings.Contains(testmcp.Text(result), "sk-proj-harnesstest0123456789") {
+		t.Errorf("get_api_key = %+v, %v", result, err)
+	}
+}
+
+func TestHarnessRegisterKey(t *testing.T) {
+	testmcp.ClearKeys(t)
+	c := testmcp.New(server.WithLogger(discardLogger))
+	c.RegisterKey(t, "internal_tools", internalToolsKey, "it-harness-0123456789abcdef")
+	if _, err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	tools, err := c.ListTools()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tool := range tools {
+		if tool.Name != "get_api_key" {
+			continue
+		}
+		if enum := tool.InputSchema.Properties["key_name"].Enum; !contains(enum, "internal_tools") {
+			t.Errorf("get_api_key's key_name enum lacks the registered key: %v", enum)
+		}
+	}
+	result, err := c.CallTool("check_api_key_exists", map[string]interface{}{"key_name": "internal_tools"})
+	if err != nil || strings.Contains(testmcp.Text(result), "NOT configured") {
+		t.Errorf("check_api_key_exists = %+v, %v", result, err)
+	}
+}
+
+func TestHarnessResourcesAndPrompts(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-harnesstest0123456789"})
+	c := newClient(t)
+
+	var resources struct {
+		Resources []struct {
+			URI string `json:"uri"`
+		} `json:"resources"`
+	}
+	if err := c.Call("resources/list", nil, &resources); err != nil {
+		t.Fatal(err)
+	}
+	if len(resources.Resources) == 0 {
+		t.Fatal("no resources listed")
+	}
+	var read struct {
+		Contents []struct {
+			Text string `json:"text"`
+		} `json:"contents"`
+	}
+	if err := c.Call("resources/read", map[string]string{"uri": resources.Resources[0].URI}, &read); err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range read.Contents {
+		if strings.Contains(content.Text, "harnesstest") {
+			t.Errorf("resource %s reveals a key value", resources.Resources[0].URI)
+		}
+	}
+
+	var prompt server.GetPromptResult
+	if err := c.Call("prompts/get", map[string]interface{}{"name": "setup_missing_keys", "arguments": map[string]string{"category": "llm"}}, &prompt); err != nil {
+		t.Fatal(err)
+	}
+	if len(prompt.Messages) == 0 {
+		t.Error("setup_missing_keys returned no messages")
+	}
+}
+
+func TestHarnessNotifications(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-harnesstest0123456789"})
+	c := newClient(t)
+	if err := c.Call("logging/setLevel", map[string]string{"level": "debug"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CallTool("get_api_key", map[string]interface{}{"key_name": "openai"}); err != nil {
+		t.Fatal(err)
+	}
+
+	logged := false
+	for _, message := range c.Notifications() {
+		if strings.Contains(string(message), "harnesstest") {
+			t.Errorf("a notification holds the key value: %s", message)
+		}
+		var notification struct {
+			Method string `json:"method"`
+		}
+		if json.Unmarshal(message, &notification) == nil && notification.Method == "notifications/message" {
+			logged = true
+		}
+	}
+	if !logged {
+		t.Errorf("no log notification for the reveal: %s", c.Notifications())
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultJWTMaxExpiry caps the lifetime of tokens mint_test_jwt signs,
+// unless --jwt-max-expiry says otherwise.
+const defaultJWTMaxExpiry = time.Hour
+
+// defaultJWTExpiry is the lifetime of a minted token when none is asked for.
+const defaultJWTExpiry = 15 * time.Minute
+
+// jwtTimeClaims are set by mint_test_jwt itself, so extra claims can't
+// stretch a token past the cap.
+var jwtTimeClaims = []string{"exp", "iat", "nbf"}
+
+var jwtEncoding = base64.RawURLEncoding
+
+// signHS256 returns the HS256 signature of a token's signing input.
+func signHS256(signingInput string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return jwtEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// mintHS256 signs claims as a compact HS256 JWT.
+func mintHS256(claims map[string]interface{}, secret []byte) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := jwtEncoding.EncodeToString(header) + "." + jwtEncoding.EncodeToString(payload)
+	return signingInput + "." + signHS256(signingInput, secret), nil
+}
+
+// verifyHS256 checks a compact JWT's HS256 signature and its exp and nbf
+// claims as of now, returning its claims. Tokens with any other alg are
+// rejected, so "none" can't be used to skip the signature.
+func verifyHS256(token string, secret []byte, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("not a JWT: expected three dot-separated parts")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	headerJSON, err := jwtEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(headerJSON, &header) != nil {
+		return nil, fmt.Errorf("malformed header")
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported alg %q: only HS256 is accepted", header.Alg)
+	}
+	claimsJSON, err := jwtEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed claims")
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims")
+	}
+
+	expected := signHS256(parts[0]+"."+parts[1], secret)
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return claims, fmt.Errorf("signature mismatch: the token wasn't signed with this secret")
+	}
+	if exp, ok := claims["exp"].(float64); ok && now.Unix() >= int64(exp) {
+		return claims, fmt.Errorf("expired at %s", time.Unix(int64(exp), 0).UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Unix() < int64(nbf) {
+		return claims, fmt.Errorf("not valid before %s", time.Unix(int64(nbf), 0).UTC().Format(time.RFC3339))
+	}
+	return claims, nil
+}
+
+func (s *Server) handleMintTestJWT(ctx context.Context, args map[string]interface{}) CallToolResult {
+	expiry := defaultJWTExpiry
+	if minutes, ok := args["expiry_minutes"].(float64); ok {
+		expiry = time.Duration(minutes * float64(time.Minute))
+	}
+	if expiry <= 0 || expiry > s.jwtMaxExpiry {
+		return failure(codeValidationFailed, fmt.Sprintf("Error: expiry_minutes must be more than 0 and at most %g (set by --jwt-max-expiry)", s.jwtMaxExpiry.Minutes()), nil)
+	}
+	secret, err := s.signingSecret("jwt_secret")
+	if err != nil {
+		return errorFailure(err, codeNotConfigured, keyDetails("jwt_secret"))
+	}
+
+	claims := map[string]interface{}{}
+	if extra, ok := args["claims"].(map[string]interface{}); ok {
+		for name, value := range extra {
+			claims[name] = value
+		}
+	}
+	for _, name := range jwtTimeClaims {
+		delete(claims, name)
+	}
+	if subject, ok := args["subject"].(string); ok && subject != "" {
+		claims["sub"] = subject
+	}
+	now := time.Now()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(expiry).Unix()
+
+	token, err := mintHS256(claims, secret)
+	if err != nil {
+		return failure(codeValidationFailed, fmt.Sprintf("Error: claims can't be encoded: %v", err), nil)
+	}
+	s.noteAudit(ctx, "info", fmt.Sprintf("mint_test_jwt signed a token valid for %s", expiry))
+
+	result := CallToolResult{
+		Content: []ContentBlock{
+			{Type: "text", Text: token},
+			{Type: "text", Text: fmt.Sprintf("HS256 token signed with jwt_secret, expires %s.", now.Add(expiry).UTC().Format(time.RFC3339))},
+		},
+	}
+	if s.dryRun {
+		result.Content = append([]ContentBlock{{Type: "text", Text: dryRunNotice}}, result.Content...)
+	}
+	return result
+}
+
+func (s *Server) handleVerifyJWT(ctx context.Context, args map[string]interface{}) CallToolResult {
+	token, _ := args["token"].(string)
+	secret, err := s.signingSecret("jwt_secret")
+	if err != nil {
+		return errorFailure(err, codeNotConfigured, keyDetails("jwt_secret"))
+	}
+
+	claims, err := verifyHS256(strings.TrimSpace(token), secret, time.Now())
+	verification := map[string]interface{}{"valid": err == nil}
+	if claims != nil {
+		verification["claims"] = claims
+	}
+	var text strings.Builder
+	if err != nil {
+		verification["reason"] = err.Error()
+		text.WriteString(fmt.Sprintf("%s Token is invalid: %v\n", s.markers.status(false), err))
+	} else {
+		text.WriteString(fmt.Sprintf("%s Token is valid: signed with jwt_secret and not expired.\n", s.markers.status(true)))
+	}
+	if claims != nil {
+		data, _ := json.MarshalIndent(claims, "", "  ")
+		text.WriteString("Claims:\n" + string(data) + "\n")
+	}
+
+	toolResult := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text.String()}},
+	}
+	if s.supportsStructuredContent() {
+		toolResult.StructuredContent = verification
+	}
+	return toolResult
+}
+
+// verifyJWTSchema describes the structured result of verify_jwt.
+var verifyJWTSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"valid":  {Type: "boolean", Description: "Whether the signature matches jwt_secret and the token is within its exp and nbf"},
+		"reason": {Type: "string", Description: "Why the token is invalid"},
+		"claims": {Type: "object", Description: "The token's decoded claims, when they could be read"},
+	},
+	Required: []string{"valid"},
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// k8sName matches a valid Kubernetes object name (a DNS-1123 subdomain).
+var k8sName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+
+func validK8sName(name string) bool {
+	return len(name) <= 253 && k8sName.MatchString(name)
+}
+
+// k8sSecretManifest renders a v1 Secret holding values keyed by env var,
+// base64-encoded under data or as plain strings under stringData. skipped
+// lines are listed in a trailing comment.
+func k8sSecretManifest(name, namespace string, envVars []string, values map[string]string, stringData bool, skipped []string) string {
+	var b strings.Builder
+	b.WriteString("# WARNING: this Secret holds real key values and is not sealed or encrypted\n")
+	b.WriteString("# (sealed: false). Apply it directly; never commit it to git.\n")
+	b.WriteString("apiVersion: v1\n")
+	b.WriteString("kind: Secret\n")
+	b.WriteString("metadata:\n")
+	b.WriteString(fmt.Sprintf("  name: %s\n", name))
+	b.WriteString(fmt.Sprintf("  namespace: %s\n", namespace))
+	b.WriteString("type: Opaque\n")
+	if stringData {
+		b.WriteString("stringData:\n")
+	} else {
+		b.WriteString("data:\n")
+	}
+	if len(envVars) == 0 {
+		b.WriteString("  {}\n")
+	}
+	for _, envVar := range envVars {
+		if stringData {
+			// A JSON string is a valid double-quoted YAML scalar
+			quoted, _ := json.Marshal(values[envVar])
+			b.WriteString(fmt.Sprintf("  %s: %s\n", envVar, quoted))
+		} else {
+			b.WriteString(fmt.Sprintf("  %s: %s\n", envVar, base64.StdEncoding.EncodeToString([]byte(values[envVar]))))
+		}
+	}
+	if len(skipped) > 0 {
+		b.WriteString("# Not included:\n")
+		for _, line := range skipped {
+			b.WriteString(fmt.Sprintf("#   %s\n", line))
+		}
+	}
+	return b.String()
+}
+
+// k8sEnvFromSnippet is the container spec fragment that loads every key in
+// the Secret as an environment variable.
+func k8sEnvFromSnippet(name string) string {
+	return fmt.Sprintf("# Add to the container spec of your Deployment:\nenvFrom:\n  - secretRef:\n      name: %s\n", name)
+}
+
+func (s *Server) handleGenerateK8sSecret(ctx context.Context, args map[string]interface{}) CallToolResult {
+	name, _ := args["name"].(string)
+	if name == "" {
+		name = "api-keys"
+	}
+	namespace, _ := args["namespace"].(string)
+	if namespace == "" {
+		namespace = "default"
+	}
+	for _, n := range []string{name, namespace} {
+		if !validK8sName(n) {
+			return failure(codeValidationFailed, fmt.Sprintf("Error: %q is not a valid Kubernetes name: use lowercase letters, digits, '-' and '.'", n), nil)
+		}
+	}
+	stringData, _ := args["string_data"].(bool)
+	withDeployment, _ := args["deployment_snippet"].(bool)
+
+	keyNames, err := s.keys.selectedKeys(args)
+	if err != nil {
+		return errorFailure(err, codeValidationFailed, nil)
+	}
+
+	var envVars, skipped []string
+	values := map[string]string{}
+	included := 0
+	for _, keyName := range keyNames {
+		config, _ := s.keys.config(keyName)
+		if _, done := values[config.EnvVars()[0]]; done {
+			continue
+		}
+		value, reason := s.revealForTool(ctx, keyName)
+		if reason != "" {
+			skipped = append(skipped, fmt.Sprintf("%s (%s): %s", keyName, config.EnvLabel(), reason))
+			continue
+		}
+		included++
+		memberValues := keyEnvValues(config, value)
+		for _, envVar := range config.EnvVars() {
+			envVars = append(envVars, envVar)
+			values[envVar] = memberValues[envVar]
+		}
+	}
+	if included > 0 {
+		s.noteAudit(ctx, "info", fmt.Sprintf("generate_k8s_secret included %d API keys in Secret %s/%s", included, namespace, name))
+	}
+
+	text := k8sSecretManifest(name, namespace, envVars, values, stringData, skipped)
+	if withDeployment {
+		text += "---\n" + k8sEnvFromSnippet(name)
+	}
+	result := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text}},
+	}
+	if s.dryRun {
+		result.Content = append([]ContentBlock{{Type: "text", Text: dryRunNotice}}, result.Content...)
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// environmentPrefix ties a value prefix to the provider environment it
+// belongs to.
+type environmentPrefix struct {
+	prefix      string
+	environment string
+	live        bool
+}
+
+// environmentPrefixes are value prefixes that say which environment a key
+// works against. They are matched on the value, not the key name, so a
+// custom key holding a Stripe or Plaid secret is labelled too.
+var environmentPrefixes = []environmentPrefix{
+	{"sk_live_", "live", true},
+	{"rk_live_", "live", true},
+	{"pk_live_", "live", true},
+	{"sk_test_", "test", false},
+	{"rk_test_", "test", false},
+	{"pk_test_", "test", false},
+	// Plaid access and public tokens
+	{"access-production-", "production", true},
+	{"access-development-", "development", false},
+	{"access-sandbox-", "sandbox", false},
+	{"public-production-", "production", true},
+	{"public-development-", "development", false},
+	{"public-sandbox-", "sandbox", false},
+}
+
+// keyEnvironment returns the environment a value's prefix reveals, such as
+// "live" or "test", and whether it is a production one. It returns "" when
+// the value doesn't say.
+func keyEnvironment(value string) (string, bool) {
+	for _, p := range environmentPrefixes {
+		if strings.HasPrefix(value, p.prefix) {
+			return p.environment, p.live
+		}
+	}
+	return "", false
+}
+
+// isLiveValue reports whether a value works against a production
+// environment.
+func isLiveValue(value string) bool {
+	_, live := keyEnvironment(value)
+	return live
+}
+
+// liveWarning is returned after a production value so that it isn't mistaken
+// for a test key.
+func liveWarning(marker, keyName string) string {
+	return fmt.Sprintf("%s LIVE key: '%s' is a production value. Charges, messages and other changes made with it are real; use a test key for development and tests.", marker, keyName)
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxKeyFileSize caps how much of a credential file the server reads, for
+// checking it and for get_api_key with read_contents. Service account keys
+// and kubeconfigs are a few kilobytes.
+const maxKeyFileSize = 256 << 10
+
+// Formats detectKeyFileFormat recognizes.
+const (
+	keyFileJSON = "json"
+	keyFilePEM  = "pem"
+)
+
+// keyFile describes the credential file a file_path key points at.
+type keyFile struct {
+	Path string
+	Size int
+	// Format is keyFileJSON, keyFilePEM, or empty for anything else, such
+	// as a YAML kubeconfig, which is only checked for being non-empty.
+	Format string
+}
+
+// detectKeyFileFormat recognizes JSON by its extension or a leading brace,
+// and PEM by a BEGIN line.
+func detectKeyFileFormat(path string, data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case strings.EqualFold(filepath.Ext(path), ".json") || bytes.HasPrefix(trimmed, []byte("{")):
+		return keyFileJSON
+	case bytes.Contains(trimmed, []byte("-----BEGIN ")):
+		return keyFilePEM
+	}
+	return ""
+}
+
+// readKeyFile reads the credential file at path and checks it: it must be
+// a readable, non-empty regular file no larger than maxKeyFileSize, and
+// JSON and PEM files must parse. The error says what is wrong without
+// quoting the contents.
+func readKeyFile(path string) (keyFile, []byte, error) {
+	file := keyFile{Path: path}
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		return file, nil, fmt.Errorf("%s doesn't exist", path)
+	case err != nil:
+		return file, nil, fmt.Errorf("can't read %s: %w", path, errors.Unwrap(err))
+	case info.IsDir():
+		return file, nil, fmt.Errorf("%s is a directory, not a file", path)
+	case info.Size() == 0:
+		return file, nil, fmt.Errorf("%s is empty", path)
+	case info.Size() > maxKeyFileSize:
+		return file, nil, fmt.Errorf("%s is %d bytes, more than the %d a key file may be", path, info.Size(), maxKeyFileSize)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return file, nil, fmt.Errorf("can't read %s: %w", path, errors.Unwrap(err))
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxKeyFileSize+1))
+	if err != nil {
+		return file, nil, fmt.Errorf("can't read %s: %w", path, err)
+	}
+	if len(data) > maxKeyFileSize {
+		return file, nil, fmt.Errorf("%s is more than the %d bytes a key file may be", path, maxKeyFileSize)
+	}
+	file.Size = len(data)
+	file.Format = detectKeyFileFormat(path, data)
+
+	switch file.Format {
+	case keyFileJSON:
+		if !json.Valid(data) {
+			return file, nil, fmt.Errorf("%s isn't valid JSON", path)
+		}
+	case keyFilePEM:
+		if block, _ := pem.Decode(data); block == nil {
+			return file, nil, fmt.Errorf("%s has a PEM header but no valid PEM block", path)
+		}
+	}
+	return file, data, nil
+}
+
+// describe summarizes the file for tool output, such as "JSON, 2304 bytes".
+func (f keyFile) describe() string {
+	switch f.Format {
+	case keyFileJSON:
+		return fmt.Sprintf("JSON, %d bytes", f.Size)
+	case keyFilePEM:
+		return fmt.Sprintf("PEM, %d bytes", f.Size)
+	}
+	return fmt.Sprintf("%d bytes", f.Size)
+}
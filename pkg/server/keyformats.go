@@ -0,0 +1,113 @@
+package server
+
+import (
+	"math"
+	"regexp"
+)
+
+// keyFormat is the recognizable shape of one provider's keys.
+type keyFormat struct {
+	Provider string
+	Pattern  *regexp.Regexp
+}
+
+// keyFormats lists the key shapes the server knows, more specific ones
+// first, so an Anthropic key isn't reported as an OpenAI one. Anything that
+// recognizes keys by their shape should read this table.
+var keyFormats = []keyFormat{
+	{"Anthropic API key", regexp.MustCompile(`sk-ant-[A-Za-z0-9_-]{20,}`)},
+	{"OpenAI API key", regexp.MustCompile(`sk-(?:proj-|svcacct-)?[A-Za-z0-9_-]{20,}`)},
+	{"Stripe secret key", regexp.MustCompile(`(?:sk|rk)_(?:live|test)_[A-Za-z0-9]{16,}`)},
+	{"Stripe publishable key", regexp.MustCompile(`pk_(?:live|test)_[A-Za-z0-9]{16,}`)},
+	{"Stripe webhook secret", regexp.MustCompile(`whsec_[A-Za-z0-9+/]{24,}`)},
+	{"AWS access key ID", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"SendGrid API key", regexp.MustCompile(`SG\.[A-Za-z0-9_-]{16,}\.[A-Za-z0-9_-]{16,}`)},
+	{"GitHub token", regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}`)},
+	{"GitLab token", regexp.MustCompile(`glpat-[A-Za-z0-9_-]{20,}`)},
+	{"Google API key", regexp.MustCompile(`AIza[0-9A-Za-z_-]{35}`)},
+	{"Slack token", regexp.MustCompile(`xox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"Slack app token", regexp.MustCompile(`xapp-[A-Za-z0-9-]{10,}`)},
+	{"Twilio account SID", regexp.MustCompile(`\bAC[0-9a-f]{32}\b`)},
+	{"Twilio API key", regexp.MustCompile(`\bSK[0-9a-f]{32}\b`)},
+	{"Private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+}
+
+// keyFormatProviders names the entry of keyFormats that values of each
+// built-in key match, for checking a value before it is saved.
+var keyFormatProviders = map[string]string{
+	"anthropic":       "Anthropic API key",
+	"openai":          "OpenAI API key",
+	"stripe":          "Stripe secret key",
+	"stripe_webhook":  "Stripe webhook secret",
+	"aws_access_key":  "AWS access key ID",
+	"sendgrid":        "SendGrid API key",
+	"github_token":    "GitHub token",
+	"gitlab_token":    "GitLab token",
+	"google_ai":       "Google API key",
+	"slack_bot_token": "Slack token",
+	"slack_app_token": "Slack app token",
+	"twilio_sid":      "Twilio account SID",
+}
+
+// checkKeyFormat reports whether value as a whole has the shape of keyName's
+// values. Keys without a known format accept anything.
+func checkKeyFormat(keyName, value string) (provider string, ok bool) {
+	provider, known := keyFormatProviders[keyName]
+	if !known {
+		return "", true
+	}
+	for _, format := range keyFormats {
+		if format.Provider == provider {
+			return provider, format.Pattern.FindString(value) == value
+		}
+	}
+	return provider, true
+}
+
+// Tokens at least minEntropyTokenLength long whose characters carry at
+// least minTokenEntropy bits each look random enough to be a secret even
+// when no provider pattern matches. Identifiers and words score well below.
+const (
+	minEntropyTokenLength = 20
+	minTokenEntropy       = 3.5
+)
+
+// entropyCandidate matches runs of characters keys are usually made of.
+var entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/=_-]{20,}`)
+
+// shannonEntropy returns the average bits of information per character of s.
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(n)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// looksRandom reports whether token is long and varied enough to be a
+// secret. It must mix letters and digits, which rules out paths and words.
+func looksRandom(token string) bool {
+	if len(token) < minEntropyTokenLength {
+		return false
+	}
+	hasLetter, hasDigit := false, false
+	for _, r := range token {
+		switch {
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+			hasLetter = true
+		}
+	}
+	return hasLetter && hasDigit && shannonEntropy(token) >= minTokenEntropy
+}
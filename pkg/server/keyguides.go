@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// keyGuide says how to get a key: the console page that creates it, what a
+// value looks like, what the free tier allows and which scopes it needs.
+type keyGuide struct {
+	ConsoleURL string   `json:"console_url,omitempty"`
+	Format     string   `json:"format,omitempty"`
+	FreeTier   string   `json:"free_tier,omitempty"`
+	Scopes     []string `json:"scopes,omitempty"`
+}
+
+//go:embed keyguides.json
+var builtinKeyGuides []byte
+
+// mustLoadKeyGuides returns the guide for each built-in key that has one,
+// from keyguides.json, which a registry's guides start from before the
+// config file's key_guides override and extend them. Adding a provider
+// only takes an entry in the file.
+func mustLoadKeyGuides() map[string]keyGuide {
+	guides := map[string]keyGuide{}
+	if err := json.Unmarshal(builtinKeyGuides, &guides); err != nil {
+		panic("invalid keyguides.json: " + err.Error())
+	}
+	return guides
+}
+
+// addKeyGuides applies the config file's key_guides over the built-in
+// ones, field by field, so an entry can change just the console URL.
+func addKeyGuides(keys *keyRegistry, guides map[string]keyGuide) error {
+	for name, guide := range guides {
+		if _, exists := keys.config(name); !exists {
+			return fmt.Errorf("key_guides: unknown key %s", name)
+		}
+		merged := keys.guides[name]
+		if guide.ConsoleURL != "" {
+			merged.ConsoleURL = guide.ConsoleURL
+		}
+		if guide.Format != "" {
+			merged.Format = guide.Format
+		}
+		if guide.FreeTier != "" {
+			merged.FreeTier = guide.FreeTier
+		}
+		if guide.Scopes != nil {
+			merged.Scopes = guide.Scopes
+		}
+		keys.guides[name] = merged
+	}
+	return nil
+}
+
+// obtainHint is appended to "not configured" errors: where the key can be
+// created, when its guide says.
+func (k *keyRegistry) obtainHint(keyName string) string {
+	if url := k.guides[keyName].ConsoleURL; url != "" {
+		return fmt.Sprintf(" Create one at %s.", url)
+	}
+	return ""
+}
+
+// keyGuideSchema describes the structured result of how_to_obtain_key.
+var keyGuideSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"key_name":    {Type: "string"},
+		"env_var":     {Type: "string", Description: "Where the server reads the key from"},
+		"configured":  {Type: "boolean"},
+		"console_url": {Type: "string", Description: "Page where the key is created"},
+		"format":      {Type: "string", Description: "What a value looks like"},
+		"free_tier":   {Type: "string", Description: "What can be done without paying"},
+		"scopes":      {Type: "array", Items: &Property{Type: "string"}, Description: "Permissions or scopes the key needs"},
+	},
+	Required: []string{"key_name", "env_var", "configured"},
+}
+
+func (s *Server) handleHowToObtainKey(ctx context.Context, args map[string]interface{}) CallToolResult {
+	keyName, ok := args["key_name"].(string)
+	if !ok {
+		return failure(codeValidationFailed, "Error: key_name is required", nil)
+	}
+	config, value, exists := s.keys.lookup(keyName)
+	if !exists {
+		return s.keys.unknownKeyFailure(keyName, s.keys.names())
+	}
+	guide, ok := s.keys.guides[keyName]
+	if !ok {
+		return failure(codeNotFound, fmt.Sprintf("Error: there is no guide for '%s' (%s). Ask whoever runs the service it belongs to, or add one under key_guides in the config file.", keyName, config.Description), keyDetails(keyName))
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("How to obtain '%s' (%s):\n", keyName, config.Description))
+	if guide.ConsoleURL != "" {
+		text.WriteString(fmt.Sprintf("  Create it at: %s\n", guide.ConsoleURL))
+	}
+	if guide.Format != "" {
+		text.WriteString(fmt.Sprintf("  Format: %s\n", guide.Format))
+	}
+	if guide.FreeTier != "" {
+		text.WriteString(fmt.Sprintf("  Free tier: %s\n", guide.FreeTier))
+	}
+	if len(guide.Scopes) > 0 {
+		text.WriteString(fmt.Sprintf("  Scopes: %s\n", strings.Join(guide.Scopes, "; ")))
+	}
+	text.WriteString(fmt.Sprintf("Then set %s in .env or the environment.", config.EnvLabel()))
+	if value != "" {
+		text.WriteString(" It is already configured.")
+	}
+
+	result := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text.String()}},
+	}
+	if s.supportsStructuredContent() {
+		result.StructuredContent = struct {
+			KeyName    string `json:"key_name"`
+			EnvVar     string `json:"env_var"`
+			Configured bool   `json:"configured"`
+			keyGuide
+		}{keyName, config.EnvLabel(), value != "", guide}
+	}
+	return result
+}
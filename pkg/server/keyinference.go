@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"path"
+)
+
+// keyInference guesses what a variable no registered key reads is from its
+// name, so candidates for the registry come with a category and a
+// description instead of a bare name.
+type keyInference struct {
+	// Pattern is a glob over the variable name, such as "GITHUB_*" or
+	// "*_DATABASE_URL".
+	Pattern     string `json:"pattern"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+}
+
+// inferredKey is the guess for one variable, and the pattern it came from,
+// so it is never mistaken for registry metadata.
+type inferredKey struct {
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	// Source is the pattern that matched, such as "GITHUB_*".
+	Source string `json:"source"`
+}
+
+// defaultKeyInferences is the built-in inference table. A registry tries
+// the config file's key_inference entries first, then these.
+var defaultKeyInferences = []keyInference{
+	{"GITHUB_*", "vcs", "GitHub credential or setting"},
+	{"GH_*", "vcs", "GitHub CLI credential or setting"},
+	{"GITLAB_*", "vcs", "GitLab credential or setting"},
+	{"BITBUCKET_*", "vcs", "Bitbucket credential or setting"},
+	{"OPENAI_*", "llm", "OpenAI setting"},
+	{"ANTHROPIC_*", "llm", "Anthropic setting"},
+	{"MISTRAL_*", "llm", "Mistral AI credential or setting"},
+	{"GROQ_*", "llm", "Groq credential or setting"},
+	{"HUGGINGFACE*", "llm", "Hugging Face credential or setting"},
+	{"HF_*", "llm", "Hugging Face credential or setting"},
+	{"REPLICATE_*", "llm", "Replicate credential or setting"},
+	{"PINECONE_*", "llm", "Pinecone vector database credential or setting"},
+	{"CANVA_*", "canva", "Canva integration setting"},
+	{"*_DATABASE_URL", "internal", "Database connection URL"},
+	{"*_DB_URL", "internal", "Database connection URL"},
+	{"*_REDIS_URL", "internal", "Redis connection URL"},
+	{"*_JWT_SECRET", "internal", "JWT signing secret"},
+	{"SUPABASE_*", "internal", "Supabase project URL or key"},
+	{"POSTGRES_*", "internal", "PostgreSQL connection setting"},
+	{"MONGO*", "internal", "MongoDB connection setting"},
+	{"VERCEL_*", "saas", "Vercel credential or setting"},
+	{"NETLIFY_*", "saas", "Netlify credential or setting"},
+	{"CLOUDFLARE_*", "saas", "Cloudflare credential or setting"},
+	{"AWS_*", "saas", "AWS credential or setting"},
+	{"AZURE_*", "saas", "Azure credential or setting"},
+	{"GOOGLE_*", "saas", "Google Cloud credential or setting"},
+	{"STRIPE_*", "saas", "Stripe credential or setting"},
+	{"SENTRY_*", "saas", "Sentry credential or setting"},
+	{"DATADOG_*", "saas", "Datadog credential or setting"},
+	{"DD_*", "saas", "Datadog agent setting"},
+	{"SLACK_*", "saas", "Slack credential or setting"},
+	{"TWILIO_*", "saas", "Twilio credential or setting"},
+	{"SENDGRID_*", "saas", "SendGrid credential or setting"},
+	{"RESEND_*", "saas", "Resend email credential or setting"},
+	{"POSTHOG_*", "saas", "PostHog credential or setting"},
+}
+
+// addKeyInferences puts the config file's key_inference entries ahead of
+// the built-in ones, so they can override them.
+func (k *keyRegistry) addKeyInferences(inferences []keyInference) error {
+	for _, inference := range inferences {
+		if _, err := path.Match(inference.Pattern, ""); err != nil || inference.Pattern == "" {
+			return fmt.Errorf("key_inference: invalid pattern %q", inference.Pattern)
+		}
+		if inference.Category == "all" || !validCategory(inference.Category) {
+			return fmt.Errorf("key_inference: %s: unknown category %q", inference.Pattern, inference.Category)
+		}
+		if inference.Description == "" {
+			return fmt.Errorf("key_inference: %s: needs a description", inference.Pattern)
+		}
+	}
+	k.inferences = append(append([]keyInference(nil), inferences...), k.inferences...)
+	return nil
+}
+
+// inferKey returns the guess of the first entry whose pattern matches
+// envVar, or nil when none does.
+func (k *keyRegistry) inferKey(envVar string) *inferredKey {
+	for _, inference := range k.inferences {
+		if matched, _ := path.Match(inference.Pattern, envVar); matched {
+			return &inferredKey{Category: inference.Category, Description: inference.Description, Source: inference.Pattern}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+// chdir changes the working directory to dir for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(previous); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestInferKey(t *testing.T) {
+	for _, test := range []struct {
+		envVar, category, source string
+	}{
+		{"GITHUB_APP_ID", "vcs", "GITHUB_*"},
+		{"GH_ENTERPRISE_TOKEN", "vcs", "GH_*"},
+		{"STAGING_DATABASE_URL", "internal", "*_DATABASE_URL"},
+		{"ANALYTICS_REDIS_URL", "internal", "*_REDIS_URL"},
+		{"SUPABASE_SERVICE_ROLE_KEY", "internal", "SUPABASE_*"},
+		{"VERCEL_TOKEN", "saas", "VERCEL_*"},
+		{"CLOUDFLARE_API_TOKEN", "saas", "CLOUDFLARE_*"},
+		{"HUGGINGFACEHUB_API_TOKEN", "llm", "HUGGINGFACE*"},
+		{"CANVA_BRAND_ID", "canva", "CANVA_*"},
+		// Patterns match the whole name, case and all
+		{"DATABASE_URL", "", ""},
+		{"github_app_id", "", ""},
+		{"MY_GITHUB_TOKEN", "", ""},
+		{"FEATURE_FLAGS", "", ""},
+	} {
+		category, description, source := server.InferKey(test.envVar)
+		if category != test.category || source != test.source || (description == "") != (test.category == "") {
+			t.Errorf("inferKey(%s) = %q, %q, %q; want %q from %q", test.envVar, category, description, source, test.category, test.source)
+		}
+	}
+}
+
+func TestKeyInferenceFromConfig(t *testing.T) {
+	inferKey, err := server.NewKeyInferrer(`[
+		{"pattern": "ACME_*", "category": "internal", "description": "Acme internal service credential"},
+		{"pattern": "GITHUB_APP_*", "category": "internal", "description": "Our GitHub App"}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		envVar, category, description string
+	}{
+		{"ACME_BILLING_TOKEN", "internal", "Acme internal service credential"},
+		// The config file's entries come before the built-in ones
+		{"GITHUB_APP_ID", "internal", "Our GitHub App"},
+		{"GITHUB_ORG", "vcs", "GitHub credential or setting"},
+	} {
+		if category, description, _ := inferKey(test.envVar); category != test.category || description != test.description {
+			t.Errorf("inferKey(%s) = %q, %q; want %q, %q", test.envVar, category, description, test.category, test.description)
+		}
+	}
+
+	dir := t.TempDir()
+	for inference, want := range map[string]string{
+		`{"pattern": "[ACME_*", "category": "internal", "description": "Acme"}`:  "invalid pattern",
+		`{"pattern": "", "category": "internal", "description": "Acme"}`:         "invalid pattern",
+		`{"pattern": "ACME_*", "category": "discovered", "description": "Acme"}`: "unknown category",
+		`{"pattern": "ACME_*", "category": "all", "description": "Acme"}`:        "unknown category",
+		`{"pattern": "ACME_*", "category": "internal"}`:                          "ACME_*: needs a description",
+	} {
+		path := filepath.Join(dir, "config.json")
+		if err := os.WriteFile(path, []byte(`{"key_inference": [`+inference+`]}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if code, _, stderr := execute(t, context.Background(), "", "--watch-env=false", "--config", path); code != 1 || !strings.Contains(stderr, want) {
+			t.Errorf("%s: Execute = %d, %s; want %q", inference, code, stderr, want)
+		}
+	}
+}
+
+func TestImportInfersUnregisteredVariables(t *testing.T) {
+	testmcp.ClearKeys(t)
+	dir := t.TempDir()
+	chdir(t, dir)
+	template := strings.Join([]string{
+		"OPENAI_API_KEY=",
+		"GITHUB_TOKEN=",
+		"GITHUB_APP_ID=12345",
+		"STAGING_DATABASE_URL=postgres://localhost/staging",
+		"SUPABASE_URL=https://project.supabase.co",
+		"VERCEL_TOKEN=",
+		"CLOUDFLARE_ZONE_ID=",
+		"FEATURE_FLAGS=beta",
+	}, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, ".env.example"), []byte(template), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := newClient(t).CallTool("import_env_template", map[string]interface{}{})
+	if err != nil || result.IsError {
+		t.Fatalf("import_env_template = %+v, %v", result, err)
+	}
+	var plan struct {
+		Entries []struct {
+			EnvVar   string `json:"env_var"`
+			Key      string `json:"key"`
+			Status   string `json:"status"`
+			Inferred *struct {
+				Category    string `json:"category"`
+				Description string `json:"description"`
+				Source      string `json:"source"`
+			} `json:"inferred"`
+		} `json:"entries"`
+	}
+	data, _ := json.Marshal(result.StructuredContent)
+	if err := json.Unmarshal(data, &plan); err != nil {
+		t.Fatal(err)
+	}
+
+	// Registered variables keep their registry metadata and aren't guessed
+	want := map[string]string{
+		"OPENAI_API_KEY":       "openai",
+		"GITHUB_TOKEN":         "github_token",
+		"GITHUB_APP_ID":        "vcs GITHUB_*",
+		"STAGING_DATABASE_URL": "internal *_DATABASE_URL",
+		"SUPABASE_URL":         "internal SUPABASE_*",
+		"VERCEL_TOKEN":         "saas VERCEL_*",
+		"CLOUDFLARE_ZONE_ID":   "saas CLOUDFLARE_*",
+		"FEATURE_FLAGS":        "",
+	}
+	got := map[string]string{}
+	for _, entry := range plan.Entries {
+		switch {
+		case entry.Key != "" && entry.Inferred != nil:
+			t.Errorf("%s is registered as %s but was guessed too", entry.EnvVar, entry.Key)
+		case entry.Key != "":
+			got[entry.EnvVar] = entry.Key
+		case entry.Status != "unregistered":
+			t.Errorf("%s has status %s", entry.EnvVar, entry.Status)
+		case entry.Inferred != nil:
+			got[entry.EnvVar] = entry.Inferred.Category + " " + entry.Inferred.Source
+		default:
+			got[entry.EnvVar] = ""
+		}
+	}
+	for envVar, guess := range want {
+		if got[envVar] != guess {
+			t.Errorf("%s = %q, want %q", envVar, got[envVar], guess)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("entries = %v", got)
+	}
+
+	if text := testmcp.Text(result); !strings.Contains(text, "unregistered (probably vcs: GitHub credential or setting, guessed from GITHUB_*)") {
+		t.Errorf("import_env_template doesn't show the guess:\n%s", text)
+	}
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxKeySuggestions is how many names a did-you-mean hint offers at most.
+const maxKeySuggestions = 3
+
+// normalizeKeyName folds the differences models make when naming a key:
+// case, and '-' for '_'.
+func normalizeKeyName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "-", "_")
+}
+
+// nameForms returns the names a key is known by, normalized: its own,
+// and the environment variables it is read from.
+func (k *keyRegistry) nameForms(name string) []string {
+	config, _ := k.config(name)
+	forms := []string{normalizeKeyName(name)}
+	for _, envVar := range append(config.EnvVars(), config.EnvVarAliases...) {
+		if envVar != "" {
+			forms = append(forms, normalizeKeyName(envVar))
+		}
+	}
+	return forms
+}
+
+// resolveName returns the registered key a client's name for it refers
+// to: the name itself, or the one key that matches it ignoring case and '-'
+// for '_', by name or by environment variable, so that OpenAI and
+// ANTHROPIC_API_KEY find openai and anthropic. Near misses are never
+// resolved, only suggested, so a typo can't reveal a different key.
+func (k *keyRegistry) resolveName(name string) (string, bool) {
+	if _, exists := k.config(name); exists {
+		return name, true
+	}
+	wanted := normalizeKeyName(name)
+	var matches []string
+	for _, candidate := range k.names() {
+		for _, form := range k.nameForms(candidate) {
+			if form == wanted {
+				matches = append(matches, candidate)
+				break
+			}
+		}
+	}
+	if len(matches) != 1 {
+		return "", false
+	}
+	return matches[0], true
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// suggest returns up to maxKeySuggestions of candidates that look
+// like what the client meant by name, closest first: those within a few
+// edits of one of their names, and those their names contain it or it
+// contains.
+func (k *keyRegistry) suggest(name string, candidates []string) []string {
+	wanted := normalizeKeyName(name)
+	if wanted == "" {
+		return nil
+	}
+	threshold := max(2, len([]rune(wanted))/3)
+
+	distances := map[string]int{}
+	for _, candidate := range candidates {
+		best := -1
+		for _, form := range k.nameForms(candidate) {
+			distance := levenshtein(wanted, form)
+			if len(wanted) >= 3 && (strings.Contains(form, wanted) || strings.Contains(wanted, form)) {
+				distance = min(distance, threshold)
+			}
+			if best < 0 || distance < best {
+				best = distance
+			}
+		}
+		if best >= 0 && best <= threshold {
+			distances[candidate] = best
+		}
+	}
+
+	suggestions := make([]string, 0, len(distances))
+	for candidate := range distances {
+		suggestions = append(suggestions, candidate)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if distances[suggestions[i]] != distances[suggestions[j]] {
+			return distances[suggestions[i]] < distances[suggestions[j]]
+		}
+		return suggestions[i] < suggestions[j]
+	})
+	if len(suggestions) > maxKeySuggestions {
+		suggestions = suggestions[:maxKeySuggestions]
+	}
+	return suggestions
+}
+
+// unknownKeyMessage reports an unknown key name, with the closest of
+// candidates as suggestions when there are any.
+func (k *keyRegistry) unknownKeyMessage(keyName string, candidates []string) (string, []string) {
+	message := fmt.Sprintf("Unknown API key name: %s", keyName)
+	suggestions := k.suggest(keyName, candidates)
+	if len(suggestions) > 0 {
+		message += fmt.Sprintf(". Did you mean: %s?", strings.Join(suggestions, ", "))
+	}
+	return message, suggestions
+}
+
+// unknownKeyFailure is the failure for an unknown key name. Suggestions only
+// name keys; nothing about them is looked up.
+func (k *keyRegistry) unknownKeyFailure(keyName string, candidates []string) CallToolResult {
+	message, suggestions := k.unknownKeyMessage(keyName, candidates)
+	details := keyDetails(keyName)
+	if len(suggestions) > 0 {
+		details["suggestions"] = suggestions
+	}
+	return failure(codeUnknownKey, "Error: "+message, details)
+}
+
+// resolveKeyArguments replaces the key names a tool is given, in key_name
+// and keys, with the registered names they resolve to, and refuses names
+// that resolve to none with suggestions. Where the schema doesn't list the
+// names, as when an upstream server may know others, unresolved names are
+// left to the handler.
+func resolveKeyArguments(s *Server, tool Tool, next HandlerFunc) HandlerFunc {
+	keyName, takesKey := tool.InputSchema.Properties["key_name"]
+	keys, takesKeys := tool.InputSchema.Properties["keys"]
+	if !takesKey && !(takesKeys && keys.Items != nil && len(keys.Items.Enum) > 0) {
+		return next
+	}
+	return func(ctx context.Context, args map[string]interface{}) CallToolResult {
+		resolved := make(map[string]interface{}, len(args))
+		for name, value := range args {
+			resolved[name] = value
+		}
+
+		if name, ok := args["key_name"].(string); ok && takesKey && name != "" {
+			if registered, ok := s.keys.resolveName(name); ok {
+				resolved["key_name"] = registered
+			} else if len(keyName.Enum) > 0 {
+				return s.keys.unknownKeyFailure(name, keyName.Enum)
+			}
+		}
+
+		if list, ok := args["keys"].([]interface{}); ok && takesKeys && keys.Items != nil && len(keys.Items.Enum) > 0 {
+			names := make([]interface{}, len(list))
+			for i, item := range list {
+				names[i] = item
+				name, ok := item.(string)
+				if !ok {
+					continue
+				}
+				registered, ok := s.keys.resolveName(name)
+				if !ok {
+					return s.keys.unknownKeyFailure(name, keys.Items.Enum)
+				}
+				names[i] = registered
+			}
+			resolved["keys"] = names
+		}
+
+		return next(ctx, resolved)
+	}
+}
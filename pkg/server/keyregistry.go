@@ -0,0 +1,173 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/registry"
+)
+
+// keyRegistry is the set of keys a server knows, starting from the built-in
+// table. Each Server has its own, so servers embedded in one process can
+// serve different keys; the CLI commands build one of their own.
+type keyRegistry struct {
+	mu      sync.RWMutex
+	configs map[string]registry.APIKeyConfig
+	// version counts changes, so what is built from the registry, like the
+	// tool schemas listing key names, can tell when it is stale.
+	version atomic.Uint64
+	// tenant is the environment of the tenant the session is bound to, which
+	// keys are read from instead of the process environment; nil when the
+	// server has no tenants.
+	tenant atomic.Pointer[tenantEnv]
+
+	// The rest is set up from the flags and config file before the
+	// registry is used, and belongs to it alone: how values are cleaned,
+	// judged and previewed, what the config file adds to the built-in
+	// tables, where each variable came from and what has been resolved.
+	mask           maskSettings
+	sanitizeValues bool
+	placeholders   []*regexp.Regexp
+	inferences     []keyInference
+	guides         map[string]keyGuide
+	validators     map[string]liveValidator
+	sources        *envProvenance
+	rotations      *rotationTracker
+	secrets        *redactor
+}
+
+// newKeyRegistry returns a registry of the built-in keys with the default
+// settings.
+func newKeyRegistry() *keyRegistry {
+	return &keyRegistry{
+		configs:        registry.Defaults(),
+		mask:           defaultMask,
+		sanitizeValues: true,
+		placeholders:   defaultPlaceholders,
+		inferences:     defaultKeyInferences,
+		guides:         mustLoadKeyGuides(),
+		validators:     builtinLiveValidators(),
+		sources:        newEnvProvenance(),
+		rotations:      newRotationTracker(),
+		secrets:        newRedactor(),
+	}
+}
+
+// config returns the registry entry for a key name.
+func (k *keyRegistry) config(name string) (registry.APIKeyConfig, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	config, exists := k.configs[name]
+	return config, exists
+}
+
+// names returns the registered key names in alphabetical order.
+func (k *keyRegistry) names() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	names := make([]string, 0, len(k.configs))
+	for name := range k.configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// count returns how many keys are registered.
+func (k *keyRegistry) count() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.configs)
+}
+
+// add registers config under name, which must not be taken.
+func (k *keyRegistry) add(name string, config registry.APIKeyConfig) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, exists := k.configs[name]; exists {
+		return fmt.Errorf("key %s: %w", name, ErrKeyExists)
+	}
+	k.configs[name] = config
+	k.version.Add(1)
+	return nil
+}
+
+// update replaces every entry with what change returns for it, dropping
+// those it reports false for.
+func (k *keyRegistry) update(change func(name string, config registry.APIKeyConfig) (registry.APIKeyConfig, bool)) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for name, config := range k.configs {
+		if config, keep := change(name, config); keep {
+			k.configs[name] = config
+		} else {
+			delete(k.configs, name)
+		}
+	}
+	k.version.Add(1)
+}
+
+// lookup returns the registry entry for a key name and its current value,
+// which is empty when the key isn't configured. It reports false for names
+// that aren't in the registry. Tools, resources and the CLI all resolve keys
+// through it, and every value it resolves is redacted from logs and errors.
+func (k *keyRegistry) lookup(name string) (registry.APIKeyConfig, string, bool) {
+	config, exists := k.config(name)
+	if !exists {
+		return registry.APIKeyConfig{}, "", false
+	}
+	if config.IsComposite() {
+		return config, k.compositeValue(name, config), true
+	}
+	value := ""
+	for _, envVar := range keyEnvVars(config) {
+		if value = k.resolvedEnv(envVar); value != "" {
+			break
+		}
+	}
+	// A credential file's path isn't secret; its contents are remembered
+	// when they are read
+	if !config.IsFilePath() {
+		k.secrets.remember(name, value)
+	}
+	return config, value, true
+}
+
+// bindTenant makes the registry read every key from a tenant's
+// environment.
+func (k *keyRegistry) bindTenant(env *tenantEnv) {
+	k.tenant.Store(env)
+	k.version.Add(1)
+}
+
+// tenantName returns the name of the tenant the registry is bound to, or
+// "".
+func (k *keyRegistry) tenantName() string {
+	if env := k.tenant.Load(); env != nil {
+		return env.name
+	}
+	return ""
+}
+
+// lookupEnv returns the value of a key's environment variable, from the
+// tenant's environment when the registry is bound to one. Everything that
+// reads a key's variables goes through it, so no session can read another
+// tenant's.
+func (k *keyRegistry) lookupEnv(envVar string) (string, bool) {
+	if env := k.tenant.Load(); env != nil {
+		return env.lookupEnv(envVar)
+	}
+	return os.LookupEnv(envVar)
+}
+
+// resolveAll looks up every key, so the redactor knows each value before
+// anything that could contain one is written.
+func (k *keyRegistry) resolveAll() {
+	for _, name := range k.names() {
+		k.lookup(name)
+	}
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxLeaseMinutes is the longest lease get_api_key grants.
+const maxLeaseMinutes = 24 * 60
+
+// Outcomes of the lease lifecycle recorded in the audit log.
+const (
+	auditLeased       = "leased"
+	auditLeaseExpired = "lease_expired"
+	auditLeaseRevoked = "lease_revoked"
+)
+
+// revealLease records that a value revealed by get_api_key was only meant
+// to be used for a while. The server can't take a revealed value back, so a
+// lease is bookkeeping: when it ends, the client is told to treat the value
+// as stale and the audit log records the exposure window.
+type revealLease struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key_name"`
+	GrantedAt time.Time `json:"granted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	timer *time.Timer
+}
+
+// revealLeases holds a session's outstanding leases, guarded by Server.mu.
+type revealLeases struct {
+	next   int
+	active map[string]*revealLease
+}
+
+// leaseSchema describes the structured result of active_leases.
+var leaseSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"leases": {
+			Type: "array",
+			Items: &Property{
+				Type: "object",
+				Properties: map[string]Property{
+					"id":         {Type: "string", Description: "Lease id, for revoke_lease"},
+					"key_name":   {Type: "string"},
+					"granted_at": {Type: "string", Description: "When the value was revealed (RFC 3339)"},
+					"expires_at": {Type: "string", Description: "When the lease ends (RFC 3339)"},
+				},
+				Required: []string{"id", "key_name", "granted_at", "expires_at"},
+			},
+		},
+	},
+	Required: []string{"leases"},
+}
+
+// leaseMinutes returns the lease_minutes get_api_key was called with, 0
+// when there is none, or why it is invalid.
+func leaseMinutes(args map[string]interface{}) (int, string) {
+	n, ok := args["lease_minutes"].(float64)
+	if !ok {
+		return 0, ""
+	}
+	if n < 1 || n > maxLeaseMinutes || n != float64(int(n)) {
+		return 0, fmt.Sprintf("Error: lease_minutes must be a whole number from 1 to %d", maxLeaseMinutes)
+	}
+	return int(n), ""
+}
+
+// leaseNotice tells the client how long it may use a leased value.
+func leaseNotice(lease revealLease) string {
+	return fmt.Sprintf("Lease %s: use this value only until %s. After that, treat it as stale and call get_api_key again.", lease.ID, lease.ExpiresAt.Format(time.RFC3339))
+}
+
+// grantLease starts a lease on keyName's just-revealed value, which ends on
+// its own after minutes, and returns it.
+func (s *Server) grantLease(ctx context.Context, keyName string, minutes int) revealLease {
+	now := time.Now().UTC()
+	s.mu.Lock()
+	s.leases.next++
+	lease := &revealLease{
+		ID:        fmt.Sprintf("lease-%d", s.leases.next),
+		Key:       keyName,
+		GrantedAt: now,
+		ExpiresAt: now.Add(time.Duration(minutes) * time.Minute),
+	}
+	lease.timer = time.AfterFunc(time.Duration(minutes)*time.Minute, func() {
+		s.endLease(context.Background(), lease.ID, auditLeaseExpired)
+	})
+	s.leases.active[lease.ID] = lease
+	s.mu.Unlock()
+
+	s.noteAccess(ctx, keyName, auditLeased, fmt.Sprintf("%s for %dm", lease.ID, minutes), "")
+	return *lease
+}
+
+// endLease ends a lease early or at its expiry, telling the client the
+// value it covered is stale. It reports false if the lease had already
+// ended.
+func (s *Server) endLease(ctx context.Context, id, outcome string) bool {
+	s.mu.Lock()
+	lease, ok := s.leases.active[id]
+	if ok {
+		delete(s.leases.active, id)
+		lease.timer.Stop()
+	}
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	how := "expired"
+	tool := "get_api_key"
+	if outcome == auditLeaseRevoked {
+		how = "been revoked"
+		tool = "revoke_lease"
+	}
+	s.logMessage("warning", "audit", fmt.Sprintf("The lease %s on API key '%s' has %s: treat the value revealed at %s as stale and don't use it again; call get_api_key if it is still needed.", lease.ID, lease.Key, how, lease.GrantedAt.Format(time.RFC3339)))
+	s.note(ctx, auditNote{entry: auditEntry{Tool: tool, Key: lease.Key, Outcome: outcome, Reason: lease.ID}})
+	return true
+}
+
+// activeLeases returns the outstanding leases, soonest to expire first.
+func (s *Server) activeLeases() []revealLease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	leases := make([]revealLease, 0, len(s.leases.active))
+	for _, lease := range s.leases.active {
+		leases = append(leases, *lease)
+	}
+	sort.Slice(leases, func(i, j int) bool {
+		if !leases[i].ExpiresAt.Equal(leases[j].ExpiresAt) {
+			return leases[i].ExpiresAt.Before(leases[j].ExpiresAt)
+		}
+		return leases[i].ID < leases[j].ID
+	})
+	return leases
+}
+
+// stopLeases stops the expiry timers at shutdown; the leases end with the
+// session.
+func (s *Server) stopLeases() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, lease := range s.leases.active {
+		lease.timer.Stop()
+	}
+}
+
+func (s *Server) handleActiveLeases(ctx context.Context, args map[string]interface{}) CallToolResult {
+	leases := s.activeLeases()
+
+	var text strings.Builder
+	if len(leases) == 0 {
+		text.WriteString("No reveal leases are active.")
+	} else {
+		text.WriteString("Active reveal leases:\n")
+		now := time.Now()
+		for _, lease := range leases {
+			remaining := lease.ExpiresAt.Sub(now).Round(time.Second)
+			text.WriteString(fmt.Sprintf("  %s: %s, revealed %s, expires %s (in %s)\n", lease.ID, lease.Key, lease.GrantedAt.Format(time.RFC3339), lease.ExpiresAt.Format(time.RFC3339), remaining))
+		}
+	}
+
+	result := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text.String()}},
+	}
+	if s.supportsStructuredContent() {
+		result.StructuredContent = map[string]interface{}{"leases": leases}
+	}
+	return result
+}
+
+func (s *Server) handleRevokeLease(ctx context.Context, args map[string]interface{}) CallToolResult {
+	id, _ := args["lease_id"].(string)
+	if id == "" {
+		return failure(codeValidationFailed, "Error: lease_id is required", nil)
+	}
+	if !s.endLease(ctx, id, auditLeaseRevoked) {
+		return failure(codeNotFound, fmt.Sprintf("Error: no active lease %s. It may have expired already; active_leases lists the current ones.", id), map[string]interface{}{"lease_id": id})
+	}
+	return CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: fmt.Sprintf("Lease %s revoked. Treat the value it covered as stale.", id)}},
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/yourusername/mcp-api-keys-server/internal/protocol"
+)
+
+// sessionState tracks where the client is in the MCP lifecycle: it must send
+// initialize, then notifications/initialized, before using the server. Once
+// shutdown starts, on a signal, a shutdown request or the end of the input,
+// no new requests are accepted.
+type sessionState int
+
+const (
+	stateUninitialized sessionState = iota
+	stateInitializing
+	stateReady
+	stateShuttingDown
+)
+
+// errNotInitialized is returned for requests made outside the lifecycle.
+const errNotInitialized = -32002
+
+// errShuttingDown is returned for requests that arrive during shutdown.
+const errShuttingDown = -32000
+
+// shutdownTimeout bounds how long shutdown waits for requests still running.
+const shutdownTimeout = 5 * time.Second
+
+// preInitMethods may be called before the session is ready.
+var preInitMethods = map[string]bool{
+	"initialize": true,
+	"ping":       true,
+	"shutdown":   true,
+}
+
+// checkLifecycle returns an error response if method may not be called in
+// the current session state, or nil if it may.
+func (s *Server) checkLifecycle(id json.RawMessage, method string) *protocol.Response {
+	s.mu.Lock()
+	state := s.state
+	s.mu.Unlock()
+
+	if state == stateShuttingDown {
+		return s.shuttingDownResponse(id)
+	}
+
+	var message string
+	switch {
+	case method == "initialize" && state != stateUninitialized:
+		message = "Server already initialized: initialize may only be sent once per session"
+	case state == stateReady || preInitMethods[method]:
+		return nil
+	case state == stateUninitialized:
+		message = fmt.Sprintf("Server not initialized: send initialize before %s", method)
+	default:
+		message = fmt.Sprintf("Server not initialized: send notifications/initialized after the initialize response before %s", method)
+	}
+
+	response := errorResponse(id, errNotInitialized, message)
+	return &response
+}
+
+// handleInitialized marks the session ready once the client acknowledges
+// the initialize response.
+func (s *Server) handleInitialized(protocol.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == stateInitializing {
+		s.state = stateReady
+	}
+}
+
+// handleShutdown ends the session for a client that asks to: the server
+// stops accepting requests and lets the running ones respond before it
+// replies, so the reply is the last response. The read loop then stops, and
+// the server shuts down as at the end of the input.
+func (s *Server) handleShutdown(id json.RawMessage) protocol.Response {
+	s.logger.Info("shutting down", "reason", "shutdown request")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.drain(ctx); err != nil {
+		s.logger.Warn("unclean shutdown", "error", err)
+	}
+	return protocol.Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  struct{}{},
+	}
+}
+
+// shuttingDownResponse is the error response to a request that arrives,
+// or would start running, once shutdown has started.
+func (s *Server) shuttingDownResponse(id json.RawMessage) *protocol.Response {
+	response := errorResponse(id, errShuttingDown, "Server is shutting down")
+	return &response
+}
+
+// shuttingDown reports whether shutdown has started.
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state == stateShuttingDown
+}
+
+// drain stops the server accepting requests and waits for the ones still
+// running until ctx is done, then cancels those left, which never respond.
+func (s *Server) drain(ctx context.Context) error {
+	s.mu.Lock()
+	s.state = stateShuttingDown
+	s.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, cancel := range s.inFlight {
+			cancel()
+		}
+		return fmt.Errorf("gave up waiting for %d running requests: %w", len(s.inFlight), ctx.Err())
+	}
+}
+
+// Shutdown stops the server accepting requests, waits for the ones still
+// running until ctx is done, closes the audit log and flushes the output.
+// Requests still running when ctx is done are cancelled, so they never
+// respond. It is safe to call more than once, also at the same time: only
+// the first call shuts down, and every call returns its error.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.shutdown(ctx)
+	})
+	return s.shutdownErr
+}
+
+// shutdown does the work of Shutdown.
+func (s *Server) shutdown(ctx context.Context) error {
+	err := s.drain(ctx)
+	s.stopLeases()
+
+	if s.envWatcher != nil {
+		s.envWatcher.Close()
+	}
+
+	if s.upstream != nil {
+		s.upstream.Close()
+	}
+
+	if s.tracer != nil {
+		if flushErr := s.tracer.Shutdown(ctx); flushErr != nil {
+			s.logger.Warn("failed to export the last traces", "error", s.keys.secrets.scrubError(flushErr))
+		}
+	}
+
+	if s.metricsServer != nil {
+		if stopErr := s.metricsServer.Shutdown(ctx); stopErr != nil && err == nil {
+			err = fmt.Errorf("failed to stop metrics server: %w", stopErr)
+		}
+	}
+
+	if s.revealWebhook != nil {
+		if waitErr := s.revealWebhook.wait(ctx); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+
+	for _, sink := range s.auditSinks {
+		if closeErr := sink.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close audit %s: %w", sink.Name(), closeErr)
+		}
+	}
+
+	if s.recorder != nil {
+		if closeErr := s.recorder.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close recording: %w", closeErr)
+		}
+	}
+
+	if s.writeFailed() == nil {
+		if flushErr := s.out.Flush(); flushErr != nil && err == nil {
+			err = fmt.Errorf("failed to flush output: %w", flushErr)
+		}
+	}
+	return err
+}
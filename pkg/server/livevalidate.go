@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// slackAPIURL is where Slack Web API methods are called.
+var slackAPIURL = "https://slack.com/api"
+
+// liveResult is what a provider said about a key when asked.
+type liveResult struct {
+	Key    string `json:"key"`
+	Valid  bool   `json:"valid"`
+	Detail string `json:"detail,omitempty"`
+	// Info holds what the provider reports about the key's owner, such as
+	// the Slack team and bot user.
+	Info map[string]string `json:"info,omitempty"`
+}
+
+// liveValidator checks one kind of key against its provider. Prefix, when
+// set, is checked first, so a malformed key is reported without a request.
+type liveValidator struct {
+	Prefix string
+	Check  func(ctx context.Context, value string) (liveResult, error)
+}
+
+// builtinLiveValidators returns the provider-validation table a registry's
+// validators start from: each key that can be checked against its
+// provider's API, and how.
+func builtinLiveValidators() map[string]liveValidator {
+	return map[string]liveValidator{
+		"github_token":    {Check: githubLiveCheck},
+		"gitlab_token":    {Check: gitlabLiveCheck},
+		"slack_bot_token": {Prefix: "xoxb-", Check: slackAuthTest},
+		"slack_app_token": {Prefix: "xapp-", Check: slackAuthTest},
+	}
+}
+
+// liveValidatedKeys returns the names of the keys that can be checked live,
+// sorted.
+func (k *keyRegistry) liveValidatedKeys() []string {
+	names := make([]string, 0, len(k.validators))
+	for name := range k.validators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func githubLiveCheck(ctx context.Context, token string) (liveResult, error) {
+	scopes, err := githubTokenScopes(ctx, token)
+	return liveResult{Valid: scopes.Valid, Detail: scopes.Detail}, err
+}
+
+func gitlabLiveCheck(ctx context.Context, token string) (liveResult, error) {
+	scopes, err := gitlabTokenScopes(ctx, token)
+	return liveResult{Valid: scopes.Valid && !scopes.Expired, Detail: scopes.Detail}, err
+}
+
+// slackAuthTest calls Slack's auth.test, which reports whether a token works
+// and which workspace and user it belongs to.
+func slackAuthTest(ctx context.Context, token string) (liveResult, error) {
+	response, body, err := providerGet(ctx, slackAPIURL+"/auth.test", map[string]string{
+		"Authorization": "Bearer " + token,
+	})
+	if err != nil {
+		return liveResult{}, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return liveResult{}, fmt.Errorf("Slack returned %s", response.Status)
+	}
+
+	var test struct {
+		OK     bool   `json:"ok"`
+		Error  string `json:"error"`
+		Team   string `json:"team"`
+		TeamID string `json:"team_id"`
+		User   string `json:"user"`
+		BotID  string `json:"bot_id"`
+	}
+	if err := json.Unmarshal(body, &test); err != nil {
+		return liveResult{}, fmt.Errorf("unexpected response from Slack: %w", err)
+	}
+	if !test.OK {
+		return liveResult{Detail: fmt.Sprintf("Slack rejected the token: %s", test.Error)}, nil
+	}
+
+	info := map[string]string{}
+	for name, value := range map[string]string{"team": test.Team, "team_id": test.TeamID, "user": test.User, "bot_id": test.BotID} {
+		if value != "" {
+			info[name] = value
+		}
+	}
+	return liveResult{Valid: true, Info: info}, nil
+}
+
+// validateLive checks one configured key with its provider.
+func (s *Server) validateLive(ctx context.Context, keyName string) liveResult {
+	config, value, _ := s.keys.lookup(keyName)
+	validator := s.keys.validators[keyName]
+	switch {
+	case value == "":
+		return liveResult{Key: keyName, Detail: fmt.Sprintf("not configured, set %s", s.keys.unsetLabel(config))}
+	case validator.Prefix != "" && !strings.HasPrefix(value, validator.Prefix):
+		return liveResult{Key: keyName, Detail: fmt.Sprintf("malformed: expected a token starting with %s", validator.Prefix)}
+	}
+
+	result, err := validator.Check(ctx, value)
+	result.Key = keyName
+	if err != nil {
+		result.Valid = false
+		result.Detail = fmt.Sprintf("could not check: %v", s.keys.secrets.scrubError(err))
+	}
+	return result
+}
+
+// liveResultsSchema describes the structured result of validate_api_key_live.
+var liveResultsSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"results": {
+			Type:        "array",
+			Description: "One result per checked key",
+			Items: &Property{
+				Type: "object",
+				Properties: map[string]Property{
+					"key":    {Type: "string", Description: "Name of the checked key"},
+					"valid":  {Type: "boolean", Description: "Whether the provider accepts the key"},
+					"detail": {Type: "string", Description: "Why the key is invalid or couldn't be checked"},
+					"info":   {Type: "object", Description: "What the provider reports about the key's owner"},
+				},
+				Required: []string{"key", "valid"},
+			},
+		},
+	},
+	Required: []string{"results"},
+}
+
+func (s *Server) handleValidateAPIKeyLive(ctx context.Context, args map[string]interface{}) CallToolResult {
+	keyName, _ := args["key_name"].(string)
+	all, _ := args["all"].(bool)
+
+	var names []string
+	switch {
+	case all:
+		// Only keys with a value are worth a request
+		for _, name := range s.keys.liveValidatedKeys() {
+			if _, value, _ := s.keys.lookup(name); value != "" {
+				names = append(names, name)
+			}
+		}
+	case keyName != "":
+		names = []string{keyName}
+	default:
+		return failure(codeValidationFailed, "Error: give key_name, or all: true", nil)
+	}
+
+	results := make([]liveResult, 0, len(names))
+	var text strings.Builder
+	for i, name := range names {
+		reportProgress(ctx, float64(i), float64(len(names)), fmt.Sprintf("Checking %s", name))
+		result := s.validateLive(ctx, name)
+		results = append(results, result)
+
+		if result.Valid {
+			text.WriteString(fmt.Sprintf("%s %s: valid", s.markers.status(true), name))
+		} else {
+			text.WriteString(fmt.Sprintf("%s %s: %s", s.markers.status(false), name, result.Detail))
+		}
+		if len(result.Info) > 0 {
+			parts := make([]string, 0, len(result.Info))
+			for field, value := range result.Info {
+				parts = append(parts, fmt.Sprintf("%s=%s", field, value))
+			}
+			sort.Strings(parts)
+			text.WriteString(" (" + strings.Join(parts, ", ") + ")")
+		}
+		text.WriteString("\n")
+	}
+	if len(names) == 0 {
+		text.WriteString("No configured keys can be checked live.\n")
+	}
+
+	toolResult := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text.String()}},
+	}
+	if s.supportsStructuredContent() {
+		toolResult.StructuredContent = map[string]interface{}{"results": results}
+	}
+	return toolResult
+}
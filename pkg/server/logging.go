@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/yourusername/mcp-api-keys-server/internal/protocol"
+)
+
+// Log levels from the MCP logging capability, in increasing severity (RFC 5424).
+var logLevels = []string{"debug", "info", "notice", "warning", "error", "critical", "alert", "emergency"}
+
+const defaultLogLevel = "warning"
+
+// SetLevelParams are the params of logging/setLevel.
+type SetLevelParams struct {
+	Level string `json:"level"`
+}
+
+// LoggingMessageParams are the params of a notifications/message log message.
+type LoggingMessageParams struct {
+	Level  string      `json:"level"`
+	Logger string      `json:"logger,omitempty"`
+	Data   interface{} `json:"data"`
+}
+
+// logSeverity returns the position of level in logLevels, or -1 if unknown.
+func logSeverity(level string) int {
+	for i, l := range logLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Server) handleSetLevel(id json.RawMessage, params SetLevelParams) protocol.Response {
+	if logSeverity(params.Level) < 0 {
+		return errorResponse(id, -32602, fmt.Sprintf("Invalid log level: %s", params.Level))
+	}
+
+	s.mu.Lock()
+	s.logLevel = params.Level
+	s.mu.Unlock()
+	return protocol.Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  struct{}{},
+	}
+}
+
+// logMessage sends a notifications/message to the client if level is at or
+// above the level the client asked for.
+func (s *Server) logMessage(level, logger string, data interface{}) {
+	s.mu.Lock()
+	minLevel := s.logLevel
+	s.mu.Unlock()
+
+	if logSeverity(level) < logSeverity(minLevel) {
+		return
+	}
+	if text, ok := data.(string); ok {
+		data = s.keys.secrets.scrub(text)
+	}
+	s.sendNotification("notifications/message", LoggingMessageParams{
+		Level:  level,
+		Logger: logger,
+		Data:   data,
+	})
+}
+
+// audit logs a key access event, noting which client it was made by.
+func (s *Server) audit(level, message string) {
+	s.mu.Lock()
+	clientInfo := s.clientInfo
+	s.mu.Unlock()
+
+	if clientInfo.Name != "" {
+		client := strings.TrimSpace(clientInfo.Name + " " + clientInfo.Version)
+		message = fmt.Sprintf("%s (client: %s)", message, client)
+	}
+	s.logMessage(level, "audit", message)
+}
+
+// newDiagnosticLogger returns the logger for operator diagnostics. It must
+// never write to stdout, which carries the protocol. New wraps it so the
+// server's known secret values are redacted from everything it writes.
+func newDiagnosticLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: use debug, info, warn or error", level)
+	}
+
+	options := &slog.HandlerOptions{Level: minLevel}
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(w, options)
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return nil, fmt.Errorf("invalid log format %q: use text or json", format)
+	}
+	return slog.New(handler), nil
+}
@@ -0,0 +1,59 @@
+package server
+
+// statusMarkers are the strings tool text output uses to show whether a key
+// is configured and to head category sections. Every tool renders through
+// the server's markers, so --plain-output covers them all.
+type statusMarkers struct {
+	configured string
+	missing    string
+	// placeholder marks keys set to something like "changeme"
+	placeholder string
+	// empty marks keys whose variable is defined with no value
+	empty string
+	// warning heads warnings such as the one after a production value
+	warning string
+	// icons prefixes category headings with their emoji
+	icons bool
+}
+
+var (
+	emojiMarkers = statusMarkers{configured: "✅", missing: "❌", placeholder: "⚠️", empty: "⭕", warning: "⚠️", icons: true}
+	// plainMarkers are for clients and log pipelines that mangle emoji
+	plainMarkers = statusMarkers{configured: "[ok]", missing: "[missing]", placeholder: "[placeholder]", empty: "[empty]", warning: "[warning]"}
+)
+
+// status returns the marker for a key's configured state.
+func (m statusMarkers) status(configured bool) string {
+	if configured {
+		return m.configured
+	}
+	return m.missing
+}
+
+// keyStatus returns the marker for a listed key, which can also be a
+// placeholder or set but empty.
+func (m statusMarkers) keyStatus(key keyStatus) string {
+	switch {
+	case key.Placeholder:
+		return m.placeholder
+	case len(key.EmptyEnvVars) > 0:
+		return m.empty
+	}
+	return m.status(key.Configured)
+}
+
+// memberStatus returns the marker for a member of a composite key.
+func (m statusMarkers) memberStatus(member memberStatus) string {
+	if member.Empty {
+		return m.empty
+	}
+	return m.status(member.Configured)
+}
+
+// heading returns the section heading for a category.
+func (m statusMarkers) heading(icon, title string) string {
+	if m.icons {
+		return icon + " " + title
+	}
+	return title
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Masking styles for --mask-style.
+const (
+	// maskPrefix shows the start of a value, which names the provider.
+	maskPrefix = "prefix"
+	// maskSuffix shows the end of a value, as provider dashboards do.
+	maskSuffix = "suffix"
+	// maskNone shows nothing: every preview is "****".
+	maskNone = "none"
+	// maskFixed shows nothing either, as --mask-chars asterisks.
+	maskFixed = "fixed"
+)
+
+const (
+	// minMaskedLength is the shortest value maskSecret shows any of.
+	minMaskedLength = 12
+	// defaultMaskChars is how many characters a preview shows by default.
+	defaultMaskChars = 4
+	// maxMaskChars bounds --mask-chars.
+	maxMaskChars = 32
+)
+
+// maskSettings is how maskSecret previews values.
+type maskSettings struct {
+	style string
+	chars int
+}
+
+// defaultMask is how values are previewed unless --mask-style and
+// --mask-chars, the config file or MCP_MASK_STYLE and MCP_MASK_CHARS say
+// otherwise. Each key registry starts from it.
+var defaultMask = maskSettings{style: maskPrefix, chars: defaultMaskChars}
+
+// configure sets how values are previewed. An empty style or zero chars
+// keeps the current setting.
+func (m *maskSettings) configure(style string, chars int) error {
+	switch style {
+	case "":
+	case maskPrefix, maskSuffix, maskNone, maskFixed:
+		m.style = style
+	default:
+		return fmt.Errorf("unknown mask style %q: use %s, %s, %s or %s", style, maskPrefix, maskSuffix, maskNone, maskFixed)
+	}
+	if chars < 0 || chars > maxMaskChars {
+		return fmt.Errorf("mask chars must be from 1 to %d, or 0 to leave the setting alone", maxMaskChars)
+	}
+	if chars > 0 {
+		m.chars = chars
+	}
+	return nil
+}
+
+// configureFromEnv applies MCP_MASK_STYLE and MCP_MASK_CHARS, which the
+// command-line commands and the server's defaults follow.
+func (m *maskSettings) configureFromEnv() error {
+	chars := 0
+	if value := strings.TrimSpace(os.Getenv("MCP_MASK_CHARS")); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("MCP_MASK_CHARS: %q is not a number", value)
+		}
+		chars = n
+	}
+	return m.configure(strings.TrimSpace(os.Getenv("MCP_MASK_STYLE")), chars)
+}
+
+// maskSecret returns a preview of a key value that is safe to show to
+// clients, in the registry's style. The prefix and suffix styles show at
+// most --mask-chars characters and never more than a third of the value,
+// with a fixed "…" so the preview doesn't give away the exact length, and
+// values shorter than minMaskedLength are fully hidden. Every preview the
+// server shows, in tools, resources, the audit log and the CLI, comes from
+// here.
+func (k *keyRegistry) maskSecret(value string) string {
+	return k.mask.apply(value)
+}
+
+func (m maskSettings) apply(value string) string {
+	runes := []rune(value)
+	switch m.style {
+	case maskNone:
+		return "****"
+	case maskFixed:
+		return strings.Repeat("*", m.chars)
+	}
+	if len(runes) < minMaskedLength {
+		return "****"
+	}
+	shown := min(m.chars, len(runes)/3)
+	if m.style == maskSuffix {
+		return "…" + string(runes[len(runes)-shown:])
+	}
+	return string(runes[:shown]) + "…"
+}
@@ -0,0 +1,142 @@
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+func TestMaskSecret(t *testing.T) {
+	for _, test := range []struct {
+		value, want string
+	}{
+		{"", "****"},
+		{"short", "****"},
+		{"sk-abcdefgh", "****"},
+		{"sk-abcdefghi", "sk-a…"},
+		{"sk-proj-0123456789abcdef", "sk-p…"},
+		// Runes are counted, not bytes: 11 runes but 22 bytes
+		{"ключключклю", "****"},
+		{"ключключключ", "ключ…"},
+		{"🔑🔑🔑🔑🔑🔑🔑🔑🔑🔑🔑🔑🔑🔑🔑", "🔑🔑🔑🔑…"},
+	} {
+		got := server.MaskSecret(test.value)
+		if got != test.want {
+			t.Errorf("maskSecret(%q) = %q, want %q", test.value, got, test.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("maskSecret(%q) = %q, which isn't valid UTF-8", test.value, got)
+		}
+		// Never more than a third of the value
+		if shown := utf8.RuneCountInString(got) - 1; got != "****" && shown*3 > utf8.RuneCountInString(test.value) {
+			t.Errorf("maskSecret(%q) shows %d characters", test.value, shown)
+		}
+	}
+}
+
+func TestMaskStyles(t *testing.T) {
+	const value = "sk-proj-0123456789abcdef"
+	for _, test := range []struct {
+		style string
+		chars int
+		want  string
+	}{
+		{"", 0, "sk-p…"},
+		{"prefix", 0, "sk-p…"},
+		{"prefix", 6, "sk-pro…"},
+		{"suffix", 0, "…cdef"},
+		{"suffix", 2, "…ef"},
+		{"none", 0, "****"},
+		{"none", 8, "****"},
+		{"fixed", 0, "****"},
+		{"fixed", 10, "**********"},
+		// Never more than a third of the value, whatever --mask-chars says
+		{"prefix", 32, "sk-proj-…"},
+		{"suffix", 32, "…89abcdef"},
+	} {
+		test := test
+		t.Run(fmt.Sprintf("%s/%d", test.style, test.chars), func(t *testing.T) {
+			mask, err := server.NewMask(false, test.style, test.chars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := mask(value); got != test.want {
+				t.Errorf("maskSecret = %q, want %q", got, test.want)
+			}
+			// Short values stay hidden in the styles that show characters
+			if got := mask("short"); test.style != "fixed" && got != "****" {
+				t.Errorf("maskSecret(short) = %q", got)
+			}
+		})
+	}
+}
+
+func TestMaskSettingsAreChecked(t *testing.T) {
+	for _, test := range []struct {
+		style string
+		chars int
+		want  string
+	}{
+		{"stars", 0, `unknown mask style "stars"`},
+		{"Prefix", 0, `unknown mask style "Prefix"`},
+		{"", -1, "mask chars must be from 1 to 32"},
+		{"", 33, "mask chars must be from 1 to 32"},
+	} {
+		_, err := server.NewMask(false, test.style, test.chars)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q/%d: NewMask = %v, want %q", test.style, test.chars, err, test.want)
+		}
+	}
+	for _, chars := range []int{0, 1, 32} {
+		if _, err := server.NewMask(false, "", chars); err != nil {
+			t.Errorf("NewMask with %d chars = %v", chars, err)
+		}
+	}
+}
+
+func TestMaskSettingsFromEnv(t *testing.T) {
+	t.Setenv("MCP_MASK_STYLE", " suffix ")
+	t.Setenv("MCP_MASK_CHARS", "3")
+	mask, err := server.NewMask(true, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mask("sk-proj-0123456789abcdef"); got != "…def" {
+		t.Errorf("maskSecret = %q, want …def", got)
+	}
+
+	t.Setenv("MCP_MASK_CHARS", "four")
+	if _, err := server.NewMask(true, "", 0); err == nil || !strings.Contains(err.Error(), "MCP_MASK_CHARS") {
+		t.Errorf("a non-numeric MCP_MASK_CHARS = %v", err)
+	}
+	t.Setenv("MCP_MASK_CHARS", "")
+	t.Setenv("MCP_MASK_STYLE", "hidden")
+	if _, err := server.NewMask(true, "", 0); err == nil {
+		t.Error("an unknown MCP_MASK_STYLE is accepted")
+	}
+}
+
+func TestExecuteLeavesOtherServersSettingsAlone(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": " sk-proj-0123456789abcdef"})
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"placeholder_patterns": ["sk-proj-.*"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, stderr := execute(t, context.Background(), "", "--watch-env=false", "--config", path, "--mask-style", "none", "--sanitize-values=false"); code != 0 {
+		t.Fatalf("Execute = %d, %s", code, stderr)
+	}
+
+	// A server created after Execute ran still has the defaults
+	result, err := newClient(t).CallTool("check_api_key_exists", map[string]interface{}{"key_name": "openai"})
+	text := testmcp.Text(result)
+	if err != nil || !strings.Contains(text, "(value: sk-p…") || strings.Contains(text, "placeholder") || strings.Contains(text, "Suspicious") {
+		t.Errorf("check_api_key_exists = %q, %v; want the default preview of the sanitized value", text, err)
+	}
+}
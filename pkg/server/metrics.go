@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourusername/mcp-api-keys-server/internal/protocol"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the tool latency
+// histogram.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram counts observations into latencyBuckets.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// serverMetrics counts what the server does, for --metrics-listen. Labels
+// only ever hold names the server defines (methods, tools, registered keys
+// and error codes), never values or anything else a client sent. A nil
+// *serverMetrics records nothing.
+type serverMetrics struct {
+	mu         sync.Mutex
+	requests   map[string]uint64
+	toolCalls  map[string]uint64
+	toolErrors map[string]uint64
+	reveals    map[string]uint64
+	errors     map[int]uint64
+	latency    map[string]*histogram
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		requests:   map[string]uint64{},
+		toolCalls:  map[string]uint64{},
+		toolErrors: map[string]uint64{},
+		reveals:    map[string]uint64{},
+		errors:     map[int]uint64{},
+		latency:    map[string]*histogram{},
+	}
+}
+
+// countRequest counts a request for method, which must be one the server
+// handles, so arbitrary client input never becomes a label.
+func (m *serverMetrics) countRequest(method string) {
+	if m == nil {
+		return
+	}
+	if _, known := methods[method]; !known {
+		method = "unknown"
+	}
+	m.mu.Lock()
+	m.requests[method]++
+	m.mu.Unlock()
+}
+
+// countResponse counts the JSON-RPC error a response carries, if any.
+func (m *serverMetrics) countResponse(response *protocol.Response) {
+	if m == nil || response == nil || response.Error == nil {
+		return
+	}
+	m.mu.Lock()
+	m.errors[response.Error.Code]++
+	m.mu.Unlock()
+}
+
+// observeTool records a call to a tool the server offers and how long it
+// took.
+func (m *serverMetrics) observeTool(tool string, elapsed time.Duration, isError bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.toolCalls[tool]++
+	if isError {
+		m.toolErrors[tool]++
+	}
+	h := m.latency[tool]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latency[tool] = h
+	}
+	seconds := elapsed.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// countReveal counts a key's value being returned to a client. The caller
+// only counts registered keys, so a client can't grow the label set.
+func (m *serverMetrics) countReveal(keyName string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.reveals[keyName]++
+	m.mu.Unlock()
+}
+
+// writeCounter writes one labelled counter family, sorted by label.
+func writeCounter(w io.Writer, name, help, label string, values map[string]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	labels := make([]string, 0, len(values))
+	for value := range values {
+		labels = append(labels, value)
+	}
+	sort.Strings(labels)
+	for _, value := range labels {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, value, values[value])
+	}
+}
+
+// write writes the metrics in the Prometheus text exposition format.
+func (m *serverMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeCounter(w, "mcp_requests_total", "JSON-RPC requests received, by method.", "method", m.requests)
+	writeCounter(w, "mcp_tool_calls_total", "Tool calls, by tool.", "tool", m.toolCalls)
+	writeCounter(w, "mcp_tool_errors_total", "Tool calls that returned an error result, by tool.", "tool", m.toolErrors)
+	writeCounter(w, "mcp_key_reveals_total", "Key values returned to clients, by key name.", "key", m.reveals)
+
+	codes := make(map[string]uint64, len(m.errors))
+	for code, count := range m.errors {
+		codes[strconv.Itoa(code)] = count
+	}
+	writeCounter(w, "mcp_errors_total", "JSON-RPC error responses, by error code.", "code", codes)
+
+	const latency = "mcp_tool_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Time taken by tool calls.\n# TYPE %s histogram\n", latency, latency)
+	tools := make([]string, 0, len(m.latency))
+	for tool := range m.latency {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	for _, tool := range tools {
+		h := m.latency[tool]
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "%s_bucket{tool=%q,le=%q} %d\n", latency, tool, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{tool=%q,le=\"+Inf\"} %d\n", latency, tool, h.count)
+		fmt.Fprintf(w, "%s_sum{tool=%q} %s\n", latency, tool, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{tool=%q} %d\n", latency, tool, h.count)
+	}
+}
+
+// metricsServer serves /metrics on --metrics-listen.
+type metricsServer struct {
+	server *http.Server
+	done   chan struct{}
+}
+
+// startMetricsServer listens on addr, so a bad address fails at startup,
+// and serves metrics there in the background.
+func startMetricsServer(addr string, metrics *serverMetrics, logger *slog.Logger) (*metricsServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		var body strings.Builder
+		metrics.write(&body)
+		io.WriteString(w, body.String())
+	})
+	m := &metricsServer{
+		server: &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second},
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(m.done)
+		if err := m.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("metrics server stopped", "error", err)
+		}
+	}()
+	return m, nil
+}
+
+// Shutdown stops serving metrics, letting scrapes in progress finish.
+func (m *metricsServer) Shutdown(ctx context.Context) error {
+	err := m.server.Shutdown(ctx)
+	<-m.done
+	return err
+}
@@ -0,0 +1,80 @@
+package server_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+// scrape returns the metrics served at url.
+func scrape(t *testing.T, url string) string {
+	t.Helper()
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s = %s, %v", url, response.Status, err)
+	}
+	if contentType := response.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	return string(body)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-metricstest0123456789"})
+	c := testmcp.New(server.WithLogger(discardLogger))
+	url := server.ServeMetrics(t, c.Server)
+	if _, err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, call := range []struct {
+		name string
+		args map[string]interface{}
+	}{
+		{"get_api_key", map[string]interface{}{"key_name": "openai"}},
+		{"get_api_key", map[string]interface{}{"key_name": "openai"}},
+		{"get_api_key", map[string]interface{}{"key_name": "anthropic"}},
+		{"check_api_key_exists", map[string]interface{}{"key_name": "openai"}},
+	} {
+		if _, err := c.CallTool(call.name, call.args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.CallTool("no_such_tool", map[string]interface{}{})
+	c.Call("no/such/method", nil, nil)
+	c.Call("ping", nil, nil)
+
+	metrics := scrape(t, url)
+	for _, line := range []string{
+		`mcp_requests_total{method="initialize"} 1`,
+		`mcp_requests_total{method="tools/call"} 5`,
+		`mcp_requests_total{method="ping"} 1`,
+		`mcp_requests_total{method="unknown"} 1`,
+		`mcp_tool_calls_total{tool="get_api_key"} 3`,
+		`mcp_tool_calls_total{tool="check_api_key_exists"} 1`,
+		`mcp_tool_errors_total{tool="get_api_key"} 1`,
+		`mcp_key_reveals_total{key="openai"} 2`,
+		`mcp_errors_total{code="-32601"} 2`,
+		`mcp_tool_duration_seconds_bucket{tool="get_api_key",le="+Inf"} 3`,
+		`mcp_tool_duration_seconds_count{tool="check_api_key_exists"} 1`,
+		"# TYPE mcp_tool_duration_seconds histogram",
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("metrics don't have %s:\n%s", line, metrics)
+		}
+	}
+	for _, leak := range []string{"metricstest", "no_such_tool", "no/such/method", `key="anthropic"`} {
+		if strings.Contains(metrics, leak) {
+			t.Errorf("metrics hold %q:\n%s", leak, metrics)
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+// auditEntries returns the entries of the audit log at path.
+func auditEntries(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("audit line isn't JSON: %q", line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// getAPIKeyLine is a get_api_key call for openai with the given extra
+// arguments.
+func getAPIKeyLine(id int, extra string) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"get_api_key","arguments":{"key_name":"openai"%s}}}`, id, extra)
+}
+
+func TestPolicyMiddlewareDeniesAndAudits(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-middlewaretest0123456789"})
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	stdin := strings.Join([]string{
+		initializeLine,
+		initializedLine,
+		getAPIKeyLine(1, ""),
+		getAPIKeyLine(2, `,"transform":"basic_auth","username_key":"openai"`),
+	}, "\n") + "\n"
+
+	code, stdout, stderr := execute(t, context.Background(), stdin, "--watch-env=false", "--log-level", "error", "--reveal-deny", "openai", "--audit-log", auditPath)
+	if code != 0 {
+		t.Fatalf("Execute = %d, %s", code, stderr)
+	}
+	if strings.Contains(stdout, "middlewaretest") {
+		t.Errorf("a denied key was revealed: %s", stdout)
+	}
+	if got := strings.Count(stdout, `"code":"policy_denied"`); got != 2 {
+		t.Errorf("got %d policy_denied results, want 2: %s", got, stdout)
+	}
+
+	entries := auditEntries(t, auditPath)
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2: %v", len(entries), entries)
+	}
+	for _, entry := range entries {
+		if entry["tool"] != "get_api_key" || entry["key"] != "openai" || entry["outcome"] != "denied" {
+			t.Errorf("audit entry = %v, want a denied get_api_key of openai", entry)
+		}
+	}
+}
+
+func TestPolicyMiddlewareLetsBreakGlassThrough(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-middlewaretest0123456789"})
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	stdin := strings.Join([]string{
+		initializeLine,
+		initializedLine,
+		getAPIKeyLine(1, `,"justification":"production outage, incident 4711, rotating the key"`),
+	}, "\n") + "\n"
+
+	code, stdout, stderr := execute(t, context.Background(), stdin, "--watch-env=false", "--log-level", "error", "--reveal-deny", "openai", "--break-glass-enabled", "--audit-log", auditPath)
+	if code != 0 {
+		t.Fatalf("Execute = %d, %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "sk-proj-middlewaretest0123456789") {
+		t.Errorf("the break-glass reveal failed: %s", stdout)
+	}
+	entries := auditEntries(t, auditPath)
+	if len(entries) != 1 || entries[0]["outcome"] != "break_glass" || entries[0]["tool"] != "get_api_key" {
+		t.Errorf("audit entries = %v, want one break_glass entry of get_api_key", entries)
+	}
+}
+
+// neverRevealSession runs the lines as a session of a server whose config
+// marks openai reveal: false, with the extra flags, and returns the output
+// and audit log entries.
+func neverRevealSession(t *testing.T, lines []string, args ...string) (string, []map[string]interface{}) {
+	t.Helper()
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"never_reveal": ["openai"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	auditPath := filepath.Join(dir, "audit.log")
+	stdin := strings.Join(append([]string{initializeLine, initializedLine}, lines...), "\n") + "\n"
+	args = append([]string{"--watch-env=false", "--log-level", "error", "--config", configPath, "--audit-log", auditPath}, args...)
+	code, stdout, stderr := execute(t, context.Background(), stdin, args...)
+	if code != 0 {
+		t.Fatalf("Execute = %d, %s", code, stderr)
+	}
+	return stdout, auditEntries(t, auditPath)
+}
+
+func TestNeverRevealKeysStayOutOfGeneratedOutput(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{
+		"openai":    "sk-proj-neverreveal0123456789",
+		"anthropic": "sk-ant-generated0123456789",
+	})
+	calls := map[string]string{
+		"fill_template":                `{"template": "a=${OPENAI_API_KEY}\nb=${ANTHROPIC_API_KEY}\n"}`,
+		"generate_k8s_secret":          `{"name": "app", "keys": ["openai", "anthropic"], "string_data": true}`,
+		"generate_compose_env":         `{"keys": ["openai", "anthropic"], "include_values": true, "dotenv": true}`,
+		"generate_gh_secrets_commands": `{"keys": ["openai", "anthropic"], "include_values": true}`,
+	}
+	var lines []string
+	for tool, arguments := range calls {
+		lines = append(lines, fmt.Sprintf(`{"jsonrpc":"2.0","id":%q,"method":"tools/call","params":{"name":%q,"arguments":%s}}`, tool, tool, arguments))
+	}
+
+	stdout, entries := neverRevealSession(t, lines)
+	messages := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		var message struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal([]byte(line), &message)
+		messages[message.ID] = line
+	}
+	for tool := range calls {
+		if strings.Contains(messages[tool], "neverreveal0123456789") {
+			t.Errorf("%s wrote a reveal: false value: %s", tool, messages[tool])
+		}
+		if !strings.Contains(messages[tool], "sk-ant-generated0123456789") {
+			t.Errorf("%s left out a revealable value: %s", tool, messages[tool])
+		}
+	}
+
+	denied := 0
+	for _, entry := range entries {
+		if entry["key"] == "openai" {
+			if entry["outcome"] != "denied" {
+				t.Errorf("audit entry = %v, want a denial", entry)
+			}
+			denied++
+		}
+	}
+	if denied != len(calls) {
+		t.Errorf("got %d denials of openai, want %d: %v", denied, len(calls), entries)
+	}
+}
+
+func TestBreakGlassDoesNotOverrideNeverReveal(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-neverreveal0123456789"})
+	stdout, entries := neverRevealSession(t, []string{
+		getAPIKeyLine(1, `,"justification":"production outage, incident 4711, rotating the key"`),
+	}, "--break-glass-enabled")
+	if strings.Contains(stdout, "neverreveal0123456789") || !strings.Contains(stdout, "blocked by its reveal: false setting") {
+		t.Errorf("a justification revealed a reveal: false key: %s", stdout)
+	}
+	if len(entries) != 1 || entries[0]["outcome"] != "denied" {
+		t.Errorf("audit entries = %v, want one denial", entries)
+	}
+}
+
+// toolNamesFrom returns the tool names in a tools/list response.
+func toolNamesFrom(t *testing.T, response map[string]interface{}) []string {
+	t.Helper()
+	result, _ := response["result"].(map[string]interface{})
+	tools, _ := result["tools"].([]interface{})
+	var names []string
+	for _, tool := range tools {
+		name, _ := tool.(map[string]interface{})["name"].(string)
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		t.Fatalf("tools/list = %v", response)
+	}
+	return names
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-readonly0123456789abcdef"})
+	stdin := strings.Join([]string{
+		initializeLine,
+		initializedLine,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}`,
+		getAPIKeyLine(2, ""),
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"fill_template","arguments":{"template":"{{openai}}"}}}`,
+		`[` + getAPIKeyLine(4, "") + `,{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"generate_k8s_secret","arguments":{"keys":["openai"]}}}]`,
+		`{"jsonrpc":"2.0","id":6,"method":"tools/call","params":{"name":"check_api_key_exists","arguments":{"key_name":"openai"}}}`,
+	}, "\n") + "\n"
+	revealing := []string{"get_api_key", "fill_template", "generate_k8s_secret"}
+
+	session := func(args ...string) ([]map[string]interface{}, string) {
+		t.Helper()
+		code, stdout, stderr := execute(t, context.Background(), stdin, append([]string{"--watch-env=false", "--log-level", "error"}, args...)...)
+		if code != 0 {
+			t.Fatalf("Execute %v = %d, %s", args, code, stderr)
+		}
+		var messages []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+			var batch []map[string]interface{}
+			if json.Unmarshal([]byte(line), &batch) == nil {
+				messages = append(messages, batch...)
+				continue
+			}
+			var message map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &message); err != nil {
+				t.Fatalf("stdout line %q isn't JSON", line)
+			}
+			messages = append(messages, message)
+		}
+		return messages, stdout
+	}
+
+	normal, _ := session()
+	normalTools := toolNamesFrom(t, responseTo(t, normal, float64(1)))
+	for _, name := range revealing {
+		if !contains(normalTools, name) {
+			t.Errorf("%s isn't listed outside read-only mode", name)
+		}
+	}
+
+	t.Run("flag", func(t *testing.T) { checkReadOnlySession(t, session, "--read-only") })
+	t.Run("environment", func(t *testing.T) {
+		t.Setenv("MCP_READ_ONLY", "1")
+		checkReadOnlySession(t, session)
+	})
+}
+
+// checkReadOnlySession checks that a session started with args lists no
+// revealing tool and refuses calls to them, directly or in a batch.
+func checkReadOnlySession(t *testing.T, session func(...string) ([]map[string]interface{}, string), args ...string) {
+	t.Helper()
+	messages, stdout := session(args...)
+	tools := toolNamesFrom(t, responseTo(t, messages, float64(1)))
+	for _, name := range []string{"get_api_key", "fill_template", "generate_k8s_secret"} {
+		if contains(tools, name) {
+			t.Errorf("%s is listed in read-only mode", name)
+		}
+	}
+	if !contains(tools, "check_api_key_exists") || !contains(tools, "list_api_keys") {
+		t.Errorf("read-only mode hides the checking tools: %v", tools)
+	}
+
+	for _, id := range []float64{2, 3, 4, 5} {
+		result, _ := responseTo(t, messages, id)["result"].(map[string]interface{})
+		content, _ := json.Marshal(result["content"])
+		if result["isError"] != true || !strings.Contains(string(content), "read-only mode") {
+			t.Errorf("call %v in read-only mode = %v, want an isError naming the mode", id, result)
+		}
+	}
+	if result, _ := responseTo(t, messages, float64(6))["result"].(map[string]interface{}); result["isError"] == true {
+		t.Errorf("check_api_key_exists in read-only mode = %v", result)
+	}
+	if strings.Contains(stdout, "readonly0123456789") {
+		t.Errorf("read-only mode revealed the key: %s", stdout)
+	}
+}
+
+func TestRevealPolicyPatterns(t *testing.T) {
+	for _, test := range []struct {
+		allow, deny []string
+		key         string
+		want        bool
+	}{
+		{nil, nil, "stripe", true},
+		{nil, []string{"stripe"}, "stripe", false},
+		{nil, []string{"stripe"}, "stripe_test", true},
+		{nil, []string{"aws_*"}, "aws_secret_key", false},
+		{nil, []string{"aws_*"}, "openai", true},
+		{nil, []string{"*_token"}, "github_token", false},
+		{nil, []string{"?penai"}, "openai", false},
+		{nil, []string{"[ab]*"}, "anthropic", false},
+		{nil, []string{"[ab]*"}, "openai", true},
+		{[]string{"openai"}, nil, "openai", true},
+		{[]string{"openai"}, nil, "anthropic", false},
+		{[]string{"*"}, nil, "anything", true},
+		// Deny wins over allow
+		{[]string{"aws_*"}, []string{"aws_secret_key"}, "aws_secret_key", false},
+		{[]string{"aws_*"}, []string{"aws_secret_key"}, "aws_access_key", true},
+		{[]string{"*"}, []string{"*"}, "openai", false},
+	} {
+		got, err := server.RevealAllows(test.allow, test.deny, test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("allow %v, deny %v: %s = %t, want %t", test.allow, test.deny, test.key, got, test.want)
+		}
+	}
+
+	if _, err := server.RevealAllows(nil, []string{"[aws"}, "aws"); err == nil {
+		t.Error("a malformed pattern is accepted")
+	}
+}
+
+func TestRevealPolicyFromFlagsAndConfig(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{
+		"openai":    "sk-proj-revealpolicy0123456789",
+		"anthropic": "sk-ant-REDACTED",
+	})
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"reveal_deny": ["anth*"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	call := func(id int, tool, key string) string {
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":%q,"arguments":{"key_name":%q}}}`, id, tool, key)
+	}
+	stdin := strings.Join([]string{
+		initializeLine,
+		initializedLine,
+		call(1, "get_api_key", "openai"),
+		call(2, "get_api_key", "anthropic"),
+		call(3, "check_api_key_exists", "anthropic"),
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"fill_template","arguments":{"template":"{{anthropic}}"}}}`,
+	}, "\n") + "\n"
+
+	for name, args := range map[string][]string{
+		"flag":   {"--reveal-deny", "anth*"},
+		"config": {"--config", configPath},
+		// A key both allowed and denied stays blocked
+		"precedence": {"--reveal-allow", "openai,anthropic", "--reveal-deny", "anthropic"},
+	} {
+		code, stdout, stderr := execute(t, context.Background(), stdin, append([]string{"--watch-env=false", "--log-level", "error"}, args...)...)
+		if code != 0 {
+			t.Fatalf("%s: Execute = %d, %s", name, code, stderr)
+		}
+		if !strings.Contains(stdout, "revealpolicy0123456789") || !strings.Contains(stdout, "sk-proj-") {
+			t.Errorf("%s: an allowed key isn't revealed: %s", name, stdout)
+		}
+		if strings.Contains(stdout, "sk-ant-") {
+			t.Errorf("%s: a denied key is revealed: %s", name, stdout)
+		}
+		if !strings.Contains(stdout, "is configured but blocked by") {
+			t.Errorf("%s: the refusal doesn't say the key is policy-blocked: %s", name, stdout)
+		}
+		if !strings.Contains(stdout, "API key 'anthropic' is configured (value") {
+			t.Errorf("%s: check_api_key_exists doesn't see a denied key: %s", name, stdout)
+		}
+	}
+}
+
+func TestDoctorPolicyTableMatchesTheServer(t *testing.T) {
+	testmcp.ClearKeys(t)
+	dir := t.TempDir()
+	policyPath := filepath.Join(dir, "policy.json")
+	policy := `{"default": "reveal", "keys": {"github_token": "check_only"}, "clients": [{"name": "ci-*", "keys": {"github_token": "reveal"}}]}`
+	configPath := filepath.Join(dir, "config.json")
+	config := `{"never_reveal": ["stripe"], "reveal_deny": ["anthropic"]}`
+	for path, content := range map[string]string{policyPath: policy, configPath: config} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, stdout, stderr := execute(t, context.Background(), "", "doctor", "--config", configPath, "--policy", policyPath, "--reveal-deny", "openai")
+	tables := map[string]map[string]string{}
+	var table map[string]string
+	for _, line := range strings.Split(stdout, "\n") {
+		switch fields := strings.Fields(line); {
+		case line == "Effective access policy:" || strings.HasPrefix(line, "For clients named"):
+			table = map[string]string{}
+			tables[line] = table
+		case line == "":
+			table = nil
+		case table != nil && len(fields) == 3:
+			table[fields[0]] = fields[2]
+		}
+	}
+
+	for heading, want := range map[string]map[string]string{
+		"Effective access policy:": {"openai": "check_only", "anthropic": "check_only", "stripe": "check_only", "github_token": "check_only", "cohere": "reveal"},
+		// A client rule can't reveal what the flags, the config or the
+		// key's reveal: false keep check-only
+		`For clients named "ci-*":`: {"openai": "check_only", "anthropic": "check_only", "stripe": "check_only", "github_token": "reveal", "cohere": "reveal"},
+	} {
+		for key, access := range want {
+			if got := tables[heading][key]; got != access {
+				t.Errorf("%s %s = %q, want %q\n%s%s", heading, key, got, access, stdout, stderr)
+			}
+		}
+	}
+}
+
+func TestClientPoliciesChangeToolsList(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-clientpolicy0123456789"})
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	policy := `{"default": "reveal", "clients": [{"name": "internal-agent*", "default": "check_only"}]}`
+	if err := os.WriteFile(policyPath, []byte(policy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	session := func(clientName string) ([]map[string]interface{}, string) {
+		t.Helper()
+		stdin := strings.Join([]string{
+			fmt.Sprintf(`{"jsonrpc":"2.0","id":"init","method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":%q,"version":"1"}}}`, clientName),
+			initializedLine,
+			`{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}`,
+			getAPIKeyLine(2, ""),
+		}, "\n") + "\n"
+		code, stdout, stderr := execute(t, context.Background(), stdin, "--watch-env=false", "--log-level", "error", "--policy", policyPath)
+		if code != 0 {
+			t.Fatalf("Execute = %d, %s", code, stderr)
+		}
+		var messages []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+			var message map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &message); err != nil {
+				t.Fatalf("stdout line %q isn't JSON", line)
+			}
+			messages = append(messages, message)
+		}
+		return messages, stdout
+	}
+
+	desktop, desktopOut := session("Claude Desktop")
+	agent, agentOut := session("Internal-Agent-Experimental")
+
+	desktopTools := toolNamesFrom(t, responseTo(t, desktop, float64(1)))
+	agentTools := toolNamesFrom(t, responseTo(t, agent, float64(1)))
+	for _, name := range []string{"get_api_key", "fill_template", "generate_k8s_secret"} {
+		if !contains(desktopTools, name) {
+			t.Errorf("%s isn't offered to a client without rules", name)
+		}
+		if contains(agentTools, name) {
+			t.Errorf("%s is offered to a check-only client", name)
+		}
+	}
+	if !contains(agentTools, "check_api_key_exists") || len(agentTools) >= len(desktopTools) {
+		t.Errorf("check-only client tools = %v, want the others less the revealing ones", agentTools)
+	}
+
+	if !strings.Contains(desktopOut, "clientpolicy0123456789") {
+		t.Errorf("a client without rules can't reveal: %s", desktopOut)
+	}
+	if result, _ := responseTo(t, agent, float64(2))["result"].(map[string]interface{}); result["isError"] != true || strings.Contains(agentOut, "clientpolicy0123456789") {
+		t.Errorf("a check-only client revealed a key: %s", agentOut)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// networkTimeout bounds each request tools make to a provider's API.
+const networkTimeout = 10 * time.Second
+
+// networkClient makes every outbound provider request. Tools that use it are
+// only offered with --allow-network.
+var networkClient = &http.Client{Timeout: networkTimeout}
+
+// maxProviderResponse caps how much of a provider's response body is read.
+const maxProviderResponse = 1 << 20
+
+// providerGet sends a GET with the given headers and returns the response
+// with its body read. Transport errors can quote the request, key and all,
+// so callers scrub them against their registry's secrets before they leave
+// the process.
+func providerGet(ctx context.Context, url string, headers map[string]string) (*http.Response, []byte, error) {
+	return providerRequest(ctx, http.MethodGet, url, headers, "")
+}
+
+// providerPost is providerGet for a POST with a body.
+func providerPost(ctx context.Context, url string, headers map[string]string, body string) (*http.Response, []byte, error) {
+	return providerRequest(ctx, http.MethodPost, url, headers, body)
+}
+
+func providerRequest(ctx context.Context, method, url string, headers map[string]string, body string) (*http.Response, []byte, error) {
+	var requestBody io.Reader
+	if body != "" {
+		requestBody = strings.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, requestBody)
+	if err != nil {
+		return nil, nil, err
+	}
+	request.Header.Set("User-Agent", serverName)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	// Only the host is recorded: some providers take the key in the query
+	_, sp := startChild(ctx, method+" "+request.URL.Host)
+	sp.setAttribute("http.request.method", method)
+	sp.setAttribute("server.address", request.URL.Host)
+	defer sp.end()
+
+	response, err := networkClient.Do(request)
+	if err != nil {
+		sp.fail("request failed")
+		return nil, nil, err
+	}
+	sp.setIntAttribute("http.response.status_code", response.StatusCode)
+	defer response.Body.Close()
+	responseBody, err := io.ReadAll(io.LimitReader(response.Body, maxProviderResponse))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response from %s: %w", request.URL.Host, err)
+	}
+	return response, responseBody, nil
+}
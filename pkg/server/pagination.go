@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+)
+
+// defaultPageSize is large enough that every list fits on one page for
+// current registries; clients that don't paginate see everything at once.
+const defaultPageSize = 100
+
+// PaginatedParams are the params of the paginated list methods.
+type PaginatedParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid cursor %q: pass back the nextCursor from a previous response unchanged", cursor)
+	}
+	offset, err := strconv.Atoi(string(data))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("Invalid cursor %q: pass back the nextCursor from a previous response unchanged", cursor)
+	}
+	return offset, nil
+}
+
+// paginate returns the [start, end) bounds of the page of a total-length list
+// that the cursor points at, plus the cursor for the following page, which
+// is empty on the last page.
+func (s *Server) paginate(total int, cursor string) (start, end int, nextCursor string, err error) {
+	if cursor != "" {
+		if start, err = decodeCursor(cursor); err != nil {
+			return 0, 0, "", err
+		}
+		if start > total {
+			return 0, 0, "", fmt.Errorf("Invalid cursor %q: it points past the end of the list", cursor)
+		}
+	}
+
+	end = start + s.pageSize
+	if end >= total {
+		return start, total, "", nil
+	}
+	return start, end, encodeCursor(end), nil
+}
@@ -0,0 +1,53 @@
+//go:build paniccheck
+
+package server_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+// These tests register a tool that panics on purpose; run them with
+// go test -tags paniccheck.
+
+func TestToolPanicIsAnInternalError(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-panictest0123456789"})
+	c := testmcp.New(server.WithLogger(discardLogger))
+	panicking := server.Tool{Name: "panic", Description: "Panics", InputSchema: server.InputSchema{Type: "object"}}
+	err := c.Server.RegisterTool(panicking, func(context.Context, map[string]interface{}) server.CallToolResult {
+		panic("handler bug holding sk-proj-panictest0123456789")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.CallTool("panic", map[string]interface{}{})
+	var rpcErr *testmcp.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32603 {
+		t.Fatalf("a panicking tool = %v, want error -32603", err)
+	}
+	data := string(rpcErr.Data)
+	if !strings.Contains(data, "handler bug") || !strings.Contains(data, `"tool":"panic"`) {
+		t.Errorf("error data = %s, want the panic summary and the tool", data)
+	}
+	if strings.Contains(data, "panictest") {
+		t.Errorf("error data holds the key value: %s", data)
+	}
+
+	// The session goes on
+	if err := c.Call("ping", nil, nil); err != nil {
+		t.Errorf("ping after the panic = %v", err)
+	}
+	result, err := c.CallTool("check_api_key_exists", map[string]interface{}{"key_name": "openai"})
+	if err != nil || result.IsError {
+		t.Errorf("a tool call after the panic = %+v, %v", result, err)
+	}
+}
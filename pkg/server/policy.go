@@ -0,0 +1,351 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/registry"
+)
+
+// revealPolicy decides which keys get_api_key may reveal. Keys matching a
+// deny pattern are never revealed; when there are allow patterns, only keys
+// matching one of them are. Patterns are key names or globs such as "aws_*".
+// Blocked keys can still be listed and checked.
+type revealPolicy struct {
+	allow []string
+	deny  []string
+}
+
+// newRevealPolicy builds a policy, rejecting malformed patterns.
+func newRevealPolicy(allow, deny []string) (revealPolicy, error) {
+	for _, pattern := range append(append([]string{}, allow...), deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return revealPolicy{}, fmt.Errorf("invalid key pattern %q: %w", pattern, err)
+		}
+	}
+	return revealPolicy{allow: allow, deny: deny}, nil
+}
+
+// allows reports whether keyName may be revealed.
+func (p revealPolicy) allows(keyName string) bool {
+	if matchesAny(p.deny, keyName) {
+		return false
+	}
+	return len(p.allow) == 0 || matchesAny(p.allow, keyName)
+}
+
+func matchesAny(patterns []string, keyName string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, keyName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPatterns splits a comma-separated flag value into patterns.
+func splitPatterns(value string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// keyAccess is what clients may do with a key.
+type keyAccess string
+
+const (
+	// accessReveal keys can be listed, checked and revealed.
+	accessReveal keyAccess = "reveal"
+	// accessCheckOnly keys can be listed and checked but not revealed.
+	accessCheckOnly keyAccess = "check_only"
+	// accessHidden keys are left out of the registry entirely.
+	accessHidden keyAccess = "hidden"
+)
+
+// accessRules set the access to keys. The most specific setting wins: a
+// key's own entry, then its category's, then the default.
+type accessRules struct {
+	Default    keyAccess            `json:"default"`
+	Categories map[string]keyAccess `json:"categories"`
+	Keys       map[string]keyAccess `json:"keys"`
+}
+
+// accessPolicy is the policy file given with --policy: rules for every
+// session, and rules for particular clients that take precedence over them.
+type accessPolicy struct {
+	accessRules
+	// Clients apply to sessions whose initialize clientInfo.name matches
+	// Name, a glob compared ignoring case; the first match applies.
+	Clients []clientRules `json:"clients"`
+}
+
+// clientRules are the access rules for the clients matching Name. They
+// can't hide keys, since the registry is shared by every session.
+type clientRules struct {
+	Name string `json:"name"`
+	accessRules
+}
+
+// loadAccessPolicy reads and validates a policy file. Unknown fields,
+// categories, keys and access levels are errors, so a typo can't leave a key
+// more exposed than intended.
+func loadAccessPolicy(keys *keyRegistry, path string) (accessPolicy, error) {
+	var policy accessPolicy
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policy, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policy); err != nil {
+		return policy, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+
+	if err := policy.accessRules.validate(keys, false); err != nil {
+		return policy, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+	for i, client := range policy.Clients {
+		if err := client.validate(keys); err != nil {
+			return policy, fmt.Errorf("invalid policy file %s: client rule %d: %w", path, i+1, err)
+		}
+	}
+	return policy, nil
+}
+
+// validate rejects a missing or malformed name pattern, and rules
+// accessRules.validate rejects.
+func (c clientRules) validate(keys *keyRegistry) error {
+	if c.Name == "" {
+		return errors.New("needs a name")
+	}
+	if _, err := path.Match(c.Name, ""); err != nil {
+		return fmt.Errorf("invalid name pattern %q: %w", c.Name, err)
+	}
+	if err := c.accessRules.validate(keys, true); err != nil {
+		return fmt.Errorf("%s: %w", c.Name, err)
+	}
+	return nil
+}
+
+// validate rejects unknown categories, keys and access levels, and for
+// client rules, hidden, which only the rules for every session may use.
+func (r accessRules) validate(keys *keyRegistry, forClient bool) error {
+	check := func(access keyAccess, what string) error {
+		if !access.valid() {
+			return fmt.Errorf("unknown access %q for %s", access, what)
+		}
+		if forClient && access == accessHidden {
+			return fmt.Errorf("%s: client rules can't hide keys; use check_only", what)
+		}
+		return nil
+	}
+	if r.Default != "" {
+		if err := check(r.Default, "default"); err != nil {
+			return err
+		}
+	}
+	for category, access := range r.Categories {
+		if !validCategory(category) || category == "all" {
+			return fmt.Errorf("unknown category %q", category)
+		}
+		if err := check(access, "category "+category); err != nil {
+			return err
+		}
+	}
+	for keyName, access := range r.Keys {
+		if _, exists := keys.config(keyName); !exists {
+			return fmt.Errorf("unknown key %q", keyName)
+		}
+		if err := check(access, "key "+keyName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a keyAccess) valid() bool {
+	return a == accessReveal || a == accessCheckOnly || a == accessHidden
+}
+
+// set returns the access the rules set for a key, if they set any.
+func (r accessRules) set(keyName string, config registry.APIKeyConfig) (keyAccess, bool) {
+	if access, ok := r.Keys[keyName]; ok {
+		return access, true
+	}
+	if access, ok := r.Categories[config.Category]; ok {
+		return access, true
+	}
+	return r.Default, r.Default != ""
+}
+
+// decide returns the access the policy grants to a key in every session.
+func (p accessPolicy) decide(keyName string, config registry.APIKeyConfig) keyAccess {
+	if access, ok := p.set(keyName, config); ok {
+		return access
+	}
+	return accessReveal
+}
+
+// clientRule returns the rules for the client named clientName, if any
+// match it.
+func (p accessPolicy) clientRule(clientName string) (clientRules, bool) {
+	for _, client := range p.Clients {
+		if matched, _ := path.Match(strings.ToLower(client.Name), strings.ToLower(clientName)); matched {
+			return client, true
+		}
+	}
+	return clientRules{}, false
+}
+
+// decideFor returns the access the policy grants to a key in a session
+// with the client named clientName: its client rules' if they set one,
+// and otherwise the policy's for every session. Hidden keys stay hidden.
+func (p accessPolicy) decideFor(clientName, keyName string, config registry.APIKeyConfig) keyAccess {
+	if client, ok := p.clientRule(clientName); ok {
+		return p.decideWith(client, keyName, config)
+	}
+	return p.decide(keyName, config)
+}
+
+// decideWith returns the access the policy grants to a key under client's
+// rules.
+func (p accessPolicy) decideWith(client clientRules, keyName string, config registry.APIKeyConfig) keyAccess {
+	access := p.decide(keyName, config)
+	if access == accessHidden {
+		return access
+	}
+	if clientAccess, ok := client.set(keyName, config); ok {
+		return clientAccess
+	}
+	return access
+}
+
+// hide removes the keys the policy hides from the registry, so no tool,
+// resource or prompt can see them.
+func (k *keyRegistry) hide(policy accessPolicy) {
+	k.update(func(name string, config registry.APIKeyConfig) (registry.APIKeyConfig, bool) {
+		return config, policy.decide(name, config) != accessHidden
+	})
+}
+
+// markNeverReveal sets reveal: false on the named keys.
+func (k *keyRegistry) markNeverReveal(names []string) error {
+	for _, name := range names {
+		if _, exists := k.config(name); !exists {
+			return fmt.Errorf("never_reveal: unknown key %s", name)
+		}
+	}
+	never := map[string]bool{}
+	for _, name := range names {
+		never[name] = true
+	}
+	k.update(func(name string, config registry.APIKeyConfig) (registry.APIKeyConfig, bool) {
+		if never[name] {
+			reveal := false
+			config.Reveal = &reveal
+		}
+		return config, true
+	})
+	return nil
+}
+
+// keyAccess returns the effective access to a key for this session's
+// client under the policy file, the --reveal-allow/--reveal-deny patterns
+// and the key's own reveal flag. Every tool that returns values decides
+// through it, so a key that is check-only here is never revealed.
+func (s *Server) keyAccess(keyName string, config registry.APIKeyConfig) keyAccess {
+	s.mu.Lock()
+	clientName := s.clientInfo.Name
+	s.mu.Unlock()
+
+	return effectiveAccess(s.accessPolicy.decideFor(clientName, keyName, config), s.revealPolicy, keyName, config)
+}
+
+// effectiveAccess narrows what the access policy grants a key to check-only
+// when the key is marked reveal: false or the reveal policy doesn't allow
+// it. doctor builds its table with it too.
+func effectiveAccess(access keyAccess, reveal revealPolicy, keyName string, config registry.APIKeyConfig) keyAccess {
+	if access == accessReveal && (!config.Revealable() || !reveal.allows(keyName)) {
+		return accessCheckOnly
+	}
+	return access
+}
+
+// policyOverrideKey marks, in a call's context, that checkKeyPolicy let the
+// call through only for its break-glass justification.
+type policyOverrideKey struct{}
+
+// policyOverridden reports whether the call may only go on as a break-glass
+// reveal.
+func policyOverridden(ctx context.Context) bool {
+	overridden, _ := ctx.Value(policyOverrideKey{}).(bool)
+	return overridden
+}
+
+// checkKeyPolicy refuses a call to a tool that reveals values when the
+// access policy doesn't let this client reveal its key_name, or the key of
+// a basic_auth username. A justification only matters for a key the policy
+// denies, and lets the call through for the handler to weigh as a
+// break-glass reveal; a key marked reveal: false stays unrevealed
+// regardless. Unknown and unconfigured keys are left to the handler to
+// report.
+func checkKeyPolicy(s *Server, tool Tool, next HandlerFunc) HandlerFunc {
+	if entry, ok := s.tools.lookup(tool.Name); !ok || !entry.revealing {
+		return next
+	}
+	return func(ctx context.Context, args map[string]interface{}) CallToolResult {
+		keyName, _ := args["key_name"].(string)
+		if config, value, exists := s.keys.lookup(keyName); exists && value != "" && s.keyAccess(keyName, config) != accessReveal {
+			if justification(args) == "" || !config.Revealable() {
+				blockedBy := "the server's reveal policy"
+				if !config.Revealable() {
+					blockedBy = "its reveal: false setting"
+				}
+				s.noteAudit(ctx, "warning", fmt.Sprintf("Access to API key '%s' was blocked by %s", keyName, blockedBy))
+				s.noteAccess(ctx, keyName, auditDenied, "blocked by reveal policy", value)
+				return failure(codePolicyDenied, fmt.Sprintf("API key '%s' is configured but blocked by %s: it can be checked with check_api_key_exists but not revealed.", keyName, blockedBy), keyDetails(keyName))
+			}
+			ctx = context.WithValue(ctx, policyOverrideKey{}, true)
+		}
+
+		// The username of basic_auth is revealed inside the result, so its
+		// key must be one the policy would reveal on its own
+		if transform, problem := parseTransform(args); problem == "" && transform.UsernameKey != "" {
+			username := transform.UsernameKey
+			if config, value, exists := s.keys.lookup(username); exists && value != "" && !config.IsComposite() && (s.keyAccess(username, config) != accessReveal || config.Restricted) {
+				s.noteAudit(ctx, "warning", fmt.Sprintf("Access to API key '%s' as a basic_auth username was blocked", username))
+				s.noteAccess(ctx, username, auditDenied, "basic_auth username not revealable", value)
+				return failure(codePolicyDenied, fmt.Sprintf("API key '%s' can't be the basic_auth username: the policy doesn't let it be revealed without confirmation.", username), keyDetails(username))
+			}
+		}
+		return next(ctx, args)
+	}
+}
+
+// mayRevealAny reports whether this session's client may reveal at least
+// one key, counting break-glass reveals. When it may not, the tools that
+// reveal values aren't offered.
+func (s *Server) mayRevealAny() bool {
+	for _, name := range s.keys.names() {
+		config, _ := s.keys.config(name)
+		switch s.keyAccess(name, config) {
+		case accessReveal:
+			return true
+		case accessCheckOnly:
+			if s.breakGlass.enabled && config.Revealable() {
+				return true
+			}
+		}
+	}
+	return false
+}
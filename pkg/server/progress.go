@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// RequestMeta is the _meta a client may attach to a request.
+type RequestMeta struct {
+	ProgressToken json.RawMessage `json:"progressToken,omitempty"`
+}
+
+// ProgressParams are the params of notifications/progress.
+type ProgressParams struct {
+	ProgressToken json.RawMessage `json:"progressToken"`
+	Progress      float64         `json:"progress"`
+	Total         float64         `json:"total,omitempty"`
+	Message       string          `json:"message,omitempty"`
+}
+
+// progressReporter sends notifications/progress for one request that asked
+// for them. Once the request's response is ready it goes quiet, so no
+// progress trails behind the result.
+type progressReporter struct {
+	server *Server
+	token  json.RawMessage
+
+	mu   sync.Mutex
+	done bool
+}
+
+type progressKey struct{}
+
+// withProgress attaches a reporter to ctx when the request supplied a
+// progress token. The returned stop function must be called before the
+// response is sent.
+func (s *Server) withProgress(ctx context.Context, meta *RequestMeta) (context.Context, func()) {
+	if meta == nil || len(meta.ProgressToken) == 0 || string(meta.ProgressToken) == "null" {
+		return ctx, func() {}
+	}
+
+	reporter := &progressReporter{server: s, token: meta.ProgressToken}
+	stop := func() {
+		reporter.mu.Lock()
+		reporter.done = true
+		reporter.mu.Unlock()
+	}
+	return context.WithValue(ctx, progressKey{}, reporter), stop
+}
+
+// reportProgress tells the client how far along the current request is. It
+// does nothing when the client didn't ask for progress.
+func reportProgress(ctx context.Context, progress, total float64, message string) {
+	reporter, ok := ctx.Value(progressKey{}).(*progressReporter)
+	if !ok {
+		return
+	}
+
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+	if reporter.done {
+		return
+	}
+	reporter.server.sendNotification("notifications/progress", ProgressParams{
+		ProgressToken: reporter.token,
+		Progress:      progress,
+		Total:         total,
+		Message:       message,
+	})
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yourusername/mcp-api-keys-server/internal/protocol"
+)
+
+// AWS access keys are rotated as a pair, so both halves share a checklist.
+var awsRotationSteps = []string{
+	"Create a second access key for the IAM user (users may hold two at once).",
+	"Update AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY together everywhere they are deployed.",
+	"Check \"last used\" on the old key to confirm nothing still uses it.",
+	"Deactivate the old key, wait, then delete it.",
+}
+
+// keyRotationSteps holds provider-specific rotation instructions. Keys without
+// an entry get the generic checklist.
+var keyRotationSteps = map[string][]string{
+	"openai": {
+		"Create a new secret key at https://platform.openai.com/api-keys in the same project.",
+		"Update OPENAI_API_KEY everywhere it is deployed and restart the services using it.",
+		"Confirm requests succeed with the new key (check the usage page for traffic).",
+		"Revoke the old key from the API keys page.",
+	},
+	"anthropic": {
+		"Create a new key at https://console.anthropic.com/settings/keys in the same workspace.",
+		"Update ANTHROPIC_API_KEY everywhere it is deployed and restart the services using it.",
+		"Confirm requests succeed with the new key.",
+		"Disable, then delete, the old key in the console.",
+	},
+	"google_ai": {
+		"Create a new key at https://aistudio.google.com/app/apikey (or in the Cloud console credentials page).",
+		"Apply the same API restrictions the old key had.",
+		"Update GOOGLE_AI_API_KEY and restart the services using it.",
+		"Delete the old key once traffic has moved over.",
+	},
+	"cohere": {
+		"Create a new key at https://dashboard.cohere.com/api-keys.",
+		"Update COHERE_API_KEY and restart the services using it.",
+		"Delete the old key from the dashboard.",
+	},
+	"stripe": {
+		"Use \"Roll key\" on https://dashboard.stripe.com/apikeys and pick an expiry for the old key.",
+		"Update STRIPE_API_KEY everywhere it is deployed before the old key expires.",
+		"Check the Stripe request logs for failures using the old key.",
+	},
+	"stripe_webhook": {
+		"Use \"Roll secret\" on the endpoint at https://dashboard.stripe.com/webhooks.",
+		"Update STRIPE_WEBHOOK_SECRET before the old secret stops being accepted.",
+		"Send a test event and confirm signature verification passes.",
+	},
+	"twilio_token": {
+		"Create a secondary auth token in the Twilio console (Account > API keys & tokens).",
+		"Update TWILIO_AUTH_TOKEN everywhere it is deployed and restart the services using it.",
+		"Promote the secondary token to primary, which invalidates the old one.",
+	},
+	"sendgrid": {
+		"Create a new key with the same permissions at https://app.sendgrid.com/settings/api_keys.",
+		"Update SENDGRID_API_KEY and restart the services using it.",
+		"Send a test email, then delete the old key.",
+	},
+	"aws_access_key": awsRotationSteps,
+	"aws_secret_key": awsRotationSteps,
+	"canva_client_secret": {
+		"Generate a new client secret for the integration at https://www.canva.com/developers/integrations.",
+		"Update CANVA_CLIENT_SECRET and restart the services using it.",
+		"Confirm the OAuth flow still completes.",
+	},
+}
+
+var genericRotationSteps = []string{
+	"Generate a new value with the issuing service (or a strong random value for internal secrets).",
+	"Deploy the new value alongside the old one if the service supports overlap.",
+	"Update %s everywhere it is deployed and restart the services using it.",
+	"Verify the service works with the new value.",
+	"Revoke or delete the old value.",
+}
+
+var prompts = []Prompt{
+	{
+		Name:        "setup_missing_keys",
+		Description: "Walk through configuring every API key that is not set yet",
+		Arguments: []PromptArgument{
+			{
+				Name:        "category",
+				Description: "Only include keys from this category: 'llm', 'saas', 'canva', 'vcs', 'internal', or 'all' (default)",
+			},
+		},
+	},
+	{
+		Name:        "rotate_key_checklist",
+		Description: "Step-by-step checklist for rotating an API key",
+		Arguments: []PromptArgument{
+			{
+				Name:        "key_name",
+				Description: "The name of the API key to rotate (e.g., 'openai', 'stripe')",
+				Required:    true,
+			},
+		},
+	},
+}
+
+func (s *Server) handlePromptsList(id json.RawMessage) protocol.Response {
+	return protocol.Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result: PromptsListResult{
+			Prompts: prompts,
+		},
+	}
+}
+
+func (s *Server) handlePromptsGet(id json.RawMessage, params GetPromptParams) protocol.Response {
+	var result GetPromptResult
+	var err error
+
+	switch params.Name {
+	case "setup_missing_keys":
+		result, err = s.renderSetupMissingKeys(params.Arguments["category"])
+	case "rotate_key_checklist":
+		result, err = s.renderRotateKeyChecklist(params.Arguments["key_name"])
+	default:
+		return errorResponseWithData(id, -32602, fmt.Sprintf("Unknown prompt: %s", params.Name), codeNotFound, map[string]interface{}{"prompt": params.Name})
+	}
+	if err != nil {
+		return errorResponse(id, -32602, err.Error())
+	}
+
+	return protocol.Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  result,
+	}
+}
+
+func userPrompt(description, text string) GetPromptResult {
+	return GetPromptResult{
+		Description: description,
+		Messages: []PromptMessage{
+			{Role: "user", Content: ContentBlock{Type: "text", Text: text}},
+		},
+	}
+}
+
+func (s *Server) renderSetupMissingKeys(category string) (GetPromptResult, error) {
+	if category == "" {
+		category = "all"
+	}
+	if !validCategory(category) {
+		return GetPromptResult{}, fmt.Errorf("Invalid category: %s", category)
+	}
+
+	var missing []string
+	for _, name := range s.keys.names() {
+		config, value, _ := s.keys.lookup(name)
+		if category != "all" && config.Category != category {
+			continue
+		}
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) == 0 {
+		return userPrompt("No missing API keys", "All API keys in this category are configured. Nothing to set up."), nil
+	}
+
+	var text strings.Builder
+	text.WriteString("Help me configure the following API keys that are not set yet. ")
+	text.WriteString("For each one, tell me where to get it and which environment variable to put it in (in .env or the environment):\n\n")
+	for _, name := range missing {
+		config, _ := s.keys.config(name)
+		text.WriteString(fmt.Sprintf("- %s: %s (env: %s)\n", name, config.Description, config.EnvLabel()))
+		if url := s.keys.guides[name].ConsoleURL; url != "" {
+			text.WriteString(fmt.Sprintf("  Obtain it at: %s\n", url))
+		} else {
+			text.WriteString("  Generate it yourself or ask the owner of the service.\n")
+		}
+	}
+	text.WriteString("\nDo not ask me to paste any key values into this conversation.")
+
+	return userPrompt(fmt.Sprintf("Set up %d missing API keys", len(missing)), text.String()), nil
+}
+
+func (s *Server) renderRotateKeyChecklist(keyName string) (GetPromptResult, error) {
+	if keyName == "" {
+		return GetPromptResult{}, fmt.Errorf("Missing required argument: key_name")
+	}
+	registered, exists := s.keys.resolveName(keyName)
+	if !exists {
+		message, _ := s.keys.unknownKeyMessage(keyName, s.keys.names())
+		return GetPromptResult{}, errors.New(message)
+	}
+	keyName = registered
+	config, _ := s.keys.config(keyName)
+
+	steps, ok := keyRotationSteps[keyName]
+	if !ok {
+		steps = make([]string, len(genericRotationSteps))
+		for i, step := range genericRotationSteps {
+			if strings.Contains(step, "%s") {
+				step = fmt.Sprintf(step, config.EnvLabel())
+			}
+			steps[i] = step
+		}
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("I need to rotate the %s (%s, env: %s). Guide me through this checklist one step at a time:\n\n", keyName, config.Description, config.EnvLabel()))
+	for i, step := range steps {
+		text.WriteString(fmt.Sprintf("%d. %s\n", i+1, step))
+	}
+	text.WriteString("\nNever ask me to paste the old or new value into this conversation.")
+
+	return userPrompt(fmt.Sprintf("Rotate %s", keyName), text.String()), nil
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// revealRate is how many reveals are allowed per period. The zero value
+// means unlimited.
+type revealRate struct {
+	count  int
+	period time.Duration
+}
+
+// parseRevealRate parses a rate such as "10/min", "1/s" or "100/hour".
+func parseRevealRate(s string) (revealRate, error) {
+	countText, unit, ok := strings.Cut(strings.TrimSpace(s), "/")
+	count, err := strconv.Atoi(countText)
+	if !ok || err != nil || count <= 0 {
+		return revealRate{}, fmt.Errorf("invalid rate %q: use <count>/<s|min|hour>, for example 10/min", s)
+	}
+	switch unit {
+	case "s", "sec", "second":
+		return revealRate{count, time.Second}, nil
+	case "m", "min", "minute":
+		return revealRate{count, time.Minute}, nil
+	case "h", "hour":
+		return revealRate{count, time.Hour}, nil
+	}
+	return revealRate{}, fmt.Errorf("invalid rate %q: unknown unit %q, use s, min or hour", s, unit)
+}
+
+// revealLimiter rate-limits reveals of each key with a token bucket: a key
+// can be revealed up to count times in a burst, and tokens come back
+// steadily over the period.
+type revealLimiter struct {
+	mu          sync.Mutex
+	now         func() time.Time
+	defaultRate revealRate
+	rates       map[string]revealRate
+	buckets     map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRevealLimiter(defaultRate revealRate, rates map[string]revealRate) *revealLimiter {
+	return &revealLimiter{
+		now:         time.Now,
+		defaultRate: defaultRate,
+		rates:       rates,
+		buckets:     make(map[string]*tokenBucket),
+	}
+}
+
+// newRevealLimiterFromConfig builds a limiter from the --reveal-rate flag and
+// the per-key rates of the config file, which must name keys in the registry.
+func newRevealLimiterFromConfig(keys *keyRegistry, defaultRate string, keyRates map[string]string) (*revealLimiter, error) {
+	var rate revealRate
+	if defaultRate != "" {
+		var err error
+		if rate, err = parseRevealRate(defaultRate); err != nil {
+			return nil, err
+		}
+	}
+
+	rates := make(map[string]revealRate, len(keyRates))
+	for keyName, text := range keyRates {
+		if _, exists := keys.config(keyName); !exists {
+			return nil, fmt.Errorf("reveal rate for unknown key %q", keyName)
+		}
+		keyRate, err := parseRevealRate(text)
+		if err != nil {
+			return nil, fmt.Errorf("reveal rate for %s: %w", keyName, err)
+		}
+		rates[keyName] = keyRate
+	}
+	return newRevealLimiter(rate, rates), nil
+}
+
+// allow takes a token for a reveal of keyName. When none is left it returns
+// false and how long until one is.
+func (l *revealLimiter) allow(keyName string) (bool, time.Duration) {
+	rate, ok := l.rates[keyName]
+	if !ok {
+		rate = l.defaultRate
+	}
+	if rate.count == 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	bucket, ok := l.buckets[keyName]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(rate.count), last: now}
+		l.buckets[keyName] = bucket
+	}
+
+	perToken := rate.period / time.Duration(rate.count)
+	bucket.tokens = math.Min(float64(rate.count), bucket.tokens+float64(now.Sub(bucket.last))/float64(perToken))
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.tokens) * float64(perToken))
+}
@@ -0,0 +1,135 @@
+package server_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+// fakeClock is a clock tests move by hand.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestRevealLimiterRefills(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	allow, err := server.NewRevealLimiter("3/min", map[string]string{"stripe": "1/hour"}, clock.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A full bucket allows a burst of the whole rate
+	for i := 0; i < 3; i++ {
+		if ok, _ := allow("openai"); !ok {
+			t.Fatalf("reveal %d of a 3/min burst is refused", i+1)
+		}
+	}
+	ok, retryAfter := allow("openai")
+	if ok || retryAfter != 20*time.Second {
+		t.Fatalf("a fourth reveal = %t, retry after %v, want refused for 20s", ok, retryAfter)
+	}
+
+	// Keys have buckets of their own
+	if ok, _ := allow("anthropic"); !ok {
+		t.Error("another key is limited by openai's reveals")
+	}
+
+	// A token comes back every 20s, and no more than the rate builds up
+	clock.Advance(10 * time.Second)
+	if ok, retryAfter := allow("openai"); ok || retryAfter != 10*time.Second {
+		t.Errorf("after 10s = %t, retry after %v, want refused for 10s", ok, retryAfter)
+	}
+	clock.Advance(10 * time.Second)
+	if ok, _ := allow("openai"); !ok {
+		t.Error("a token isn't back after 20s")
+	}
+	clock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		if ok, _ := allow("openai"); !ok {
+			t.Fatalf("reveal %d after an idle hour is refused", i+1)
+		}
+	}
+	if ok, _ := allow("openai"); ok {
+		t.Error("an idle hour builds up more than the rate")
+	}
+
+	// A per-key rate overrides the default
+	if ok, _ := allow("stripe"); !ok {
+		t.Fatal("the first stripe reveal is refused")
+	}
+	if ok, retryAfter := allow("stripe"); ok || retryAfter != time.Hour {
+		t.Errorf("a second stripe reveal = %t, retry after %v, want refused for an hour", ok, retryAfter)
+	}
+}
+
+func TestRevealLimiterUnlimited(t *testing.T) {
+	allow, err := server.NewRevealLimiter("", nil, time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if ok, _ := allow("openai"); !ok {
+			t.Fatalf("reveal %d is refused without a rate", i+1)
+		}
+	}
+}
+
+func TestRevealRatesAreChecked(t *testing.T) {
+	for _, test := range []struct {
+		rate     string
+		keyRates map[string]string
+	}{
+		{"10", nil},
+		{"0/min", nil},
+		{"-1/min", nil},
+		{"10/week", nil},
+		{"", map[string]string{"no_such_key": "1/min"}},
+		{"", map[string]string{"stripe": "often"}},
+	} {
+		if _, err := server.NewRevealLimiter(test.rate, test.keyRates, time.Now); err == nil {
+			t.Errorf("rate %q, key rates %v are accepted", test.rate, test.keyRates)
+		}
+	}
+}
+
+func TestRateLimitedRevealIsAudited(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-ratelimit0123456789"})
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	stdin := strings.Join([]string{
+		initializeLine,
+		initializedLine,
+		getAPIKeyLine(1, ""),
+		getAPIKeyLine(2, ""),
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"check_api_key_exists","arguments":{"key_name":"openai"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"check_api_key_exists","arguments":{"key_name":"openai"}}}`,
+	}, "\n") + "\n"
+
+	code, stdout, stderr := execute(t, context.Background(), stdin, "--watch-env=false", "--log-level", "error", "--reveal-rate", "1/hour", "--audit-log", auditPath)
+	if code != 0 {
+		t.Fatalf("Execute = %d, %s", code, stderr)
+	}
+	if !strings.Contains(stdout, `"id":2,"result"`) || !strings.Contains(stdout, "is rate limited, retry after") {
+		t.Errorf("the second reveal isn't rate limited: %s", stdout)
+	}
+	for _, line := range strings.Split(stdout, "\n") {
+		if (strings.Contains(line, `"id":3,`) || strings.Contains(line, `"id":4,`)) && strings.Contains(line, "isError") {
+			t.Errorf("check_api_key_exists is throttled: %s", line)
+		}
+	}
+
+	var outcomes []interface{}
+	for _, entry := range auditEntries(t, auditPath) {
+		if entry["tool"] == "get_api_key" {
+			outcomes = append(outcomes, entry["outcome"])
+		}
+	}
+	if len(outcomes) != 2 || outcomes[1] != "rate_limited" {
+		t.Errorf("get_api_key audit outcomes = %v, want the second rate_limited", outcomes)
+	}
+}
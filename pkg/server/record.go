@@ -0,0 +1,281 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Directions of a recorded message, from the server's point of view.
+const (
+	directionIn  = "in"
+	directionOut = "out"
+)
+
+// recordedMessage is one line of a --record file.
+type recordedMessage struct {
+	Time      string `json:"time"`
+	Direction string `json:"direction"`
+	// Message is the message with every string scrubbed of secret values.
+	Message json.RawMessage `json:"message,omitempty"`
+	// Raw holds, scrubbed, an inbound line that isn't valid JSON.
+	Raw string `json:"raw,omitempty"`
+}
+
+// sessionRecorder appends every message the server reads and writes to a
+// file, for --record. Values are scrubbed before they are written, so a
+// recording can be shared like a log.
+type sessionRecorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	secrets *redactor
+	// failed is set once a write fails; the session carries on unrecorded.
+	failed bool
+}
+
+// openRecorder opens path for appending, creating it readable only by its
+// owner. Every key is resolved first, so the redactor knows each value
+// before the first message is recorded.
+func openRecorder(keys *keyRegistry, path string) (*sessionRecorder, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	keys.resolveAll()
+	return &sessionRecorder{file: file, secrets: keys.secrets}, nil
+}
+
+// record appends one message. It does nothing on a nil recorder, so callers
+// needn't check whether --record is set.
+func (r *sessionRecorder) record(direction string, data []byte) {
+	if r == nil {
+		return
+	}
+	entry := recordedMessage{Time: time.Now().UTC().Format(time.RFC3339Nano), Direction: direction}
+	if scrubbed, ok := scrubJSON(r.secrets, data); ok {
+		entry.Message = scrubbed
+	} else {
+		entry.Raw = r.secrets.scrub(string(data))
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failed {
+		return
+	}
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		r.failed = true
+	}
+}
+
+// Close closes the recording file.
+func (r *sessionRecorder) Close() error {
+	return r.file.Close()
+}
+
+// scrubJSON returns data with every string in it, keys included, scrubbed
+// of the values secrets knows. Scrubbing the decoded strings rather than the raw text
+// catches values that JSON escaping would otherwise hide. ok is false when
+// data isn't valid JSON.
+func scrubJSON(secrets *redactor, data []byte) (json.RawMessage, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var message interface{}
+	if err := decoder.Decode(&message); err != nil || decoder.More() {
+		return nil, false
+	}
+	scrubbed, err := json.Marshal(scrubValue(secrets, message))
+	if err != nil {
+		return nil, false
+	}
+	return scrubbed, true
+}
+
+func scrubValue(secrets *redactor, value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		return secrets.scrub(value)
+	case []interface{}:
+		for i, element := range value {
+			value[i] = scrubValue(secrets, element)
+		}
+		return value
+	case map[string]interface{}:
+		scrubbed := make(map[string]interface{}, len(value))
+		for key, element := range value {
+			scrubbed[secrets.scrub(key)] = scrubValue(secrets, element)
+		}
+		return scrubbed
+	}
+	return value
+}
+
+// readRecording reads a --record file.
+func readRecording(path string) ([]recordedMessage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []recordedMessage
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), defaultMaxMessageSize*2)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry recordedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: not a recorded message: %w", path, lineNumber, err)
+		}
+		if entry.Direction != directionIn && entry.Direction != directionOut {
+			return nil, fmt.Errorf("%s:%d: unknown direction %q", path, lineNumber, entry.Direction)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// responsesByID splits a recorded or replayed reply, a response or a batch
+// of them, into responses keyed by their encoded id. Notifications and
+// requests have no result or error and are left out.
+func responsesByID(message json.RawMessage) map[string]json.RawMessage {
+	var batch []json.RawMessage
+	if err := json.Unmarshal(message, &batch); err != nil {
+		batch = []json.RawMessage{message}
+	}
+	responses := map[string]json.RawMessage{}
+	for _, element := range batch {
+		var envelope struct {
+			ID     json.RawMessage `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  json.RawMessage `json:"error"`
+		}
+		if json.Unmarshal(element, &envelope) != nil || envelope.ID == nil || envelope.Result == nil && envelope.Error == nil {
+			continue
+		}
+		responses[string(envelope.ID)] = element
+	}
+	return responses
+}
+
+// replayDivergence is a response that differs between the recording and
+// the replay; Recorded or Replayed is empty when there was none.
+type replayDivergence struct {
+	ID       string
+	Recorded json.RawMessage
+	Replayed json.RawMessage
+}
+
+// replaySession feeds the inbound messages of a recording to s in order
+// and compares each response with the recorded one for the same id. The
+// replayed responses are scrubbed like the recorded ones before comparing.
+func replaySession(s *Server, entries []recordedMessage) (replayed int, divergences []replayDivergence) {
+	recorded := map[string]json.RawMessage{}
+	for _, entry := range entries {
+		if entry.Direction == directionOut {
+			for id, response := range responsesByID(entry.Message) {
+				recorded[id] = response
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Direction != directionIn {
+			continue
+		}
+		message := []byte(entry.Message)
+		if entry.Message == nil {
+			message = []byte(entry.Raw)
+		}
+		replayed++
+		reply := s.Handle(message)
+		if reply == nil {
+			continue
+		}
+		scrubbed, _ := scrubJSON(s.keys.secrets, reply)
+		for id, response := range responsesByID(scrubbed) {
+			seen[id] = true
+			if !sameJSON(recorded[id], response) {
+				divergences = append(divergences, replayDivergence{ID: id, Recorded: recorded[id], Replayed: response})
+			}
+		}
+	}
+
+	var unanswered []string
+	for id := range recorded {
+		if !seen[id] {
+			unanswered = append(unanswered, id)
+		}
+	}
+	sort.Strings(unanswered)
+	for _, id := range unanswered {
+		divergences = append(divergences, replayDivergence{ID: id, Recorded: recorded[id]})
+	}
+	return replayed, divergences
+}
+
+// sameJSON reports whether a and b encode the same value, ignoring spacing
+// and the order of object keys.
+func sameJSON(a, b json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	var left, right interface{}
+	if json.Unmarshal(a, &left) != nil || json.Unmarshal(b, &right) != nil {
+		return bytes.Equal(a, b)
+	}
+	leftData, _ := json.Marshal(left)
+	rightData, _ := json.Marshal(right)
+	return bytes.Equal(leftData, rightData)
+}
+
+func runReplay(keys *keyRegistry, args []string, stdout, stderr io.Writer) int {
+	flags := newCommandFlags("replay", "replay <path>", stderr)
+	if err := flags.Parse(args); err != nil {
+		return exitUsageErr
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsageErr
+	}
+	entries, err := readRecording(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+
+	// New resolves every key, so the redactor knows each value
+	s := New(strings.NewReader(""), io.Discard)
+	replayed, divergences := replaySession(s, entries)
+	for _, divergence := range divergences {
+		fmt.Fprintf(stdout, "Response %s differs:\n  recorded: %s\n  replayed: %s\n", divergence.ID, orNone(divergence.Recorded), orNone(divergence.Replayed))
+	}
+	if len(divergences) > 0 {
+		fmt.Fprintf(stdout, "%d messages replayed; %d responses differ\n", replayed, len(divergences))
+		return exitFailure
+	}
+	fmt.Fprintf(stdout, "%d messages replayed; every response matches the recording\n", replayed)
+	return exitOK
+}
+
+// orNone shows a missing response as "(none)".
+func orNone(message json.RawMessage) string {
+	if message == nil {
+		return "(none)"
+	}
+	return string(message)
+}
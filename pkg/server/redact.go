@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// minRedactLength is the shortest value the redactor replaces; shorter ones
+// would match too much unrelated text to be worth scrubbing.
+const minRedactLength = 6
+
+// redactor remembers the secret values resolved this session and replaces
+// any occurrence of them in text with [REDACTED:<key name>].
+type redactor struct {
+	mu       sync.RWMutex
+	names    map[string]string // value -> key name
+	replacer *strings.Replacer
+}
+
+// newRedactor returns a redactor that knows no values yet. Each key
+// registry has one, holding every value its lookup resolved; logs, error
+// messages and tool errors are scrubbed against it before they leave the
+// process.
+func newRedactor() *redactor {
+	return &redactor{names: map[string]string{}}
+}
+
+// remember adds a resolved value to the redactor.
+func (r *redactor) remember(keyName, value string) {
+	if len(value) < minRedactLength {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[value] == keyName {
+		return
+	}
+	r.names[value] = keyName
+
+	// Replace longer values first, so a value containing another is
+	// redacted as a whole
+	values := make([]string, 0, len(r.names))
+	for v := range r.names {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, fmt.Sprintf("[REDACTED:%s]", r.names[v]))
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+// scrub returns s with every known secret value replaced.
+func (r *redactor) scrub(s string) string {
+	r.mu.RLock()
+	replacer := r.replacer
+	r.mu.RUnlock()
+	if replacer == nil {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+// scrubError returns err with known secret values removed from its message.
+// The original error stays reachable through errors.Is and errors.As.
+func (r *redactor) scrubError(err error) error {
+	if err == nil {
+		return nil
+	}
+	message := r.scrub(err.Error())
+	if message == err.Error() {
+		return err
+	}
+	return &redactedError{message: message, err: err}
+}
+
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e *redactedError) Error() string { return e.message }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactingHandler is a slog.Handler that scrubs the message and attributes
+// of every record before passing it on.
+type redactingHandler struct {
+	slog.Handler
+	redactor *redactor
+}
+
+func (h redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	scrubbed := slog.NewRecord(record.Time, record.Level, h.redactor.scrub(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		scrubbed.AddAttrs(h.scrubAttr(attr))
+		return true
+	})
+	return h.Handler.Handle(ctx, scrubbed)
+}
+
+func (h redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	scrubbed := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		scrubbed[i] = h.scrubAttr(attr)
+	}
+	return redactingHandler{Handler: h.Handler.WithAttrs(scrubbed), redactor: h.redactor}
+}
+
+func (h redactingHandler) WithGroup(name string) slog.Handler {
+	return redactingHandler{Handler: h.Handler.WithGroup(name), redactor: h.redactor}
+}
+
+func (h redactingHandler) scrubAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, h.redactor.scrub(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		scrubbed := make([]any, len(group))
+		for i, nested := range group {
+			scrubbed[i] = h.scrubAttr(nested)
+		}
+		return slog.Group(attr.Key, scrubbed...)
+	case slog.KindAny:
+		// Errors, structs and the like are rendered to find secrets in
+		// them, and only replaced by their text if something was redacted
+		text := fmt.Sprint(value.Any())
+		if scrubbed := h.redactor.scrub(text); scrubbed != text {
+			return slog.String(attr.Key, scrubbed)
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
@@ -0,0 +1,40 @@
+package server_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+func TestLoggerRedactsKeyValues(t *testing.T) {
+	const value = "sk-proj-logredaction0123456789"
+	testmcp.SetKeys(t, map[string]string{"openai": value})
+	for _, format := range []string{"text", "json"} {
+		var output bytes.Buffer
+		handler := slog.Handler(slog.NewTextHandler(&output, nil))
+		if format == "json" {
+			handler = slog.NewJSONHandler(&output, nil)
+		}
+		c := testmcp.New(server.WithLogger(slog.New(handler)))
+
+		logger := c.Server.Logger().With("preset", "key "+value)
+		logger.Info("read "+value,
+			"value", value,
+			"error", errors.New("backend rejected "+value),
+			slog.Group("request", "header", "Bearer "+value),
+		)
+		logger.WithGroup("upstream").Warn("failed", "body", value)
+
+		if strings.Contains(output.String(), "logredaction") {
+			t.Errorf("%s: the log holds the value:\n%s", format, output.String())
+		}
+		if got := strings.Count(output.String(), "[REDACTED:openai]"); got != 7 {
+			t.Errorf("%s: got %d redactions, want 7:\n%s", format, got, output.String())
+		}
+	}
+}
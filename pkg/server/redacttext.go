@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// secretVariant is one form of a configured value that redact_text looks
+// for: the value itself, or an encoding of it.
+type secretVariant struct {
+	text    string
+	keyName string
+}
+
+// secretVariants returns every configured value with its URL-encoded and
+// base64 forms, longest first so a value containing another is replaced as
+// a whole. Keys with identical values are reported under the name that
+// sorts first.
+func (k *keyRegistry) secretVariants() []secretVariant {
+	var variants []secretVariant
+	seen := map[string]bool{}
+	for _, name := range k.names() {
+		_, value, _ := k.lookup(name)
+		if len(value) < minRedactLength {
+			continue
+		}
+		for _, text := range []string{
+			value,
+			url.QueryEscape(value),
+			url.PathEscape(value),
+			base64.StdEncoding.EncodeToString([]byte(value)),
+			base64.URLEncoding.EncodeToString([]byte(value)),
+			base64.RawStdEncoding.EncodeToString([]byte(value)),
+			base64.RawURLEncoding.EncodeToString([]byte(value)),
+		} {
+			if !seen[text] {
+				seen[text] = true
+				variants = append(variants, secretVariant{text: text, keyName: name})
+			}
+		}
+	}
+	sort.SliceStable(variants, func(i, j int) bool { return len(variants[i].text) > len(variants[j].text) })
+	return variants
+}
+
+// redactText replaces every variant found in text with [REDACTED:<key name>]
+// and counts the replacements per key. It scans left to right and takes the
+// longest variant matching at each position, so overlapping matches are
+// resolved the same way every time.
+func redactText(text string, variants []secretVariant) (string, map[string]int) {
+	counts := map[string]int{}
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		matched := false
+		for _, variant := range variants {
+			if strings.HasPrefix(text[i:], variant.text) {
+				b.WriteString("[REDACTED:" + variant.keyName + "]")
+				counts[variant.keyName]++
+				i += len(variant.text)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			b.WriteByte(text[i])
+			i++
+		}
+	}
+	return b.String(), counts
+}
+
+// redactionCount is the number of replacements made for one key.
+type redactionCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// redactTextSchema describes the structured result of redact_text.
+var redactTextSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"text": {Type: "string", Description: "The text with secret values replaced"},
+		"replacements": {
+			Type:        "array",
+			Description: "Replacements made per key, sorted by key name",
+			Items: &Property{
+				Type: "object",
+				Properties: map[string]Property{
+					"key":   {Type: "string", Description: "Name of the key whose value was found"},
+					"count": {Type: "integer", Description: "Occurrences replaced, including encoded forms"},
+				},
+				Required: []string{"key", "count"},
+			},
+		},
+	},
+	Required: []string{"text", "replacements"},
+}
+
+func (s *Server) handleRedactText(ctx context.Context, args map[string]interface{}) CallToolResult {
+	text, ok := args["text"].(string)
+	if !ok {
+		return failure(codeValidationFailed, "Error: text is required", nil)
+	}
+
+	redacted, counts := redactText(text, s.keys.secretVariants())
+
+	replacements := make([]redactionCount, 0, len(counts))
+	total := 0
+	for key, count := range counts {
+		replacements = append(replacements, redactionCount{Key: key, Count: count})
+		total += count
+	}
+	sort.Slice(replacements, func(i, j int) bool { return replacements[i].Key < replacements[j].Key })
+
+	summary := "No configured secret values found."
+	if total > 0 {
+		parts := make([]string, len(replacements))
+		for i, r := range replacements {
+			parts[i] = fmt.Sprintf("%s (%d)", r.Key, r.Count)
+		}
+		summary = fmt.Sprintf("Redacted %d occurrences: %s", total, strings.Join(parts, ", "))
+	}
+
+	// The text stays alone in its block so clients can use it as is
+	result := CallToolResult{
+		Content: []ContentBlock{
+			{Type: "text", Text: redacted},
+			{Type: "text", Text: summary},
+		},
+	}
+	if s.supportsStructuredContent() {
+		result.StructuredContent = map[string]interface{}{"text": redacted, "replacements": replacements}
+	}
+	return result
+}
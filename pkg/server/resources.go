@@ -0,0 +1,230 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/yourusername/mcp-api-keys-server/internal/protocol"
+)
+
+// Status resources expose the configured state of each API key without ever
+// revealing its value. Clients can subscribe to them to be told when a key
+// goes from missing to configured (or its value changes).
+const statusResourcePrefix = "apikey://status/"
+
+// keyStatus is the client-visible state of a key, as served by its status
+// resource.
+type keyStatus struct {
+	Name        string `json:"name"`
+	EnvVar      string `json:"env_var"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	Configured  bool   `json:"configured"`
+	Masked      string `json:"masked,omitempty"`
+	// Placeholder is set when the value looks like a stand-in such as
+	// "changeme" rather than a real key.
+	Placeholder bool `json:"placeholder,omitempty"`
+	// EmptyEnvVars lists the variables of an unconfigured key that are
+	// defined with no value rather than not defined at all.
+	EmptyEnvVars []string `json:"empty_env_vars,omitempty"`
+	// Environment is the provider environment the value's prefix reveals,
+	// such as "live" or "test" for Stripe.
+	Environment string `json:"environment,omitempty"`
+	// RotationOverdue is set when the key is older than its max_age_days.
+	RotationOverdue bool `json:"rotation_overdue,omitempty"`
+	// NeverReveal is set for keys whose config has reveal: false.
+	NeverReveal bool `json:"never_reveal,omitempty"`
+	// Members break a composite key down into its variables.
+	Members []memberStatus `json:"members,omitempty"`
+}
+
+// keyStatusSchema describes keyStatus for tool output schemas.
+var keyStatusSchema = Property{
+	Type: "object",
+	Properties: map[string]Property{
+		"name":             {Type: "string", Description: "Key name used with get_api_key"},
+		"env_var":          {Type: "string", Description: "Environment variable holding the key"},
+		"description":      {Type: "string"},
+		"category":         {Type: "string"},
+		"configured":       {Type: "boolean", Description: "Whether the environment variable has a value"},
+		"masked":           {Type: "string", Description: "Masked preview of the value, present only when configured"},
+		"placeholder":      {Type: "boolean", Description: "Whether the value looks like a placeholder rather than a real key"},
+		"empty_env_vars":   {Type: "array", Items: &Property{Type: "string"}, Description: "Variables of an unconfigured key that are set but empty, as opposed to not set at all"},
+		"rotation_overdue": {Type: "boolean", Description: "Whether the key has gone unrotated longer than its max_age_days"},
+		"never_reveal":     {Type: "boolean", Description: "Whether the key's config keeps its value from ever being returned by a tool"},
+		"environment":      {Type: "string", Description: "Provider environment revealed by the value's prefix, such as live or test, when it has one"},
+		"members": {
+			Type:        "array",
+			Description: "For composite keys, each member variable and whether it is set",
+			Items: &Property{
+				Type: "object",
+				Properties: map[string]Property{
+					"role":       {Type: "string"},
+					"env_var":    {Type: "string"},
+					"configured": {Type: "boolean"},
+					"empty":      {Type: "boolean", Description: "Whether the variable is set but empty"},
+				},
+				Required: []string{"role", "env_var", "configured"},
+			},
+		},
+	},
+	Required: []string{"name", "env_var", "description", "category", "configured"},
+}
+
+func statusResourceURI(keyName string) string {
+	return statusResourcePrefix + keyName
+}
+
+// nameFromURI returns the key name for a status resource URI, or false if
+// the URI doesn't refer to a registered key.
+func (k *keyRegistry) nameFromURI(uri string) (string, bool) {
+	if !strings.HasPrefix(uri, statusResourcePrefix) {
+		return "", false
+	}
+	name := strings.TrimPrefix(uri, statusResourcePrefix)
+	_, exists := k.config(name)
+	return name, exists
+}
+
+// status returns the current status of a key.
+func (k *keyRegistry) status(keyName string) keyStatus {
+	config, value, _ := k.lookup(keyName)
+	status := keyStatus{
+		Name:        keyName,
+		EnvVar:      config.EnvLabel(),
+		Description: config.Description,
+		Category:    config.Category,
+		NeverReveal: !config.Revealable(),
+	}
+	if config.IsComposite() {
+		// A preview of the JSON value would show nothing useful
+		status.Members = k.memberStatuses(config)
+		status.Configured = value != ""
+		if !status.Configured {
+			status.EmptyEnvVars = k.emptyEnvVars(config)
+		}
+		return status
+	}
+	if value != "" {
+		status.Configured = true
+		status.Masked = k.maskSecret(value)
+		status.Placeholder = k.looksLikePlaceholder(value)
+		status.Environment, _ = keyEnvironment(value)
+		status.RotationOverdue = k.rotations.status(keyName, time.Now()).Overdue
+	} else {
+		status.EmptyEnvVars = k.emptyEnvVars(config)
+	}
+	return status
+}
+
+// list returns the status of every key in category ("all" for every
+// key), sorted by name. All key listings are built from it.
+func (k *keyRegistry) list(category string) []keyStatus {
+	keys := make([]keyStatus, 0, k.count())
+	for _, name := range k.names() {
+		if config, _ := k.config(name); category == "all" || config.Category == category {
+			keys = append(keys, k.status(name))
+		}
+	}
+	return keys
+}
+
+func (s *Server) handleResourcesList(id json.RawMessage, params PaginatedParams) protocol.Response {
+	// Pages must be cut from the same order every time, so list keys sorted
+	// rather than in map order.
+	names := s.keys.names()
+
+	start, end, nextCursor, err := s.paginate(len(names), params.Cursor)
+	if err != nil {
+		return errorResponse(id, -32602, err.Error())
+	}
+
+	resources := make([]Resource, 0, end-start)
+	for _, name := range names[start:end] {
+		config, _ := s.keys.config(name)
+		resources = append(resources, Resource{
+			URI:         statusResourceURI(name),
+			Name:        name + " status",
+			Description: fmt.Sprintf("Configuration status of %s (%s)", config.Description, config.EnvLabel()),
+			MimeType:    "application/json",
+		})
+	}
+
+	return protocol.Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result: ResourcesListResult{
+			Resources:  resources,
+			NextCursor: nextCursor,
+		},
+	}
+}
+
+func (s *Server) handleResourcesRead(id json.RawMessage, uri string) protocol.Response {
+	keyName, ok := s.keys.nameFromURI(uri)
+	if !ok {
+		return errorResponseWithData(id, -32002, fmt.Sprintf("Resource not found: %s", uri), codeNotFound, map[string]interface{}{"uri": uri})
+	}
+
+	data, _ := json.Marshal(s.keys.status(keyName))
+	return protocol.Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result: ReadResourceResult{
+			Contents: []ResourceContents{{URI: uri, MimeType: "application/json", Text: string(data)}},
+		},
+	}
+}
+
+func (s *Server) handleResourcesSubscribe(id json.RawMessage, uri string) protocol.Response {
+	keyName, ok := s.keys.nameFromURI(uri)
+	if !ok {
+		return errorResponseWithData(id, -32002, fmt.Sprintf("Resource not found: %s", uri), codeNotFound, map[string]interface{}{"uri": uri})
+	}
+
+	s.mu.Lock()
+	s.subscriptions[uri] = s.keys.status(keyName)
+	s.mu.Unlock()
+	return protocol.Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  struct{}{},
+	}
+}
+
+func (s *Server) handleResourcesUnsubscribe(id json.RawMessage, uri string) protocol.Response {
+	s.mu.Lock()
+	delete(s.subscriptions, uri)
+	s.mu.Unlock()
+	return protocol.Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  struct{}{},
+	}
+}
+
+// notifySubscribers sends notifications/resources/updated for every
+// subscribed key whose configured state, masked value or members changed
+// since it was last reported.
+func (s *Server) notifySubscribers() {
+	var updated []string
+
+	s.mu.Lock()
+	for uri, previous := range s.subscriptions {
+		keyName, _ := s.keys.nameFromURI(uri)
+		current := s.keys.status(keyName)
+		if reflect.DeepEqual(current, previous) {
+			continue
+		}
+		s.subscriptions[uri] = current
+		updated = append(updated, uri)
+	}
+	s.mu.Unlock()
+
+	for _, uri := range updated {
+		s.sendNotification("notifications/resources/updated", ResourceURIParams{URI: uri})
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// revealForTool resolves a key for a tool that writes values into generated
+// text, under the same rules as get_api_key except that restricted keys are
+// always refused: generated text is no place to ask for confirmation. It
+// returns the value, a fake one in dry-run mode, or why the key can't be
+// used.
+func (s *Server) revealForTool(ctx context.Context, keyName string) (string, string) {
+	config, value, exists := s.keys.lookup(keyName)
+	switch {
+	case !exists:
+		return "", "unknown key"
+	case value == "":
+		return "", fmt.Sprintf("not configured, set %s", s.keys.unsetLabel(config))
+	case s.readOnly:
+		return "", "the server is in read-only mode"
+	case s.keyAccess(keyName, config) != accessReveal:
+		s.noteAccess(ctx, keyName, auditDenied, "blocked by reveal policy", value)
+		return "", "blocked by the reveal policy"
+	case config.Restricted:
+		s.noteAccess(ctx, keyName, auditDenied, "restricted key", value)
+		return "", "restricted, fetch it with get_api_key instead"
+	case s.blockLiveReveal && isLiveValue(value):
+		s.noteAccess(ctx, keyName, auditDenied, "live key", value)
+		return "", "live key, fetch it with get_api_key and confirm_live instead"
+	}
+	release, message := s.reserveRevealBudget(keyName, false)
+	if message != "" {
+		s.noteAccess(ctx, keyName, auditDenied, "reveal budget exhausted", value)
+		return "", "the session reveal budget is used up"
+	}
+	if s.revealLimiter != nil {
+		if ok, retryAfter := s.revealLimiter.allow(keyName); !ok {
+			release()
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			s.noteAccess(ctx, keyName, auditLimited, fmt.Sprintf("retry after %ds", seconds), value)
+			return "", fmt.Sprintf("rate limited, retry after %ds", seconds)
+		}
+	}
+
+	if s.dryRun {
+		s.noteAccess(ctx, keyName, auditRevealed, "dry run", s.keys.fakeSecret(keyName))
+		return s.keys.fakeSecret(keyName), ""
+	}
+	s.noteAccess(ctx, keyName, auditRevealed, "", value)
+	return value, ""
+}
+
+// selectedKeys returns the key names a generating tool was asked for: the
+// "keys" argument if given, otherwise every key in "category" ("all" by
+// default). Names are checked against the registry.
+func (k *keyRegistry) selectedKeys(args map[string]interface{}) ([]string, error) {
+	if list, ok := args["keys"].([]interface{}); ok && len(list) > 0 {
+		names := make([]string, 0, len(list))
+		for _, item := range list {
+			name, _ := item.(string)
+			if _, exists := k.config(name); !exists {
+				return nil, withCode(codeUnknownKey, fmt.Errorf("Unknown API key name: %s", name))
+			}
+			names = append(names, name)
+		}
+		return names, nil
+	}
+
+	category := "all"
+	if cat, ok := args["category"].(string); ok && cat != "" {
+		category = cat
+	}
+	var names []string
+	for _, key := range k.list(category) {
+		names = append(names, key.Name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("No API keys in category %s", category)
+	}
+	return names, nil
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMaxKeyAgeDays is how long a key may go unrotated when the config
+// file sets no max_age_days.
+const defaultMaxKeyAgeDays = 90
+
+// stateFile is what the server persists across restarts in --state-file.
+type stateFile struct {
+	// RotatedAt records when each key was last marked rotated.
+	RotatedAt map[string]time.Time `json:"rotated_at"`
+}
+
+// rotationTracker knows when keys were last rotated, from the config file
+// and the state file, and how old they may get.
+type rotationTracker struct {
+	mu sync.Mutex
+	// statePath is where mark_key_rotated saves; empty when --state-file
+	// isn't set.
+	statePath     string
+	configured    map[string]time.Time
+	marked        map[string]time.Time
+	maxAgeDays    int
+	keyMaxAgeDays map[string]int
+}
+
+// newRotationTracker returns a tracker that knows of no rotations yet.
+// Each key registry has its own; listings read it through currentKeyStatus.
+func newRotationTracker() *rotationTracker {
+	return &rotationTracker{
+		configured: map[string]time.Time{},
+		marked:     map[string]time.Time{},
+		maxAgeDays: defaultMaxKeyAgeDays,
+	}
+}
+
+// rotationInfo is a key's age against its maximum.
+type rotationInfo struct {
+	Key        string `json:"key"`
+	RotatedAt  string `json:"rotated_at,omitempty"`
+	AgeDays    int    `json:"age_days,omitempty"`
+	MaxAgeDays int    `json:"max_age_days"`
+	Overdue    bool   `json:"overdue"`
+}
+
+// rotationInfoSchema describes the structured result of rotation_status.
+var rotationInfoSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"keys": {
+			Type: "array",
+			Items: &Property{
+				Type: "object",
+				Properties: map[string]Property{
+					"key":          {Type: "string"},
+					"rotated_at":   {Type: "string", Description: "When the key was last rotated (RFC 3339), if recorded"},
+					"age_days":     {Type: "integer", Description: "Days since the key was rotated"},
+					"max_age_days": {Type: "integer", Description: "Days the key may go unrotated"},
+					"overdue":      {Type: "boolean", Description: "Whether the key is older than max_age_days"},
+				},
+				Required: []string{"key", "max_age_days", "overdue"},
+			},
+		},
+	},
+	Required: []string{"keys"},
+}
+
+// parseRotationDate accepts a date (2026-01-31) or an RFC 3339 time.
+func parseRotationDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// configure applies the config file's rotated_at, max_age_days and
+// key_max_age_days, which must name keys in the registry.
+func (t *rotationTracker) configure(keys *keyRegistry, config fileConfig) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name, value := range config.RotatedAt {
+		if _, exists := keys.config(name); !exists {
+			return fmt.Errorf("rotated_at: unknown key %s", name)
+		}
+		rotated, err := parseRotationDate(value)
+		if err != nil {
+			return fmt.Errorf("rotated_at: %s: expected a date such as 2026-01-31: %w", name, err)
+		}
+		t.configured[name] = rotated
+	}
+	if config.MaxAgeDays < 0 {
+		return fmt.Errorf("max_age_days must not be negative")
+	}
+	if config.MaxAgeDays > 0 {
+		t.maxAgeDays = config.MaxAgeDays
+	}
+	for name, days := range config.KeyMaxAgeDays {
+		if _, exists := keys.config(name); !exists {
+			return fmt.Errorf("key_max_age_days: unknown key %s", name)
+		}
+		if days <= 0 {
+			return fmt.Errorf("key_max_age_days: %s must be more than 0", name)
+		}
+	}
+	t.keyMaxAgeDays = config.KeyMaxAgeDays
+	return nil
+}
+
+// load reads the state file at path, which need not exist yet, and saves
+// there from now on.
+func (t *rotationTracker) load(path string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.statePath = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	for name, rotated := range state.RotatedAt {
+		t.marked[name] = rotated
+	}
+	return nil
+}
+
+// save writes the state file through a temporary file, so a crash never
+// leaves it half written. The caller holds t.mu.
+func (t *rotationTracker) save() error {
+	data, err := json.MarshalIndent(stateFile{RotatedAt: t.marked}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.statePath), 0o700); err != nil {
+		return err
+	}
+	tmp := t.statePath + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.statePath)
+}
+
+// markRotated records that a key was rotated at now and saves the state
+// file.
+func (t *rotationTracker) markRotated(name string, now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.statePath == "" {
+		return fmt.Errorf("the server has no state file: start it with --state-file to record rotations")
+	}
+	previous, had := t.marked[name]
+	t.marked[name] = now.UTC()
+	if err := t.save(); err != nil {
+		if had {
+			t.marked[name] = previous
+		} else {
+			delete(t.marked, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// status returns a key's age against its maximum as of now. The later of
+// the config file's rotated_at and the state file's record counts.
+func (t *rotationTracker) status(name string, now time.Time) rotationInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	info := rotationInfo{Key: name, MaxAgeDays: t.maxAgeDays}
+	if days, ok := t.keyMaxAgeDays[name]; ok {
+		info.MaxAgeDays = days
+	}
+	rotated, ok := t.configured[name]
+	if marked, had := t.marked[name]; had && marked.After(rotated) {
+		rotated, ok = marked, true
+	}
+	if ok {
+		info.RotatedAt = rotated.UTC().Format(time.RFC3339)
+		info.AgeDays = int(now.Sub(rotated).Hours() / 24)
+		info.Overdue = info.AgeDays > info.MaxAgeDays
+	}
+	return info
+}
+
+// overdueKeys returns the configured keys that are past their maximum age.
+func overdueKeys(keys *keyRegistry, now time.Time) []rotationInfo {
+	var overdue []rotationInfo
+	for _, name := range keys.names() {
+		if _, value, _ := keys.lookup(name); value == "" {
+			continue
+		}
+		if info := keys.rotations.status(name, now); info.Overdue {
+			overdue = append(overdue, info)
+		}
+	}
+	return overdue
+}
+
+func (s *Server) handleMarkKeyRotated(ctx context.Context, args map[string]interface{}) CallToolResult {
+	keyName, _ := args["key_name"].(string)
+	if _, exists := s.keys.config(keyName); !exists {
+		return s.keys.unknownKeyFailure(keyName, s.keys.names())
+	}
+	if err := s.keys.rotations.markRotated(keyName, time.Now()); err != nil {
+		return errorFailure(err, codeBackendUnavailable, keyDetails(keyName))
+	}
+	s.noteAudit(ctx, "info", fmt.Sprintf("API key '%s' was marked rotated", keyName))
+	info := s.keys.rotations.status(keyName, time.Now())
+	return CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: fmt.Sprintf("%s Recorded that '%s' was rotated at %s. Next rotation due within %d days.", s.markers.status(true), keyName, info.RotatedAt, info.MaxAgeDays)}},
+	}
+}
+
+func (s *Server) handleRotationStatus(ctx context.Context, args map[string]interface{}) CallToolResult {
+	category := "all"
+	if cat, ok := args["category"].(string); ok && cat != "" {
+		category = cat
+	}
+	overdueOnly, _ := args["overdue_only"].(bool)
+
+	now := time.Now()
+	infos := []rotationInfo{}
+	var text strings.Builder
+	text.WriteString("Key rotation status:\n")
+	for _, key := range s.keys.list(category) {
+		if !key.Configured {
+			continue
+		}
+		info := s.keys.rotations.status(key.Name, now)
+		if overdueOnly && !info.Overdue {
+			continue
+		}
+		infos = append(infos, info)
+		switch {
+		case info.Overdue:
+			text.WriteString(fmt.Sprintf("  %s %s: OVERDUE, rotated %d days ago (max %d)\n", s.markers.status(false), key.Name, info.AgeDays, info.MaxAgeDays))
+		case info.RotatedAt != "":
+			text.WriteString(fmt.Sprintf("  %s %s: rotated %d days ago (max %d)\n", s.markers.status(true), key.Name, info.AgeDays, info.MaxAgeDays))
+		default:
+			text.WriteString(fmt.Sprintf("  %s %s: no rotation recorded (max %d days); use mark_key_rotated after rotating it\n", s.markers.warning, key.Name, info.MaxAgeDays))
+		}
+	}
+	if len(infos) == 0 {
+		text.WriteString("  No configured keys to report.\n")
+	}
+
+	toolResult := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text.String()}},
+	}
+	if s.supportsStructuredContent() {
+		toolResult.StructuredContent = map[string]interface{}{"keys": infos}
+	}
+	return toolResult
+}
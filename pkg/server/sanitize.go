@@ -0,0 +1,110 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/registry"
+)
+
+// sanitizeFromEnv reports whether MCP_SANITIZE_VALUES leaves sanitization
+// on; only "0" turns it off.
+func sanitizeFromEnv() bool {
+	return os.Getenv("MCP_SANITIZE_VALUES") != "0"
+}
+
+// sanitize strips surrounding whitespace and a pair of matching wrapping
+// quotes from value, and says what it stripped, such as "a trailing
+// newline". Whitespace inside the value is left alone, so connection strings
+// like "host=db user=app" keep their spaces.
+func sanitize(value string) (string, []string) {
+	var stripped []string
+	trim := func() {
+		if trimmed := strings.TrimLeftFunc(value, unicode.IsSpace); trimmed != value {
+			stripped = append(stripped, "leading whitespace")
+			value = trimmed
+		}
+		if trimmed := strings.TrimRightFunc(value, unicode.IsSpace); trimmed != value {
+			if strings.TrimRight(value[len(trimmed):], "\r\n") == "" {
+				stripped = append(stripped, "a trailing newline")
+			} else {
+				stripped = append(stripped, "trailing whitespace")
+			}
+			value = trimmed
+		}
+	}
+	trim()
+	if len(value) >= 2 && strings.ContainsAny(value[:1], `"'`) && value[len(value)-1] == value[0] {
+		if value[0] == '"' {
+			stripped = append(stripped, "wrapping double quotes")
+		} else {
+			stripped = append(stripped, "wrapping single quotes")
+		}
+		value = value[1 : len(value)-1]
+		trim()
+	}
+	return value, stripped
+}
+
+// resolvedEnv returns the value of envVar, sanitized unless the registry's
+// sanitizeValues is off. Values are sanitized by default: surrounding
+// whitespace and a pair of wrapping quotes, as left by copying a key from a
+// dashboard, are stripped. Execute sets it from --sanitize-values, and the
+// command-line commands from the environment.
+func (k *keyRegistry) resolvedEnv(envVar string) string {
+	value, _ := k.lookupEnv(envVar)
+	if k.sanitizeValues {
+		value, _ = sanitize(value)
+	}
+	return value
+}
+
+// suspiciousContent describes what is left in a resolved value that
+// probably doesn't belong in a key: a pasted Authorization scheme, line
+// breaks or tabs, spaces in anything but a key=value connection string, and
+// characters outside ASCII such as smart quotes or zero-width spaces.
+func suspiciousContent(value string) []string {
+	var found []string
+	lower := strings.ToLower(value)
+	if strings.HasPrefix(lower, "bearer ") || strings.HasPrefix(lower, "token ") || strings.HasPrefix(lower, "basic ") {
+		found = append(found, fmt.Sprintf("a %q prefix, which belongs in the Authorization header rather than the key", value[:strings.IndexByte(value, ' ')]))
+	} else if strings.ContainsAny(value, "\n\r\t") || (strings.Contains(value, " ") && !strings.Contains(value, "=")) {
+		found = append(found, "whitespace inside the value")
+	}
+	for _, r := range value {
+		if r > unicode.MaxASCII {
+			found = append(found, fmt.Sprintf("non-ASCII characters such as %U", r))
+			break
+		}
+	}
+	return found
+}
+
+// valueFindings reports on the variable a plain key's value came from: what
+// sanitization stripped from it and what suspicious content remains. With
+// sanitization off, what it would strip counts as suspicious instead.
+// Composite keys report nothing.
+func (k *keyRegistry) valueFindings(config registry.APIKeyConfig) (envVar string, stripped, suspicious []string) {
+	if config.IsComposite() {
+		return "", nil, nil
+	}
+	for _, candidate := range keyEnvVars(config) {
+		raw, _ := k.lookupEnv(candidate)
+		if k.resolvedEnv(candidate) == "" {
+			continue
+		}
+		value, changes := sanitize(raw)
+		if !k.sanitizeValues {
+			return candidate, nil, append(changes, suspiciousContent(value)...)
+		}
+		return candidate, changes, suspiciousContent(value)
+	}
+	return "", nil, nil
+}
+
+// strippedNote tells the client what was removed from a value it was given.
+func strippedNote(envVar string, stripped []string) string {
+	return fmt.Sprintf("Note: stripped %s from %s; the value above is cleaned. Fix it at the source to silence this note.", strings.Join(stripped, " and "), envVar)
+}
@@ -0,0 +1,149 @@
+package server_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+func TestSanitize(t *testing.T) {
+	for _, test := range []struct {
+		value, want, stripped string
+	}{
+		{"sk-proj-0123456789", "sk-proj-0123456789", ""},
+		{"sk-proj-0123456789\n", "sk-proj-0123456789", "a trailing newline"},
+		{"sk-proj-0123456789\r\n", "sk-proj-0123456789", "a trailing newline"},
+		{"sk-proj-0123456789 \t", "sk-proj-0123456789", "trailing whitespace"},
+		{"  sk-proj-0123456789", "sk-proj-0123456789", "leading whitespace"},
+		{`"sk-proj-0123456789"`, "sk-proj-0123456789", "wrapping double quotes"},
+		{`'sk-proj-0123456789'`, "sk-proj-0123456789", "wrapping single quotes"},
+		{" \"sk-proj-0123456789\"\n", "sk-proj-0123456789", "leading whitespace, a trailing newline, wrapping double quotes"},
+		{`" sk-proj-0123456789 "`, "sk-proj-0123456789", "wrapping double quotes, leading whitespace, trailing whitespace"},
+		// Only a matching pair of quotes around the whole value is stripped
+		{`"sk-proj-0123456789`, `"sk-proj-0123456789`, ""},
+		{`"sk-proj-0123456789'`, `"sk-proj-0123456789'`, ""},
+		{`sk-"proj"-0123456789`, `sk-"proj"-0123456789`, ""},
+		{`"`, `"`, ""},
+		{`""`, "", "wrapping double quotes"},
+		// Inner whitespace is kept: connection strings hold legitimate spaces
+		{"host=db.internal port=5432 user=app password=s3cret sslmode=require", "host=db.internal port=5432 user=app password=s3cret sslmode=require", ""},
+		{"Server=tcp:db,1433;Initial Catalog=app;User ID=app;Password=p w;", "Server=tcp:db,1433;Initial Catalog=app;User ID=app;Password=p w;", ""},
+		{" host=db user=app password='a b' \n", "host=db user=app password='a b'", "leading whitespace, trailing whitespace"},
+		{"", "", ""},
+		{" \n", "", "leading whitespace"},
+	} {
+		got, stripped := server.Sanitize(test.value)
+		if got != test.want || strings.Join(stripped, ", ") != test.stripped {
+			t.Errorf("sanitize(%q) = %q, %q; want %q, %q", test.value, got, stripped, test.want, test.stripped)
+		}
+		// Sanitizing twice changes nothing more
+		if again, stripped := server.Sanitize(got); again != got {
+			t.Errorf("sanitize(%q) = %q, %q, which sanitizes again", test.value, again, stripped)
+		}
+	}
+}
+
+func TestSuspiciousContent(t *testing.T) {
+	for _, test := range []struct {
+		value, want string
+	}{
+		{"sk-proj-0123456789", ""},
+		{"Bearer sk-proj-0123456789", `a "Bearer" prefix`},
+		{"token ghp_0123456789", `a "token" prefix`},
+		{"Basic dXNlcjpwYXNz", `a "Basic" prefix`},
+		{"sk-proj 0123456789", "whitespace inside the value"},
+		{"sk-proj\t0123456789", "whitespace inside the value"},
+		{"sk-proj\n0123456789", "whitespace inside the value"},
+		{"host=db user=app password=secret", ""},
+		{"sk-proj\u200b0123456789", "non-ASCII characters such as U+200B"},
+		{"“sk-proj-0123456789”", "non-ASCII characters such as U+201C"},
+		{"Bearer sk-proj-é", `a "Bearer" prefix, which belongs in the Authorization header rather than the key; non-ASCII characters such as U+00E9`},
+	} {
+		got := strings.Join(server.SuspiciousContent(test.value), "; ")
+		if !strings.HasPrefix(got, test.want) || (test.want == "") != (got == "") {
+			t.Errorf("suspiciousContent(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestSanitizedValuesInTools(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{
+		"openai":       " \"sk-proj-sanitize0123456789\"\n",
+		"anthropic":    "Bearer sk-ant-sanitize0123456789",
+		"database_url": "host=db.internal user=app password=sanitize0123456789",
+	})
+	c := newClient(t, server.WithSanitizeValues(true))
+
+	result, err := c.CallTool("get_api_key", map[string]interface{}{"key_name": "openai"})
+	if err != nil || result.IsError {
+		t.Fatalf("get_api_key = %+v, %v", result, err)
+	}
+	text := testmcp.Text(result)
+	if !strings.Contains(text, "sk-proj-sanitize0123456789") || strings.Contains(text, `"sk-proj-sanitize0123456789"`) {
+		t.Errorf("get_api_key = %q, want the sanitized value", text)
+	}
+	if !strings.Contains(text, "Note: stripped leading whitespace and a trailing newline and wrapping double quotes from OPENAI_API_KEY") {
+		t.Errorf("get_api_key doesn't say what was stripped: %q", text)
+	}
+
+	for _, test := range []struct {
+		key, want, unwanted string
+	}{
+		{"openai", "Sanitized: stripped leading whitespace and a trailing newline and wrapping double quotes from OPENAI_API_KEY", "Suspicious"},
+		{"anthropic", `Suspicious: ANTHROPIC_API_KEY has a "Bearer" prefix`, "Sanitized"},
+		{"database_url", "is configured", "Suspicious"},
+	} {
+		result, err := c.CallTool("check_api_key_exists", map[string]interface{}{"key_name": test.key})
+		text := testmcp.Text(result)
+		if err != nil || !strings.Contains(text, test.want) || strings.Contains(text, test.unwanted) {
+			t.Errorf("check_api_key_exists %s = %q, %v; want %q", test.key, text, err, test.want)
+		}
+	}
+
+	// The connection string comes back as it is
+	result, err = c.CallTool("get_api_key", map[string]interface{}{"key_name": "database_url"})
+	if err != nil || !strings.Contains(testmcp.Text(result), "host=db.internal user=app password=sanitize0123456789") || strings.Contains(testmcp.Text(result), "Note: stripped") {
+		t.Errorf("get_api_key of a connection string = %q, %v", testmcp.Text(result), err)
+	}
+}
+
+func TestSanitizationOff(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "'sk-proj-sanitize0123456789'\n"})
+	c := newClient(t, server.WithSanitizeValues(false))
+
+	result, err := c.CallTool("get_api_key", map[string]interface{}{"key_name": "openai"})
+	if err != nil || !strings.Contains(testmcp.Text(result), "'sk-proj-sanitize0123456789'") || strings.Contains(testmcp.Text(result), "Note: stripped") {
+		t.Errorf("get_api_key without sanitization = %q, %v; want the raw value", testmcp.Text(result), err)
+	}
+	// What would be stripped is reported as suspicious instead
+	result, err = c.CallTool("check_api_key_exists", map[string]interface{}{"key_name": "openai"})
+	if text := testmcp.Text(result); err != nil || !strings.Contains(text, "Suspicious: OPENAI_API_KEY has a trailing newline, wrapping single quotes") {
+		t.Errorf("check_api_key_exists without sanitization = %q, %v", text, err)
+	}
+}
+
+func TestDoctorReportsSanitization(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{
+		"openai":    "sk-proj-sanitize0123456789\n",
+		"anthropic": "sk-ant sanitize0123456789",
+	})
+
+	_, stdout, _ := execute(t, context.Background(), "", "doctor")
+	for _, want := range []string{
+		"openai (OPENAI_API_KEY) has a trailing newline, which the server strips; fix it at the source",
+		"anthropic (ANTHROPIC_API_KEY) has whitespace inside the value",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("doctor lacks %q:\n%s", want, stdout)
+		}
+	}
+
+	t.Setenv("MCP_SANITIZE_VALUES", "0")
+	_, stdout, _ = execute(t, context.Background(), "", "doctor")
+	if !strings.Contains(stdout, "openai (OPENAI_API_KEY) has a trailing newline") || strings.Contains(stdout, "which the server strips") {
+		t.Errorf("doctor with MCP_SANITIZE_VALUES=0:\n%s", stdout)
+	}
+}
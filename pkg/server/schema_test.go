@@ -0,0 +1,178 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+// schemaProblems returns where value doesn't match schema, the subset of
+// JSON Schema the output schemas use.
+func schemaProblems(schema server.Property, value interface{}, path string) []string {
+	var problems []string
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: %T, want an object", path, value)}
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: required %s missing", path, name))
+			}
+		}
+		for name, property := range schema.Properties {
+			if field, ok := object[name]; ok {
+				problems = append(problems, schemaProblems(property, field, path+"."+name)...)
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: %T, want an array", path, value)}
+		}
+		if schema.Items != nil {
+			for i, item := range array {
+				problems = append(problems, schemaProblems(*schema.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %T, want a string", path, value)}
+		}
+		if len(schema.Enum) > 0 && !contains(schema.Enum, text) {
+			problems = append(problems, fmt.Sprintf("%s: %q isn't one of %v", path, text, schema.Enum))
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != math.Trunc(number) {
+			problems = append(problems, fmt.Sprintf("%s: %v, want an integer", path, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			problems = append(problems, fmt.Sprintf("%s: %T, want a number", path, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: %T, want a boolean", path, value))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("%s: unknown schema type %q", path, schema.Type))
+	}
+	return problems
+}
+
+func TestStructuredContentMatchesOutputSchema(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{
+		"openai":                "sk-proj-schematest0123456789",
+		"github_webhook_secret": "schema-test-webhook-secret",
+		"jwt_secret":            "schema-test-jwt-secret-0123456789",
+	})
+	c := newClient(t)
+	tools, err := c.ListTools()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checked := 0
+	for _, tool := range tools {
+		args, ok := toolHappyPaths[tool.Name]
+		if tool.OutputSchema == nil || !ok {
+			continue
+		}
+		t.Run(tool.Name, func(t *testing.T) {
+			result, err := c.CallTool(tool.Name, args)
+			if err != nil || result.IsError {
+				t.Fatalf("%+v, %v", result, err)
+			}
+			if result.StructuredContent == nil {
+				t.Fatal("no structuredContent, though the tool declares an output schema")
+			}
+			// Check what the client receives, not the Go values
+			data, _ := json.Marshal(result.StructuredContent)
+			var content interface{}
+			json.Unmarshal(data, &content)
+			schema := server.Property{Type: tool.OutputSchema.Type, Properties: tool.OutputSchema.Properties, Required: tool.OutputSchema.Required}
+			for _, problem := range schemaProblems(schema, content, "structuredContent") {
+				t.Error(problem)
+			}
+		})
+		checked++
+	}
+	if checked < 5 {
+		t.Errorf("only %d tools with output schemas were checked", checked)
+	}
+}
+
+// toolsAt returns the tools listed, and the result of list_api_keys, to a
+// session that negotiated version.
+func toolsAt(t *testing.T, version string) ([]map[string]interface{}, map[string]interface{}) {
+	t.Helper()
+	messages := runSession(t,
+		`{"jsonrpc":"2.0","id":"init","method":"initialize","params":{"protocolVersion":"`+version+`","capabilities":{},"clientInfo":{"name":"schema-test"}}}`,
+		initializedLine,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"list_api_keys","arguments":{}}}`,
+	)
+	result, _ := responseTo(t, messages, "init")["result"].(map[string]interface{})
+	if result["protocolVersion"] != version {
+		t.Fatalf("negotiated %v, want %s", result["protocolVersion"], version)
+	}
+	list, _ := responseTo(t, messages, float64(1))["result"].(map[string]interface{})
+	var tools []map[string]interface{}
+	for _, tool := range list["tools"].([]interface{}) {
+		tools = append(tools, tool.(map[string]interface{}))
+	}
+	called, _ := responseTo(t, messages, float64(2))["result"].(map[string]interface{})
+	return tools, called
+}
+
+func TestStructuredContentNeedsProtocolVersion(t *testing.T) {
+	testmcp.ClearKeys(t)
+	tools, called := toolsAt(t, "2025-03-26")
+	for _, tool := range tools {
+		if tool["outputSchema"] != nil {
+			t.Errorf("%s has an output schema for a client on 2025-03-26", tool["name"])
+		}
+	}
+	if called["structuredContent"] != nil {
+		t.Errorf("list_api_keys sent structuredContent to a client on 2025-03-26: %v", called)
+	}
+
+	tools, called = toolsAt(t, testmcp.ProtocolVersion)
+	if called["structuredContent"] == nil {
+		t.Errorf("list_api_keys sent no structuredContent on %s", testmcp.ProtocolVersion)
+	}
+	for _, tool := range tools {
+		if tool["name"] == "list_api_keys" && tool["outputSchema"] == nil {
+			t.Errorf("list_api_keys has no output schema on %s", testmcp.ProtocolVersion)
+		}
+	}
+}
+
+func TestAnnotationsNeedProtocolVersion(t *testing.T) {
+	testmcp.ClearKeys(t)
+	tools, _ := toolsAt(t, "2024-11-05")
+	for _, tool := range tools {
+		if tool["annotations"] != nil {
+			t.Errorf("%s has annotations for a client on 2024-11-05", tool["name"])
+		}
+	}
+
+	for _, version := range []string{"2025-03-26", testmcp.ProtocolVersion} {
+		tools, _ := toolsAt(t, version)
+		for _, tool := range tools {
+			annotations, _ := tool["annotations"].(map[string]interface{})
+			if title, _ := annotations["title"].(string); title == "" {
+				t.Errorf("%s has no title on %s: %v", tool["name"], version, tool["annotations"])
+			}
+			if tool["name"] == "list_api_keys" && annotations["readOnlyHint"] != true {
+				t.Errorf("list_api_keys isn't read-only on %s: %v", version, annotations)
+			}
+		}
+	}
+}
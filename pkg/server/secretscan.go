@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// secretFinding is a string in scanned text that looks like a key.
+type secretFinding struct {
+	Provider string `json:"provider"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Offset   int    `json:"offset"`
+	Masked   string `json:"masked"`
+	// ConfiguredKey names the registered key whose value this is, if any.
+	ConfiguredKey string `json:"configured_key,omitempty"`
+}
+
+// scanForSecrets finds key-shaped strings in text: matches of a provider
+// format, configured values, and other long random-looking tokens. Findings
+// don't overlap and are sorted by position.
+func (k *keyRegistry) scanForSecrets(text string) []secretFinding {
+	type span struct {
+		start, end int
+		provider   string
+	}
+	var spans []span
+	taken := func(start, end int) bool {
+		for _, s := range spans {
+			if start < s.end && s.start < end {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, format := range keyFormats {
+		for _, loc := range format.Pattern.FindAllStringIndex(text, -1) {
+			if !taken(loc[0], loc[1]) {
+				spans = append(spans, span{loc[0], loc[1], format.Provider})
+			}
+		}
+	}
+
+	configured := map[string]string{} // value -> key name
+	for _, name := range k.names() {
+		_, value, _ := k.lookup(name)
+		if len(value) < minRedactLength {
+			continue
+		}
+		if _, ok := configured[value]; !ok {
+			configured[value] = name
+		}
+		for offset := 0; ; {
+			i := strings.Index(text[offset:], value)
+			if i < 0 {
+				break
+			}
+			start := offset + i
+			if !taken(start, start+len(value)) {
+				spans = append(spans, span{start, start + len(value), "Configured key value"})
+			}
+			offset = start + len(value)
+		}
+	}
+
+	for _, loc := range entropyCandidate.FindAllStringIndex(text, -1) {
+		if looksRandom(text[loc[0]:loc[1]]) && !taken(loc[0], loc[1]) {
+			spans = append(spans, span{loc[0], loc[1], "Unknown (high entropy)"})
+		}
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	findings := make([]secretFinding, 0, len(spans))
+	for _, s := range spans {
+		match := text[s.start:s.end]
+		line := strings.Count(text[:s.start], "\n") + 1
+		column := s.start - strings.LastIndex(text[:s.start], "\n")
+		findings = append(findings, secretFinding{
+			Provider:      s.provider,
+			Line:          line,
+			Column:        column,
+			Offset:        s.start,
+			Masked:        k.maskSecret(match),
+			ConfiguredKey: configured[match],
+		})
+	}
+	return findings
+}
+
+// secretFindingsSchema describes the structured result of
+// scan_text_for_secrets.
+var secretFindingsSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"findings": {
+			Type:        "array",
+			Description: "Key-shaped strings found, in order of position",
+			Items: &Property{
+				Type: "object",
+				Properties: map[string]Property{
+					"provider":       {Type: "string", Description: "The provider the string looks like it belongs to"},
+					"line":           {Type: "integer", Description: "Line of the finding, counting from 1"},
+					"column":         {Type: "integer", Description: "Byte column of the finding, counting from 1"},
+					"offset":         {Type: "integer", Description: "Byte offset of the finding in the text"},
+					"masked":         {Type: "string", Description: "Masked excerpt of the finding"},
+					"configured_key": {Type: "string", Description: "Name of the configured key with exactly this value, if any"},
+				},
+				Required: []string{"provider", "line", "column", "offset", "masked"},
+			},
+		},
+	},
+	Required: []string{"findings"},
+}
+
+func (s *Server) handleScanTextForSecrets(ctx context.Context, args map[string]interface{}) CallToolResult {
+	text, ok := args["text"].(string)
+	if !ok {
+		return failure(codeValidationFailed, "Error: text is required", nil)
+	}
+
+	findings := s.keys.scanForSecrets(text)
+
+	var result strings.Builder
+	if len(findings) == 0 {
+		result.WriteString("No secrets found.")
+	} else {
+		result.WriteString(fmt.Sprintf("Found %d possible secrets:\n", len(findings)))
+		for _, f := range findings {
+			result.WriteString(fmt.Sprintf("  line %d, column %d: %s %s", f.Line, f.Column, f.Provider, f.Masked))
+			if f.ConfiguredKey != "" {
+				result.WriteString(fmt.Sprintf(" (value of configured key '%s')", f.ConfiguredKey))
+			}
+			result.WriteString("\n")
+		}
+	}
+
+	toolResult := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: result.String()}},
+	}
+	if s.supportsStructuredContent() {
+		toolResult.StructuredContent = map[string]interface{}{"findings": findings}
+	}
+	return toolResult
+}
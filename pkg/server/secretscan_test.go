@@ -0,0 +1,81 @@
+package server_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+// scanFinding is what the tests check of a scan_text_for_secrets finding.
+type scanFinding struct {
+	Provider      string `json:"provider"`
+	Line          int    `json:"line"`
+	ConfiguredKey string `json:"configured_key"`
+}
+
+func TestScanTextForSecretsFixtures(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"anthropic": "sk-ant-REDACTED"})
+	c := newClient(t)
+
+	for _, test := range []struct {
+		fixture string
+		want    []scanFinding
+	}{
+		{"diff.txt", []scanFinding{
+			{Provider: "OpenAI API key", Line: 7},
+			{Provider: "AWS access key ID", Line: 8},
+			{Provider: "GitHub token", Line: 9},
+		}},
+		{"compose.yaml", []scanFinding{
+			{Provider: "Anthropic API key", Line: 6, ConfiguredKey: "anthropic"},
+			{Provider: "Stripe secret key", Line: 7},
+			{Provider: "Unknown (high entropy)", Line: 8},
+			{Provider: "SendGrid API key", Line: 9},
+		}},
+		{"clean.go", nil},
+	} {
+		t.Run(test.fixture, func(t *testing.T) {
+			text, err := os.ReadFile(filepath.Join("testdata", "secretscan", test.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := c.CallTool("scan_text_for_secrets", map[string]interface{}{"text": string(text)})
+			if err != nil || result.IsError {
+				t.Fatalf("scan_text_for_secrets = %+v, %v", result, err)
+			}
+			var scanned struct {
+				Findings []struct {
+					scanFinding
+					Column int    `json:"column"`
+					Offset int    `json:"offset"`
+					Masked string `json:"masked"`
+				} `json:"findings"`
+			}
+			data, _ := json.Marshal(result.StructuredContent)
+			if err := json.Unmarshal(data, &scanned); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []scanFinding
+			for _, finding := range scanned.Findings {
+				got = append(got, finding.scanFinding)
+				// The position points at the finding, which is masked
+				match := string(text[finding.Offset:])
+				if lineStart := strings.LastIndex(string(text[:finding.Offset]), "\n") + 1; finding.Offset-lineStart+1 != finding.Column {
+					t.Errorf("finding at offset %d is reported at column %d", finding.Offset, finding.Column)
+				}
+				if prefix, _, _ := strings.Cut(finding.Masked, "…"); !strings.HasPrefix(match, prefix) || strings.Contains(testmcp.Text(result), match[:20]) {
+					t.Errorf("masked excerpt %q doesn't mask the text at offset %d", finding.Masked, finding.Offset)
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("findings = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/yourusername/mcp-api-keys-server/internal/protocol"
+)
+
+// selfTestSkipped are tools the self-test leaves out because calling them
+// changes something outside the server.
+var selfTestSkipped = map[string]string{
+	"mark_key_rotated": "records a rotation in the state file",
+}
+
+// selfTestCheck is the outcome of one step of the self-test.
+type selfTestCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// selfTestReport is what --self-test-json prints.
+type selfTestReport struct {
+	Passed bool            `json:"passed"`
+	Checks []selfTestCheck `json:"checks"`
+}
+
+// selfTestSession drives a server through its dispatcher, as a client
+// would, and checks what comes back.
+type selfTestSession struct {
+	s      *Server
+	nextID int
+	report selfTestReport
+}
+
+func (t *selfTestSession) check(name string, problem string) {
+	t.report.Checks = append(t.report.Checks, selfTestCheck{Name: name, Passed: problem == "", Detail: problem})
+}
+
+// request sends a message through the dispatcher and returns the response
+// as the client would decode it, or nil when there is none.
+func (t *selfTestSession) request(method string, params interface{}, notification bool) map[string]interface{} {
+	message := map[string]interface{}{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		message["params"] = params
+	}
+	if !notification {
+		t.nextID++
+		message["id"] = t.nextID
+	}
+	data, _ := json.Marshal(message)
+	return decodeSelfTestResponse(t.s.handleMessage(context.Background(), data, false))
+}
+
+func decodeSelfTestResponse(response interface{}) map[string]interface{} {
+	if response == nil {
+		return nil
+	}
+	if r, ok := response.(*protocol.Response); ok && r == nil {
+		return nil
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+	return decoded
+}
+
+// rpcErrorCode returns the code of a JSON-RPC error response, or 0.
+func rpcErrorCode(response map[string]interface{}) int {
+	rpcError, _ := response["error"].(map[string]interface{})
+	code, _ := rpcError["code"].(float64)
+	return int(code)
+}
+
+// checkToolResult returns what is wrong with a tools/call response, or "".
+func checkToolResult(response map[string]interface{}, tool Tool) string {
+	if response == nil {
+		return "no response"
+	}
+	if response["error"] != nil {
+		return fmt.Sprintf("JSON-RPC error %d", rpcErrorCode(response))
+	}
+	result, ok := response["result"].(map[string]interface{})
+	if !ok {
+		return "response has no result"
+	}
+	content, _ := result["content"].([]interface{})
+	if len(content) == 0 {
+		return "result has no content"
+	}
+	for _, block := range content {
+		block, _ := block.(map[string]interface{})
+		if block["type"] != "text" {
+			return fmt.Sprintf("content block of type %v", block["type"])
+		}
+		if _, ok := block["text"].(string); !ok {
+			return "text block without text"
+		}
+	}
+	isError, _ := result["isError"].(bool)
+	if tool.OutputSchema != nil && !isError && result["structuredContent"] == nil {
+		return "tool declares an output schema but returned no structuredContent"
+	}
+	return ""
+}
+
+// selfTestArguments builds arguments a tool accepts from its schema: the
+// first allowed value, a registered key for key names, or a harmless
+// literal. Booleans are false, so nothing optional such as writing or
+// running a command is switched on.
+func selfTestArguments(schema InputSchema) map[string]interface{} {
+	args := map[string]interface{}{}
+	for _, name := range schema.Required {
+		property := schema.Properties[name]
+		switch {
+		case len(property.Enum) > 0:
+			args[name] = property.Enum[0]
+			for _, value := range property.Enum {
+				if value == "openai" {
+					args[name] = value
+				}
+			}
+		case name == "key_name":
+			args[name] = "openai"
+		case property.Type == "boolean":
+			args[name] = false
+		case property.Type == "integer" || property.Type == "number":
+			args[name] = 1
+		case property.Type == "object":
+			args[name] = map[string]interface{}{}
+		case property.Type == "array":
+			args[name] = []interface{}{}
+		default:
+			args[name] = "self-test"
+		}
+	}
+	return args
+}
+
+// run replays the scripted session.
+func (t *selfTestSession) run() {
+	response := t.request("initialize", InitializeParams{
+		ProtocolVersion: supportedProtocolVersions[0],
+		ClientInfo:      ClientInfo{Name: "self-test", Version: "1"},
+	}, false)
+	result, _ := response["result"].(map[string]interface{})
+	serverInfo, _ := result["serverInfo"].(map[string]interface{})
+	capabilities, _ := result["capabilities"].(map[string]interface{})
+	switch {
+	case result == nil:
+		t.check("initialize", fmt.Sprintf("no result (error %d)", rpcErrorCode(response)))
+	case result["protocolVersion"] != supportedProtocolVersions[0]:
+		t.check("initialize", fmt.Sprintf("negotiated protocol version %v", result["protocolVersion"]))
+	case serverInfo["name"] != serverName:
+		t.check("initialize", fmt.Sprintf("server name %v", serverInfo["name"]))
+	case capabilities["tools"] == nil:
+		t.check("initialize", "tools capability missing")
+	default:
+		t.check("initialize", "")
+	}
+
+	if response := t.request("notifications/initialized", nil, true); response != nil {
+		t.check("notifications/initialized", "a notification was answered")
+	} else {
+		t.check("notifications/initialized", "")
+	}
+
+	var names []string
+	cursor := ""
+	problem := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		response := t.request("tools/list", params, false)
+		result, _ := response["result"].(map[string]interface{})
+		if result == nil {
+			problem = fmt.Sprintf("no result (error %d)", rpcErrorCode(response))
+			break
+		}
+		tools, _ := result["tools"].([]interface{})
+		for _, tool := range tools {
+			tool, _ := tool.(map[string]interface{})
+			name, _ := tool["name"].(string)
+			inputSchema, _ := tool["inputSchema"].(map[string]interface{})
+			if name == "" || inputSchema["type"] != "object" {
+				problem = fmt.Sprintf("malformed tool %v", tool["name"])
+			}
+			names = append(names, name)
+		}
+		if cursor, _ = result["nextCursor"].(string); cursor == "" {
+			break
+		}
+	}
+	if problem == "" && len(names) == 0 {
+		problem = "no tools listed"
+	}
+	t.check("tools/list", problem)
+
+	sort.Strings(names)
+	for _, name := range names {
+		if reason, skip := selfTestSkipped[name]; skip {
+			t.report.Checks = append(t.report.Checks, selfTestCheck{Name: "tools/call " + name, Passed: true, Detail: "skipped: " + reason})
+			continue
+		}
+		tool, ok := t.s.findTool(name)
+		if !ok {
+			t.check("tools/call "+name, "listed but not callable")
+			continue
+		}
+		response := t.request("tools/call", map[string]interface{}{"name": name, "arguments": selfTestArguments(tool.InputSchema)}, false)
+		problem := checkToolResult(response, tool.Tool)
+		if problem == "" && name == "get_api_key" {
+			// Only the fake value may ever come back
+			result, _ := response["result"].(map[string]interface{})
+			data, _ := json.Marshal(result["content"])
+			if isError, _ := result["isError"].(bool); !isError && !strings.Contains(string(data), t.s.keys.fakeSecret("openai")) {
+				problem = "returned something other than the dry-run value"
+			}
+		}
+		t.check("tools/call "+name, problem)
+	}
+
+	// Deliberately bad calls must fail cleanly
+	if code := rpcErrorCode(t.request("no/such/method", nil, false)); code != -32601 {
+		t.check("unknown method", fmt.Sprintf("expected error -32601, got %d", code))
+	} else {
+		t.check("unknown method", "")
+	}
+	if code := rpcErrorCode(t.request("tools/call", map[string]interface{}{"name": "no_such_tool", "arguments": map[string]interface{}{}}, false)); code != -32601 {
+		t.check("unknown tool", fmt.Sprintf("expected error -32601, got %d", code))
+	} else {
+		t.check("unknown tool", "")
+	}
+	response = t.request("tools/call", map[string]interface{}{"name": "get_api_key", "arguments": map[string]interface{}{"key_name": 42}}, false)
+	result, _ = response["result"].(map[string]interface{})
+	if isError, _ := result["isError"].(bool); !isError {
+		t.check("invalid arguments", "a call with a numeric key_name didn't return an error result")
+	} else {
+		t.check("invalid arguments", "")
+	}
+	if code := rpcErrorCode(decodeSelfTestResponse(t.s.handleLine([]byte("{"), false))); code != -32700 {
+		t.check("parse error", fmt.Sprintf("expected error -32700, got %d", code))
+	} else {
+		t.check("parse error", "")
+	}
+
+	t.report.Passed = true
+	for _, check := range t.report.Checks {
+		t.report.Passed = t.report.Passed && check.Passed
+	}
+}
+
+// runSelfTest replays a scripted session against a dry-run server with no
+// network, command or write access, prints the report and returns the exit
+// code: 0 when every check passed, 1 otherwise.
+func runSelfTest(logger *slog.Logger, stdout io.Writer, asJSON bool) int {
+	// Notifications such as log messages are not part of the report
+	s := New(strings.NewReader(""), io.Discard, WithLogger(logger))
+	s.dryRun = true
+
+	session := &selfTestSession{s: s}
+	session.run()
+
+	if asJSON {
+		data, _ := json.MarshalIndent(session.report, "", "  ")
+		fmt.Fprintln(stdout, string(data))
+	} else {
+		failed := 0
+		for _, check := range session.report.Checks {
+			status := "PASS"
+			if !check.Passed {
+				status = "FAIL"
+				failed++
+			}
+			line := fmt.Sprintf("%s  %s", status, check.Name)
+			if check.Detail != "" {
+				line += ": " + check.Detail
+			}
+			fmt.Fprintln(stdout, line)
+		}
+		fmt.Fprintf(stdout, "\n%d checks, %d failed\n", len(session.report.Checks), failed)
+	}
+	if !session.report.Passed {
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,1685 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/yourusername/mcp-api-keys-server/internal/protocol"
+	"github.com/yourusername/mcp-api-keys-server/version"
+)
+
+// MCP Protocol Types
+
+// ServerInfo names the server, as sent in initialize.
+type ServerInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// InitializeParams are the params of initialize.
+type InitializeParams struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ClientCapabilities `json:"capabilities"`
+	ClientInfo      ClientInfo         `json:"clientInfo"`
+	// Meta carries the tenant token of a server started with --tenants.
+	Meta map[string]interface{} `json:"_meta,omitempty"`
+}
+
+// ClientInfo names the client, as sent in initialize.
+type ClientInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// InitializeResult is the result of initialize.
+type InitializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      ServerInfo         `json:"serverInfo"`
+	Instructions    string             `json:"instructions,omitempty"`
+}
+
+// ServerCapabilities are the features the server declares in initialize.
+type ServerCapabilities struct {
+	Tools       *ToolsCapability       `json:"tools,omitempty"`
+	Resources   *ResourcesCapability   `json:"resources,omitempty"`
+	Prompts     *PromptsCapability     `json:"prompts,omitempty"`
+	Logging     *LoggingCapability     `json:"logging,omitempty"`
+	Completions *CompletionsCapability `json:"completions,omitempty"`
+}
+
+// ToolsCapability declares tool support.
+type ToolsCapability struct {
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+// ResourcesCapability declares resource support.
+type ResourcesCapability struct {
+	Subscribe   bool `json:"subscribe,omitempty"`
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+// PromptsCapability declares prompt support.
+type PromptsCapability struct {
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+// LoggingCapability declares support for logging/setLevel.
+type LoggingCapability struct{}
+
+// CompletionsCapability declares support for completion/complete.
+type CompletionsCapability struct{}
+
+// Tool is the definition of a tool, as listed in tools/list.
+type Tool struct {
+	Name         string           `json:"name"`
+	Description  string           `json:"description"`
+	InputSchema  InputSchema      `json:"inputSchema"`
+	OutputSchema *InputSchema     `json:"outputSchema,omitempty"`
+	Annotations  *ToolAnnotations `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations are hints clients use to decide how to present a tool and
+// whether calls need user confirmation. Unset hints take the spec defaults.
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    *bool  `json:"readOnlyHint,omitempty"`
+	DestructiveHint *bool  `json:"destructiveHint,omitempty"`
+	IdempotentHint  *bool  `json:"idempotentHint,omitempty"`
+	OpenWorldHint   *bool  `json:"openWorldHint,omitempty"`
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// InputSchema is the JSON Schema of a tool's arguments or structured output.
+type InputSchema struct {
+	Type       string              `json:"type"`
+	Properties map[string]Property `json:"properties,omitempty"`
+	Required   []string            `json:"required,omitempty"`
+}
+
+// Property is the schema of one property of an InputSchema.
+type Property struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+
+	// Nested schemas, used by output schemas
+	Items      *Property           `json:"items,omitempty"`
+	Properties map[string]Property `json:"properties,omitempty"`
+	Required   []string            `json:"required,omitempty"`
+}
+
+// ToolsListResult is the result of tools/list.
+type ToolsListResult struct {
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// Resource describes a resource, as listed in resources/list.
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourcesListResult is the result of resources/list.
+type ResourcesListResult struct {
+	Resources  []Resource `json:"resources"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// ResourceURIParams are the params of the resource methods that take a URI.
+type ResourceURIParams struct {
+	URI string `json:"uri"`
+}
+
+// ResourceContents is the content of a resource.
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text"`
+}
+
+// ReadResourceResult is the result of resources/read.
+type ReadResourceResult struct {
+	Contents []ResourceContents `json:"contents"`
+}
+
+// Prompt describes a prompt, as listed in prompts/list.
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+// PromptArgument is an argument a prompt accepts.
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// PromptsListResult is the result of prompts/list.
+type PromptsListResult struct {
+	Prompts []Prompt `json:"prompts"`
+}
+
+// GetPromptParams are the params of prompts/get.
+type GetPromptParams struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+// PromptMessage is one message of a rendered prompt.
+type PromptMessage struct {
+	Role    string       `json:"role"`
+	Content ContentBlock `json:"content"`
+}
+
+// GetPromptResult is the result of prompts/get.
+type GetPromptResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+// CallToolParams are the params of tools/call.
+type CallToolParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Meta      *RequestMeta           `json:"_meta,omitempty"`
+}
+
+// CallToolResult is the result of a tool call.
+type CallToolResult struct {
+	Content           []ContentBlock `json:"content"`
+	StructuredContent interface{}    `json:"structuredContent,omitempty"`
+	IsError           bool           `json:"isError,omitempty"`
+
+	// panicked summarizes the panic the handler ended in, which is reported
+	// as a JSON-RPC error rather than as this result
+	panicked string
+}
+
+// ContentBlock is one block of a tool result's content.
+type ContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// categoryNames lists the category filters accepted by tools and prompts.
+var categoryNames = []string{"llm", "saas", "canva", "vcs", "internal", "all"}
+
+func validCategory(category string) bool {
+	for _, name := range categoryNames {
+		if name == category {
+			return true
+		}
+	}
+	return false
+}
+
+// listFormats are the output formats of list_api_keys.
+var listFormats = []string{"text", "json"}
+
+// keyCategories gives each category its heading in list_api_keys and
+// generated .env files, in the order the sections are listed.
+var keyCategories = []struct {
+	Name  string
+	Icon  string
+	Title string
+}{
+	{"llm", "🤖", "LLM APIs"},
+	{"saas", "☁️", "SaaS APIs"},
+	{"canva", "🎨", "Canva APIs"},
+	{"vcs", "🔀", "Version Control"},
+	{"internal", "🔧", "Internal/Custom"},
+}
+
+// Server is an MCP server that serves API keys from the environment over
+// the stdio transport. Create one with New.
+type Server struct {
+	// logger receives operator diagnostics on stderr; anything meant for the
+	// client goes through logMessage instead.
+	logger *slog.Logger
+
+	reader *bufio.Reader
+	// maxMessageSize is the largest line, in bytes, accepted from the
+	// client; longer ones are answered with an error and skipped.
+	maxMessageSize int
+
+	// out carries every response, notification and request to the client,
+	// one whole line at a time. After its first write failure nothing more
+	// is written and Run stops.
+	out *protocol.Writer
+
+	// keys is the registry of keys this server serves.
+	keys *keyRegistry
+
+	// mu guards the session state below, which tool calls running in their
+	// own goroutines may read while the read loop updates it.
+	mu sync.Mutex
+
+	// inFlight holds the cancel function of each request still being
+	// handled in the background, keyed by requestKey.
+	inFlight map[string]context.CancelFunc
+	handlers sync.WaitGroup
+	// shutdownOnce runs Shutdown once; shutdownErr is what it returned.
+	shutdownOnce sync.Once
+	shutdownErr  error
+	// workers bounds how many background requests run at once; each running
+	// handler holds one slot.
+	workers chan struct{}
+
+	// logLevel is the minimum level of notifications/message sent to the
+	// client, as set by logging/setLevel.
+	logLevel string
+	// startupLogs holds messages raised before the client initialized; they
+	// are sent right after the initialize response.
+	startupLogs []LoggingMessageParams
+	state       sessionState
+
+	// protocolVersion is the version agreed with the client during
+	// initialize, used to gate newer protocol features.
+	protocolVersion    string
+	clientInfo         ClientInfo
+	clientCapabilities ClientCapabilities
+
+	// nextRequestID numbers the requests the server sends to the client;
+	// pendingRequests holds a channel for each one awaiting its response.
+	nextRequestID   int64
+	pendingRequests map[string]chan clientResponse
+
+	// instructions tells the client's model how to use this server; it is
+	// left out of the initialize result when empty.
+	instructions string
+
+	// requestTimeout bounds how long a single request may run.
+	requestTimeout time.Duration
+
+	// readOnly hides and refuses every tool that reveals key values.
+	readOnly bool
+	// dryRun makes value-revealing tools return fake values. Like every
+	// mode, it is set at startup and no tool can change it.
+	dryRun bool
+	// revealPolicy and accessPolicy limit which keys value-revealing tools
+	// may return; see keyAccess.
+	revealPolicy revealPolicy
+	accessPolicy accessPolicy
+	// revealLimiter rate-limits reveals of each key; nil means unlimited.
+	revealLimiter *revealLimiter
+	revealBudget  revealBudget
+	// tenants, when set, binds each session to the tenant named by the token
+	// it sends in initialize, whose keys are all the session sees.
+	tenants *tenants
+	// leases are the outstanding reveal leases from get_api_key.
+	leases revealLeases
+	// allowExec lets tools run external commands, such as gh, on request.
+	allowExec bool
+	// allowNetwork offers the tools that call provider APIs.
+	allowNetwork bool
+	// allowWrites lets tools change files such as .env when asked to.
+	allowWrites bool
+	// snapshotDir holds environment snapshots; empty when --state-file
+	// isn't set, which leaves the snapshot tools out.
+	snapshotDir string
+	// upstream answers for keys this server doesn't know; nil without
+	// --upstream.
+	upstream *upstreamClient
+	// metrics counts requests for --metrics-listen; nil records nothing.
+	metrics       *serverMetrics
+	metricsServer *metricsServer
+	// tracer exports request spans over OTLP; nil when no endpoint is
+	// configured.
+	tracer *tracer
+	// jwtMaxExpiry caps the lifetime of tokens mint_test_jwt signs.
+	jwtMaxExpiry time.Duration
+	// blockLiveReveal refuses production values unless the caller passes
+	// confirm_live.
+	blockLiveReveal bool
+	// breakGlass lets get_api_key override the access policy with a
+	// justification.
+	breakGlass breakGlass
+	// envWatcher applies edits to .env while the server runs; nil when
+	// --watch-env is off.
+	envWatcher *envWatcher
+	// revealWebhook is told about reveals of sensitive keys; nil when
+	// --reveal-webhook isn't set.
+	revealWebhook *revealWebhook
+
+	// auditLog records every secret access when --audit-log is set;
+	// exposeAuditLog lets clients read it back with read_audit_log.
+	auditLog       *auditLog
+	exposeAuditLog bool
+	// auditSinks receive every audit entry: the audit log, syslog and the
+	// reveal webhook, as configured.
+	auditSinks []auditSink
+	// recorder keeps a scrubbed copy of every message read and written;
+	// nil when --record isn't set.
+	recorder *sessionRecorder
+
+	// markers are used in tool text output; see --plain-output.
+	markers statusMarkers
+
+	// pageSize is the number of entries per page of tools/list and
+	// resources/list.
+	pageSize int
+
+	// tools holds the built-in tools and those added with RegisterTool.
+	tools *ToolRegistry
+
+	// subscriptions maps a subscribed resource URI to the key status last
+	// reported to the client, so updates are only sent on real changes.
+	subscriptions map[string]keyStatus
+}
+
+// Option configures a Server created with New.
+type Option func(*Server)
+
+// WithLogger sends the server's operator diagnostics to logger rather than
+// to stderr.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// New returns a server reading newline-delimited requests from in and
+// writing responses and notifications to out, with every other option at
+// its default unless opts change it. It loads .env first.
+func New(in io.Reader, out io.Writer, opts ...Option) *Server {
+	s := &Server{
+		keys:            newKeyRegistry(),
+		reader:          bufio.NewReader(in),
+		out:             protocol.NewWriter(out),
+		maxMessageSize:  defaultMaxMessageSize,
+		logLevel:        defaultLogLevel,
+		pageSize:        defaultPageSize,
+		requestTimeout:  defaultRequestTimeout,
+		markers:         emojiMarkers,
+		workers:         make(chan struct{}, defaultMaxConcurrency),
+		instructions:    defaultInstructions,
+		inFlight:        make(map[string]context.CancelFunc),
+		pendingRequests: make(map[string]chan clientResponse),
+		subscriptions:   make(map[string]keyStatus),
+		revealBudget:    revealBudget{revealed: make(map[string]int)},
+		leases:          revealLeases{active: make(map[string]*revealLease)},
+		jwtMaxExpiry:    defaultJWTMaxExpiry,
+	}
+	s.tools = &ToolRegistry{builtin: s.builtinTools, keys: s.keys}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.logger == nil {
+		s.logger, _ = newDiagnosticLogger(os.Stderr, "info", "text")
+	}
+	s.logger = slog.New(redactingHandler{Handler: s.logger.Handler(), redactor: s.keys.secrets})
+
+	if err := s.keys.loadDotEnv(); err != nil {
+		s.logger.Error("failed to load .env", "error", err)
+		s.startupLogs = append(s.startupLogs, LoggingMessageParams{
+			Level:  "error",
+			Logger: "config",
+			Data:   fmt.Sprintf("Failed to load .env: %v", err),
+		})
+	}
+
+	// Resolve every key up front so their values are redacted from the very
+	// first log line
+	s.keys.resolveAll()
+
+	return s
+}
+
+// NewStdio returns a server on the process's stdin and stdout, as the
+// command runs it.
+func NewStdio(opts ...Option) *Server {
+	return New(os.Stdin, os.Stdout, opts...)
+}
+
+// loadDotEnv loads the .env file in the working directory, if there is one,
+// for local development, then .env.enc. Variables already set in the
+// environment win, and .env wins over .env.enc; the registry's sources
+// record which one each value came from.
+func (k *keyRegistry) loadDotEnv() error {
+	values, err := godotenv.Read(".env")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	k.sources.apply(".env", values)
+	return k.loadEncryptedEnv(encryptedEnvFile)
+}
+
+// writeMessage writes one message as a single line and flushes it. Once a
+// write has failed, every later call returns that error without writing.
+func (s *Server) writeMessage(message interface{}) error {
+	data, err := s.marshalMessage(message)
+	if err != nil {
+		return err
+	}
+	s.recorder.record(directionOut, data)
+	if err := s.out.WriteMessage(json.RawMessage(data)); err != nil {
+		return fmt.Errorf("failed to write to the client: %w", err)
+	}
+	return nil
+}
+
+// marshalMessage encodes a message for writeMessage. A response whose result
+// can't be encoded is replaced with an internal error for the same id, so the
+// client still gets an answer.
+func (s *Server) marshalMessage(message interface{}) ([]byte, error) {
+	switch message := message.(type) {
+	case protocol.Response:
+		return s.marshalResponse(message), nil
+	case []protocol.Response:
+		encoded := make([]json.RawMessage, len(message))
+		for i, response := range message {
+			encoded[i] = s.marshalResponse(response)
+		}
+		return json.Marshal(encoded)
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		s.logger.Error("failed to encode message", "error", err)
+	}
+	return data, err
+}
+
+func (s *Server) marshalResponse(response protocol.Response) []byte {
+	if response.Error != nil {
+		// Error messages may quote what a backend or the client sent
+		scrubbed := *response.Error
+		scrubbed.Message = s.keys.secrets.scrub(scrubbed.Message)
+		response.Error = &scrubbed
+	}
+	data, err := json.Marshal(response)
+	if err == nil {
+		return data
+	}
+	s.logger.Error("failed to encode response", "id", string(response.ID), "error", err)
+
+	// Build the fallback by hand; the id was valid JSON when it was read
+	id := "null"
+	if len(response.ID) > 0 {
+		id = string(response.ID)
+	}
+	return []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"error":{"code":-32603,"message":"Internal error: failed to encode response"}}`, id))
+}
+
+// writeFailed returns the error that stopped output, if any.
+func (s *Server) writeFailed() error {
+	if err := s.out.Err(); err != nil {
+		return fmt.Errorf("failed to write to the client: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) sendNotification(method string, params interface{}) error {
+	return s.writeMessage(protocol.Notification{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+}
+
+// supportedProtocolVersions lists the MCP versions this server speaks,
+// newest first.
+var supportedProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// negotiateProtocolVersion echoes the client's requested version when we
+// support it, and otherwise offers our latest.
+func negotiateProtocolVersion(requested string) string {
+	for _, version := range supportedProtocolVersions {
+		if version == requested {
+			return version
+		}
+	}
+	return supportedProtocolVersions[0]
+}
+
+// supportsStructuredContent reports whether the negotiated protocol version
+// includes structuredContent in tool results and outputSchema on tools.
+func (s *Server) supportsStructuredContent() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.protocolVersion >= "2025-06-18"
+}
+
+// supportsToolAnnotations reports whether the negotiated protocol version
+// includes tool annotations.
+func (s *Server) supportsToolAnnotations() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.protocolVersion >= "2025-03-26"
+}
+
+func (s *Server) handleInitialize(id json.RawMessage, params InitializeParams) protocol.Response {
+	protocolVersion := negotiateProtocolVersion(params.ProtocolVersion)
+
+	// A server with tenants serves no session from the shared environment
+	if s.tenants != nil {
+		env, err := s.tenants.bind(tenantToken(params.Meta))
+		if err != nil {
+			s.logger.Warn("refused a session without a valid tenant token", "client", params.ClientInfo.Name, "error", err)
+			return errorResponse(id, -32602, fmt.Sprintf("Invalid params: this server serves tenants, and _meta.%s must hold one's token", tenantTokenMeta))
+		}
+		s.keys.bindTenant(env)
+		s.keys.resolveAll()
+		s.logger.Info("session bound to tenant", "tenant", env.name)
+	}
+
+	s.mu.Lock()
+	s.state = stateInitializing
+	s.protocolVersion = protocolVersion
+	s.clientInfo = params.ClientInfo
+	s.clientCapabilities = params.Capabilities
+	s.mu.Unlock()
+
+	return protocol.Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result: InitializeResult{
+			ProtocolVersion: protocolVersion,
+			Capabilities: ServerCapabilities{
+				Tools: &ToolsCapability{
+					ListChanged: false,
+				},
+				Resources: &ResourcesCapability{
+					Subscribe:   true,
+					ListChanged: false,
+				},
+				Prompts: &PromptsCapability{
+					ListChanged: false,
+				},
+				Logging:     &LoggingCapability{},
+				Completions: &CompletionsCapability{},
+			},
+			ServerInfo: ServerInfo{
+				Name:    serverName,
+				Version: version.Version,
+			},
+			Instructions: s.initializeInstructions(),
+		},
+	}
+}
+
+// initializeInstructions returns the instructions for the initialize result,
+// noting read-only and dry-run mode when they are on.
+func (s *Server) initializeInstructions() string {
+	instructions := s.instructions
+	if s.readOnly {
+		instructions += "\n" + readOnlyInstructions
+	}
+	if s.dryRun {
+		instructions += "\n" + dryRunInstructions
+	}
+	return strings.TrimSpace(instructions)
+}
+
+// flushStartupLogs sends log messages queued before the client initialized.
+// It runs after the initialize response has been written, since clients
+// expect that response first.
+func (s *Server) flushStartupLogs() {
+	s.mu.Lock()
+	if s.state == stateUninitialized {
+		s.mu.Unlock()
+		return
+	}
+	pending := s.startupLogs
+	s.startupLogs = nil
+	s.mu.Unlock()
+
+	for _, message := range pending {
+		s.logMessage(message.Level, message.Logger, message.Data)
+	}
+}
+
+// readOnlyInstructions is added to the initialize instructions in read-only
+// mode, so the model doesn't go looking for tools that aren't there.
+const readOnlyInstructions = "This server is running in read-only mode: key values can't be revealed, only listed and checked for existence."
+
+// handleToolsList serves pages of the tool list, marshaled once and then
+// reused until keys or tools are added: with many keys, the schemas'
+// key-name enums make the list large to rebuild on every call.
+func (s *Server) handleToolsList(id json.RawMessage, params PaginatedParams) protocol.Response {
+	// Clients on older protocol versions don't know about output schemas
+	// or annotations
+	key := toolsListKey{
+		structured: s.supportsStructuredContent(),
+		annotated:  s.supportsToolAnnotations(),
+		revealing:  s.mayRevealAny(),
+		cursor:     params.Cursor,
+	}
+	page, err := s.tools.list(key, func() (interface{}, error) {
+		var tools []Tool
+		for _, entry := range s.availableTools() {
+			tool := entry.Tool
+			if !key.structured {
+				tool.OutputSchema = nil
+			}
+			if !key.annotated {
+				tool.Annotations = nil
+			}
+			tools = append(tools, tool)
+		}
+
+		start, end, nextCursor, err := s.paginate(len(tools), params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		return ToolsListResult{
+			Tools:      tools[start:end],
+			NextCursor: nextCursor,
+		}, nil
+	})
+	if err != nil {
+		return errorResponse(id, -32602, err.Error())
+	}
+
+	return protocol.Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  page,
+	}
+}
+
+func (s *Server) handleToolCall(ctx context.Context, id json.RawMessage, params CallToolParams) protocol.Response {
+	if params.Name == "" {
+		return errorResponse(id, -32602, "Invalid params: name is required")
+	}
+	if entry, ok := s.tools.lookup(params.Name); ok && entry.revealing {
+		reason := ""
+		switch {
+		case s.readOnly:
+			reason = "the server is running in read-only mode, which never reveals key values"
+		case !s.mayRevealAny():
+			reason = "the access policy lets this client reveal no key values"
+		}
+		if reason != "" {
+			return protocol.Response{
+				JSONRPC: "2.0",
+				ID:      id,
+				Result:  s.structured(failure(codePolicyDenied, fmt.Sprintf("Error: %s is disabled because %s.", params.Name, reason), nil)),
+			}
+		}
+	}
+	entry, ok := s.findTool(params.Name)
+	if !ok {
+		return errorResponseWithData(id, -32601, fmt.Sprintf("Unknown tool: %s", params.Name), codeNotFound, map[string]interface{}{"tool": params.Name})
+	}
+	// Only names the server knows are recorded, never argument values
+	sp := spanFromContext(ctx)
+	sp.setAttribute("mcp.tool.name", params.Name)
+	if keyName, ok := params.Arguments["key_name"].(string); ok {
+		if _, registered := s.keys.config(keyName); registered {
+			sp.setAttribute("mcp.key.name", keyName)
+		}
+	}
+
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	ctx, stopProgress := s.withProgress(ctx, params.Meta)
+	defer stopProgress()
+
+	result := s.toolChain(entry)(ctx, params.Arguments)
+	if result.panicked != "" {
+		return errorResponseWithData(id, -32603, "Internal error", codeInternal, map[string]interface{}{"panic": result.panicked, "tool": params.Name})
+	}
+	return protocol.Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  s.structured(result),
+	}
+}
+
+func (s *Server) handleGetAPIKey(ctx context.Context, args map[string]interface{}) CallToolResult {
+	keyName, ok := args["key_name"].(string)
+	if !ok {
+		return failure(codeValidationFailed, "Error: key_name is required", nil)
+	}
+	minutes, problem := leaseMinutes(args)
+	if problem != "" {
+		return failure(codeValidationFailed, problem, nil)
+	}
+	transform, problem := parseTransform(args)
+	if problem != "" {
+		return failure(codeValidationFailed, problem, map[string]interface{}{"valid_transforms": valueTransforms})
+	}
+
+	config, value, exists := s.keys.lookup(keyName)
+	if !exists {
+		if result, ok := s.forwardToUpstream(ctx, "get_api_key", keyName, args); ok {
+			return result
+		}
+		return s.keys.unknownKeyFailure(keyName, s.keys.names())
+	}
+
+	if value == "" {
+		s.noteAudit(ctx, "notice", fmt.Sprintf("Requested API key '%s' is not configured", keyName))
+		s.noteAccess(ctx, keyName, auditMissing, "", "")
+		if empty := s.keys.emptyEnvVars(config); len(empty) > 0 && !config.IsComposite() {
+			return failure(codeNotConfigured, fmt.Sprintf("API key '%s' is not configured: %s", keyName, emptyHint(empty)), keyDetails(keyName))
+		}
+		return failure(codeNotConfigured, fmt.Sprintf("API key '%s' is not configured. Set the %s environment variable.%s", keyName, s.keys.unsetLabel(config), s.keys.obtainHint(keyName)), keyDetails(keyName))
+	}
+	readContents, _ := args["read_contents"].(bool)
+	if readContents && !config.IsFilePath() {
+		return failure(codeValidationFailed, fmt.Sprintf("Error: read_contents only applies to keys that hold the path of a credential file, such as gcp_credentials; '%s' holds its value directly.", keyName), keyDetails(keyName))
+	}
+
+	// checkKeyPolicy only lets a key the policy denies through with a
+	// justification, which must pass as a break-glass one
+	reason := justification(args)
+	breakGlass := policyOverridden(ctx)
+	if breakGlass {
+		if result, ok := s.checkBreakGlass(ctx, keyName, reason, value); !ok {
+			return result
+		}
+	}
+
+	// A restricted key needs the user's confirmation. A client that can't
+	// ask for it only gets the key as a break-glass reveal
+	if config.Restricted && !s.supportsElicitation() && !breakGlass {
+		if reason == "" || !s.breakGlass.enabled {
+			s.noteAudit(ctx, "warning", fmt.Sprintf("Reveal of restricted API key '%s' was refused: the client can't ask the user to confirm it", keyName))
+			s.noteAccess(ctx, keyName, auditDenied, "restricted key without confirmation", value)
+			return failure(codePolicyDenied, s.unconfirmableMessage(keyName), keyDetails(keyName))
+		}
+		if result, ok := s.checkBreakGlass(ctx, keyName, reason, value); !ok {
+			return result
+		}
+		breakGlass = true
+	}
+
+	if confirmLive, _ := args["confirm_live"].(bool); s.blockLiveReveal && !confirmLive && isLiveValue(value) {
+		s.noteAudit(ctx, "warning", fmt.Sprintf("Reveal of live API key '%s' was refused without confirm_live", keyName))
+		s.noteAccess(ctx, keyName, auditDenied, "live key without confirm_live", value)
+		return failure(codePolicyDenied, fmt.Sprintf("%s API key '%s' holds a LIVE (production) value and the server blocks live reveals. Use a test key, or call get_api_key again with confirm_live: true if the user wants the live key.", s.markers.warning, keyName), keyDetails(keyName))
+	}
+
+	// checkKeyPolicy has made sure the policy would reveal the username's
+	// key on its own
+	username := ""
+	if transform.UsernameKey != "" {
+		usernameConfig, usernameValue, exists := s.keys.lookup(transform.UsernameKey)
+		switch {
+		case !exists:
+			return s.keys.unknownKeyFailure(transform.UsernameKey, s.keys.names())
+		case config.IsComposite() || usernameConfig.IsComposite():
+			return failure(codeValidationFailed, "Error: basic_auth can't combine composite keys; get their members with get_api_key instead.", keyDetails(keyName))
+		case usernameValue == "":
+			return failure(codeNotConfigured, fmt.Sprintf("API key '%s', the username for basic_auth, is not configured. Set the %s environment variable.%s", transform.UsernameKey, usernameConfig.EnvVar, s.keys.obtainHint(transform.UsernameKey)), keyDetails(transform.UsernameKey))
+		}
+		username = usernameValue
+	}
+
+	if readContents && !s.dryRun {
+		_, data, err := readKeyFile(value)
+		if err != nil {
+			s.noteAccess(ctx, keyName, auditMissing, "unusable key file", "")
+			return failure(codeNotConfigured, fmt.Sprintf("API key '%s' points at a file that can't be used: %v.", keyName, err), keyDetails(keyName))
+		}
+		value = string(data)
+		s.keys.secrets.remember(keyName, value)
+	}
+
+	release, message := s.reserveRevealBudget(keyName, breakGlass)
+	if message != "" {
+		s.noteAudit(ctx, "warning", fmt.Sprintf("Reveal of API key '%s' was refused: the session reveal budget is used up", keyName))
+		s.noteAccess(ctx, keyName, auditDenied, "reveal budget exhausted", value)
+		return failure(codeRateLimited, message, keyDetails(keyName))
+	}
+
+	if s.revealLimiter != nil {
+		if ok, retryAfter := s.revealLimiter.allow(keyName); !ok {
+			release()
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			s.noteAudit(ctx, "warning", fmt.Sprintf("Reveal of API key '%s' was rate limited", keyName))
+			s.noteAccess(ctx, keyName, auditLimited, fmt.Sprintf("retry after %ds", seconds), value)
+			return failure(codeRateLimited, fmt.Sprintf("Error: API key '%s' is rate limited, retry after %ds.", keyName, seconds), map[string]interface{}{"key_name": keyName, "retry_after_seconds": seconds})
+		}
+	}
+
+	if config.Restricted && s.supportsElicitation() {
+		if allowed, reason := s.confirmReveal(ctx, keyName, config); !allowed {
+			release()
+			s.noteAudit(ctx, "warning", fmt.Sprintf("Access to restricted API key '%s' was denied: %s", keyName, reason))
+			s.noteAccess(ctx, keyName, auditDenied, reason, value)
+			return failure(codePolicyDenied, fmt.Sprintf("Access to restricted API key '%s' was denied: %s.", keyName, reason), keyDetails(keyName))
+		}
+	}
+
+	if s.dryRun {
+		if breakGlass {
+			s.recordBreakGlass(ctx, keyName, reason, "dry run", s.keys.fakeSecret(keyName))
+		} else {
+			s.noteAudit(ctx, "info", fmt.Sprintf("API key '%s' was revealed as a fake value (dry run)", keyName))
+			s.noteAccess(ctx, keyName, auditRevealed, "dry run", s.keys.fakeSecret(keyName))
+		}
+		result := CallToolResult{
+			Content: []ContentBlock{
+				{Type: "text", Text: dryRunNotice},
+				{Type: "text", Text: transform.apply(s.keys.fakeSecret(keyName), s.keys.fakeSecret(transform.UsernameKey))},
+			},
+		}
+		if minutes > 0 {
+			result.Content = append(result.Content, ContentBlock{Type: "text", Text: leaseNotice(s.grantLease(ctx, keyName, minutes))})
+		}
+		return result
+	}
+	if breakGlass {
+		s.recordBreakGlass(ctx, keyName, reason, "", value)
+	} else {
+		s.noteAudit(ctx, "info", fmt.Sprintf("API key '%s' was revealed", keyName))
+		s.noteAccess(ctx, keyName, auditRevealed, "", value)
+	}
+	if transform.UsernameKey != "" {
+		s.noteAccess(ctx, transform.UsernameKey, auditRevealed, "basic_auth username for "+keyName, username)
+	}
+	revealed := transform.apply(value, username)
+	s.keys.secrets.remember(keyName, revealed)
+	result := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: revealed}},
+	}
+	// The value stays alone in its block so clients can use it as is
+	if transform.Name != transformRaw {
+		result.Content = append(result.Content, ContentBlock{Type: "text", Text: fmt.Sprintf("The value above is '%s' transformed with %s.", keyName, transform.describe())})
+	}
+	if envVar, stripped, _ := s.keys.valueFindings(config); len(stripped) > 0 {
+		result.Content = append(result.Content, ContentBlock{Type: "text", Text: strippedNote(envVar, stripped)})
+	}
+	if s.keys.looksLikePlaceholder(value) {
+		result.Content = append(result.Content, ContentBlock{Type: "text", Text: placeholderWarning(keyName, config.EnvLabel())})
+	}
+	if isLiveValue(value) {
+		result.Content = append(result.Content, ContentBlock{Type: "text", Text: liveWarning(s.markers.warning, keyName)})
+	}
+	if config.IsFilePath() && !readContents {
+		result.Content = append(result.Content, ContentBlock{Type: "text", Text: fmt.Sprintf("This is the path of the credential file in %s. Call get_api_key with read_contents: true to get its contents instead.", config.EnvVar)})
+	}
+	if minutes > 0 {
+		result.Content = append(result.Content, ContentBlock{Type: "text", Text: leaseNotice(s.grantLease(ctx, keyName, minutes))})
+	}
+	return result
+}
+
+func (s *Server) handleListAPIKeys(ctx context.Context, args map[string]interface{}) CallToolResult {
+	category := "all"
+	if cat, ok := args["category"].(string); ok && cat != "" {
+		category = cat
+	}
+	format := "text"
+	if f, ok := args["format"].(string); ok && f != "" {
+		format = f
+	}
+	configuredOnly, _ := args["configured_only"].(bool)
+	missingOnly, _ := args["missing_only"].(bool)
+	if configuredOnly && missingOnly {
+		return failure(codeValidationFailed, "Error: configured_only and missing_only can't both be set", nil)
+	}
+	offset, limit := 0, 0
+	if n, ok := args["offset"].(float64); ok {
+		offset = int(n)
+	}
+	if n, ok := args["limit"].(float64); ok {
+		limit = int(n)
+	}
+	if offset < 0 || limit < 0 {
+		return failure(codeValidationFailed, "Error: offset and limit must not be negative", nil)
+	}
+
+	keys := s.keys.list(category)
+	if configuredOnly || missingOnly {
+		filtered := keys[:0]
+		for _, key := range keys {
+			if key.Configured == configuredOnly {
+				filtered = append(filtered, key)
+			}
+		}
+		keys = filtered
+	}
+	page := pageKeys(keys, offset, limit)
+	paged := offset > 0 || limit > 0
+
+	var text string
+	switch format {
+	case "json":
+		var data []byte
+		if paged {
+			data, _ = json.MarshalIndent(page, "", "  ")
+		} else {
+			data, _ = json.MarshalIndent(page.Keys, "", "  ")
+		}
+		text = string(data)
+	default:
+		text = renderKeyList(ctx, s.markers, category, page.Keys)
+		if paged {
+			text += page.summary()
+		}
+	}
+
+	toolResult := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text}},
+	}
+	if s.supportsStructuredContent() {
+		toolResult.StructuredContent = page
+	}
+	return toolResult
+}
+
+// keyPage is one page of list_api_keys. With no limit, the page is every
+// key from offset on.
+type keyPage struct {
+	Keys    []keyStatus `json:"keys"`
+	Total   int         `json:"total"`
+	Offset  int         `json:"offset"`
+	HasMore bool        `json:"has_more"`
+	// NextOffset is the offset of the next page, when there is one.
+	NextOffset int `json:"next_offset,omitempty"`
+}
+
+// pageKeys cuts the page of keys starting at offset, at most limit long
+// unless limit is 0.
+func pageKeys(keys []keyStatus, offset, limit int) keyPage {
+	page := keyPage{Total: len(keys), Offset: offset}
+	start := min(offset, len(keys))
+	end := len(keys)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+		page.HasMore = true
+		page.NextOffset = end
+	}
+	page.Keys = keys[start:end]
+	return page
+}
+
+// summary says which keys the page holds and how to get the next one.
+func (p keyPage) summary() string {
+	if len(p.Keys) == 0 {
+		return fmt.Sprintf("No keys at offset %d (%d in total).\n", p.Offset, p.Total)
+	}
+	summary := fmt.Sprintf("Showing keys %d-%d of %d.", p.Offset+1, p.Offset+len(p.Keys), p.Total)
+	if p.HasMore {
+		summary += fmt.Sprintf(" More are available: call again with offset %d.", p.NextOffset)
+	}
+	return summary + "\n"
+}
+
+// renderKeyList renders keys as text, one section per category, reporting
+// progress as each section is listed.
+func renderKeyList(ctx context.Context, markers statusMarkers, category string, keys []keyStatus) string {
+	var result strings.Builder
+	result.WriteString("Available API Keys:\n\n")
+
+	total := float64(len(keyCategories))
+	if category != "all" {
+		total = 1
+	}
+	listed := 0.0
+	var empty []string
+
+	for _, cat := range keyCategories {
+		if category != "all" && category != cat.Name {
+			continue
+		}
+		listed++
+		reportProgress(ctx, listed, total, fmt.Sprintf("Listing %s", cat.Title))
+
+		result.WriteString(fmt.Sprintf("%s:\n", markers.heading(cat.Icon, cat.Title)))
+		for _, key := range keys {
+			if key.Category == cat.Name {
+				environment := ""
+				if key.Environment != "" {
+					environment = ", environment: " + key.Environment
+				}
+				marks := ""
+				if key.RotationOverdue {
+					marks = " [rotation overdue]"
+				}
+				if key.NeverReveal {
+					marks += " [never revealed]"
+				}
+				result.WriteString(fmt.Sprintf("  %s %s - %s (env: %s%s)%s\n", markers.keyStatus(key), key.Name, key.Description, key.EnvVar, environment, marks))
+				for _, member := range key.Members {
+					result.WriteString(fmt.Sprintf("      %s %s (%s)\n", markers.memberStatus(member), member.Role, member.EnvVar))
+				}
+				empty = append(empty, key.EmptyEnvVars...)
+			}
+		}
+		result.WriteString("\n")
+	}
+	if len(empty) > 0 {
+		result.WriteString(fmt.Sprintf("%s %s\n", markers.empty, emptyHint(empty)))
+	}
+	return result.String()
+}
+
+func (s *Server) handleCheckAPIKeyExists(ctx context.Context, args map[string]interface{}) CallToolResult {
+	keyName, ok := args["key_name"].(string)
+	if !ok {
+		return failure(codeValidationFailed, "Error: key_name is required", nil)
+	}
+
+	config, value, exists := s.keys.lookup(keyName)
+	if !exists {
+		if result, ok := s.forwardToUpstream(ctx, "check_api_key_exists", keyName, args); ok {
+			return result
+		}
+		return s.keys.unknownKeyFailure(keyName, s.keys.names())
+	}
+
+	if config.IsComposite() {
+		var set, missing []string
+		for _, member := range s.keys.memberStatuses(config) {
+			if member.Configured {
+				set = append(set, member.Role)
+			} else if member.Empty {
+				missing = append(missing, fmt.Sprintf("%s (%s, set but empty)", member.Role, member.EnvVar))
+			} else {
+				missing = append(missing, fmt.Sprintf("%s (%s)", member.Role, member.EnvVar))
+			}
+		}
+		if len(missing) == 0 {
+			return CallToolResult{
+				Content: []ContentBlock{{Type: "text", Text: fmt.Sprintf("%s API key '%s' is configured (members: %s)", s.markers.status(true), keyName, strings.Join(set, ", "))}},
+			}
+		}
+		return CallToolResult{
+			Content: []ContentBlock{{Type: "text", Text: fmt.Sprintf("%s API key '%s' is NOT configured. Missing members: %s.%s", s.markers.status(false), keyName, strings.Join(missing, ", "), s.keys.obtainHint(keyName))}},
+		}
+	}
+
+	if value != "" && config.IsFilePath() {
+		file, _, err := readKeyFile(value)
+		if err != nil {
+			return CallToolResult{
+				Content: []ContentBlock{{Type: "text", Text: fmt.Sprintf("%s API key '%s' is set, but the file it points at can't be used: %v. Fix the file or %s.", s.markers.warning, keyName, err, config.EnvVar)}},
+			}
+		}
+		return CallToolResult{
+			Content: []ContentBlock{{Type: "text", Text: fmt.Sprintf("%s API key '%s' is configured (file: %s, %s)", s.markers.status(true), keyName, file.Path, file.describe())}},
+		}
+	}
+
+	if value != "" && s.keys.looksLikePlaceholder(value) {
+		return CallToolResult{
+			Content: []ContentBlock{{Type: "text", Text: fmt.Sprintf("%s API key '%s' is set but looks like a placeholder (value: %s). Replace it with a real key in the %s environment variable.", s.markers.placeholder, keyName, s.keys.maskSecret(value), config.EnvLabel())}},
+		}
+	} else if value != "" {
+		masked := s.keys.maskSecret(value)
+		if environment, _ := keyEnvironment(value); environment != "" {
+			masked += ", environment: " + environment
+		}
+		text := fmt.Sprintf("%s API key '%s' is configured (value: %s)", s.markers.status(true), keyName, masked)
+		if note := s.keys.shadowNote(config); note != "" {
+			text += fmt.Sprintf(". %s Shadowed: %s.", s.markers.warning, note)
+		}
+		envVar, stripped, suspicious := s.keys.valueFindings(config)
+		if len(stripped) > 0 {
+			text += fmt.Sprintf(". Sanitized: stripped %s from %s", strings.Join(stripped, " and "), envVar)
+		}
+		if len(suspicious) > 0 {
+			text += fmt.Sprintf(". %s Suspicious: %s has %s", s.markers.warning, envVar, strings.Join(suspicious, ", "))
+		}
+		return CallToolResult{
+			Content: []ContentBlock{{Type: "text", Text: text}},
+		}
+	} else if empty := s.keys.emptyEnvVars(config); len(empty) > 0 {
+		return CallToolResult{
+			Content: []ContentBlock{{Type: "text", Text: fmt.Sprintf("%s API key '%s' is NOT configured: %s", s.markers.empty, keyName, emptyHint(empty))}},
+		}
+	} else {
+		return CallToolResult{
+			Content: []ContentBlock{{Type: "text", Text: fmt.Sprintf("%s API key '%s' is NOT configured. Set %s environment variable.%s", s.markers.status(false), keyName, config.EnvLabel(), s.keys.obtainHint(keyName))}},
+		}
+	}
+}
+
+// methodHandler handles one JSON-RPC request method and returns its response.
+// ctx is cancelled if the client cancels the request.
+type methodHandler func(s *Server, ctx context.Context, request protocol.Request) protocol.Response
+
+// notificationHandler handles one JSON-RPC notification method.
+type notificationHandler func(s *Server, request protocol.Request)
+
+// methods routes each supported JSON-RPC method to its handler. Adding a
+// protocol method is one entry here.
+var methods = map[string]methodHandler{
+	"initialize":            withParams((*Server).handleInitialize),
+	"ping":                  withoutParams((*Server).handlePing),
+	"tools/list":            withParams((*Server).handleToolsList),
+	"tools/call":            withContextParams((*Server).handleToolCall),
+	"logging/setLevel":      withParams((*Server).handleSetLevel),
+	"completion/complete":   withParams((*Server).handleComplete),
+	"prompts/list":          withoutParams((*Server).handlePromptsList),
+	"prompts/get":           withParams((*Server).handlePromptsGet),
+	"resources/list":        withParams((*Server).handleResourcesList),
+	"resources/read":        withResourceURI((*Server).handleResourcesRead),
+	"resources/subscribe":   withResourceURI((*Server).handleResourcesSubscribe),
+	"resources/unsubscribe": withResourceURI((*Server).handleResourcesUnsubscribe),
+	"shutdown":              withoutParams((*Server).handleShutdown),
+}
+
+// inlineMethods are handled on the read loop itself. Every other request
+// runs on a worker goroutine so that slow calls don't block the ones behind
+// them and can be cancelled with notifications/cancelled. initialize stays
+// inline because everything after it depends on the session it sets up, and
+// shutdown because it waits for the requests on the workers.
+var inlineMethods = map[string]bool{
+	"initialize": true,
+	"shutdown":   true,
+}
+
+// notifications routes JSON-RPC notifications (messages without an id).
+// Notifications never get a response, so unknown ones are silently ignored.
+var notifications = map[string]notificationHandler{
+	"notifications/initialized": (*Server).handleInitialized,
+	"initialized":               (*Server).handleInitialized, // Pre-namespacing form sent by older clients
+	"notifications/cancelled":   (*Server).handleCancelled,
+}
+
+func withoutParams(handle func(s *Server, id json.RawMessage) protocol.Response) methodHandler {
+	return func(s *Server, _ context.Context, request protocol.Request) protocol.Response {
+		return handle(s, request.ID)
+	}
+}
+
+// withParams decodes the request params into P before calling handle,
+// replying with Invalid params if they don't fit. Omitted or null params
+// decode as the zero value.
+func withParams[P any](handle func(s *Server, id json.RawMessage, params P) protocol.Response) methodHandler {
+	return withContextParams(func(s *Server, _ context.Context, id json.RawMessage, params P) protocol.Response {
+		return handle(s, id, params)
+	})
+}
+
+// withContextParams is withParams for handlers that need the request context.
+func withContextParams[P any](handle func(s *Server, ctx context.Context, id json.RawMessage, params P) protocol.Response) methodHandler {
+	return func(s *Server, ctx context.Context, request protocol.Request) protocol.Response {
+		var params P
+		if len(request.Params) == 0 || string(request.Params) == "null" {
+			return handle(s, ctx, request.ID, params)
+		}
+		if !protocol.IsObject(request.Params) {
+			return errorResponse(request.ID, -32602, "Invalid params: params must be an object")
+		}
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return errorResponse(request.ID, -32602, "Invalid params")
+		}
+		return handle(s, ctx, request.ID, params)
+	}
+}
+
+func withResourceURI(handle func(s *Server, id json.RawMessage, uri string) protocol.Response) methodHandler {
+	return withParams(func(s *Server, id json.RawMessage, params ResourceURIParams) protocol.Response {
+		if params.URI == "" {
+			return errorResponse(id, -32602, "Invalid params: uri is required")
+		}
+		return handle(s, id, params.URI)
+	})
+}
+
+func (s *Server) handlePing(id json.RawMessage) protocol.Response {
+	return protocol.Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  struct{}{},
+	}
+}
+
+// CancelledParams are the params of notifications/cancelled.
+type CancelledParams struct {
+	RequestID json.RawMessage `json:"requestId"`
+	Reason    string          `json:"reason,omitempty"`
+}
+
+func (s *Server) handleCancelled(request protocol.Request) {
+	var params CancelledParams
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	cancel, ok := s.inFlight[requestKey(params.RequestID)]
+	s.mu.Unlock()
+	// The request may already have been answered, in which case there is
+	// nothing left to stop.
+	if !ok {
+		return
+	}
+	cancel()
+	s.logMessage("debug", "protocol", fmt.Sprintf("Client cancelled request %v: %s", params.RequestID, params.Reason))
+}
+
+// requestKey identifies a request ID in the in-flight map. IDs are keyed by
+// their JSON encoding so the string "1" and the number 1 stay distinct.
+func requestKey(id json.RawMessage) string {
+	return string(id)
+}
+
+// handleInBackground runs a request in its own goroutine and writes its
+// response when done, unless the client cancelled the request meanwhile.
+func (s *Server) handleInBackground(handler methodHandler, request protocol.Request) {
+	ctx, cancel := context.WithCancel(context.Background())
+	key := requestKey(request.ID)
+
+	// Once shutdown has started, drain may be waiting on the handlers, so
+	// no more are started
+	s.mu.Lock()
+	if s.state == stateShuttingDown {
+		s.mu.Unlock()
+		cancel()
+		response := s.shuttingDownResponse(request.ID)
+		s.metrics.countResponse(response)
+		s.writeMessage(*response)
+		return
+	}
+	s.inFlight[key] = cancel
+	s.handlers.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.handlers.Done()
+		defer cancel()
+
+		// Wait for a free worker, giving up if the request is cancelled first
+		select {
+		case s.workers <- struct{}{}:
+		case <-ctx.Done():
+			s.mu.Lock()
+			delete(s.inFlight, key)
+			s.mu.Unlock()
+			return
+		}
+		response := s.runHandler(ctx, handler, request)
+		<-s.workers
+
+		s.mu.Lock()
+		delete(s.inFlight, key)
+		s.mu.Unlock()
+
+		// A cancelled request must not get a response
+		if ctx.Err() != nil {
+			return
+		}
+		if s.writeMessage(response) != nil {
+			return
+		}
+		s.notifySubscribers()
+	}()
+}
+
+// handleLine processes one line read from the client, which holds either a
+// single message or a batch, and returns what should be written back: a
+// response, an array of responses, or nil when there is nothing to send.
+// allowBackground is set on the read loop, where a single request or a
+// batch may be handed off to respond on its own, and whatever is handled
+// inline can't wait on the client.
+func (s *Server) handleLine(line []byte, allowBackground bool) interface{} {
+	if !json.Valid(line) {
+		response := errorResponse(nil, -32700, "Parse error")
+		s.metrics.countResponse(&response)
+		return response
+	}
+
+	ctx := context.Background()
+	if allowBackground {
+		ctx = context.WithValue(ctx, readLoopKey{}, true)
+	}
+	if !protocol.IsBatch(line) {
+		if response := s.handleMessage(ctx, line, allowBackground); response != nil {
+			return *response
+		}
+		return nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(line, &batch); err != nil || len(batch) == 0 {
+		return errorResponse(nil, -32600, "Invalid Request: batch must be a non-empty array")
+	}
+
+	// Batch entries are answered together, in order. On the read loop they
+	// are checked at once but run on a worker, so they can wait on the
+	// client, unless one of them sets up or ends the session, which the
+	// lines after the batch depend on
+	if allowBackground && !hasInlineMethod(batch) {
+		entries := make([]batchEntry, len(batch))
+		for i, message := range batch {
+			entries[i].response, entries[i].handler, entries[i].request = s.checkMessage(message)
+		}
+		s.handleBatchInBackground(entries)
+		return nil
+	}
+	responses := make([]protocol.Response, 0, len(batch))
+	for _, message := range batch {
+		if response := s.handleMessage(ctx, message, false); response != nil {
+			responses = append(responses, *response)
+		}
+	}
+	// A batch of only notifications gets no reply at all
+	if len(responses) == 0 {
+		return nil
+	}
+	return responses
+}
+
+// batchEntry is an entry of a batch checked by checkMessage: its response,
+// or the handler still to run for its request, or neither for a
+// notification.
+type batchEntry struct {
+	response *protocol.Response
+	handler  methodHandler
+	request  protocol.Request
+}
+
+// handleBatchInBackground runs the handlers of a checked batch one after
+// the other on a worker goroutine, and writes the responses when all of
+// them are done.
+func (s *Server) handleBatchInBackground(entries []batchEntry) {
+	s.mu.Lock()
+	if s.state == stateShuttingDown {
+		s.mu.Unlock()
+		var responses []protocol.Response
+		for _, entry := range entries {
+			if entry.handler != nil {
+				entry.response = s.shuttingDownResponse(entry.request.ID)
+				s.metrics.countResponse(entry.response)
+			}
+			if entry.response != nil {
+				responses = append(responses, *entry.response)
+			}
+		}
+		if len(responses) > 0 {
+			s.writeMessage(responses)
+		}
+		return
+	}
+	s.handlers.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.handlers.Done()
+		s.workers <- struct{}{}
+		var responses []protocol.Response
+		for _, entry := range entries {
+			if entry.handler != nil {
+				response := s.runHandler(context.Background(), entry.handler, entry.request)
+				entry.response = &response
+			}
+			if entry.response != nil {
+				responses = append(responses, *entry.response)
+			}
+		}
+		<-s.workers
+
+		if len(responses) == 0 || s.writeMessage(responses) != nil {
+			return
+		}
+		s.notifySubscribers()
+	}()
+}
+
+// hasInlineMethod reports whether a batch holds a request for one of the
+// inlineMethods.
+func hasInlineMethod(batch []json.RawMessage) bool {
+	for _, message := range batch {
+		var request struct {
+			Method string `json:"method"`
+		}
+		if json.Unmarshal(message, &request) == nil && inlineMethods[request.Method] {
+			return true
+		}
+	}
+	return false
+}
+
+// handleMessage dispatches a single request or notification, handling it
+// inline under ctx. It returns nil for notifications, which never get a
+// response, and for requests handed off to the background when
+// allowBackground is set, which respond on their own.
+func (s *Server) handleMessage(ctx context.Context, message []byte, allowBackground bool) *protocol.Response {
+	response, handler, request := s.checkMessage(message)
+	if handler == nil {
+		return response
+	}
+	if allowBackground && !inlineMethods[request.Method] {
+		s.handleInBackground(handler, request)
+		return nil
+	}
+	result := s.runHandler(ctx, handler, request)
+	return &result
+}
+
+// runHandler runs a request's handler under ctx, within the time the
+// request may take.
+func (s *Server) runHandler(ctx context.Context, handler methodHandler, request protocol.Request) protocol.Response {
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeoutFor(request))
+	defer cancel()
+	return s.callHandler(handler, ctx, request)
+}
+
+// checkMessage takes a single message as far as it can without running a
+// method handler: it delivers client responses, runs notifications, and
+// checks requests. It returns the response to send, if that is already
+// known, or otherwise the handler to run for the request.
+func (s *Server) checkMessage(message []byte) (*protocol.Response, methodHandler, protocol.Request) {
+	var request protocol.Request
+	if isClientResponse(message) {
+		s.handleClientResponse(message)
+		return nil, nil, request
+	}
+
+	if !protocol.IsObject(message) || json.Unmarshal(message, &request) != nil {
+		response := errorResponse(nil, -32600, "Invalid Request")
+		s.metrics.countResponse(&response)
+		return &response, nil, request
+	}
+	if problem := invalidRequest(request); problem != "" {
+		if len(request.ID) == 0 {
+			s.logger.Debug("ignoring invalid notification", "problem", problem)
+			return nil, nil, request
+		}
+		id := request.ID
+		if !protocol.ValidID(id) {
+			id = nil
+		}
+		response := errorResponse(id, -32600, "Invalid Request: "+problem)
+		s.metrics.countResponse(&response)
+		return &response, nil, request
+	}
+
+	// A message without an id is a notification
+	if len(request.ID) == 0 {
+		if handler, ok := notifications[request.Method]; ok {
+			s.callNotificationHandler(handler, request)
+		} else {
+			s.logger.Debug("ignoring unknown notification", "method", request.Method)
+		}
+		return nil, nil, request
+	}
+
+	s.metrics.countRequest(request.Method)
+	handler, ok := methods[request.Method]
+	if !ok {
+		s.logger.Warn("unknown method", "method", request.Method, "id", string(request.ID))
+		response := errorResponseWithData(request.ID, -32601, fmt.Sprintf("Method not found: %s", request.Method), codeNotFound, map[string]interface{}{"method": request.Method})
+		s.metrics.countResponse(&response)
+		return &response, nil, request
+	}
+	if response := s.checkLifecycle(request.ID, request.Method); response != nil {
+		s.metrics.countResponse(response)
+		return response, nil, request
+	}
+	return nil, handler, request
+}
+
+// invalidRequest returns what makes a decoded message an invalid JSON-RPC
+// request or notification, or "".
+func invalidRequest(request protocol.Request) string {
+	switch {
+	case len(request.ID) > 0 && !protocol.ValidID(request.ID):
+		return "id must be a string, a number or null"
+	case request.JSONRPC != "2.0":
+		return `jsonrpc must be "2.0"`
+	case request.Method == "":
+		return "method is required"
+	}
+	return ""
+}
+
+// callHandler runs a method handler, turning a panic into an internal error
+// response so one bad request can't take down the session.
+func (s *Server) callHandler(handler methodHandler, ctx context.Context, request protocol.Request) (response protocol.Response) {
+	ctx, sp := s.tracer.start(ctx, request.Method, spanKindServer)
+	sp.setAttribute("rpc.system", "jsonrpc")
+	sp.setAttribute("rpc.method", request.Method)
+	defer func() {
+		if response.Error != nil {
+			sp.setIntAttribute("rpc.jsonrpc.error_code", response.Error.Code)
+			sp.fail("JSON-RPC error")
+		}
+		sp.end()
+	}()
+	defer func() { s.metrics.countResponse(&response) }()
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Error("panic handling request", "method", request.Method, "id", string(request.ID), "panic", r, "stack", string(debug.Stack()))
+			response = errorResponseWithData(request.ID, -32603, "Internal error", codeInternal, map[string]interface{}{"panic": s.panicSummary(r)})
+		}
+	}()
+	return handler(s, ctx, request)
+}
+
+// maxPanicSummary caps the length of a panic's summary in an error.
+const maxPanicSummary = 200
+
+// panicSummary describes a recovered panic for a client, without any key
+// value it may have held.
+func (s *Server) panicSummary(r interface{}) string {
+	summary := []rune(s.keys.secrets.scrub(fmt.Sprint(r)))
+	if len(summary) > maxPanicSummary {
+		return string(summary[:maxPanicSummary]) + "..."
+	}
+	return string(summary)
+}
+
+// callNotificationHandler runs a notification handler, logging and
+// swallowing a panic since notifications have no response to carry it.
+func (s *Server) callNotificationHandler(handler notificationHandler, request protocol.Request) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Error("panic handling notification", "method", request.Method, "panic", r, "stack", string(debug.Stack()))
+		}
+	}()
+	handler(s, request)
+}
+
+// utf8BOM is the UTF-8 encoding of the byte order mark.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// Run serves requests from the input until it is closed, then shuts down. It
+// returns nil on a clean EOF, and otherwise the read, write or shutdown error
+// that stopped it.
+func (s *Server) Run() error {
+	err := s.serve()
+
+	// Let requests still running finish writing their responses
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if shutdownErr := s.Shutdown(ctx); err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+// serve is the read loop. It stops at EOF, after a shutdown request, or when
+// reading or writing fails; once the output is gone there is no point
+// reading further requests.
+func (s *Server) serve() error {
+	firstLine := true
+	for {
+		if err := s.writeFailed(); err != nil {
+			return err
+		}
+
+		line, err := protocol.ReadLine(s.reader, s.maxMessageSize)
+		if errors.Is(err, protocol.ErrMessageTooLarge) {
+			s.writeMessage(errorResponse(nil, -32600, fmt.Sprintf("Invalid Request: message exceeds the maximum size of %d bytes", s.maxMessageSize)))
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read from the client: %w", err)
+		}
+
+		// Some Windows hosts start the stream with a UTF-8 byte order mark
+		// and end lines with \r\n; neither is part of the message
+		if firstLine {
+			line = bytes.TrimPrefix(line, utf8BOM)
+			firstLine = false
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		// Once shutdown has started, what is still read isn't handled
+		if s.shuttingDown() {
+			return nil
+		}
+		s.recorder.record(directionIn, line)
+		if reply := s.handleLine(line, true); reply != nil {
+			s.writeMessage(reply)
+		}
+		s.flushStartupLogs()
+		if s.shuttingDown() {
+			return nil
+		}
+
+		// Key values may have changed while handling the request, so let
+		// subscribers know before reading the next one.
+		s.notifySubscribers()
+	}
+}
+
+// defaultMaxMessageSize is the largest message accepted unless overridden
+// with --max-message-size.
+const defaultMaxMessageSize = 4 << 20
+
+// defaultMaxConcurrency is how many requests are handled at once unless
+// overridden with --max-concurrency.
+const defaultMaxConcurrency = 8
+
+// defaultRequestTimeout is how long a request may run unless overridden with
+// --request-timeout.
+const defaultRequestTimeout = 30 * time.Second
+
+// readOnlyFromEnv reports whether MCP_READ_ONLY asks for read-only mode.
+func readOnlyFromEnv() bool {
+	return os.Getenv("MCP_READ_ONLY") == "1"
+}
+
+// defaultInstructions is sent to clients in the initialize result unless
+// overridden with --instructions-file.
+const defaultInstructions = `This server manages API keys stored in environment variables.
+Prefer check_api_key_exists or list_api_keys to find out whether a key is configured; they never reveal values.
+Only call get_api_key when you must embed the actual value somewhere, and never repeat a revealed value back to the user or write it into files that may be committed.
+If a key is missing, tell the user which environment variable to set rather than asking them to paste the key into the conversation.`
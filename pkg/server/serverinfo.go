@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/yourusername/mcp-api-keys-server/version"
+)
+
+const serverName = "api-keys-server"
+
+// serverInfo describes the running build, for bug reports and diagnostics.
+type serverInfo struct {
+	Name            string `json:"name"`
+	Version         string `json:"version"`
+	Commit          string `json:"commit"`
+	BuildDate       string `json:"build_date"`
+	GoVersion       string `json:"go_version"`
+	ProtocolVersion string `json:"protocol_version"`
+	Keys            int    `json:"keys"`
+	ReadOnly        bool   `json:"read_only"`
+	DryRun          bool   `json:"dry_run"`
+	// RevealBudget is only reported when --reveal-budget is set.
+	RevealBudget *budgetStatus `json:"reveal_budget,omitempty"`
+}
+
+var serverInfoSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"name":             {Type: "string"},
+		"version":          {Type: "string"},
+		"commit":           {Type: "string", Description: "Git commit the server was built from"},
+		"build_date":       {Type: "string"},
+		"go_version":       {Type: "string"},
+		"protocol_version": {Type: "string", Description: "MCP protocol version negotiated with this client"},
+		"keys":             {Type: "integer", Description: "Number of API keys in the registry"},
+		"read_only":        {Type: "boolean", Description: "Whether value-revealing tools are disabled"},
+		"dry_run":          {Type: "boolean", Description: "Whether get_api_key returns fake values"},
+		"reveal_budget": {
+			Type:        "object",
+			Description: "Use of the session reveal budget, present when one is set",
+			Properties: map[string]Property{
+				"limit":       {Type: "integer", Description: "Most distinct keys the session may reveal"},
+				"unique_keys": {Type: "integer", Description: "Distinct keys revealed so far"},
+				"total_calls": {Type: "integer", Description: "Reveals so far, counting repeats"},
+				"remaining":   {Type: "integer", Description: "Distinct keys that may still be revealed"},
+			},
+			Required: []string{"limit", "unique_keys", "total_calls", "remaining"},
+		},
+	},
+	Required: []string{"name", "version", "commit", "build_date", "go_version", "protocol_version", "keys", "read_only", "dry_run"},
+}
+
+func (s *Server) handleServerInfo(ctx context.Context, args map[string]interface{}) CallToolResult {
+	s.mu.Lock()
+	protocolVersion := s.protocolVersion
+	s.mu.Unlock()
+
+	info := serverInfo{
+		Name:            serverName,
+		Version:         version.Version,
+		Commit:          version.Commit,
+		BuildDate:       version.Date,
+		GoVersion:       runtime.Version(),
+		ProtocolVersion: protocolVersion,
+		Keys:            s.keys.count(),
+		ReadOnly:        s.readOnly,
+		DryRun:          s.dryRun,
+	}
+	if budget := s.revealBudgetStatus(); budget.Limit > 0 {
+		info.RevealBudget = &budget
+	}
+
+	text := fmt.Sprintf("%s %s\nCommit: %s\nBuilt: %s\nGo: %s\nProtocol: %s\nKeys: %d\nRead-only: %t\nDry run: %t",
+		info.Name, info.Version, info.Commit, info.BuildDate, info.GoVersion, info.ProtocolVersion, info.Keys, info.ReadOnly, info.DryRun)
+	if budget := info.RevealBudget; budget != nil {
+		text += fmt.Sprintf("\nReveal budget: %d of %d distinct keys used, %d remaining (%d reveals in total)",
+			budget.UniqueKeys, budget.Limit, budget.Remaining, budget.TotalCalls)
+		if budget.BreakGlass > 0 {
+			text += fmt.Sprintf(", %d of them break-glass, counting double", budget.BreakGlass)
+		}
+	}
+	result := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text}},
+	}
+	if s.supportsStructuredContent() {
+		result.StructuredContent = info
+	}
+	return result
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/registry"
+)
+
+// setupField is one variable the setup command asks for: a plain key's
+// variable, or a missing member of a composite key.
+type setupField struct {
+	Key    string
+	EnvVar string
+	// Role is the member's role for composite keys.
+	Role string
+	// config is the key's registry entry.
+	config registry.APIKeyConfig
+}
+
+// label names the field in prompts, such as "azure_openai (endpoint)".
+func (f setupField) label() string {
+	if f.Role != "" {
+		return fmt.Sprintf("%s (%s)", f.Key, f.Role)
+	}
+	return f.Key
+}
+
+// setupFields returns the variables of the unconfigured keys in category,
+// restricted to the keys in only when it isn't empty, and the selected keys
+// that are already configured.
+func setupFields(keys *keyRegistry, category string, only []string) ([]setupField, []string, error) {
+	selected := map[string]bool{}
+	for _, name := range only {
+		if _, exists := keys.config(name); !exists {
+			message, _ := keys.unknownKeyMessage(name, keys.names())
+			return nil, nil, fmt.Errorf("%s", message)
+		}
+		selected[name] = true
+	}
+
+	var fields []setupField
+	var configured []string
+	for _, name := range keys.names() {
+		config, value, _ := keys.lookup(name)
+		if category != "all" && config.Category != category || len(only) > 0 && !selected[name] {
+			continue
+		}
+		switch {
+		case value != "":
+			configured = append(configured, name)
+		case config.IsComposite():
+			for _, member := range keys.memberStatuses(config) {
+				if !member.Configured {
+					fields = append(fields, setupField{Key: name, EnvVar: member.EnvVar, Role: member.Role, config: config})
+				}
+			}
+		default:
+			fields = append(fields, setupField{Key: name, EnvVar: config.EnvVar, config: config})
+		}
+	}
+	return fields, configured, nil
+}
+
+// checkSetupValue cleans a value entered for field and checks it. problem
+// says what is wrong without quoting the value; badFormat is set when the
+// only problem is that the value doesn't have the key's usual shape, which
+// the user may override.
+func checkSetupValue(keys *keyRegistry, field setupField, value string) (cleaned, problem string, badFormat bool) {
+	cleaned, _ = sanitize(value)
+	switch {
+	case cleaned == "":
+		return "", "", false
+	case keys.looksLikePlaceholder(cleaned):
+		return cleaned, "that looks like a placeholder, not a real key", false
+	case field.config.IsFilePath():
+		if _, _, err := readKeyFile(cleaned); err != nil {
+			return cleaned, err.Error(), false
+		}
+	case field.Role == "":
+		if provider, ok := checkKeyFormat(field.Key, cleaned); !ok {
+			return cleaned, fmt.Sprintf("that doesn't look like a %s", provider), true
+		}
+	}
+	return cleaned, "", false
+}
+
+func runSetup(keys *keyRegistry, args []string, stdout, stderr io.Writer) int {
+	flags := newCommandFlags("setup", "setup [--category name] [--only key1,key2] [--target file] [--from-stdin-json]", stderr)
+	category := flags.String("category", "all", "Only set up keys in this category: llm, saas, canva, vcs or internal")
+	only := flags.String("only", "", "Comma-separated key names to set up, instead of every unconfigured key")
+	target := flags.String("target", ".env", "The .env file to write values to")
+	fromJSON := flags.Bool("from-stdin-json", false, `Read values from a JSON object on stdin, such as {"openai": "sk-...", "AZURE_OPENAI_ENDPOINT": "https://..."}, instead of asking`)
+	if err := flags.Parse(args); err != nil {
+		return exitUsageErr
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitUsageErr
+	}
+	if !validCategory(*category) {
+		fmt.Fprintf(stderr, "Invalid category: %s\n", *category)
+		return exitUsageErr
+	}
+	var names []string
+	for _, name := range strings.Split(*only, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	fields, configured, err := setupFields(keys, *category, names)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsageErr
+	}
+	if len(configured) > 0 && len(names) > 0 {
+		fmt.Fprintf(stdout, "Already configured, not changed: %s\n", strings.Join(configured, ", "))
+	}
+	if len(fields) == 0 {
+		fmt.Fprintln(stdout, "Nothing to set up: every selected key is configured.")
+		return exitOK
+	}
+
+	if *fromJSON {
+		return setupFromJSON(keys, fields, os.Stdin, *target, stdout, stderr)
+	}
+	return setupInteractive(keys, fields, *target, stdout, stderr)
+}
+
+// setupInteractive asks for each field on the terminal, with echo off, and
+// saves each accepted value to target as soon as it is entered.
+func setupInteractive(keys *keyRegistry, fields []setupField, target string, stdout, stderr io.Writer) int {
+	tty, restore, err := openHiddenTTY()
+	if err != nil {
+		fmt.Fprintln(stderr, "No terminal to ask on; use --from-stdin-json to set up keys from a script.")
+		return exitFailure
+	}
+	defer restore()
+	reader := bufio.NewReader(tty)
+	ask := func(prompt string) (string, error) {
+		fmt.Fprint(tty, prompt)
+		line, err := reader.ReadString('\n')
+		fmt.Fprintln(tty)
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprintf(tty, "Setting up %d variables in %s. What you type isn't shown; press Enter to skip one.\n", len(fields), target)
+	var saved, skipped []string
+	for _, field := range fields {
+		fmt.Fprintf(tty, "\n%s - %s\n", field.label(), field.config.Description)
+		guide := keys.guides[field.Key]
+		if guide.ConsoleURL != "" {
+			fmt.Fprintf(tty, "  Create it at: %s\n", guide.ConsoleURL)
+		}
+		if guide.Format != "" && field.Role == "" {
+			fmt.Fprintf(tty, "  Format: %s\n", guide.Format)
+		}
+
+		value := ""
+		for {
+			entered, err := ask(fmt.Sprintf("%s: ", field.EnvVar))
+			if err != nil {
+				fmt.Fprintf(stderr, "Stopped: %v\n", err)
+				return exitFailure
+			}
+			cleaned, problem, badFormat := checkSetupValue(keys, field, entered)
+			if cleaned == "" || problem == "" {
+				value = cleaned
+				break
+			}
+			if !badFormat {
+				fmt.Fprintf(tty, "  Not saved: %s. Try again, or press Enter to skip.\n", problem)
+				continue
+			}
+			fmt.Fprintf(tty, "  Careful: %s. Enter it again to save it anyway, or press Enter to skip.\n", problem)
+			again, err := ask(fmt.Sprintf("%s: ", field.EnvVar))
+			if err != nil {
+				fmt.Fprintf(stderr, "Stopped: %v\n", err)
+				return exitFailure
+			}
+			if confirmed, _ := sanitize(again); confirmed == cleaned || confirmed == "" {
+				value = confirmed
+				break
+			}
+			fmt.Fprintln(tty, "  The two entries differ; starting over.")
+		}
+
+		if value == "" {
+			skipped = append(skipped, field.EnvVar)
+			continue
+		}
+		if err := setEnvFileValue(target, field.EnvVar, value); err != nil {
+			fmt.Fprintf(stderr, "Failed to update %s: %v\n", target, err)
+			return exitFailure
+		}
+		fmt.Fprintf(tty, "  Saved %s.\n", field.EnvVar)
+		saved = append(saved, field.EnvVar)
+	}
+	fmt.Fprint(stdout, setupSummary(target, saved, skipped))
+	return exitOK
+}
+
+// setupFromJSON reads a JSON object of values by key name, or by variable
+// for composite members, and saves them to target. Every value is checked
+// before any is written, and a value that doesn't have its key's usual
+// shape is rejected.
+func setupFromJSON(keys *keyRegistry, fields []setupField, stdin io.Reader, target string, stdout, stderr io.Writer) int {
+	var values map[string]string
+	if err := json.NewDecoder(stdin).Decode(&values); err != nil {
+		fmt.Fprintf(stderr, "Invalid JSON on stdin: expected an object of strings: %v\n", keys.secrets.scrubError(err))
+		return exitUsageErr
+	}
+	byName := map[string]setupField{}
+	for _, field := range fields {
+		byName[field.EnvVar] = field
+		if field.Role == "" {
+			byName[field.Key] = field
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	accepted := map[string]string{}
+	var problems []string
+	for _, name := range names {
+		field, ok := byName[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: not a key or variable that needs setting up", name))
+			continue
+		}
+		cleaned, problem, _ := checkSetupValue(keys, field, values[name])
+		switch {
+		case problem != "":
+			problems = append(problems, fmt.Sprintf("%s: %s", name, problem))
+		case cleaned != "":
+			accepted[field.EnvVar] = cleaned
+		}
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(stderr, "Nothing was saved:\n- %s\n", strings.Join(problems, "\n- "))
+		return exitFailure
+	}
+
+	var saved, skipped []string
+	for _, field := range fields {
+		value, ok := accepted[field.EnvVar]
+		if !ok {
+			skipped = append(skipped, field.EnvVar)
+			continue
+		}
+		if err := setEnvFileValue(target, field.EnvVar, value); err != nil {
+			fmt.Fprintf(stderr, "Failed to update %s: %v\n", target, err)
+			return exitFailure
+		}
+		saved = append(saved, field.EnvVar)
+	}
+	fmt.Fprint(stdout, setupSummary(target, saved, skipped))
+	return exitOK
+}
+
+// setupSummary names the variables saved and skipped, never their values.
+func setupSummary(target string, saved, skipped []string) string {
+	target = envFileTarget(target)
+	var b strings.Builder
+	if len(saved) > 0 {
+		b.WriteString(fmt.Sprintf("Saved to %s: %s\n", target, strings.Join(saved, ", ")))
+	} else {
+		b.WriteString(fmt.Sprintf("Saved nothing to %s.\n", target))
+	}
+	if len(skipped) > 0 {
+		b.WriteString(fmt.Sprintf("Still missing: %s\n", strings.Join(skipped, ", ")))
+	}
+	return b.String()
+}
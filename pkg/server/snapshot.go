@@ -0,0 +1,380 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshots of the key environment are kept in a snapshots directory next
+// to the --state-file, one file per label, encrypted with AES-256-GCM under
+// a random key stored once per machine in the user's config directory. A
+// snapshot copied to another machine can't be read, and no export tool reads
+// snapshots; only restore_env decrypts them.
+const snapshotExt = ".snap"
+
+var snapshotMagic = []byte("MCPSNAP\x01")
+
+// snapshotLabel is what a label may look like, so it is always a plain file
+// name.
+var snapshotLabel = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// envSnapshot is the plaintext of a snapshot file.
+type envSnapshot struct {
+	Label     string          `json:"label"`
+	CreatedAt time.Time       `json:"created_at"`
+	Values    []snapshotValue `json:"values"`
+}
+
+// snapshotValue is one environment variable of a registered key.
+type snapshotValue struct {
+	Key    string `json:"key"`
+	EnvVar string `json:"env_var"`
+	Value  string `json:"value"`
+}
+
+// snapshotInfo describes a snapshot for list_snapshots.
+type snapshotInfo struct {
+	Label     string `json:"label"`
+	CreatedAt string `json:"created_at,omitempty"`
+	Keys      int    `json:"keys"`
+	Error     string `json:"error,omitempty"`
+}
+
+// snapshotChange is how restoring a snapshot changes one variable.
+type snapshotChange struct {
+	EnvVar string `json:"env_var"`
+	Key    string `json:"key"`
+	// Change is added, changed or unchanged.
+	Change string `json:"change"`
+}
+
+var snapshotListSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"snapshots": {
+			Type: "array",
+			Items: &Property{
+				Type: "object",
+				Properties: map[string]Property{
+					"label":      {Type: "string"},
+					"created_at": {Type: "string", Description: "When the snapshot was taken (RFC 3339)"},
+					"keys":       {Type: "integer", Description: "Number of variables the snapshot holds"},
+					"error":      {Type: "string", Description: "Why the snapshot can't be read on this machine"},
+				},
+				Required: []string{"label", "keys"},
+			},
+		},
+	},
+	Required: []string{"snapshots"},
+}
+
+var snapshotRestoreSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"label":  {Type: "string"},
+		"target": {Type: "string"},
+		"changes": {
+			Type: "array",
+			Items: &Property{
+				Type: "object",
+				Properties: map[string]Property{
+					"env_var": {Type: "string"},
+					"key":     {Type: "string"},
+					"change":  {Type: "string", Enum: []string{"added", "changed", "unchanged"}},
+				},
+				Required: []string{"env_var", "key", "change"},
+			},
+		},
+		"not_in_snapshot": {
+			Type:        "array",
+			Description: "Variables set now that the snapshot doesn't hold; they are left as they are",
+			Items:       &Property{Type: "string"},
+		},
+	},
+	Required: []string{"label", "target", "changes", "not_in_snapshot"},
+}
+
+// machineKey returns this machine's snapshot key, creating it on first use.
+func machineKey() ([]byte, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("no place to keep the machine key: %w", err)
+	}
+	path := filepath.Join(dir, "mcp-api-keys-server", "machine.key")
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("machine key %s is damaged", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		// Another process created it first
+		return machineKey()
+	} else if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(key); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return key, file.Close()
+}
+
+func snapshotCipher() (cipher.AEAD, error) {
+	key, err := machineKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeSnapshot encrypts snapshot into dir, refusing to replace a snapshot
+// with the same label.
+func writeSnapshot(dir string, snapshot envSnapshot) error {
+	plaintext, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	gcm, err := snapshotCipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	header := append(append([]byte(nil), snapshotMagic...), nonce...)
+	data := gcm.Seal(header, nonce, plaintext, []byte(snapshot.Label))
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, snapshot.Label+snapshotExt)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("a snapshot labelled %s already exists", snapshot.Label)
+	}
+	return writeFileAtomic(path, data, 0o600)
+}
+
+// readSnapshot decrypts the snapshot with the given label from dir.
+func readSnapshot(dir, label string) (envSnapshot, error) {
+	var snapshot envSnapshot
+	data, err := os.ReadFile(filepath.Join(dir, label+snapshotExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshot, fmt.Errorf("no snapshot labelled %s", label)
+	} else if err != nil {
+		return snapshot, err
+	}
+	gcm, err := snapshotCipher()
+	if err != nil {
+		return snapshot, err
+	}
+	if !bytes.HasPrefix(data, snapshotMagic) || len(data) < len(snapshotMagic)+gcm.NonceSize() {
+		return snapshot, fmt.Errorf("snapshot %s is corrupted", label)
+	}
+	data = data[len(snapshotMagic):]
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(label))
+	if err != nil {
+		return snapshot, fmt.Errorf("snapshot %s can't be decrypted: it was taken on another machine or is corrupted", label)
+	}
+	if err := json.Unmarshal(plaintext, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("snapshot %s is corrupted: %w", label, err)
+	}
+	return snapshot, nil
+}
+
+// captureSnapshot reads the current value of every registered key's
+// variables, skipping unset ones.
+func (k *keyRegistry) captureSnapshot(label string, now time.Time) envSnapshot {
+	snapshot := envSnapshot{Label: label, CreatedAt: now.UTC(), Values: []snapshotValue{}}
+	for _, name := range k.names() {
+		config, value, _ := k.lookup(name)
+		if !config.IsComposite() {
+			if value != "" {
+				snapshot.Values = append(snapshot.Values, snapshotValue{Key: name, EnvVar: config.EnvVar, Value: value})
+			}
+			continue
+		}
+		for _, member := range config.Members {
+			if value := k.resolvedEnv(member.EnvVar); value != "" {
+				snapshot.Values = append(snapshot.Values, snapshotValue{Key: name, EnvVar: member.EnvVar, Value: value})
+			}
+		}
+	}
+	return snapshot
+}
+
+// listSnapshots describes the snapshots in dir, oldest first.
+func listSnapshots(dir string) ([]snapshotInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []snapshotInfo{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	infos := []snapshotInfo{}
+	for _, entry := range entries {
+		label, ok := strings.CutSuffix(entry.Name(), snapshotExt)
+		if !ok || entry.IsDir() || !snapshotLabel.MatchString(label) {
+			continue
+		}
+		info := snapshotInfo{Label: label}
+		if snapshot, err := readSnapshot(dir, label); err != nil {
+			info.Error = err.Error()
+		} else {
+			info.CreatedAt = snapshot.CreatedAt.Format(time.RFC3339)
+			info.Keys = len(snapshot.Values)
+		}
+		infos = append(infos, info)
+	}
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].CreatedAt < infos[j].CreatedAt })
+	return infos, nil
+}
+
+func (s *Server) handleSnapshotEnv(ctx context.Context, args map[string]interface{}) CallToolResult {
+	now := time.Now()
+	label, _ := args["label"].(string)
+	if label == "" {
+		label = now.UTC().Format("20060102-150405")
+	}
+	if !snapshotLabel.MatchString(label) {
+		return failure(codeValidationFailed, "Error: label must start with a letter or digit and use only letters, digits, '.', '_' and '-' (at most 64 characters)", nil)
+	}
+
+	snapshot := s.keys.captureSnapshot(label, now)
+	if err := writeSnapshot(s.snapshotDir, snapshot); err != nil {
+		return errorFailure(err, codeBackendUnavailable, nil)
+	}
+	s.noteAudit(ctx, "info", fmt.Sprintf("snapshot_env saved %d variables as '%s'", len(snapshot.Values), label))
+	return CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: fmt.Sprintf("%s Saved snapshot '%s' with %d variables. Restore it with restore_env.", s.markers.status(true), label, len(snapshot.Values))}},
+	}
+}
+
+func (s *Server) handleListSnapshots(ctx context.Context, args map[string]interface{}) CallToolResult {
+	infos, err := listSnapshots(s.snapshotDir)
+	if err != nil {
+		return errorFailure(err, codeBackendUnavailable, nil)
+	}
+
+	var text strings.Builder
+	text.WriteString("Environment snapshots:\n")
+	for _, info := range infos {
+		if info.Error != "" {
+			text.WriteString(fmt.Sprintf("  %s %s: %s\n", s.markers.status(false), info.Label, info.Error))
+			continue
+		}
+		text.WriteString(fmt.Sprintf("  %s: %s, %d variables\n", info.Label, info.CreatedAt, info.Keys))
+	}
+	if len(infos) == 0 {
+		text.WriteString("  No snapshots yet; take one with snapshot_env.\n")
+	}
+
+	toolResult := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text.String()}},
+	}
+	if s.supportsStructuredContent() {
+		toolResult.StructuredContent = map[string]interface{}{"snapshots": infos}
+	}
+	return toolResult
+}
+
+func (s *Server) handleRestoreEnv(ctx context.Context, args map[string]interface{}) CallToolResult {
+	label, _ := args["label"].(string)
+	// Only the .env file the server loads its keys from is written, so a
+	// client can't use a snapshot to put values anywhere else
+	target := ".env"
+	if path, _ := args["target"].(string); path != "" {
+		if inside, err := inWorkingDir(path); err != nil || inside != target {
+			return failure(codeValidationFailed, "Error: restore_env only writes .env in the working directory, which the server loads its keys from", map[string]interface{}{"target": path})
+		}
+	}
+	if !snapshotLabel.MatchString(label) {
+		return failure(codeNotFound, fmt.Sprintf("Error: no snapshot labelled %q", label), nil)
+	}
+	snapshot, err := readSnapshot(s.snapshotDir, label)
+	if err != nil {
+		return errorFailure(err, codeBackendUnavailable, nil)
+	}
+	for _, value := range snapshot.Values {
+		s.keys.secrets.remember(value.Key, value.Value)
+	}
+
+	changes := []snapshotChange{}
+	inSnapshot := map[string]bool{}
+	for _, value := range snapshot.Values {
+		inSnapshot[value.EnvVar] = true
+		change := snapshotChange{EnvVar: value.EnvVar, Key: value.Key, Change: "unchanged"}
+		switch current, _ := s.keys.lookupEnv(value.EnvVar); {
+		case current == "":
+			change.Change = "added"
+		case current != value.Value:
+			change.Change = "changed"
+		}
+		if change.Change != "unchanged" {
+			if err := setEnvFileValue(target, value.EnvVar, value.Value); err != nil {
+				return failure(codeBackendUnavailable, fmt.Sprintf("Error: failed to update %s: %v", target, s.keys.secrets.scrubError(err)), nil)
+			}
+		}
+		changes = append(changes, change)
+	}
+	notInSnapshot := []string{}
+	for _, current := range s.keys.captureSnapshot(label, time.Now()).Values {
+		if !inSnapshot[current.EnvVar] {
+			notInSnapshot = append(notInSnapshot, current.EnvVar)
+		}
+	}
+	written := envFileTarget(target)
+	s.noteAudit(ctx, "info", fmt.Sprintf("restore_env wrote snapshot '%s' to %s", label, written))
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Restored snapshot '%s' (%s) into %s:\n", label, snapshot.CreatedAt.Format(time.RFC3339), written))
+	for _, change := range changes {
+		text.WriteString(fmt.Sprintf("  %-28s %s\n", change.EnvVar, change.Change))
+	}
+	if len(notInSnapshot) > 0 {
+		text.WriteString(fmt.Sprintf("\nSet now but not in the snapshot, left as they are: %s\n", strings.Join(notInSnapshot, ", ")))
+	}
+
+	toolResult := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text.String()}},
+	}
+	if s.supportsStructuredContent() {
+		toolResult.StructuredContent = map[string]interface{}{
+			"label":           label,
+			"target":          target,
+			"changes":         changes,
+			"not_in_snapshot": notInSnapshot,
+		}
+	}
+	return toolResult
+}
@@ -0,0 +1,78 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+// snapshotSession runs lines, after initialize, against a server that keeps
+// snapshots next to stateFile and may write files, and returns its messages.
+func snapshotSession(t *testing.T, stateFile string, lines ...string) []map[string]interface{} {
+	t.Helper()
+	stdin := strings.Join(append([]string{initializeLine, initializedLine}, lines...), "\n") + "\n"
+	code, stdout, stderr := execute(t, context.Background(), stdin, "--watch-env=false", "--log-level", "error", "--state-file", stateFile, "--allow-writes")
+	if code != 0 {
+		t.Fatalf("Execute = %d, %s", code, stderr)
+	}
+	var messages []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		var message map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &message); err != nil {
+			t.Fatalf("stdout line %q isn't JSON", line)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func TestRestoreEnvOnlyWritesDotEnv(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	outside := t.TempDir()
+	dir := t.TempDir()
+	chdir(t, dir)
+	if err := os.Symlink(outside, "linked"); err != nil {
+		t.Fatal(err)
+	}
+
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-snapshot0123456789abcdef"})
+	snapshotSession(t, stateFile, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"snapshot_env","arguments":{"label":"before"}}}`)
+	testmcp.ClearKeys(t)
+
+	restore := func(target string) string {
+		return `{"jsonrpc":"2.0","id":"` + target + `","method":"tools/call","params":{"name":"restore_env","arguments":{"label":"before","target":"` + target + `"}}}`
+	}
+	targets := []string{filepath.Join(outside, ".env"), "../" + filepath.Base(outside) + "/.env", "linked/.env", "other.env"}
+	var lines []string
+	for _, target := range targets {
+		lines = append(lines, restore(target))
+	}
+	messages := snapshotSession(t, stateFile, append(lines, restore(".env"))...)
+
+	for _, target := range targets {
+		result, _ := responseTo(t, messages, target)["result"].(map[string]interface{})
+		structured, _ := result["structuredContent"].(map[string]interface{})
+		if failure, _ := structured["error"].(map[string]interface{}); result["isError"] != true || failure["code"] != "validation_failed" {
+			t.Errorf("restore_env into %s = %v", target, result)
+		}
+	}
+	if entries, err := os.ReadDir(outside); err != nil || len(entries) != 0 {
+		t.Errorf("restore_env wrote outside the working directory: %v, %v", entries, err)
+	}
+	if _, err := os.Stat("other.env"); !os.IsNotExist(err) {
+		t.Errorf("restore_env wrote other.env: %v", err)
+	}
+
+	if result, _ := responseTo(t, messages, ".env")["result"].(map[string]interface{}); result["isError"] == true {
+		t.Errorf("restore_env into .env = %v", result)
+	}
+	if data, err := os.ReadFile(".env"); err != nil || !strings.Contains(string(data), "OPENAI_API_KEY=sk-proj-snapshot0123456789abcdef") {
+		t.Errorf(".env = %q, %v", data, err)
+	}
+}
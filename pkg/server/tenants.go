@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// tenantTokenMeta is the initialize _meta field a client names its tenant
+// with when the server is started with --tenants.
+const tenantTokenMeta = "tenantToken"
+
+// tenantConfig is one tenant of a --tenants file. A session bound to it
+// reads every key either from the variables named with EnvPrefix in front,
+// so OPENAI_API_KEY is ACME_OPENAI_API_KEY, or from EnvFile alone.
+type tenantConfig struct {
+	// TokenSHA256 is the hex SHA-256 of the token a client sends in
+	// initialize to be bound to the tenant.
+	TokenSHA256 string `json:"token_sha256"`
+	EnvPrefix   string `json:"env_prefix,omitempty"`
+	EnvFile     string `json:"env_file,omitempty"`
+}
+
+// tenantsFile is the format of the --tenants file.
+type tenantsFile struct {
+	Tenants map[string]tenantConfig `json:"tenants"`
+}
+
+// tenants maps the tokens a client may send in initialize to the tenant
+// the session is bound to. A server with tenants serves only sessions bound
+// to one of them, never the shared environment.
+type tenants struct {
+	byName map[string]tenantConfig
+	// dir is the directory of the tenants file, which relative env files
+	// are found from.
+	dir string
+}
+
+// loadTenants reads and checks a --tenants file.
+func loadTenants(path string) (*tenants, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file tenantsFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid tenants file %s: %w", path, err)
+	}
+	if len(file.Tenants) == 0 {
+		return nil, fmt.Errorf("invalid tenants file %s: no tenants", path)
+	}
+
+	names := make([]string, 0, len(file.Tenants))
+	for name := range file.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	hashes := map[string]string{}
+	prefixes := map[string]string{}
+	for _, name := range names {
+		tenant := file.Tenants[name]
+		if problem := tenant.validate(); problem != "" {
+			return nil, fmt.Errorf("invalid tenants file %s: tenant %s: %s", path, name, problem)
+		}
+		hash := strings.ToLower(tenant.TokenSHA256)
+		if other, taken := hashes[hash]; taken {
+			return nil, fmt.Errorf("invalid tenants file %s: tenants %s and %s have the same token", path, other, name)
+		}
+		hashes[hash] = name
+		// One tenant's prefix starting another's would let the shorter one
+		// be given a name that reads the other's variables
+		for prefix, other := range prefixes {
+			if tenant.EnvPrefix != "" && (strings.HasPrefix(prefix, tenant.EnvPrefix) || strings.HasPrefix(tenant.EnvPrefix, prefix)) {
+				return nil, fmt.Errorf("invalid tenants file %s: the env prefixes of tenants %s and %s overlap", path, other, name)
+			}
+		}
+		if tenant.EnvPrefix != "" {
+			prefixes[tenant.EnvPrefix] = name
+		}
+	}
+	return &tenants{byName: file.Tenants, dir: filepath.Dir(path)}, nil
+}
+
+// validate returns what is wrong with a tenant, or "".
+func (c tenantConfig) validate() string {
+	if hash, err := hex.DecodeString(c.TokenSHA256); err != nil || len(hash) != sha256.Size {
+		return "token_sha256 must be the hex SHA-256 of the tenant's token"
+	}
+	switch {
+	case (c.EnvPrefix == "") == (c.EnvFile == ""):
+		return "needs exactly one of env_prefix and env_file"
+	case c.EnvPrefix != "" && strings.Trim(c.EnvPrefix, "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_") != "":
+		return fmt.Sprintf("env_prefix %q may only hold capital letters, digits and underscores", c.EnvPrefix)
+	}
+	return ""
+}
+
+// errUnknownTenantToken is returned by bind for a token no tenant has.
+var errUnknownTenantToken = errors.New("no tenant has that token")
+
+// bind returns the environment of the tenant whose token is token.
+func (t *tenants) bind(token string) (*tenantEnv, error) {
+	if token == "" {
+		return nil, errUnknownTenantToken
+	}
+	sum := sha256.Sum256([]byte(token))
+	for name, tenant := range t.byName {
+		want, _ := hex.DecodeString(tenant.TokenSHA256)
+		if subtle.ConstantTimeCompare(sum[:], want) != 1 {
+			continue
+		}
+		env := &tenantEnv{name: name, prefix: tenant.EnvPrefix}
+		if tenant.EnvFile != "" {
+			path := tenant.EnvFile
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(t.dir, path)
+			}
+			values, err := godotenv.Read(path)
+			if err != nil {
+				return nil, fmt.Errorf("tenant %s: %w", name, err)
+			}
+			env.values = values
+		}
+		return env, nil
+	}
+	return nil, errUnknownTenantToken
+}
+
+// tenantEnv is the environment a session bound to a tenant reads keys
+// from, in place of the server's own.
+type tenantEnv struct {
+	name   string
+	prefix string
+	// values are those of the tenant's env file, when it has one.
+	values map[string]string
+}
+
+// lookupEnv returns the tenant's value of envVar.
+func (e *tenantEnv) lookupEnv(envVar string) (string, bool) {
+	if e.values != nil {
+		value, set := e.values[envVar]
+		return value, set
+	}
+	return os.LookupEnv(e.prefix + envVar)
+}
+
+// tenantToken returns the token in an initialize request's _meta.
+func tenantToken(meta map[string]interface{}) string {
+	token, _ := meta[tenantTokenMeta].(string)
+	return token
+}
+
+// sharedEnvTools are left out for a session bound to a tenant: they read
+// or write the server's own .env, snapshots or audit log, which may hold
+// every tenant's keys.
+var sharedEnvTools = map[string]bool{
+	"snapshot_env":        true,
+	"list_snapshots":      true,
+	"restore_env":         true,
+	"import_env_template": true,
+	"read_audit_log":      true,
+}
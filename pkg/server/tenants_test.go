@@ -0,0 +1,183 @@
+package server_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+// tenantInitializeLine is an initialize request carrying a tenant token.
+func tenantInitializeLine(token string) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":"init","method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"tenant-test","version":"1"},"_meta":{"tenantToken":%q}}}`, token)
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeTenants writes a tenants file for acme, reading ACME_ variables, and
+// globex, reading its own env file, and returns its path.
+func writeTenants(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "globex.env"), []byte("OPENAI_API_KEY=sk-proj-globex0123456789abcdef\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "tenants.json")
+	tenants := fmt.Sprintf(`{"tenants": {
+		"acme": {"token_sha256": %q, "env_prefix": "ACME_"},
+		"globex": {"token_sha256": %q, "env_file": "globex.env"}
+	}}`, tokenHash("acme-token"), tokenHash("globex-token"))
+	if err := os.WriteFile(path, []byte(tenants), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// tenantClient returns a client whose session is bound to the tenant with
+// token.
+func tenantClient(t *testing.T, tenantsPath, token string) *testmcp.Client {
+	t.Helper()
+	c := testmcp.New(server.WithLogger(discardLogger), server.WithTenantsFile(tenantsPath))
+	params := server.InitializeParams{
+		ProtocolVersion: testmcp.ProtocolVersion,
+		ClientInfo:      server.ClientInfo{Name: "tenant-test", Version: "1"},
+		Meta:            map[string]interface{}{"tenantToken": token},
+	}
+	if err := c.Call("initialize", params, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Notify("notifications/initialized", nil); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestTenantSessionsAreIsolated(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-shared0123456789abcdef"})
+	t.Setenv("ACME_OPENAI_API_KEY", "sk-proj-acme0123456789abcdef")
+	tenantsPath := writeTenants(t)
+
+	values := map[string]string{
+		"acme":   "sk-proj-acme0123456789abcdef",
+		"globex": "sk-proj-globex0123456789abcdef",
+	}
+	clients := map[string]*testmcp.Client{}
+	for tenant := range values {
+		clients[tenant] = tenantClient(t, tenantsPath, tenant+"-token")
+	}
+
+	// Both sessions are served at once
+	var wg sync.WaitGroup
+	for tenant, c := range clients {
+		tenant, c := tenant, c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				var seen []string
+				for _, call := range []struct {
+					name string
+					args map[string]interface{}
+				}{
+					{"get_api_key", map[string]interface{}{"key_name": "openai"}},
+					{"check_api_key_exists", map[string]interface{}{"key_name": "openai"}},
+				} {
+					result, err := c.CallTool(call.name, call.args)
+					if err != nil {
+						t.Errorf("%s: %s = %v", tenant, call.name, err)
+						return
+					}
+					seen = append(seen, testmcp.Text(result))
+				}
+				text := strings.Join(seen, "\n")
+				if !strings.Contains(text, values[tenant]) {
+					t.Errorf("%s doesn't get its own key: %s", tenant, text)
+				}
+				for other, value := range values {
+					if other != tenant && strings.Contains(text, value) {
+						t.Errorf("%s reads %s's key", tenant, other)
+					}
+				}
+				if strings.Contains(text, "shared0123456789") {
+					t.Errorf("%s reads the shared environment", tenant)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTenantSessionIsAudited(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-shared0123456789abcdef"})
+	t.Setenv("ACME_OPENAI_API_KEY", "sk-proj-acme0123456789abcdef")
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	stdin := strings.Join([]string{
+		tenantInitializeLine("acme-token"),
+		initializedLine,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"get_api_key","arguments":{"key_name":"openai"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"read_audit_log","arguments":{}}}`,
+	}, "\n") + "\n"
+
+	code, stdout, stderr := execute(t, context.Background(), stdin, "--watch-env=false", "--log-level", "error", "--tenants", writeTenants(t), "--audit-log", auditPath, "--expose-audit-log")
+	if code != 0 {
+		t.Fatalf("Execute = %d, %s", code, stderr)
+	}
+	if !strings.Contains(stdout, `"id":2,"error":{"code":-32601`) {
+		t.Errorf("a tenant session can read the shared audit log: %s", stdout)
+	}
+	entries := auditEntries(t, auditPath)
+	if len(entries) != 1 || entries[0]["tenant"] != "acme" {
+		t.Errorf("audit entries = %v, want one of tenant acme", entries)
+	}
+}
+
+func TestTenantTokenIsRequired(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-shared0123456789abcdef"})
+	tenantsPath := writeTenants(t)
+
+	for _, initialize := range []string{initializeLine, tenantInitializeLine("wrong-token")} {
+		stdin := strings.Join([]string{
+			initialize,
+			initializedLine,
+			`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"get_api_key","arguments":{"key_name":"openai"}}}`,
+		}, "\n") + "\n"
+		_, stdout, _ := execute(t, context.Background(), stdin, "--watch-env=false", "--log-level", "error", "--tenants", tenantsPath)
+		if !strings.Contains(stdout, `"id":"init","error":{"code":-32602`) {
+			t.Errorf("initialize without a valid token = %s, want error -32602", stdout)
+		}
+		if !strings.Contains(stdout, `"id":1,"error":{"code":-32002`) || strings.Contains(stdout, "shared0123456789") {
+			t.Errorf("a session without a tenant was served: %s", stdout)
+		}
+	}
+}
+
+func TestTenantsFileIsChecked(t *testing.T) {
+	dir := t.TempDir()
+	for name, tenants := range map[string]string{
+		"no tenants":         `{"tenants": {}}`,
+		"bad hash":           `{"tenants": {"a": {"token_sha256": "abc", "env_prefix": "A_"}}}`,
+		"prefix and file":    fmt.Sprintf(`{"tenants": {"a": {"token_sha256": %q, "env_prefix": "A_", "env_file": "a.env"}}}`, tokenHash("a")),
+		"lowercase prefix":   fmt.Sprintf(`{"tenants": {"a": {"token_sha256": %q, "env_prefix": "a_"}}}`, tokenHash("a")),
+		"shared token":       fmt.Sprintf(`{"tenants": {"a": {"token_sha256": %q, "env_prefix": "A_"}, "b": {"token_sha256": %q, "env_prefix": "B_"}}}`, tokenHash("a"), tokenHash("a")),
+		"overlapping prefix": fmt.Sprintf(`{"tenants": {"a": {"token_sha256": %q, "env_prefix": "A_"}, "b": {"token_sha256": %q, "env_prefix": "A_B_"}}}`, tokenHash("a"), tokenHash("b")),
+	} {
+		path := filepath.Join(dir, "tenants.json")
+		if err := os.WriteFile(path, []byte(tenants), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if code, _, stderr := execute(t, context.Background(), "", "--watch-env=false", "--tenants", path); code != 1 || !strings.Contains(stderr, "tenants") {
+			t.Errorf("%s: Execute = %d, %s", name, code, stderr)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+// TestStructuredContentMatchesOutputSchema has a long name but no secret.
+func main() {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	placeholder := "sk-your-key-here"
+	fmt.Println(apiKey, placeholder, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaa0")
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// API endpoints check_token_scopes calls.
+var (
+	githubAPIURL = "https://api.github.com"
+	gitlabAPIURL = "https://gitlab.com/api/v4"
+)
+
+// scopeKeys are the keys check_token_scopes can introspect.
+var scopeKeys = []string{"github_token", "gitlab_token"}
+
+// tokenScopes is what a provider says about a token.
+type tokenScopes struct {
+	Valid       bool     `json:"valid"`
+	Scopes      []string `json:"scopes"`
+	FineGrained bool     `json:"fine_grained,omitempty"`
+	Expired     bool     `json:"expired,omitempty"`
+	ExpiresAt   string   `json:"expires_at,omitempty"`
+	// Detail is the provider's reason when the token is invalid.
+	Detail string `json:"detail,omitempty"`
+}
+
+// splitScopes parses a comma-separated scope header such as GitHub's
+// X-OAuth-Scopes.
+func splitScopes(header string) []string {
+	scopes := []string{}
+	for _, scope := range strings.Split(header, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// githubTokenScopes asks GitHub about a token. Classic tokens list their
+// scopes in X-OAuth-Scopes; fine-grained tokens have no such header, as
+// their permissions are per repository.
+func githubTokenScopes(ctx context.Context, token string) (tokenScopes, error) {
+	response, _, err := providerGet(ctx, githubAPIURL+"/user", map[string]string{
+		"Authorization": "Bearer " + token,
+		"Accept":        "application/vnd.github+json",
+	})
+	if err != nil {
+		return tokenScopes{}, err
+	}
+
+	result := tokenScopes{Scopes: []string{}}
+	switch response.StatusCode {
+	case http.StatusOK:
+		result.Valid = true
+	case http.StatusUnauthorized:
+		result.Detail = "GitHub rejected the token: it is invalid, revoked or expired"
+		return result, nil
+	default:
+		return result, fmt.Errorf("GitHub returned %s", response.Status)
+	}
+
+	if header, ok := response.Header["X-Oauth-Scopes"]; ok {
+		result.Scopes = splitScopes(strings.Join(header, ","))
+	} else {
+		result.FineGrained = true
+	}
+	// Sent for tokens with an expiry, as "2026-11-01 00:00:00 UTC"
+	if expiry := response.Header.Get("GitHub-Authentication-Token-Expiration"); expiry != "" {
+		result.ExpiresAt = expiry
+	}
+	return result, nil
+}
+
+// gitlabTokenScopes asks GitLab about a personal access token.
+func gitlabTokenScopes(ctx context.Context, token string) (tokenScopes, error) {
+	response, body, err := providerGet(ctx, gitlabAPIURL+"/personal_access_tokens/self", map[string]string{
+		"PRIVATE-TOKEN": token,
+	})
+	if err != nil {
+		return tokenScopes{}, err
+	}
+
+	result := tokenScopes{Scopes: []string{}}
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		result.Detail = "GitLab rejected the token: it is invalid, revoked or expired"
+		return result, nil
+	default:
+		return result, fmt.Errorf("GitLab returned %s", response.Status)
+	}
+
+	var self struct {
+		Scopes    []string `json:"scopes"`
+		Active    bool     `json:"active"`
+		Revoked   bool     `json:"revoked"`
+		ExpiresAt string   `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &self); err != nil {
+		return result, fmt.Errorf("unexpected response from GitLab: %w", err)
+	}
+	result.Valid = self.Active && !self.Revoked
+	if self.Scopes != nil {
+		result.Scopes = self.Scopes
+	}
+	result.ExpiresAt = self.ExpiresAt
+	if expiry, err := time.Parse("2006-01-02", self.ExpiresAt); err == nil && time.Now().After(expiry.AddDate(0, 0, 1)) {
+		result.Expired = true
+	}
+	switch {
+	case self.Revoked:
+		result.Detail = "the token was revoked"
+	case result.Expired:
+		result.Detail = "the token has expired"
+	case !self.Active:
+		result.Detail = "the token is not active"
+	}
+	return result, nil
+}
+
+func (s *Server) handleCheckTokenScopes(ctx context.Context, args map[string]interface{}) CallToolResult {
+	keyName, ok := args["key_name"].(string)
+	if !ok {
+		return failure(codeValidationFailed, "Error: key_name is required", nil)
+	}
+
+	config, token, exists := s.keys.lookup(keyName)
+	if !exists {
+		return s.keys.unknownKeyFailure(keyName, s.keys.names())
+	}
+	if token == "" {
+		return failure(codeNotConfigured, fmt.Sprintf("Error: API key '%s' is not configured. Please set the %s environment variable.", keyName, config.EnvLabel()), keyDetails(keyName))
+	}
+
+	var result tokenScopes
+	var err error
+	switch keyName {
+	case "github_token":
+		result, err = githubTokenScopes(ctx, token)
+	case "gitlab_token":
+		result, err = gitlabTokenScopes(ctx, token)
+	}
+	if err != nil {
+		return failure(codeBackendUnavailable, fmt.Sprintf("Error: failed to check the scopes of '%s' (%s): %v", keyName, s.keys.maskSecret(token), err), keyDetails(keyName))
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Token '%s' (%s): ", keyName, s.keys.maskSecret(token)))
+	switch {
+	case !result.Valid:
+		text.WriteString(fmt.Sprintf("%s invalid: %s\n", s.markers.status(false), result.Detail))
+	case result.Expired:
+		text.WriteString(fmt.Sprintf("%s expired\n", s.markers.status(false)))
+	default:
+		text.WriteString(fmt.Sprintf("%s valid\n", s.markers.status(true)))
+	}
+	if result.Valid {
+		switch {
+		case result.FineGrained:
+			text.WriteString("Fine-grained token: permissions are set per repository and not listed by the API\n")
+		case len(result.Scopes) == 0:
+			text.WriteString("Scopes: none\n")
+		default:
+			text.WriteString(fmt.Sprintf("Scopes: %s\n", strings.Join(result.Scopes, ", ")))
+		}
+	}
+	if result.ExpiresAt != "" {
+		text.WriteString(fmt.Sprintf("Expires: %s\n", result.ExpiresAt))
+	}
+
+	toolResult := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text.String()}},
+	}
+	if s.supportsStructuredContent() {
+		toolResult.StructuredContent = result
+	}
+	return toolResult
+}
+
+// tokenScopesSchema describes the structured result of check_token_scopes.
+var tokenScopesSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"valid":        {Type: "boolean", Description: "Whether the provider accepts the token"},
+		"scopes":       {Type: "array", Description: "Scopes granted to the token", Items: &Property{Type: "string"}},
+		"fine_grained": {Type: "boolean", Description: "Whether this is a GitHub fine-grained token, whose permissions aren't listed"},
+		"expired":      {Type: "boolean", Description: "Whether the token is past its expiry date"},
+		"expires_at":   {Type: "string", Description: "When the token expires, as reported by the provider"},
+		"detail":       {Type: "string", Description: "Why the token is invalid"},
+	},
+	Required: []string{"valid", "scopes"},
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"path"
+)
+
+// toolFilter decides which tools the registry holds at all. Tools matching
+// a disable pattern are left out; when there are enable patterns, only
+// tools matching one of them are kept. Patterns are tool names or globs
+// such as "*_snapshot". A tool left out is absent from tools/list and
+// unknown to tools/call, exactly like a tool that doesn't exist.
+type toolFilter struct {
+	enable  []string
+	disable []string
+}
+
+// newToolFilter builds a filter, rejecting malformed patterns.
+func newToolFilter(enable, disable []string) (toolFilter, error) {
+	for _, pattern := range append(append([]string{}, enable...), disable...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return toolFilter{}, fmt.Errorf("invalid tool pattern %q: %w", pattern, err)
+		}
+	}
+	return toolFilter{enable: enable, disable: disable}, nil
+}
+
+// allows reports whether the tool name is kept.
+func (f toolFilter) allows(name string) bool {
+	if matchesAny(f.disable, name) {
+		return false
+	}
+	return len(f.enable) == 0 || matchesAny(f.enable, name)
+}
+
+// unmatched returns the patterns that match none of names, which are most
+// likely misspelled.
+func (f toolFilter) unmatched(names []string) []string {
+	var patterns []string
+	for _, pattern := range append(append([]string{}, f.enable...), f.disable...) {
+		matched := false
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// toolState says whether a tool would be offered, for doctor.
+type toolState struct {
+	Name  string
+	State string
+}
+
+// toolStates returns the state of every tool under the server's options:
+// active, left out by the filter, hidden by read-only mode, or off until
+// the server flag its feature needs is given.
+func (s *Server) toolStates() []toolState {
+	var states []toolState
+	for _, entry := range s.tools.all() {
+		state := "active"
+		switch {
+		case !s.tools.filter.allows(entry.Name):
+			state = "left out by --enable-tools or --disable-tools"
+		case entry.revealing && s.readOnly:
+			state = "hidden and refused in read-only mode"
+		case !s.toolOffered(entry):
+			state = "off until the server flag it needs is given"
+		}
+		states = append(states, toolState{Name: entry.Name, State: state})
+	}
+	return states
+}
@@ -0,0 +1,204 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+func TestToolFilterPatterns(t *testing.T) {
+	for _, test := range []struct {
+		enable, disable []string
+		name            string
+		want            bool
+	}{
+		{nil, nil, "get_api_key", true},
+		{[]string{"check_api_key_exists", "list_api_keys"}, nil, "list_api_keys", true},
+		{[]string{"check_api_key_exists", "list_api_keys"}, nil, "get_api_key", false},
+		{[]string{"list_*"}, nil, "list_snapshots", true},
+		{[]string{"list_*"}, nil, "check_api_key_exists", false},
+		{nil, []string{"*_snapshot*"}, "list_snapshots", false},
+		{nil, []string{"*_snapshot*"}, "snapshot_env", true},
+		{nil, []string{"?et_api_key"}, "get_api_key", false},
+		{nil, []string{"get_[a-z]*_key"}, "get_api_key", false},
+		// Patterns match whole names
+		{nil, []string{"get_api"}, "get_api_key", true},
+		{[]string{"GET_API_KEY"}, nil, "get_api_key", false},
+		// Disabling wins over enabling
+		{[]string{"*"}, []string{"get_api_key"}, "get_api_key", false},
+		{[]string{"get_api_key"}, []string{"get_*"}, "get_api_key", false},
+	} {
+		got, err := server.ToolFilterAllows(test.enable, test.disable, test.name)
+		if err != nil || got != test.want {
+			t.Errorf("enable %v, disable %v: allows(%s) = %v, %v; want %v", test.enable, test.disable, test.name, got, err, test.want)
+		}
+	}
+	if _, err := server.ToolFilterAllows([]string{"get_[api"}, nil, "get_api_key"); err == nil || !strings.Contains(err.Error(), `invalid tool pattern "get_[api"`) {
+		t.Errorf("a malformed pattern = %v", err)
+	}
+}
+
+// toolFilterSession runs a session that lists the tools and calls
+// get_api_key, fill_template and check_api_key_exists, and returns its
+// messages.
+func toolFilterSession(t *testing.T, args ...string) []map[string]interface{} {
+	t.Helper()
+	stdin := strings.Join([]string{
+		initializeLine,
+		initializedLine,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}`,
+		getAPIKeyLine(2, ""),
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"fill_template","arguments":{"template":"{{openai}}"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"check_api_key_exists","arguments":{"key_name":"openai"}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"no_such_tool","arguments":{}}}`,
+	}, "\n") + "\n"
+	code, stdout, stderr := execute(t, context.Background(), stdin, append([]string{"--watch-env=false", "--log-level", "error"}, args...)...)
+	if code != 0 {
+		t.Fatalf("Execute %v = %d, %s", args, code, stderr)
+	}
+	if strings.Contains(stdout, "toolfilter0123456789") {
+		t.Errorf("Execute %v revealed the key", args)
+	}
+	var messages []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		var message map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &message); err != nil {
+			t.Fatalf("stdout line %q isn't JSON", line)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// unknownToolError returns the error of a response with the tool's name
+// taken out, so it compares equal to that of any other unknown tool.
+func unknownToolError(t *testing.T, response map[string]interface{}) string {
+	t.Helper()
+	rpcError, _ := response["error"].(map[string]interface{})
+	if rpcError == nil {
+		return ""
+	}
+	data, _ := rpcError["data"].(map[string]interface{})
+	details, _ := data["details"].(map[string]interface{})
+	tool, _ := details["tool"].(string)
+	encoded, _ := json.Marshal(rpcError)
+	return strings.ReplaceAll(string(encoded), tool, "TOOL")
+}
+
+func TestToolFilter(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-toolfilter0123456789"})
+
+	messages := toolFilterSession(t, "--enable-tools", "check_api_key_exists,list_api_keys")
+	tools := toolNamesFrom(t, responseTo(t, messages, float64(1)))
+	if sort.Strings(tools); strings.Join(tools, ",") != "check_api_key_exists,list_api_keys" {
+		t.Errorf("tools/list = %v, want the two enabled tools alone", tools)
+	}
+	// A disabled tool fails exactly like one that doesn't exist
+	unknown := unknownToolError(t, responseTo(t, messages, float64(5)))
+	if !strings.Contains(unknown, "-32601") {
+		t.Fatalf("an unknown tool = %s", unknown)
+	}
+	for _, id := range []float64{2, 3} {
+		if got := unknownToolError(t, responseTo(t, messages, id)); got != unknown {
+			t.Errorf("call %v of a disabled tool = %s, want %s", id, got, unknown)
+		}
+	}
+	if result, _ := responseTo(t, messages, float64(4))["result"].(map[string]interface{}); result == nil || result["isError"] == true {
+		t.Errorf("check_api_key_exists = %v", responseTo(t, messages, float64(4)))
+	}
+}
+
+func TestToolFilterWithReadOnlyMode(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-toolfilter0123456789"})
+
+	// get_api_key is disabled, fill_template only hidden by read-only mode
+	messages := toolFilterSession(t, "--read-only", "--disable-tools", "get_*")
+	tools := toolNamesFrom(t, responseTo(t, messages, float64(1)))
+	for _, name := range []string{"get_api_key", "fill_template", "generate_k8s_secret"} {
+		if contains(tools, name) {
+			t.Errorf("%s is listed", name)
+		}
+	}
+	if !contains(tools, "check_api_key_exists") {
+		t.Errorf("tools/list = %v", tools)
+	}
+	if got, unknown := unknownToolError(t, responseTo(t, messages, float64(2))), unknownToolError(t, responseTo(t, messages, float64(5))); got == "" || got != unknown {
+		t.Errorf("a disabled tool in read-only mode = %s, want %s", got, unknown)
+	}
+	result, _ := responseTo(t, messages, float64(3))["result"].(map[string]interface{})
+	if content, _ := json.Marshal(result["content"]); result["isError"] != true || !strings.Contains(string(content), "read-only mode") {
+		t.Errorf("fill_template in read-only mode = %v, want it refused by the mode", responseTo(t, messages, float64(3)))
+	}
+
+	// Enabling a revealing tool doesn't get it past read-only mode
+	messages = toolFilterSession(t, "--read-only", "--enable-tools", "get_api_key,check_api_key_exists")
+	if tools := toolNamesFrom(t, responseTo(t, messages, float64(1))); strings.Join(tools, ",") != "check_api_key_exists" {
+		t.Errorf("tools/list = %v, want check_api_key_exists alone", tools)
+	}
+	result, _ = responseTo(t, messages, float64(2))["result"].(map[string]interface{})
+	if content, _ := json.Marshal(result["content"]); result["isError"] != true || !strings.Contains(string(content), "read-only mode") {
+		t.Errorf("an enabled get_api_key in read-only mode = %v", responseTo(t, messages, float64(2)))
+	}
+}
+
+func TestToolFilterAppliesToRegisteredTools(t *testing.T) {
+	c := testmcp.New(server.WithLogger(discardLogger), server.WithToolFilter(nil, []string{"deploy_*"}))
+	handler := func(ctx context.Context, args map[string]interface{}) server.CallToolResult {
+		return server.CallToolResult{Content: []server.ContentBlock{{Type: "text", Text: "done"}}}
+	}
+	for _, name := range []string{"deploy_preview", "ping_internal"} {
+		if err := c.Server.RegisterTool(server.Tool{Name: name, Description: "Test tool"}, handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A filtered-out name is still taken
+	if err := c.Server.RegisterTool(server.Tool{Name: "deploy_preview", Description: "Again"}, handler); err == nil {
+		t.Error("a second deploy_preview was registered")
+	}
+	if _, err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	tools, err := c.ListTools()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	if contains(names, "deploy_preview") || !contains(names, "ping_internal") {
+		t.Errorf("tools/list = %v, want ping_internal without deploy_preview", names)
+	}
+	var rpcError *testmcp.RPCError
+	if _, err := c.CallTool("deploy_preview", nil); !errors.As(err, &rpcError) || rpcError.Code != -32601 {
+		t.Errorf("deploy_preview = %v, want error -32601", err)
+	}
+	if result, err := c.CallTool("ping_internal", nil); err != nil || testmcp.Text(result) != "done" {
+		t.Errorf("ping_internal = %q, %v", testmcp.Text(result), err)
+	}
+}
+
+func TestDoctorListsTools(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-toolfilter0123456789"})
+	_, stdout, _ := execute(t, context.Background(), "", "doctor", "--read-only", "--disable-tools", "list_snapshots,no_such_*")
+	for _, want := range []string{
+		"check_api_key_exists           active",
+		"get_api_key                    hidden and refused in read-only mode",
+		"list_snapshots                 left out by --enable-tools or --disable-tools",
+		`[warning] Tool pattern "no_such_*" matches no tool`,
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("doctor lacks %q:\n%s", want, stdout)
+		}
+	}
+	if code, _, stderr := execute(t, context.Background(), "", "--watch-env=false", "--enable-tools", "get_[api"); code != 1 || !strings.Contains(stderr, "invalid tool filter") {
+		t.Errorf("a malformed pattern = %d, %s", code, stderr)
+	}
+}
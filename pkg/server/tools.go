@@ -0,0 +1,1331 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HandlerFunc handles a call to a tool. args have already been checked
+// against the tool's input schema. The context is cancelled when the client
+// cancels the request or it times out.
+type HandlerFunc func(ctx context.Context, args map[string]interface{}) CallToolResult
+
+// toolEntry is a tool in the registry: its definition, the handler that
+// answers calls to it, and when it is offered.
+type toolEntry struct {
+	Tool
+	handler HandlerFunc
+	// backend names what the tool may wait on, for timeout errors.
+	backend string
+	// revealing tools return key values, which read-only mode disables.
+	revealing bool
+	// enabled reports whether the optional feature the tool depends on is
+	// switched on; nil means the tool is always offered.
+	enabled func() bool
+}
+
+// ToolRegistry holds every tool a server offers, each registered once with
+// its definition and handler: tools/list is generated from it and
+// tools/call dispatches through it. The built-in tools' schemas name the
+// keys registered at the time they are built, so they are rebuilt, and
+// cached tools/list pages dropped, whenever keys or tools are added; tools
+// added with Register follow them. Tools the filter leaves out are dropped
+// as the registry is built, so the rest of the server never sees them.
+type ToolRegistry struct {
+	builtin    func() []toolEntry
+	registered []toolEntry
+	// keys is the key registry the built-in tools' schemas are built from.
+	keys *keyRegistry
+
+	mu sync.Mutex
+	// filter is set from --enable-tools and --disable-tools.
+	filter toolFilter
+	// version counts calls to Register and setFilter.
+	version uint64
+	// built is the keys' version and version cached and lists were built at.
+	built  [2]uint64
+	cached []toolEntry
+	lists  map[toolsListKey]json.RawMessage
+}
+
+// toolsListKey identifies a tools/list page: the client's capabilities
+// decide which fields it gets, and its access to keys whether the revealing
+// tools are in it.
+type toolsListKey struct {
+	structured, annotated, revealing bool
+	cursor                           string
+}
+
+// Register adds a tool. Its name must not clash with any other tool's,
+// including those the filter leaves out. A tool the filter leaves out is
+// accepted but never offered.
+func (r *ToolRegistry) Register(tool Tool, handler HandlerFunc) error {
+	if tool.Name == "" {
+		return errors.New("tool needs a name")
+	}
+	if handler == nil {
+		return fmt.Errorf("tool %s: handler is nil", tool.Name)
+	}
+	if tool.InputSchema.Type == "" {
+		tool.InputSchema.Type = "object"
+	}
+	for _, name := range r.names() {
+		if name == tool.Name {
+			return fmt.Errorf("tool %s: a tool with that name already exists", tool.Name)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registered = append(r.registered, toolEntry{Tool: tool, handler: handler, backend: "its handler"})
+	r.version++
+	return nil
+}
+
+// setFilter replaces the filter deciding which tools the registry holds.
+func (r *ToolRegistry) setFilter(filter toolFilter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.filter = filter
+	r.version++
+}
+
+// all returns every tool, including those the filter leaves out.
+func (r *ToolRegistry) all() []toolEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append(r.builtin(), r.registered...)
+}
+
+// names returns the name of every tool, including those the filter leaves
+// out.
+func (r *ToolRegistry) names() []string {
+	entries := r.all()
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name
+	}
+	return names
+}
+
+// refresh rebuilds the cached tools if keys or tools were added since they
+// were built. r.mu must be held.
+func (r *ToolRegistry) refresh() {
+	current := [2]uint64{r.keys.version.Load(), r.version}
+	if r.cached != nil && r.built == current {
+		return
+	}
+	r.cached = []toolEntry{}
+	for _, entry := range append(r.builtin(), r.registered...) {
+		if r.filter.allows(entry.Name) {
+			r.cached = append(r.cached, entry)
+		}
+	}
+	r.lists = map[toolsListKey]json.RawMessage{}
+	r.built = current
+}
+
+// entries returns every tool the filter keeps, offered or not, in listing
+// order. The entries are shared: callers must copy before changing them.
+func (r *ToolRegistry) entries() []toolEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refresh()
+	return r.cached[:len(r.cached):len(r.cached)]
+}
+
+// list returns the marshaled tools/list page for key, building it with
+// build the first time it is asked for since the tools last changed.
+func (r *ToolRegistry) list(key toolsListKey, build func() (interface{}, error)) (json.RawMessage, error) {
+	r.mu.Lock()
+	r.refresh()
+	page, ok := r.lists[key]
+	built := r.built
+	r.mu.Unlock()
+	if ok {
+		return page, nil
+	}
+
+	result, err := build()
+	if err != nil {
+		return nil, err
+	}
+	if page, err = json.Marshal(result); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Keys or tools may have been added while building; only keep a page
+	// that is still current.
+	if r.built == built {
+		r.lists[key] = page
+	}
+	return page, nil
+}
+
+// lookup returns the named tool, offered or not, if the filter keeps it.
+func (r *ToolRegistry) lookup(name string) (toolEntry, bool) {
+	for _, entry := range r.entries() {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+	return toolEntry{}, false
+}
+
+// toolOffered reports whether a tool is offered with the server's current
+// options; tools that depend on an optional feature are hidden without it,
+// and tools that reveal values from clients the policy lets reveal nothing.
+func (s *Server) toolOffered(entry toolEntry) bool {
+	if entry.revealing && (s.readOnly || !s.mayRevealAny()) {
+		return false
+	}
+	if sharedEnvTools[entry.Name] && s.keys.tenantName() != "" {
+		return false
+	}
+	return entry.enabled == nil || entry.enabled()
+}
+
+// availableTools returns the tools this server offers, with all optional
+// fields filled in; handleToolsList strips what the client can't use.
+func (s *Server) availableTools() []toolEntry {
+	var tools []toolEntry
+	for _, entry := range s.tools.entries() {
+		if !s.toolOffered(entry) {
+			continue
+		}
+		if s.upstream != nil && s.keys.tenantName() == "" && upstreamTools[entry.Name] {
+			// The upstream server may know names this one doesn't. The
+			// entries are shared, so change a copy of the properties.
+			properties := make(map[string]Property, len(entry.InputSchema.Properties))
+			for name, property := range entry.InputSchema.Properties {
+				properties[name] = property
+			}
+			keyName := properties["key_name"]
+			keyName.Enum = nil
+			properties["key_name"] = keyName
+			entry.InputSchema.Properties = properties
+		}
+		tools = append(tools, entry)
+	}
+	return tools
+}
+
+// findTool returns the named tool, if it is offered.
+func (s *Server) findTool(name string) (toolEntry, bool) {
+	for _, entry := range s.availableTools() {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+	return toolEntry{}, false
+}
+
+// toolMiddleware wraps a tool's handler with behaviour every tool shares.
+type toolMiddleware func(s *Server, tool Tool, next HandlerFunc) HandlerFunc
+
+// toolMiddlewares are applied to every tool call, outermost first.
+var toolMiddlewares = []toolMiddleware{
+	resolveKeyArguments,
+	validateToolArguments,
+	observeToolCall,
+	auditToolCall,
+	checkKeyPolicy,
+	scrubToolErrors,
+	reportToolTimeout,
+	recoverToolPanic,
+}
+
+// toolChain returns the tool's handler wrapped in every middleware.
+func (s *Server) toolChain(entry toolEntry) HandlerFunc {
+	handler := entry.handler
+	for i := len(toolMiddlewares) - 1; i >= 0; i-- {
+		handler = toolMiddlewares[i](s, entry.Tool, handler)
+	}
+	return handler
+}
+
+// validateToolArguments refuses arguments that don't match the tool's
+// input schema, and warns about arguments it ignores.
+func validateToolArguments(s *Server, tool Tool, next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, args map[string]interface{}) CallToolResult {
+		problems, unknown := validateArguments(tool.InputSchema, args)
+		if len(problems) > 0 {
+			return failure(codeValidationFailed, "Error: invalid arguments:\n- "+strings.Join(problems, "\n- "), map[string]interface{}{"problems": problems})
+		}
+		result := next(ctx, args)
+		if len(unknown) > 0 {
+			result.Content = append(result.Content, ContentBlock{
+				Type: "text",
+				Text: fmt.Sprintf("Warning: ignored unknown arguments: %s", strings.Join(unknown, ", ")),
+			})
+		}
+		return result
+	}
+}
+
+// observeToolCall records the call's duration and outcome in the metrics
+// and the request's span.
+func observeToolCall(s *Server, tool Tool, next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, args map[string]interface{}) CallToolResult {
+		started := time.Now()
+		result := next(ctx, args)
+		s.metrics.observeTool(tool.Name, time.Since(started), result.IsError)
+		if result.IsError {
+			spanFromContext(ctx).fail("tool returned an error")
+		}
+		return result
+	}
+}
+
+// scrubToolErrors redacts key values from error results, whose text may
+// embed what a backend said, and from the message of their structured
+// failure.
+func scrubToolErrors(s *Server, tool Tool, next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, args map[string]interface{}) CallToolResult {
+		result := next(ctx, args)
+		if result.IsError {
+			for i := range result.Content {
+				result.Content[i].Text = s.keys.secrets.scrub(result.Content[i].Text)
+			}
+			if structured, ok := result.StructuredContent.(map[string]interface{}); ok {
+				if failure, ok := structured["error"].(toolFailure); ok {
+					failure.Message = s.keys.secrets.scrub(failure.Message)
+					structured["error"] = failure
+				}
+			}
+		}
+		return result
+	}
+}
+
+// reportToolTimeout replaces the result of a call that ran out of time
+// with an error naming what it was waiting on.
+func reportToolTimeout(s *Server, tool Tool, next HandlerFunc) HandlerFunc {
+	backend := "its handler"
+	if entry, ok := s.tools.lookup(tool.Name); ok {
+		backend = entry.backend
+	}
+	return func(ctx context.Context, args map[string]interface{}) CallToolResult {
+		result := next(ctx, args)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return failure(codeTimeout, fmt.Sprintf("Error: %s timed out after %s waiting for %s", tool.Name, s.requestTimeout, backend), nil)
+		}
+		return result
+	}
+}
+
+// recoverToolPanic stops a panic in a handler, so one bad call can't take
+// down the session. The result is an error for the middlewares around it to
+// observe and audit, and is answered with an internal JSON-RPC error.
+func recoverToolPanic(s *Server, tool Tool, next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, args map[string]interface{}) (result CallToolResult) {
+		defer func() {
+			if r := recover(); r != nil {
+				s.logger.Error("panic in tool", "tool", tool.Name, "panic", r, "stack", string(debug.Stack()))
+				result = failure(codeInternal, fmt.Sprintf("Error: %s failed with an internal error", tool.Name), nil)
+				result.panicked = s.panicSummary(r)
+			}
+		}()
+		return next(ctx, args)
+	}
+}
+
+// builtinTools returns the tools the server always registers.
+func (s *Server) builtinTools() []toolEntry {
+	// Sorted so the schemas are identical on every call and clients caching
+	// them don't see spurious changes
+	keyNames := s.keys.names()
+
+	network := func() bool { return s.allowNetwork }
+	snapshots := func() bool { return s.snapshotDir != "" }
+	snapshotRestores := func() bool { return s.snapshotDir != "" && s.allowWrites }
+	auditLogExposed := func() bool { return s.auditLog != nil && s.exposeAuditLog }
+
+	return []toolEntry{
+		{
+			Tool: Tool{
+				Name:        "get_api_key",
+				Description: "Retrieve an API key by its name. Returns the API key value from environment variables.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"key_name": {
+							Type:        "string",
+							Description: "The name of the API key to retrieve (e.g., 'openai', 'stripe', 'canva_client_id')",
+							Enum:        keyNames,
+						},
+						"confirm_live": {
+							Type:        "boolean",
+							Description: "Set to true to fetch a production (live) value when the server blocks live reveals. Only do this when the user wants the live key.",
+						},
+						"lease_minutes": {
+							Type:        "integer",
+							Description: fmt.Sprintf("Only use the value for this many minutes (1 to %d). The server records a lease, listed by active_leases, and says when the value should be treated as stale.", maxLeaseMinutes),
+						},
+						"read_contents": {
+							Type:        "boolean",
+							Description: fmt.Sprintf("For keys that hold the path of a credential file, such as gcp_credentials, return the file's contents (at most %d KiB) instead of its path", maxKeyFileSize>>10),
+						},
+						"transform": {
+							Type:        "string",
+							Description: fmt.Sprintf("Return the value in a derived form: %s. basic_auth:<username_key> returns an Authorization header value from another key as the username and this key as the password, such as basic_auth:twilio_sid for twilio_token. Defaults to raw.", strings.Join(valueTransforms, ", ")),
+						},
+						"justification": {
+							Type:        "string",
+							Description: "Break glass: why the user needs a key the access policy denies, right now. Only accepted when the server allows break-glass reveals; every one is audited and reported. Never set this without the user asking.",
+						},
+					},
+					Required: []string{"key_name"},
+				},
+				// Not marked read-only: revealing a secret should still
+				// prompt the user in clients that auto-approve read-only tools.
+				Annotations: &ToolAnnotations{
+					Title:         "Get API Key",
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler:   s.handleGetAPIKey,
+			backend:   "the user to answer the confirmation prompt",
+			revealing: true,
+		},
+		{
+			Tool: Tool{
+				Name:        "active_leases",
+				Description: "List the outstanding reveal leases from get_api_key calls with lease_minutes: which key, when it was revealed and when the lease ends. Never includes values.",
+				InputSchema: InputSchema{
+					Type:       "object",
+					Properties: map[string]Property{},
+					Required:   []string{},
+				},
+				OutputSchema: &leaseSchema,
+				Annotations: &ToolAnnotations{
+					Title:         "Active Leases",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleActiveLeases,
+			backend: "the server itself",
+		},
+		{
+			Tool: Tool{
+				Name:        "revoke_lease",
+				Description: "End a reveal lease early, once the value is no longer needed. The value it covered should be treated as stale from then on.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"lease_id": {
+							Type:        "string",
+							Description: "The lease to end, as returned by get_api_key or active_leases",
+						},
+					},
+					Required: []string{"lease_id"},
+				},
+				Annotations: &ToolAnnotations{
+					Title:           "Revoke Lease",
+					ReadOnlyHint:    boolPtr(false),
+					DestructiveHint: boolPtr(false),
+					OpenWorldHint:   boolPtr(false),
+				},
+			},
+			handler: s.handleRevokeLease,
+			backend: "the server itself",
+		},
+		{
+			Tool: Tool{
+				Name:        "list_api_keys",
+				Description: "List all available API key names and their descriptions. Does not return actual key values.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"category": {
+							Type:        "string",
+							Description: "Filter by category: 'llm', 'saas', 'canva', 'vcs', 'internal', or 'all'",
+							Enum:        categoryNames,
+						},
+						"format": {
+							Type:        "string",
+							Description: "Output format: 'text' (default) for a readable list, or 'json' for an array of key objects (an object with the page's keys and total, has_more and next_offset when offset or limit is given)",
+							Enum:        listFormats,
+						},
+						"configured_only": {
+							Type:        "boolean",
+							Description: "List only keys that have a value",
+						},
+						"missing_only": {
+							Type:        "boolean",
+							Description: "List only keys that have no value",
+						},
+						"offset": {
+							Type:        "integer",
+							Description: "Number of matching keys to skip (default 0)",
+						},
+						"limit": {
+							Type:        "integer",
+							Description: "Maximum number of keys to return (default: all)",
+						},
+					},
+					Required: []string{},
+				},
+				OutputSchema: &InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"keys": {
+							Type:        "array",
+							Description: "The page of matching API keys, sorted by name",
+							Items:       &keyStatusSchema,
+						},
+						"total":       {Type: "integer", Description: "Number of keys matching the category and filters, across all pages"},
+						"offset":      {Type: "integer", Description: "Position of the first key of this page among the matching keys"},
+						"has_more":    {Type: "boolean", Description: "Whether more keys follow this page"},
+						"next_offset": {Type: "integer", Description: "Offset of the next page, when has_more is set"},
+					},
+					Required: []string{"keys", "total", "offset", "has_more"},
+				},
+				Annotations: &ToolAnnotations{
+					Title:         "List API Keys",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleListAPIKeys,
+			backend: "the environment",
+		},
+		{
+			Tool: Tool{
+				Name:        "check_api_key_exists",
+				Description: "Check if an API key is configured (has a value set) without revealing the key itself.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"key_name": {
+							Type:        "string",
+							Description: "The name of the API key to check",
+							Enum:        keyNames,
+						},
+					},
+					Required: []string{"key_name"},
+				},
+				Annotations: &ToolAnnotations{
+					Title:         "Check API Key",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleCheckAPIKeyExists,
+			backend: "the environment",
+		},
+		{
+			Tool: Tool{
+				Name:        "fill_template",
+				Description: "Fill {{key_name}} and ${ENV_VAR} placeholders in a template, such as a config file, with API key values in one call. ${ENV_VAR} may name a key's variable or one of its aliases, such as GH_TOKEN. Placeholders that can't be filled (unknown, missing, restricted or blocked by policy) are left as they are and listed.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"template": {
+							Type:        "string",
+							Description: fmt.Sprintf("The text to fill in, at most %d bytes", maxTemplateSize),
+						},
+						"escape": {
+							Type:        "string",
+							Description: "Escape values for where they appear: 'none' (default), 'json' or 'yaml' for inside a double-quoted string, or 'shell' to single-quote them",
+							Enum:        templateEscapes,
+						},
+					},
+					Required: []string{"template"},
+				},
+				// Like get_api_key, this reveals values
+				Annotations: &ToolAnnotations{
+					Title:         "Fill Template",
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler:   s.handleFillTemplate,
+			backend:   "the environment",
+			revealing: true,
+		},
+		{
+			Tool: Tool{
+				Name:        "generate_k8s_secret",
+				Description: "Generate a Kubernetes v1 Secret manifest holding API key values keyed by env var name, for the given keys or a category. Keys that are missing, restricted or blocked by policy are listed in a trailing comment instead.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"keys": {
+							Type:        "array",
+							Description: "Names of the API keys to include; overrides category",
+							Items:       &Property{Type: "string", Enum: keyNames},
+						},
+						"category": {
+							Type:        "string",
+							Description: "Include every key in this category when keys isn't given (default 'all')",
+							Enum:        categoryNames,
+						},
+						"name": {
+							Type:        "string",
+							Description: "Name of the Secret (default 'api-keys')",
+						},
+						"namespace": {
+							Type:        "string",
+							Description: "Namespace of the Secret (default 'default')",
+						},
+						"string_data": {
+							Type:        "boolean",
+							Description: "Write plain values under stringData instead of base64 under data",
+						},
+						"deployment_snippet": {
+							Type:        "boolean",
+							Description: "Also return the envFrom snippet that loads the Secret into a Deployment's container",
+						},
+					},
+					Required: []string{},
+				},
+				// Like get_api_key, this reveals values
+				Annotations: &ToolAnnotations{
+					Title:         "Generate Kubernetes Secret",
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler:   s.handleGenerateK8sSecret,
+			backend:   "the environment",
+			revealing: true,
+		},
+		{
+			Tool: Tool{
+				Name:        "generate_compose_env",
+				Description: "Generate the docker-compose service block that passes API keys to a container, as an environment block of ${ENV_VAR} references or an env_file reference, plus the matching .env file. With include_values, real values are filled in where the reveal policy allows.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"keys": {
+							Type:        "array",
+							Description: "Names of the API keys to include; overrides category",
+							Items:       &Property{Type: "string", Enum: keyNames},
+						},
+						"category": {
+							Type:        "string",
+							Description: "Include every key in this category when keys isn't given (default 'all')",
+							Enum:        categoryNames,
+						},
+						"format": {
+							Type:        "string",
+							Description: "'environment' (default) to list the variables in the service, or 'env_file' to load them from .env",
+							Enum:        composeFormats,
+						},
+						"service": {
+							Type:        "string",
+							Description: "Name of the Compose service (default 'app')",
+						},
+						"include_values": {
+							Type:        "boolean",
+							Description: "Fill in real values instead of ${ENV_VAR} references and empty .env entries",
+						},
+						"dotenv": {
+							Type:        "boolean",
+							Description: "Also return the matching .env file content (always included for env_file)",
+						},
+					},
+					Required: []string{},
+				},
+				// Not read-only: with include_values it reveals values
+				Annotations: &ToolAnnotations{
+					Title:         "Generate Compose Environment",
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleGenerateComposeEnv,
+			backend: "the environment",
+		},
+		{
+			Tool: Tool{
+				Name:        "generate_gh_secrets_commands",
+				Description: "Generate the gh secret set commands that copy API keys into a GitHub repository's secrets, plus the workflow snippet that reads them. Commands read values from the shell unless include_values is set. With execute, and the server started with --allow-exec, runs gh itself and reports each key.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"keys": {
+							Type:        "array",
+							Description: "Names of the API keys to include; overrides category",
+							Items:       &Property{Type: "string", Enum: keyNames},
+						},
+						"category": {
+							Type:        "string",
+							Description: "Include every key in this category when keys isn't given (default 'all')",
+							Enum:        categoryNames,
+						},
+						"app": {
+							Type:        "string",
+							Description: "Secret store to write to (default 'actions')",
+							Enum:        ghSecretApps,
+						},
+						"repo": {
+							Type:        "string",
+							Description: "Repository as owner/name (default: the repository gh finds in the working directory)",
+						},
+						"environment": {
+							Type:        "string",
+							Description: "Deployment environment to set the secrets in instead of the repository",
+						},
+						"include_values": {
+							Type:        "boolean",
+							Description: "Put the values in the commands instead of reading them from the shell",
+						},
+						"execute": {
+							Type:        "boolean",
+							Description: "Run the commands with the gh CLI; needs the server to be started with --allow-exec",
+						},
+					},
+					Required: []string{},
+				},
+				// Not read-only: it can reveal values and write to GitHub
+				Annotations: &ToolAnnotations{
+					Title:         "Generate GitHub Secrets Commands",
+					OpenWorldHint: boolPtr(true),
+				},
+			},
+			handler: s.handleGenerateGhSecretsCommands,
+			backend: "the gh CLI",
+		},
+		{
+			Tool: Tool{
+				Name:        "check_token_scopes",
+				Description: "Ask GitHub or GitLab which scopes the configured token has, and whether it is valid, expired or fine-grained. Never reveals the token.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"key_name": {
+							Type:        "string",
+							Description: "The token to check",
+							Enum:        scopeKeys,
+						},
+					},
+					Required: []string{"key_name"},
+				},
+				OutputSchema: &tokenScopesSchema,
+				Annotations: &ToolAnnotations{
+					Title:         "Check Token Scopes",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(true),
+				},
+			},
+			handler: s.handleCheckTokenScopes,
+			backend: "the provider's API",
+			enabled: network,
+		},
+		{
+			Tool: Tool{
+				Name:        "validate_api_key_live",
+				Description: "Check keys against their provider's API to tell live keys from revoked or malformed ones, reporting what the provider says about them (for Slack, the team and bot user). Never reveals the keys.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"key_name": {
+							Type:        "string",
+							Description: "The key to check",
+							Enum:        s.keys.liveValidatedKeys(),
+						},
+						"all": {
+							Type:        "boolean",
+							Description: "Check every configured key that can be checked live",
+						},
+					},
+					Required: []string{},
+				},
+				OutputSchema: &liveResultsSchema,
+				Annotations: &ToolAnnotations{
+					Title:         "Validate API Key Live",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(true),
+				},
+			},
+			handler: s.handleValidateAPIKeyLive,
+			backend: "the provider's API",
+			enabled: network,
+		},
+		{
+			Tool: Tool{
+				Name:        "provider_usage",
+				Description: "Look up what OpenAI or Anthropic reports about a key before a large job: its organization and rate-limit headers and, for admin keys, the organization's spend this month. Other key types get a note that usage isn't available to them. Never reveals the key.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"key_name": {
+							Type:        "string",
+							Description: "The key to look up usage for",
+							Enum:        usageKeys(),
+						},
+					},
+					Required: []string{"key_name"},
+				},
+				OutputSchema: &providerUsageSchema,
+				Annotations: &ToolAnnotations{
+					Title:         "Provider Usage",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(true),
+				},
+			},
+			handler: s.handleProviderUsage,
+			backend: "the provider's API",
+			enabled: network,
+		},
+		{
+			Tool: Tool{
+				Name:        "validate_aws_credentials",
+				Description: "Check the configured AWS access key, secret key and optional session token by calling sts:GetCallerIdentity, returning the account ID, ARN and user ID, or why AWS rejected them (invalid key, invalid secret, expired token, clock skew). Never reveals the credentials.",
+				InputSchema: InputSchema{
+					Type:       "object",
+					Properties: map[string]Property{},
+					Required:   []string{},
+				},
+				OutputSchema: &awsIdentitySchema,
+				Annotations: &ToolAnnotations{
+					Title:         "Validate AWS Credentials",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(true),
+				},
+			},
+			handler: s.handleValidateAWSCredentials,
+			backend: "AWS STS",
+			enabled: network,
+		},
+		{
+			Tool: Tool{
+				Name:        "check_database_connection",
+				Description: "Check that the database in a connection URL (postgres, mysql, sqlserver or mongodb) accepts TCP connections, reporting reachable or unreachable, the latency and the host:port. Never returns the URL or its credentials.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"key_name": {
+							Type:        "string",
+							Description: "The key holding the connection URL (default 'database_url')",
+							Enum:        keyNames,
+						},
+					},
+					Required: []string{},
+				},
+				OutputSchema: &connectionResultSchema,
+				Annotations: &ToolAnnotations{
+					Title:         "Check Database Connection",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(true),
+				},
+			},
+			handler: s.handleCheckDatabaseConnection,
+			backend: "the database",
+			enabled: network,
+		},
+		{
+			Tool: Tool{
+				Name:        "check_redis_connection",
+				Description: "Check that the Redis server in a redis:// or rediss:// URL is reachable and, unless ping is false, answers PING after authenticating. Reports the latency and host:port, never the URL or its credentials.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"key_name": {
+							Type:        "string",
+							Description: "The key holding the Redis URL (default 'redis_url')",
+							Enum:        keyNames,
+						},
+						"ping": {
+							Type:        "boolean",
+							Description: "Authenticate and send PING after connecting (default true)",
+						},
+					},
+					Required: []string{},
+				},
+				OutputSchema: &connectionResultSchema,
+				Annotations: &ToolAnnotations{
+					Title:         "Check Redis Connection",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(true),
+				},
+			},
+			handler: s.handleCheckRedisConnection,
+			backend: "the Redis server",
+			enabled: network,
+		},
+		{
+			Tool: Tool{
+				Name:        "key_fingerprint",
+				Description: "Return the SHA-256 fingerprint, length and a masked preview of an API key, to compare keys across environments without revealing them.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"key_name": {
+							Type:        "string",
+							Description: "The name of the API key to fingerprint",
+							Enum:        keyNames,
+						},
+						"full": {
+							Type:        "boolean",
+							Description: fmt.Sprintf("Return the full 64-character hash instead of the first %d characters", shortFingerprintLength),
+						},
+					},
+					Required: []string{"key_name"},
+				},
+				Annotations: &ToolAnnotations{
+					Title:         "Fingerprint API Key",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleKeyFingerprint,
+			backend: "the environment",
+		},
+		{
+			Tool: Tool{
+				Name:        "how_to_obtain_key",
+				Description: "Explain how to get an API key that is missing: the console page that creates it, what the value looks like, free-tier notes and the scopes it needs. Never returns values.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"key_name": {
+							Type:        "string",
+							Description: "The name of the API key to explain",
+							Enum:        keyNames,
+						},
+					},
+					Required: []string{"key_name"},
+				},
+				OutputSchema: &keyGuideSchema,
+				Annotations: &ToolAnnotations{
+					Title:         "How to Obtain a Key",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleHowToObtainKey,
+			backend: "the environment",
+		},
+		{
+			Tool: Tool{
+				Name:        "redact_text",
+				Description: "Replace every configured API key value in the given text, including URL-encoded and base64 forms, with [REDACTED:<key_name>]. Use it to sanitize logs or generated files before showing them. Reports how many replacements were made per key, never the values.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"text": {
+							Type:        "string",
+							Description: "The text to sanitize",
+						},
+					},
+					Required: []string{"text"},
+				},
+				OutputSchema: &redactTextSchema,
+				Annotations: &ToolAnnotations{
+					Title:         "Redact Text",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleRedactText,
+			backend: "the environment",
+		},
+		{
+			Tool: Tool{
+				Name:        "scan_text_for_secrets",
+				Description: "Look for strings that look like API keys in the given text, such as a diff or a generated config file: known provider formats (sk-, AKIA, SG., ghp_ and others), configured key values, and long random-looking tokens. Reports each finding's provider, position and a masked excerpt.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"text": {
+							Type:        "string",
+							Description: "The text to scan",
+						},
+					},
+					Required: []string{"text"},
+				},
+				OutputSchema: &secretFindingsSchema,
+				Annotations: &ToolAnnotations{
+					Title:         "Scan Text for Secrets",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleScanTextForSecrets,
+			backend: "the environment",
+		},
+		{
+			Tool: Tool{
+				Name:        "verify_webhook_signature",
+				Description: "Check a webhook's signature against the configured signing secret: Stripe's t=/v1= header with a timestamp tolerance, GitHub's sha256= header, or Slack's v0= signature with its request timestamp. Reports valid or why not (signature mismatch, timestamp too old). Comparisons are constant-time and the secret is never returned.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"provider": {
+							Type:        "string",
+							Description: "Who sent the webhook",
+							Enum:        webhookProviderNames,
+						},
+						"payload": {
+							Type:        "string",
+							Description: "The raw request body, exactly as received",
+						},
+						"signature": {
+							Type:        "string",
+							Description: "The signature header value: Stripe-Signature, X-Hub-Signature-256 or X-Slack-Signature",
+						},
+						"timestamp": {
+							Type:        "string",
+							Description: "For Slack, the X-Slack-Request-Timestamp header",
+						},
+						"tolerance_seconds": {
+							Type:        "number",
+							Description: "How old a Stripe or Slack timestamp may be (default 300)",
+						},
+					},
+					Required: []string{"provider", "payload", "signature"},
+				},
+				OutputSchema: &webhookVerificationSchema,
+				Annotations: &ToolAnnotations{
+					Title:         "Verify Webhook Signature",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleVerifyWebhookSignature,
+			backend: "the environment",
+		},
+		{
+			Tool: Tool{
+				Name:        "compute_webhook_signature",
+				Description: "Sign a payload the way Stripe, GitHub or Slack would with the configured signing secret, returning the signature headers for a test fixture. The secret is never returned.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"provider": {
+							Type:        "string",
+							Description: "Whose signature scheme to use",
+							Enum:        webhookProviderNames,
+						},
+						"payload": {
+							Type:        "string",
+							Description: "The request body to sign",
+						},
+						"timestamp": {
+							Type:        "integer",
+							Description: "Unix time to sign for Stripe and Slack (default now)",
+						},
+					},
+					Required: []string{"provider", "payload"},
+				},
+				Annotations: &ToolAnnotations{
+					Title:         "Compute Webhook Signature",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleComputeWebhookSignature,
+			backend: "the environment",
+		},
+		{
+			Tool: Tool{
+				Name:        "mint_test_jwt",
+				Description: "Sign a short-lived HS256 JWT with the configured jwt_secret, for testing an API that checks tokens. The secret itself is never returned.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"subject": {
+							Type:        "string",
+							Description: "The sub claim",
+						},
+						"expiry_minutes": {
+							Type:        "number",
+							Description: "Minutes until the token expires (default 15, at most the server's --jwt-max-expiry)",
+						},
+						"claims": {
+							Type:        "object",
+							Description: "Extra claims to include; exp, iat and nbf are always set by the server",
+						},
+					},
+					Required: []string{},
+				},
+				Annotations: &ToolAnnotations{
+					Title:         "Mint Test JWT",
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleMintTestJWT,
+			backend: "the environment",
+		},
+		{
+			Tool: Tool{
+				Name:        "verify_jwt",
+				Description: "Check a JWT's HS256 signature against the configured jwt_secret and its expiry, returning the decoded claims and, if it is invalid, why.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"token": {
+							Type:        "string",
+							Description: "The compact JWT to verify",
+						},
+					},
+					Required: []string{"token"},
+				},
+				OutputSchema: &verifyJWTSchema,
+				Annotations: &ToolAnnotations{
+					Title:         "Verify JWT",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleVerifyJWT,
+			backend: "the environment",
+		},
+		{
+			Tool: Tool{
+				Name:        "rotation_status",
+				Description: "Report how long ago each configured key was rotated against its maximum age (90 days unless configured), flagging overdue keys and keys with no rotation recorded.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"category": {
+							Type:        "string",
+							Description: "Only report keys in this category",
+							Enum:        categoryNames,
+						},
+						"overdue_only": {
+							Type:        "boolean",
+							Description: "Only report overdue keys",
+						},
+					},
+					Required: []string{},
+				},
+				OutputSchema: &rotationInfoSchema,
+				Annotations: &ToolAnnotations{
+					Title:         "Rotation Status",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleRotationStatus,
+			backend: "the environment",
+		},
+		{
+			Tool: Tool{
+				Name:        "mark_key_rotated",
+				Description: "Record that a key was rotated just now, in the server's state file, so rotation_status and listings measure its age from today.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"key_name": {
+							Type:        "string",
+							Description: "The key that was rotated",
+							Enum:        keyNames,
+						},
+					},
+					Required: []string{"key_name"},
+				},
+				Annotations: &ToolAnnotations{
+					Title:           "Mark Key Rotated",
+					ReadOnlyHint:    boolPtr(false),
+					DestructiveHint: boolPtr(false),
+					OpenWorldHint:   boolPtr(false),
+				},
+			},
+			handler: s.handleMarkKeyRotated,
+			backend: "the state file",
+		},
+		{
+			Tool: Tool{
+				Name:        "snapshot_env",
+				Description: "Save the current values of every registered key, encrypted with this machine's key, as a snapshot to return to with restore_env, for example before changing the environment. Values are never returned.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"label": {
+							Type:        "string",
+							Description: "Name for the snapshot: letters, digits, '.', '_' and '-' (default: the current UTC time)",
+						},
+					},
+					Required: []string{},
+				},
+				Annotations: &ToolAnnotations{
+					Title:           "Snapshot Environment",
+					ReadOnlyHint:    boolPtr(false),
+					DestructiveHint: boolPtr(false),
+					OpenWorldHint:   boolPtr(false),
+				},
+			},
+			handler: s.handleSnapshotEnv,
+			backend: "the snapshot directory",
+			enabled: snapshots,
+		},
+		{
+			Tool: Tool{
+				Name:        "list_snapshots",
+				Description: "List the saved environment snapshots with when they were taken and how many variables each holds.",
+				InputSchema: InputSchema{
+					Type:       "object",
+					Properties: map[string]Property{},
+					Required:   []string{},
+				},
+				OutputSchema: &snapshotListSchema,
+				Annotations: &ToolAnnotations{
+					Title:          "List Snapshots",
+					ReadOnlyHint:   boolPtr(true),
+					OpenWorldHint:  boolPtr(false),
+					IdempotentHint: boolPtr(true),
+				},
+			},
+			handler: s.handleListSnapshots,
+			backend: "the snapshot directory",
+			enabled: snapshots,
+		},
+		{
+			Tool: Tool{
+				Name:        "restore_env",
+				Description: "Write a snapshot's values back into the .env file and report which variables were added, changed or already matched. Variables set now that the snapshot doesn't hold are left alone. Values are never returned.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"label": {
+							Type:        "string",
+							Description: "The snapshot to restore, as listed by list_snapshots",
+						},
+						"target": {
+							Type:        "string",
+							Description: "The .env file to write; only '.env' in the working directory, which the server loads, is accepted (default '.env')",
+						},
+					},
+					Required: []string{"label"},
+				},
+				OutputSchema: &snapshotRestoreSchema,
+				Annotations: &ToolAnnotations{
+					Title:           "Restore Environment",
+					ReadOnlyHint:    boolPtr(false),
+					DestructiveHint: boolPtr(true),
+					OpenWorldHint:   boolPtr(false),
+				},
+			},
+			handler: s.handleRestoreEnv,
+			backend: "the .env file",
+			enabled: snapshotRestores,
+		},
+		{
+			Tool: Tool{
+				Name:        "generate_client_config",
+				Description: "Generate the JSON snippet that registers this server with an MCP client, using this binary's path and flags, plus where to put it.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"target": {
+							Type:        "string",
+							Description: "The MCP client to generate configuration for",
+							Enum:        clientConfigTargets,
+						},
+					},
+					Required: []string{"target"},
+				},
+				Annotations: &ToolAnnotations{
+					Title:         "Generate Client Config",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleGenerateClientConfig,
+			backend: "the server itself",
+		},
+		{
+			Tool: Tool{
+				Name:        "import_env_template",
+				Description: "Reconcile a template such as .env.example with a .env file: report which variables belong to registered keys, which are configured or missing, and which match no key. With write (and the server's --allow-writes), copy non-secret defaults and add commented stubs for missing keys to the .env. Only reports by default; values are never returned.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"template": {
+							Type:        "string",
+							Description: "Template file to import, inside the working directory (default '.env.example')",
+						},
+						"target": {
+							Type:        "string",
+							Description: "The .env file to reconcile, inside the working directory (default '.env')",
+						},
+						"write": {
+							Type:        "boolean",
+							Description: "Change the target file instead of only reporting (default false)",
+						},
+					},
+					Required: []string{},
+				},
+				OutputSchema: &importPlanSchema,
+				Annotations: &ToolAnnotations{
+					Title:           "Import Env Template",
+					ReadOnlyHint:    boolPtr(false),
+					DestructiveHint: boolPtr(false),
+					OpenWorldHint:   boolPtr(false),
+				},
+			},
+			handler: s.handleImportEnvTemplate,
+			backend: "the .env file",
+		},
+		{
+			Tool: Tool{
+				Name:        "generate_env_template",
+				Description: "Generate a .env.example template listing the environment variable of every registered API key, grouped by category. Never includes values.",
+				InputSchema: InputSchema{
+					Type:       "object",
+					Properties: map[string]Property{},
+					Required:   []string{},
+				},
+				Annotations: &ToolAnnotations{
+					Title:         "Generate .env Template",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleGenerateEnvTemplate,
+			backend: "the environment",
+		},
+		{
+			Tool: Tool{
+				Name:        "read_audit_log",
+				Description: "Return the most recent entries of the secret access audit log: which keys were revealed, denied or missing, when, and for which client. Never includes values.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"limit": {
+							Type:        "integer",
+							Description: fmt.Sprintf("Number of entries to return, newest last (default %d)", defaultAuditReadLimit),
+						},
+					},
+					Required: []string{},
+				},
+				Annotations: &ToolAnnotations{
+					Title:         "Read Audit Log",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleReadAuditLog,
+			backend: "the audit log file",
+			enabled: auditLogExposed,
+		},
+		{
+			Tool: Tool{
+				Name:        "server_info",
+				Description: "Report the server's version, build commit and date, and negotiated protocol version. Useful to include in bug reports.",
+				InputSchema: InputSchema{
+					Type:       "object",
+					Properties: map[string]Property{},
+					Required:   []string{},
+				},
+				OutputSchema: &serverInfoSchema,
+				Annotations: &ToolAnnotations{
+					Title:         "Server Info",
+					ReadOnlyHint:  boolPtr(true),
+					OpenWorldHint: boolPtr(false),
+				},
+			},
+			handler: s.handleServerInfo,
+			backend: "the server itself",
+		},
+	}
+}
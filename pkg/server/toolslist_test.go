@@ -0,0 +1,91 @@
+package server_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+const toolsListLine = `{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}`
+
+// keyNameEnum returns the key_name enum of get_api_key.
+func keyNameEnum(t *testing.T, c *testmcp.Client) []string {
+	t.Helper()
+	tools, err := c.ListTools()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tool := range tools {
+		if tool.Name == "get_api_key" {
+			return tool.InputSchema.Properties["key_name"].Enum
+		}
+	}
+	t.Fatal("get_api_key isn't listed")
+	return nil
+}
+
+func TestToolsListCacheInvalidatesOnNewKey(t *testing.T) {
+	testmcp.ClearKeys(t)
+	c := newClient(t)
+
+	first := c.Server.Handle([]byte(toolsListLine))
+	if again := c.Server.Handle([]byte(toolsListLine)); !bytes.Equal(first, again) {
+		t.Error("an unchanged tools/list differs between calls")
+	}
+	if contains(keyNameEnum(t, c), "internal_tools") {
+		t.Fatal("the key is listed before it is registered")
+	}
+
+	if err := c.Server.RegisterKey("internal_tools", internalToolsKey); err != nil {
+		t.Fatal(err)
+	}
+	if !contains(keyNameEnum(t, c), "internal_tools") {
+		t.Error("tools/list still serves the page cached before the key was added")
+	}
+	if bytes.Equal(first, c.Server.Handle([]byte(toolsListLine))) {
+		t.Error("tools/list didn't change when a key was added")
+	}
+}
+
+// benchmarkServer returns an initialized server with 200 keys besides the
+// built-in ones, so the key_name enums are long.
+func benchmarkServer(b *testing.B) *server.Server {
+	testmcp.ClearKeys(b)
+	s := server.New(strings.NewReader(""), &bytes.Buffer{}, server.WithLogger(discardLogger))
+	for i := 0; i < 200; i++ {
+		config := internalToolsKey
+		config.EnvVar = fmt.Sprintf("BENCH_KEY_%03d", i)
+		if err := s.RegisterKey(fmt.Sprintf("bench_key_%03d", i), config); err != nil {
+			b.Fatal(err)
+		}
+	}
+	s.Handle([]byte(initializeLine))
+	s.Handle([]byte(initializedLine))
+	return s
+}
+
+// BenchmarkToolsList compares serving tools/list from the cache with
+// rebuilding it on every call, as it was before the cache.
+func BenchmarkToolsList(b *testing.B) {
+	b.Run("cached", func(b *testing.B) {
+		s := benchmarkServer(b)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			s.Handle([]byte(toolsListLine))
+		}
+	})
+	b.Run("rebuilt", func(b *testing.B) {
+		s := benchmarkServer(b)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			s.InvalidateToolsList()
+			s.Handle([]byte(toolsListLine))
+		}
+	})
+}
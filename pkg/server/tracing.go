@@ -0,0 +1,317 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourusername/mcp-api-keys-server/version"
+)
+
+// Tracing exports a span per JSON-RPC request, with child spans for the
+// calls the server makes on its behalf, to an OTLP collector over HTTP with
+// the JSON encoding. It is configured by the standard OTEL_EXPORTER_OTLP_*
+// variables; without an endpoint s.tracer is nil and every span is a nil
+// *span whose methods do nothing.
+const (
+	traceExportInterval = 5 * time.Second
+	traceExportTimeout  = 10 * time.Second
+	// maxBufferedSpans bounds memory when the collector is unreachable;
+	// newer spans are dropped past it.
+	maxBufferedSpans = 2048
+)
+
+// OTLP span kinds and status codes.
+const (
+	spanKindServer = 2
+	spanKindClient = 3
+	statusOK       = 1
+	statusError    = 2
+)
+
+type otlpValue struct {
+	StringValue string `json:"stringValue,omitempty"`
+	IntValue    string `json:"intValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+// span is a span in progress. Attributes must only ever hold names and
+// outcomes, never key values.
+type span struct {
+	tracer *tracer
+	mu     sync.Mutex
+	data   otlpSpan
+}
+
+type spanKey struct{}
+
+// spanFromContext returns the span a context carries, or nil.
+func spanFromContext(ctx context.Context) *span {
+	sp, _ := ctx.Value(spanKey{}).(*span)
+	return sp
+}
+
+// setAttribute records a string attribute on the span.
+func (sp *span) setAttribute(key, value string) {
+	if sp == nil {
+		return
+	}
+	sp.mu.Lock()
+	sp.data.Attributes = append(sp.data.Attributes, otlpAttribute{Key: key, Value: otlpValue{StringValue: value}})
+	sp.mu.Unlock()
+}
+
+// setIntAttribute records an integer attribute on the span.
+func (sp *span) setIntAttribute(key string, value int) {
+	if sp == nil {
+		return
+	}
+	sp.mu.Lock()
+	sp.data.Attributes = append(sp.data.Attributes, otlpAttribute{Key: key, Value: otlpValue{IntValue: strconv.Itoa(value)}})
+	sp.mu.Unlock()
+}
+
+// fail marks the span as failed with a message, which must not quote a
+// value.
+func (sp *span) fail(message string) {
+	if sp == nil {
+		return
+	}
+	sp.mu.Lock()
+	sp.data.Status = otlpStatus{Code: statusError, Message: message}
+	sp.mu.Unlock()
+}
+
+// end finishes the span and queues it for export.
+func (sp *span) end() {
+	if sp == nil {
+		return
+	}
+	sp.mu.Lock()
+	sp.data.EndTimeUnixNano = strconv.FormatInt(time.Now().UnixNano(), 10)
+	if sp.data.Status.Code == 0 {
+		sp.data.Status.Code = statusOK
+	}
+	data := sp.data
+	sp.mu.Unlock()
+	sp.tracer.queue(data)
+}
+
+// tracer batches finished spans and posts them to the collector.
+type tracer struct {
+	endpoint string
+	headers  map[string]string
+	resource []otlpAttribute
+	client   *http.Client
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	pending []otlpSpan
+	// failed is set after an export fails, so the warning is logged once
+	// rather than every interval.
+	failed bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// newTracerFromEnv returns a tracer for the collector the OTEL_* variables
+// name, or nil when none is configured.
+func newTracerFromEnv(logger *slog.Logger) *tracer {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	if protocol := os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); protocol != "" && protocol != "http/json" {
+		logger.Warn("only the http/json OTLP protocol is supported, exporting traces with it", "protocol", protocol)
+	}
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = serverName
+	}
+
+	headers := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if name, value, ok := strings.Cut(pair, "="); ok {
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+
+	t := &tracer{
+		endpoint: endpoint,
+		headers:  headers,
+		resource: []otlpAttribute{
+			{Key: "service.name", Value: otlpValue{StringValue: serviceName}},
+			{Key: "service.version", Value: otlpValue{StringValue: version.Version}},
+		},
+		client: &http.Client{Timeout: traceExportTimeout},
+		logger: logger,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// start begins a span, as a child of the span ctx carries if any, and
+// returns a context carrying it. With a nil tracer it returns ctx and a nil
+// span.
+func (t *tracer) start(ctx context.Context, name string, kind int) (context.Context, *span) {
+	if t == nil {
+		return ctx, nil
+	}
+	now := time.Now()
+	sp := &span{
+		tracer: t,
+		data: otlpSpan{
+			SpanID:            randomHex(8),
+			Name:              name,
+			Kind:              kind,
+			StartTimeUnixNano: strconv.FormatInt(now.UnixNano(), 10),
+		},
+	}
+	if parent := spanFromContext(ctx); parent != nil {
+		sp.data.TraceID = parent.data.TraceID
+		sp.data.ParentSpanID = parent.data.SpanID
+	} else {
+		sp.data.TraceID = randomHex(16)
+	}
+	return context.WithValue(ctx, spanKey{}, sp), sp
+}
+
+// startChild begins a client span under the span ctx carries. Without one,
+// it does nothing, so background work outside a request isn't traced.
+func startChild(ctx context.Context, name string) (context.Context, *span) {
+	parent := spanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.start(ctx, name, spanKindClient)
+}
+
+func (t *tracer) queue(data otlpSpan) {
+	t.mu.Lock()
+	if len(t.pending) < maxBufferedSpans {
+		t.pending = append(t.pending, data)
+	}
+	t.mu.Unlock()
+}
+
+func (t *tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(traceExportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), traceExportTimeout)
+			t.flush(ctx)
+			cancel()
+		}
+	}
+}
+
+// flush posts the pending spans to the collector.
+func (t *tracer) flush(ctx context.Context) error {
+	t.mu.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": t.resource},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": serverName, "version": version.Version},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	err = t.post(ctx, body)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil && !t.failed {
+		t.logger.Warn("failed to export traces", "endpoint", t.endpoint, "spans", len(spans), "error", err)
+	}
+	t.failed = err != nil
+	return err
+}
+
+func (t *tracer) post(ctx context.Context, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range t.headers {
+		request.Header.Set(name, value)
+	}
+	response, err := t.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("collector answered HTTP %d", response.StatusCode)
+	}
+	return nil
+}
+
+// Shutdown stops the export loop and sends the spans still pending. It is
+// safe to call more than once.
+func (t *tracer) Shutdown(ctx context.Context) error {
+	t.stopOnce.Do(func() { close(t.stop) })
+	<-t.done
+	return t.flush(ctx)
+}
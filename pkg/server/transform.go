@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Transforms get_api_key can apply to a value before returning it. They are
+// applied last, after every policy check, so encoding a value can't get
+// around a policy that refuses it.
+const (
+	transformRaw       = "raw"
+	transformBase64    = "base64"
+	transformURLEncode = "urlencode"
+	transformBearer    = "bearer"
+	// transformBasicAuth is followed by the name of the key holding the
+	// username, as in "basic_auth:twilio_sid".
+	transformBasicAuth = "basic_auth:"
+)
+
+// valueTransforms lists the transforms for messages and the schema.
+var valueTransforms = []string{transformRaw, transformBase64, transformURLEncode, transformBearer, transformBasicAuth + "<username_key>"}
+
+// valueTransform is a parsed transform argument.
+type valueTransform struct {
+	Name string
+	// UsernameKey is the key whose value is the username of basic_auth.
+	UsernameKey string
+}
+
+// parseTransform reads the transform argument, which defaults to raw. The
+// problem lists the valid transforms.
+func parseTransform(args map[string]interface{}) (valueTransform, string) {
+	name, _ := args["transform"].(string)
+	switch {
+	case name == "":
+		return valueTransform{Name: transformRaw}, ""
+	case name == transformRaw || name == transformBase64 || name == transformURLEncode || name == transformBearer:
+		return valueTransform{Name: name}, ""
+	case strings.HasPrefix(name, transformBasicAuth) && len(name) > len(transformBasicAuth):
+		return valueTransform{Name: transformBasicAuth, UsernameKey: strings.TrimPrefix(name, transformBasicAuth)}, ""
+	}
+	return valueTransform{}, fmt.Sprintf("Error: unknown transform %q: use one of %s", name, strings.Join(valueTransforms, ", "))
+}
+
+// apply returns value in the transform's form. username is only used by
+// basic_auth. Values are transformed byte for byte, so non-ASCII values
+// are encoded as UTF-8.
+func (t valueTransform) apply(value, username string) string {
+	switch t.Name {
+	case transformBase64:
+		return base64.StdEncoding.EncodeToString([]byte(value))
+	case transformURLEncode:
+		return url.QueryEscape(value)
+	case transformBearer:
+		return "Bearer " + value
+	case transformBasicAuth:
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+value))
+	}
+	return value
+}
+
+// describe names the transform for notes, such as "basic_auth (twilio_sid
+// as the username)".
+func (t valueTransform) describe() string {
+	if t.Name == transformBasicAuth {
+		return fmt.Sprintf("basic_auth (%s as the username)", t.UsernameKey)
+	}
+	return t.Name
+}
@@ -0,0 +1,124 @@
+package server_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+func TestApplyTransform(t *testing.T) {
+	for _, test := range []struct {
+		transform, value, username, want string
+	}{
+		{"", "sk-proj-0123", "", "sk-proj-0123"},
+		{"raw", "sk-proj-0123", "", "sk-proj-0123"},
+		{"base64", "sk-proj-0123", "", "c2stcHJvai0wMTIz"},
+		{"base64", "", "", ""},
+		// Non-ASCII values are encoded as UTF-8
+		{"base64", "ключ🔑", "", "0LrQu9GO0Yfwn5SR"},
+		{"urlencode", "a b+c/d=e&f?g#h%", "", "a+b%2Bc%2Fd%3De%26f%3Fg%23h%25"},
+		{"urlencode", "ключ🔑", "", "%D0%BA%D0%BB%D1%8E%D1%87%F0%9F%94%91"},
+		{"urlencode", "", "", ""},
+		{"bearer", "sk-proj-0123", "", "Bearer sk-proj-0123"},
+		{"bearer", "ключ", "", "Bearer ключ"},
+		{"bearer", "", "", "Bearer "},
+		// The example from RFC 7617
+		{"basic_auth:twilio_sid", "open sesame", "Aladdin", "Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ=="},
+		{"basic_auth:twilio_sid", "пароль", "user", "Basic " + base64.StdEncoding.EncodeToString([]byte("user:пароль"))},
+		{"basic_auth:twilio_sid", "", "", "Basic Og=="},
+	} {
+		got, problem := server.ApplyTransform(test.transform, test.value, test.username)
+		if got != test.want || problem != "" {
+			t.Errorf("transform %q of %q = %q, %q; want %q", test.transform, test.value, got, problem, test.want)
+		}
+	}
+
+	for _, transform := range []string{"rot13", "Base64", "basic_auth:", "basic_auth", "bearer "} {
+		if _, problem := server.ApplyTransform(transform, "sk-proj-0123", ""); !strings.Contains(problem, "use one of raw, base64, urlencode, bearer, basic_auth:<username_key>") {
+			t.Errorf("transform %q = %q, want the valid transforms", transform, problem)
+		}
+	}
+}
+
+// failureOf returns the error code and details of a failed tool call.
+func failureOf(t *testing.T, result server.CallToolResult) (string, map[string]interface{}) {
+	t.Helper()
+	var structured struct {
+		Error struct {
+			Code    string                 `json:"code"`
+			Details map[string]interface{} `json:"details"`
+		} `json:"error"`
+	}
+	data, _ := json.Marshal(result.StructuredContent)
+	if err := json.Unmarshal(data, &structured); err != nil || !result.IsError {
+		t.Fatalf("result = %+v, want a failure", result)
+	}
+	return structured.Error.Code, structured.Error.Details
+}
+
+func TestGetAPIKeyTransforms(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{
+		"twilio_sid":   "ACtransform0123456789",
+		"twilio_token": "tok/transform+0123456789",
+	})
+	c := newClient(t)
+	hidden := internalToolsKey
+	hidden.Reveal = new(bool)
+	c.RegisterKey(t, "internal_tools", hidden, "internal-transform0123456789")
+
+	for _, test := range []struct {
+		transform, want string
+	}{
+		{"raw", "tok/transform+0123456789"},
+		{"base64", base64.StdEncoding.EncodeToString([]byte("tok/transform+0123456789"))},
+		{"urlencode", "tok%2Ftransform%2B0123456789"},
+		{"bearer", "Bearer tok/transform+0123456789"},
+		{"basic_auth:twilio_sid", "Basic " + base64.StdEncoding.EncodeToString([]byte("ACtransform0123456789:tok/transform+0123456789"))},
+	} {
+		result, err := c.CallTool("get_api_key", map[string]interface{}{"key_name": "twilio_token", "transform": test.transform})
+		if err != nil || result.IsError {
+			t.Fatalf("%s: get_api_key = %+v, %v", test.transform, result, err)
+		}
+		// The value stays alone in the first block
+		if result.Content[0].Text != test.want {
+			t.Errorf("%s: get_api_key = %q, want %q", test.transform, result.Content[0].Text, test.want)
+		}
+		if noted := strings.Contains(testmcp.Text(result), "transformed with"); noted != (test.transform != "raw") {
+			t.Errorf("%s: get_api_key = %q", test.transform, testmcp.Text(result))
+		}
+	}
+
+	for _, test := range []struct {
+		key, transform, code string
+	}{
+		{"twilio_token", "rot13", "validation_failed"},
+		// A key that is never revealed isn't revealed encoded either
+		{"internal_tools", "base64", "policy_denied"},
+		{"internal_tools", "bearer", "policy_denied"},
+		// Nor as the username of basic_auth
+		{"twilio_token", "basic_auth:internal_tools", "policy_denied"},
+		{"twilio_token", "basic_auth:no_such_key", "unknown_key"},
+		{"twilio_token", "basic_auth:openai", "not_configured"},
+		{"twilio_token", "basic_auth:azure_openai", "validation_failed"},
+	} {
+		result, err := c.CallTool("get_api_key", map[string]interface{}{"key_name": test.key, "transform": test.transform})
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, details := failureOf(t, result)
+		if code != test.code {
+			t.Errorf("%s of %s: code = %q, want %q: %s", test.transform, test.key, code, test.code, testmcp.Text(result))
+		}
+		if test.transform == "rot13" && len(details["valid_transforms"].([]interface{})) != 5 {
+			t.Errorf("an unknown transform's details = %v, want the valid transforms", details)
+		}
+		data, _ := json.Marshal(result)
+		if strings.Contains(string(data), "internal-transform") || strings.Contains(string(data), base64.StdEncoding.EncodeToString([]byte("internal-transform0123456789"))) {
+			t.Errorf("%s of %s reveals the value: %s", test.transform, test.key, data)
+		}
+	}
+}
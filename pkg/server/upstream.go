@@ -0,0 +1,459 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yourusername/mcp-api-keys-server/internal/protocol"
+	"github.com/yourusername/mcp-api-keys-server/version"
+)
+
+// upstreamTimeout bounds each call to the upstream server, including
+// connecting and initializing when that hasn't happened yet.
+const upstreamTimeout = 10 * time.Second
+
+// upstreamTools are the tools whose unknown keys are forwarded upstream.
+var upstreamTools = map[string]bool{
+	"get_api_key":          true,
+	"check_api_key_exists": true,
+}
+
+// upstreamConn is a connection to the upstream server over one transport.
+// IDs come from the client, which numbers its requests independently of
+// the ones this server answers.
+type upstreamConn interface {
+	call(ctx context.Context, id int64, method string, params interface{}) (json.RawMessage, error)
+	notify(ctx context.Context, method string, params interface{}) error
+	// alive reports whether the connection can still be used.
+	alive() bool
+	close()
+}
+
+// upstreamMessage is any message the upstream server sends.
+type upstreamMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *protocol.Error `json:"error,omitempty"`
+}
+
+// upstreamRequest is a request or, without an ID, a notification sent
+// upstream.
+type upstreamRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      *int64      `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// upstreamClient is a minimal MCP client for the server named by
+// --upstream: a command run over stdio, or a Streamable HTTP URL. It
+// connects and initializes on first use and reconnects when a command
+// exits.
+type upstreamClient struct {
+	target string
+	nextID atomic.Int64
+
+	mu   sync.Mutex
+	conn upstreamConn
+}
+
+func newUpstreamClient(target string) *upstreamClient {
+	return &upstreamClient{target: target}
+}
+
+// isHTTP reports whether the upstream is reached over HTTP.
+func (c *upstreamClient) isHTTP() bool {
+	return strings.HasPrefix(c.target, "http://") || strings.HasPrefix(c.target, "https://")
+}
+
+// label names the upstream for people without repeating credentials a URL
+// or command line may carry.
+func (c *upstreamClient) label() string {
+	if c.isHTTP() {
+		if parsed, err := url.Parse(c.target); err == nil {
+			return parsed.Host
+		}
+		return "upstream"
+	}
+	if fields := strings.Fields(c.target); len(fields) > 0 {
+		return filepath.Base(fields[0])
+	}
+	return "upstream"
+}
+
+// connection returns the open connection, connecting and initializing
+// first if there is none.
+func (c *upstreamClient) connection(ctx context.Context) (upstreamConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil && c.conn.alive() {
+		return c.conn, nil
+	}
+
+	var conn upstreamConn
+	if c.isHTTP() {
+		conn = &httpUpstream{url: c.target}
+	} else {
+		stdio, err := startStdioUpstream(c.target)
+		if err != nil {
+			return nil, err
+		}
+		conn = stdio
+	}
+	params := InitializeParams{
+		ProtocolVersion: supportedProtocolVersions[0],
+		ClientInfo:      ClientInfo{Name: serverName, Version: version.Version},
+	}
+	if _, err := conn.call(ctx, c.nextID.Add(1), "initialize", params); err != nil {
+		conn.close()
+		return nil, fmt.Errorf("initialize failed: %w", err)
+	}
+	if err := conn.notify(ctx, "notifications/initialized", nil); err != nil {
+		conn.close()
+		return nil, err
+	}
+	c.conn = conn
+	return conn, nil
+}
+
+// callTool calls a tool on the upstream server.
+func (c *upstreamClient) callTool(ctx context.Context, name string, args map[string]interface{}) (CallToolResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+	defer cancel()
+	ctx, sp := startChild(ctx, "upstream tools/call")
+	sp.setAttribute("mcp.tool.name", name)
+	sp.setAttribute("mcp.upstream", c.label())
+	defer sp.end()
+
+	var result CallToolResult
+	conn, err := c.connection(ctx)
+	if err != nil {
+		sp.fail("connection failed")
+		return result, err
+	}
+	raw, err := conn.call(ctx, c.nextID.Add(1), "tools/call", map[string]interface{}{"name": name, "arguments": args})
+	if err != nil {
+		sp.fail("call failed")
+		return result, err
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return result, fmt.Errorf("invalid tools/call result: %w", err)
+	}
+	return result, nil
+}
+
+// Close ends the connection, stopping an upstream command.
+func (c *upstreamClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		c.conn.close()
+		c.conn = nil
+	}
+}
+
+// responseResult returns a response's result, or its error.
+func responseResult(message upstreamMessage) (json.RawMessage, error) {
+	if message.Error != nil {
+		return nil, fmt.Errorf("upstream error %d: %s", message.Error.Code, message.Error.Message)
+	}
+	return message.Result, nil
+}
+
+// stdioUpstream runs the upstream server as a child process and speaks
+// newline-delimited JSON-RPC over its stdin and stdout.
+type stdioUpstream struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	out   *protocol.Writer
+
+	mu      sync.Mutex
+	pending map[int64]chan upstreamMessage
+	// done is closed once the process's output ends.
+	done chan struct{}
+}
+
+func startStdioUpstream(command string) (*stdioUpstream, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty upstream command")
+	}
+	cmd := exec.Command(fields[0], fields[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	u := &stdioUpstream{
+		cmd:     cmd,
+		stdin:   stdin,
+		out:     protocol.NewWriter(stdin),
+		pending: map[int64]chan upstreamMessage{},
+		done:    make(chan struct{}),
+	}
+	go u.read(stdout)
+	return u, nil
+}
+
+// read delivers responses to their callers until the output ends. Requests
+// from the upstream server are refused, since this client offers nothing.
+func (u *stdioUpstream) read(stdout io.Reader) {
+	defer close(u.done)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), defaultMaxMessageSize)
+	for scanner.Scan() {
+		var message upstreamMessage
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			continue
+		}
+		if message.Method != "" {
+			if len(message.ID) > 0 {
+				u.out.WriteMessage(protocol.Response{JSONRPC: "2.0", ID: message.ID, Error: &protocol.Error{Code: -32601, Message: "Method not found"}})
+			}
+			continue
+		}
+		id, err := strconv.ParseInt(string(message.ID), 10, 64)
+		if err != nil {
+			continue
+		}
+		u.mu.Lock()
+		reply, ok := u.pending[id]
+		delete(u.pending, id)
+		u.mu.Unlock()
+		if ok {
+			reply <- message
+		}
+	}
+}
+
+func (u *stdioUpstream) call(ctx context.Context, id int64, method string, params interface{}) (json.RawMessage, error) {
+	reply := make(chan upstreamMessage, 1)
+	u.mu.Lock()
+	u.pending[id] = reply
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		delete(u.pending, id)
+		u.mu.Unlock()
+	}()
+
+	if err := u.out.WriteMessage(upstreamRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		return nil, err
+	}
+	select {
+	case message := <-reply:
+		return responseResult(message)
+	case <-u.done:
+		return nil, errors.New("upstream server exited")
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no response to %s: %w", method, ctx.Err())
+	}
+}
+
+func (u *stdioUpstream) notify(ctx context.Context, method string, params interface{}) error {
+	return u.out.WriteMessage(upstreamRequest{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (u *stdioUpstream) alive() bool {
+	select {
+	case <-u.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (u *stdioUpstream) close() {
+	u.stdin.Close()
+	select {
+	case <-u.done:
+	case <-time.After(time.Second):
+		u.cmd.Process.Kill()
+	}
+	u.cmd.Wait()
+}
+
+// httpUpstream posts each message to a Streamable HTTP endpoint, keeping
+// the session ID the server assigns.
+type httpUpstream struct {
+	url string
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+func (u *httpUpstream) post(ctx context.Context, message upstreamRequest) (*http.Response, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, u.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json, text/event-stream")
+	request.Header.Set("User-Agent", serverName)
+	u.mu.Lock()
+	if u.sessionID != "" {
+		request.Header.Set("Mcp-Session-Id", u.sessionID)
+		request.Header.Set("MCP-Protocol-Version", supportedProtocolVersions[0])
+	}
+	u.mu.Unlock()
+
+	response, err := networkClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if session := response.Header.Get("Mcp-Session-Id"); session != "" {
+		u.mu.Lock()
+		u.sessionID = session
+		u.mu.Unlock()
+	}
+	if response.StatusCode >= 300 {
+		response.Body.Close()
+		return nil, fmt.Errorf("upstream answered HTTP %d", response.StatusCode)
+	}
+	return response, nil
+}
+
+func (u *httpUpstream) call(ctx context.Context, id int64, method string, params interface{}) (json.RawMessage, error) {
+	response, err := u.post(ctx, upstreamRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body := io.LimitReader(response.Body, maxProviderResponse)
+	want := strconv.FormatInt(id, 10)
+
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if mediaType != "text/event-stream" {
+		var message upstreamMessage
+		if err := json.NewDecoder(body).Decode(&message); err != nil {
+			return nil, fmt.Errorf("invalid response to %s: %w", method, err)
+		}
+		return responseResult(message)
+	}
+	// The response may come after other messages on the stream
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), defaultMaxMessageSize)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var message upstreamMessage
+		if json.Unmarshal([]byte(strings.TrimSpace(data)), &message) == nil && message.Method == "" && string(message.ID) == want {
+			return responseResult(message)
+		}
+	}
+	return nil, fmt.Errorf("the stream ended without a response to %s", method)
+}
+
+func (u *httpUpstream) notify(ctx context.Context, method string, params interface{}) error {
+	response, err := u.post(ctx, upstreamRequest{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (u *httpUpstream) alive() bool { return true }
+
+func (u *httpUpstream) close() {}
+
+// forwardToUpstream asks the upstream server to answer a call for a key
+// this server doesn't know. It reports false when there is no upstream or
+// it failed, so the caller answers as it would without one.
+func (s *Server) forwardToUpstream(ctx context.Context, tool, keyName string, args map[string]interface{}) (CallToolResult, bool) {
+	// The upstream server only knows the shared environment
+	if s.upstream == nil || s.keys.tenantName() != "" {
+		return CallToolResult{}, false
+	}
+	if tool == "get_api_key" {
+		return s.revealFromUpstream(ctx, keyName, args)
+	}
+	return s.callUpstream(ctx, tool, keyName, args)
+}
+
+// revealFromUpstream forwards get_api_key under the controls a local key
+// gets: the --reveal-allow/--reveal-deny patterns, the reveal budget, the
+// rate limiter and dry run, with the outcome in the access audit. The
+// upstream server applies its own policy on top.
+func (s *Server) revealFromUpstream(ctx context.Context, keyName string, args map[string]interface{}) (CallToolResult, bool) {
+	if !s.revealPolicy.allows(keyName) {
+		s.noteAudit(ctx, "warning", fmt.Sprintf("Access to API key '%s' was blocked by the server's reveal policy", keyName))
+		s.noteAccess(ctx, keyName, auditDenied, "blocked by reveal policy", "")
+		return failure(codePolicyDenied, fmt.Sprintf("API key '%s' is blocked by the server's reveal policy: it isn't fetched from the upstream server.", keyName), keyDetails(keyName)), true
+	}
+	release, message := s.reserveRevealBudget(keyName, false)
+	if message != "" {
+		s.noteAudit(ctx, "warning", fmt.Sprintf("Reveal of API key '%s' was refused: the session reveal budget is used up", keyName))
+		s.noteAccess(ctx, keyName, auditDenied, "reveal budget exhausted", "")
+		return failure(codeRateLimited, message, keyDetails(keyName)), true
+	}
+	if s.revealLimiter != nil {
+		if ok, retryAfter := s.revealLimiter.allow(keyName); !ok {
+			release()
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			s.noteAudit(ctx, "warning", fmt.Sprintf("Reveal of API key '%s' was rate limited", keyName))
+			s.noteAccess(ctx, keyName, auditLimited, fmt.Sprintf("retry after %ds", seconds), "")
+			return failure(codeRateLimited, fmt.Sprintf("Error: API key '%s' is rate limited, retry after %ds.", keyName, seconds), map[string]interface{}{"key_name": keyName, "retry_after_seconds": seconds}), true
+		}
+	}
+
+	if s.dryRun {
+		transform, _ := parseTransform(args)
+		fake := transform.apply(s.keys.fakeSecret(keyName), s.keys.fakeSecret(transform.UsernameKey))
+		s.noteAudit(ctx, "info", fmt.Sprintf("API key '%s' was revealed as a fake value (dry run)", keyName))
+		s.noteAccess(ctx, keyName, auditRevealed, "dry run", fake)
+		return CallToolResult{Content: []ContentBlock{{Type: "text", Text: dryRunNotice}, {Type: "text", Text: fake}}}, true
+	}
+	result, ok := s.callUpstream(ctx, "get_api_key", keyName, args)
+	if !ok || result.IsError || len(result.Content) == 0 {
+		release()
+		return result, ok
+	}
+	s.noteAccess(ctx, keyName, auditRevealed, "answered by the upstream server "+s.upstream.label(), result.Content[0].Text)
+	return result, true
+}
+
+// callUpstream calls tool on the upstream server, reporting false when it
+// failed.
+func (s *Server) callUpstream(ctx context.Context, tool, keyName string, args map[string]interface{}) (CallToolResult, bool) {
+	result, err := s.upstream.callTool(ctx, tool, args)
+	if err != nil {
+		s.logger.Warn("upstream server failed, answering locally", "upstream", s.upstream.label(), "tool", tool, "error", s.keys.secrets.scrubError(err))
+		return CallToolResult{}, false
+	}
+	if tool == "get_api_key" && !result.IsError && len(result.Content) > 0 {
+		s.keys.secrets.remember(keyName, result.Content[0].Text)
+	}
+	s.noteAudit(ctx, "info", fmt.Sprintf("%s for '%s' was answered by the upstream server %s", tool, keyName, s.upstream.label()))
+	result.Content = append(result.Content, ContentBlock{Type: "text", Text: fmt.Sprintf("(Answered by the upstream secrets server %s.)", s.upstream.label())})
+	return result, true
+}
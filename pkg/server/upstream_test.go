@@ -0,0 +1,138 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+const upstreamSecret = "sk-upstream-forwarded0123456789"
+
+// fakeUpstream serves an MCP endpoint whose get_api_key returns
+// upstreamSecret for any key, counting the tool calls in calls.
+func fakeUpstream(t *testing.T, calls *int32) string {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		if request.ID == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		result := `{"protocolVersion":"2025-06-18","capabilities":{},"serverInfo":{"name":"fake","version":"1"}}`
+		if request.Method == "tools/call" {
+			atomic.AddInt32(calls, 1)
+			result = fmt.Sprintf(`{"content":[{"type":"text","text":%q}]}`, upstreamSecret)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, request.ID, result)
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream.URL
+}
+
+// upstreamSession fetches each of keys, which only the upstream server
+// knows, and returns the output and audit log entries. The calls run
+// concurrently, in no particular order.
+func upstreamSession(t *testing.T, url string, keys []string, args ...string) (string, []map[string]interface{}) {
+	t.Helper()
+	testmcp.ClearKeys(t)
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	lines := []string{initializeLine, initializedLine}
+	for id, key := range keys {
+		lines = append(lines, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"get_api_key","arguments":{"key_name":%q}}}`, id+1, key))
+	}
+	args = append([]string{"--watch-env=false", "--log-level", "error", "--upstream", url, "--audit-log", auditPath}, args...)
+	code, stdout, stderr := execute(t, context.Background(), strings.Join(lines, "\n")+"\n", args...)
+	if code != 0 {
+		t.Fatalf("Execute = %d, %s", code, stderr)
+	}
+	return stdout, auditEntries(t, auditPath)
+}
+
+// outcomes counts the audit entries by outcome.
+func outcomes(entries []map[string]interface{}) map[string]int {
+	counts := map[string]int{}
+	for _, entry := range entries {
+		counts[fmt.Sprint(entry["outcome"])]++
+	}
+	return counts
+}
+
+func TestUpstreamRevealIsAudited(t *testing.T) {
+	var calls int32
+	stdout, entries := upstreamSession(t, fakeUpstream(t, &calls), []string{"team_db_password"})
+	if !strings.Contains(stdout, upstreamSecret) {
+		t.Fatalf("the upstream value wasn't returned: %s", stdout)
+	}
+	if len(entries) != 1 || entries[0]["key"] != "team_db_password" || entries[0]["outcome"] != "revealed" {
+		t.Errorf("audit entries = %v, want a reveal of team_db_password", entries)
+	}
+}
+
+func TestUpstreamRevealFollowsRevealPolicy(t *testing.T) {
+	var calls int32
+	stdout, entries := upstreamSession(t, fakeUpstream(t, &calls), []string{"team_db_password"}, "--reveal-deny", "team_*")
+	if strings.Contains(stdout, upstreamSecret) || !strings.Contains(stdout, `"code":"policy_denied"`) {
+		t.Errorf("a denied key was fetched upstream: %s", stdout)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 0 {
+		t.Errorf("the upstream server was called %d times", calls)
+	}
+	if len(entries) != 1 || entries[0]["outcome"] != "denied" {
+		t.Errorf("audit entries = %v, want a denial", entries)
+	}
+}
+
+func TestUpstreamRevealInDryRun(t *testing.T) {
+	var calls int32
+	stdout, entries := upstreamSession(t, fakeUpstream(t, &calls), []string{"team_db_password"}, "--dry-run")
+	if strings.Contains(stdout, upstreamSecret) || !strings.Contains(stdout, "FAKE_TEAM_DB_PASSWORD_") {
+		t.Errorf("dry run returned %s", stdout)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 0 {
+		t.Errorf("the upstream server was called %d times", calls)
+	}
+	if len(entries) != 1 || entries[0]["outcome"] != "revealed" || entries[0]["reason"] != "dry run" {
+		t.Errorf("audit entries = %v, want a dry-run reveal", entries)
+	}
+}
+
+func TestUpstreamRevealCountsAgainstBudget(t *testing.T) {
+	var calls int32
+	stdout, entries := upstreamSession(t, fakeUpstream(t, &calls), []string{"team_db_password", "team_api_token"}, "--reveal-budget", "1")
+	if strings.Count(stdout, upstreamSecret) != 1 || !strings.Contains(stdout, "reveal budget") {
+		t.Errorf("a key past the budget was fetched upstream: %s", stdout)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Errorf("the upstream server was called %d times, want 1", calls)
+	}
+	if got := outcomes(entries); got["revealed"] != 1 || got["denied"] != 1 {
+		t.Errorf("audit entries = %v, want one reveal and one denial", entries)
+	}
+}
+
+func TestUpstreamRevealIsRateLimited(t *testing.T) {
+	var calls int32
+	stdout, entries := upstreamSession(t, fakeUpstream(t, &calls), []string{"team_db_password", "team_db_password"}, "--reveal-rate", "1/hour")
+	if strings.Count(stdout, upstreamSecret) != 1 || !strings.Contains(stdout, "rate limited") {
+		t.Errorf("the second reveal wasn't rate limited: %s", stdout)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Errorf("the upstream server was called %d times, want 1", calls)
+	}
+	if got := outcomes(entries); got["revealed"] != 1 || got["rate_limited"] != 1 {
+		t.Errorf("audit entries = %v, want one reveal and one rate limited", entries)
+	}
+}
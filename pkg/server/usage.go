@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API endpoints provider_usage calls.
+var (
+	openAIAPIURL    = "https://api.openai.com/v1"
+	anthropicAPIURL = "https://api.anthropic.com/v1"
+)
+
+// anthropicVersion is the API version sent to Anthropic.
+const anthropicVersion = "2023-06-01"
+
+// providerUsage is what a provider tells an API key about its limits and
+// spending.
+type providerUsage struct {
+	Key          string `json:"key"`
+	Organization string `json:"organization,omitempty"`
+	// RateLimits are the provider's rate-limit headers, such as
+	// x-ratelimit-remaining-requests, by header name.
+	RateLimits map[string]string `json:"rate_limits,omitempty"`
+	// UsageAvailable is set when the key may read usage or cost reports,
+	// which only admin keys can.
+	UsageAvailable bool `json:"usage_available"`
+	// CostThisMonth is the organization's spend since the start of the
+	// month (UTC), in Currency.
+	CostThisMonth *float64 `json:"cost_this_month,omitempty"`
+	Currency      string   `json:"currency,omitempty"`
+	Detail        string   `json:"detail,omitempty"`
+}
+
+// providerUsageSchema describes providerUsage for the tool's output schema.
+var providerUsageSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"key":             {Type: "string", Description: "Name of the checked key"},
+		"organization":    {Type: "string", Description: "Organization the key belongs to"},
+		"rate_limits":     {Type: "object", Description: "Rate-limit headers returned by the provider, by header name"},
+		"usage_available": {Type: "boolean", Description: "Whether this key type can read usage and cost reports"},
+		"cost_this_month": {Type: "number", Description: "Organization spend since the start of the month (UTC)"},
+		"currency":        {Type: "string"},
+		"detail":          {Type: "string", Description: "Why usage isn't available or couldn't be read"},
+	},
+	Required: []string{"key", "usage_available"},
+}
+
+// usageProviders is the per-provider table of keys provider_usage can look
+// up, and how.
+var usageProviders = map[string]func(ctx context.Context, value string) (providerUsage, error){
+	"openai":    openAIUsage,
+	"anthropic": anthropicUsage,
+}
+
+// usageKeys returns the names in usageProviders, sorted.
+func usageKeys() []string {
+	names := make([]string, 0, len(usageProviders))
+	for name := range usageProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rateLimitHeaders collects the response headers whose names start with one
+// of prefixes, lowercased.
+func rateLimitHeaders(header http.Header, prefixes ...string) map[string]string {
+	limits := map[string]string{}
+	for name, values := range header {
+		lower := strings.ToLower(name)
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(lower, prefix) && len(values) > 0 {
+				limits[lower] = values[0]
+			}
+		}
+	}
+	return limits
+}
+
+// monthStart is the start of the current month, UTC, which cost reports are
+// read from.
+func monthStart() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// openAIUsage lists models, which any key may do, for the organization and
+// rate-limit headers; admin keys (sk-admin-) also read this month's costs.
+func openAIUsage(ctx context.Context, key string) (providerUsage, error) {
+	headers := map[string]string{"Authorization": "Bearer " + key}
+	if !strings.HasPrefix(key, "sk-admin-") {
+		response, _, err := providerGet(ctx, openAIAPIURL+"/models", headers)
+		if err != nil {
+			return providerUsage{}, err
+		}
+		if response.StatusCode == http.StatusUnauthorized {
+			return providerUsage{Detail: "OpenAI rejected the key"}, nil
+		}
+		return providerUsage{
+			Organization: response.Header.Get("Openai-Organization"),
+			RateLimits:   rateLimitHeaders(response.Header, "x-ratelimit-"),
+			Detail:       "usage and costs are not available with this key type; OpenAI only reports them to admin keys (sk-admin-)",
+		}, nil
+	}
+
+	query := url.Values{"start_time": {strconv.FormatInt(monthStart().Unix(), 10)}, "limit": {"31"}}
+	response, body, err := providerGet(ctx, openAIAPIURL+"/organization/costs?"+query.Encode(), headers)
+	if err != nil {
+		return providerUsage{}, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return providerUsage{Detail: fmt.Sprintf("OpenAI returned %s for the cost report", response.Status)}, nil
+	}
+	var costs struct {
+		Data []struct {
+			Results []struct {
+				Amount struct {
+					Value    float64 `json:"value"`
+					Currency string  `json:"currency"`
+				} `json:"amount"`
+			} `json:"results"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &costs); err != nil {
+		return providerUsage{}, fmt.Errorf("unexpected response from OpenAI: %w", err)
+	}
+	usage := providerUsage{UsageAvailable: true, Currency: "usd"}
+	total := 0.0
+	for _, bucket := range costs.Data {
+		for _, result := range bucket.Results {
+			total += result.Amount.Value
+			if result.Amount.Currency != "" {
+				usage.Currency = result.Amount.Currency
+			}
+		}
+	}
+	usage.CostThisMonth = &total
+	return usage, nil
+}
+
+// anthropicUsage lists models, which any key may do, for the organization
+// and rate-limit headers; admin keys (sk-ant-admin) also read this month's
+// cost report.
+func anthropicUsage(ctx context.Context, key string) (providerUsage, error) {
+	headers := map[string]string{"x-api-key": key, "anthropic-version": anthropicVersion}
+	if !strings.HasPrefix(key, "sk-ant-admin") {
+		response, _, err := providerGet(ctx, anthropicAPIURL+"/models", headers)
+		if err != nil {
+			return providerUsage{}, err
+		}
+		if response.StatusCode == http.StatusUnauthorized {
+			return providerUsage{Detail: "Anthropic rejected the key"}, nil
+		}
+		return providerUsage{
+			Organization: response.Header.Get("Anthropic-Organization-Id"),
+			RateLimits:   rateLimitHeaders(response.Header, "anthropic-ratelimit-", "retry-after"),
+			Detail:       "usage and costs are not available with this key type; Anthropic only reports them to admin keys (sk-ant-admin)",
+		}, nil
+	}
+
+	query := url.Values{"starting_at": {monthStart().Format(time.RFC3339)}, "limit": {"31"}}
+	response, body, err := providerGet(ctx, anthropicAPIURL+"/organizations/cost_report?"+query.Encode(), headers)
+	if err != nil {
+		return providerUsage{}, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return providerUsage{Detail: fmt.Sprintf("Anthropic returned %s for the cost report", response.Status)}, nil
+	}
+	var costs struct {
+		Data []struct {
+			Results []struct {
+				// Amount is a decimal string in cents
+				Amount   string `json:"amount"`
+				Currency string `json:"currency"`
+			} `json:"results"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &costs); err != nil {
+		return providerUsage{}, fmt.Errorf("unexpected response from Anthropic: %w", err)
+	}
+	usage := providerUsage{UsageAvailable: true, Currency: "USD"}
+	total := 0.0
+	for _, bucket := range costs.Data {
+		for _, result := range bucket.Results {
+			cents, err := strconv.ParseFloat(result.Amount, 64)
+			if err != nil {
+				return providerUsage{}, fmt.Errorf("unexpected amount %q from Anthropic", result.Amount)
+			}
+			total += cents / 100
+			if result.Currency != "" {
+				usage.Currency = result.Currency
+			}
+		}
+	}
+	usage.CostThisMonth = &total
+	return usage, nil
+}
+
+func (s *Server) handleProviderUsage(ctx context.Context, args map[string]interface{}) CallToolResult {
+	keyName, _ := args["key_name"].(string)
+	lookup, supported := usageProviders[keyName]
+	if !supported {
+		return failure(codeValidationFailed, fmt.Sprintf("Error: usage can only be looked up for %s", strings.Join(usageKeys(), ", ")), nil)
+	}
+	config, value, _ := s.keys.lookup(keyName)
+	if value == "" {
+		return failure(codeNotConfigured, fmt.Sprintf("Error: API key '%s' is not configured. Set the %s environment variable.", keyName, s.keys.unsetLabel(config)), keyDetails(keyName))
+	}
+
+	usage, err := lookup(ctx, value)
+	usage.Key = keyName
+	if err != nil {
+		return failure(codeBackendUnavailable, fmt.Sprintf("Error: could not look up usage for '%s': %v", keyName, s.keys.secrets.scrubError(err)), keyDetails(keyName))
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Usage for %s:\n", keyName))
+	if usage.Organization != "" {
+		text.WriteString(fmt.Sprintf("  Organization: %s\n", usage.Organization))
+	}
+	if usage.CostThisMonth != nil {
+		text.WriteString(fmt.Sprintf("  Cost this month: %.2f %s\n", *usage.CostThisMonth, strings.ToUpper(usage.Currency)))
+	}
+	if len(usage.RateLimits) > 0 {
+		names := make([]string, 0, len(usage.RateLimits))
+		for name := range usage.RateLimits {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		text.WriteString("  Rate limits:\n")
+		for _, name := range names {
+			text.WriteString(fmt.Sprintf("    %s: %s\n", name, usage.RateLimits[name]))
+		}
+	}
+	if usage.Detail != "" {
+		text.WriteString(fmt.Sprintf("  Note: %s\n", usage.Detail))
+	}
+
+	toolResult := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text.String()}},
+	}
+	if s.supportsStructuredContent() {
+		toolResult.StructuredContent = usage
+	}
+	return toolResult
+}
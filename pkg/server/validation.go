@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// validateArguments checks tool arguments against the tool's input schema.
+// It returns one problem per argument that is missing, has the wrong type or
+// isn't one of the allowed values, and the names of arguments the schema
+// doesn't declare, which are ignored rather than rejected.
+func validateArguments(schema InputSchema, args map[string]interface{}) (problems []string, unknown []string) {
+	for _, name := range schema.Required {
+		if _, ok := args[name]; !ok {
+			problems = append(problems, fmt.Sprintf("%s: required", name))
+		}
+	}
+
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, declared := schema.Properties[name]
+		if !declared {
+			unknown = append(unknown, name)
+			continue
+		}
+		problems = append(problems, validateValue(name, property, args[name])...)
+	}
+	return problems, unknown
+}
+
+// validateValue checks one value against its property schema, descending
+// into arrays and objects. path names the value in problem messages.
+func validateValue(path string, property Property, value interface{}) []string {
+	if actual := jsonType(value); !typeMatches(property.Type, value) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, property.Type, actual)}
+	}
+
+	if len(property.Enum) > 0 {
+		s, _ := value.(string)
+		allowed := false
+		for _, candidate := range property.Enum {
+			if s == candidate {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return []string{fmt.Sprintf("%s: %q is not one of %s", path, s, strings.Join(property.Enum, ", "))}
+		}
+	}
+
+	var problems []string
+	switch value := value.(type) {
+	case []interface{}:
+		if property.Items != nil {
+			for i, item := range value {
+				problems = append(problems, validateValue(fmt.Sprintf("%s[%d]", path, i), *property.Items, item)...)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range property.Required {
+			if _, ok := value[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s: required", path, name))
+			}
+		}
+		for name, nested := range property.Properties {
+			if item, ok := value[name]; ok {
+				problems = append(problems, validateValue(path+"."+name, nested, item)...)
+			}
+		}
+		sort.Strings(problems)
+	}
+	return problems
+}
+
+// typeMatches reports whether a decoded JSON value has the given JSON Schema
+// type. An empty type accepts anything.
+func typeMatches(schemaType string, value interface{}) bool {
+	switch schemaType {
+	case "":
+		return true
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	}
+	return jsonType(value) == schemaType
+}
+
+// jsonType names the JSON Schema type of a value decoded by encoding/json.
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/registry"
+)
+
+const (
+	// webhookTimeout bounds each delivery attempt.
+	webhookTimeout = 5 * time.Second
+	// webhookRetryDelay is the wait before the single retry.
+	webhookRetryDelay = time.Second
+	// webhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of
+	// the body, keyed with the webhook secret.
+	webhookSignatureHeader = "X-Signature-256"
+)
+
+// Sensitivity thresholds for --reveal-webhook-on.
+const (
+	webhookOnRestricted = "restricted"
+	webhookOnAll        = "all"
+)
+
+// webhookSecretFromEnv returns the key reveal webhooks are signed with. It is
+// read from the environment rather than a flag so it doesn't show up in
+// process listings.
+func webhookSecretFromEnv() string {
+	return os.Getenv("MCP_REVEAL_WEBHOOK_SECRET")
+}
+
+// revealEvent is the body POSTed to the webhook. It never holds a key value.
+type revealEvent struct {
+	Event         string          `json:"event"`
+	Time          time.Time       `json:"time"`
+	Key           string          `json:"key"`
+	Category      string          `json:"category"`
+	Restricted    bool            `json:"restricted"`
+	Masked        string          `json:"masked"`
+	Client        string          `json:"client,omitempty"`
+	ClientVersion string          `json:"client_version,omitempty"`
+	RequestID     json.RawMessage `json:"request_id,omitempty"`
+	Justification string          `json:"justification,omitempty"`
+}
+
+// revealWebhook posts an event for each reveal of a sensitive key. Delivery
+// happens in the background, so a slow or failing receiver never delays or
+// fails the tool call; failures are only logged.
+type revealWebhook struct {
+	url    string
+	secret []byte
+	// on is the sensitivity threshold: webhookOnRestricted or webhookOnAll.
+	on      string
+	client  *http.Client
+	logger  *slog.Logger
+	pending sync.WaitGroup
+}
+
+func newRevealWebhook(url, on, secret string, logger *slog.Logger) (*revealWebhook, error) {
+	if on != webhookOnRestricted && on != webhookOnAll {
+		return nil, fmt.Errorf("invalid webhook threshold %q: use %s or %s", on, webhookOnRestricted, webhookOnAll)
+	}
+	return &revealWebhook{
+		url:    url,
+		secret: []byte(secret),
+		on:     on,
+		client: &http.Client{Timeout: webhookTimeout},
+		logger: logger,
+	}, nil
+}
+
+// covers reports whether reveals of a key are sent to the webhook.
+func (w *revealWebhook) covers(config registry.APIKeyConfig) bool {
+	return w.on == webhookOnAll || config.Restricted
+}
+
+// send delivers event in the background, retrying once.
+func (w *revealWebhook) send(event revealEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		w.logger.Error("failed to encode reveal webhook", "error", err)
+		return
+	}
+
+	w.pending.Add(1)
+	go func() {
+		defer w.pending.Done()
+		err := w.post(body)
+		if err != nil {
+			time.Sleep(webhookRetryDelay)
+			err = w.post(body)
+		}
+		if err != nil {
+			w.logger.Warn("failed to deliver reveal webhook", "key", event.Key, "error", err)
+		}
+	}()
+}
+
+func (w *revealWebhook) post(body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		request.Header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", response.Status)
+	}
+	return nil
+}
+
+// wait blocks until deliveries in progress finish or ctx is done.
+func (w *revealWebhook) wait(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		w.pending.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("gave up waiting for reveal webhooks: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultWebhookTolerance is how old a Stripe or Slack signature timestamp
+// may be, matching both providers' own libraries.
+const defaultWebhookTolerance = 5 * time.Minute
+
+// webhookProvider signs and verifies one provider's webhook signatures.
+type webhookProvider struct {
+	// Key is the registered key holding the signing secret.
+	Key string
+	// Header is the request header the signature arrives in.
+	Header string
+	// Timestamped providers sign a timestamp along with the payload.
+	Timestamped bool
+}
+
+// webhookProviders is the table of providers verify_webhook_signature and
+// compute_webhook_signature support.
+var webhookProviders = map[string]webhookProvider{
+	"stripe": {Key: "stripe_webhook", Header: "Stripe-Signature", Timestamped: true},
+	"github": {Key: "github_webhook_secret", Header: "X-Hub-Signature-256"},
+	"slack":  {Key: "slack_signing_secret", Header: "X-Slack-Signature", Timestamped: true},
+}
+
+var webhookProviderNames = []string{"github", "slack", "stripe"}
+
+// signingSecret returns the value of a key a tool signs with, or a fake one
+// in dry-run mode, with an error fit for the client when it isn't
+// configured. The value is only used, never returned.
+func (s *Server) signingSecret(keyName string) ([]byte, error) {
+	config, value, _ := s.keys.lookup(keyName)
+	if value == "" {
+		return nil, withCode(codeNotConfigured, fmt.Errorf("API key '%s' is not configured. Set the %s environment variable.", keyName, s.keys.unsetLabel(config)))
+	}
+	if s.dryRun {
+		return []byte(s.keys.fakeSecret(keyName)), nil
+	}
+	return []byte(value), nil
+}
+
+func hmacSHA256Hex(secret []byte, message string) string {
+	return hex.EncodeToString(hmacSHA256(secret, message))
+}
+
+// computeWebhookSignature returns the header value provider would send for
+// payload, signed at timestamp.
+func computeWebhookSignature(provider string, secret []byte, payload string, timestamp int64) string {
+	switch provider {
+	case "stripe":
+		return fmt.Sprintf("t=%d,v1=%s", timestamp, hmacSHA256Hex(secret, fmt.Sprintf("%d.%s", timestamp, payload)))
+	case "slack":
+		return "v0=" + hmacSHA256Hex(secret, fmt.Sprintf("v0:%d:%s", timestamp, payload))
+	default:
+		return "sha256=" + hmacSHA256Hex(secret, payload)
+	}
+}
+
+// signaturesMatch compares signatures in constant time.
+func signaturesMatch(expected, actual string) bool {
+	return hmac.Equal([]byte(expected), []byte(actual))
+}
+
+// checkTimestamp reports whether a signed timestamp is within tolerance of
+// now.
+func checkTimestamp(timestamp int64, tolerance time.Duration, now time.Time) error {
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance {
+		return fmt.Errorf("timestamp too old: signed %s ago, tolerance is %s", age.Round(time.Second), tolerance)
+	}
+	if -age > tolerance {
+		return fmt.Errorf("timestamp is %s in the future", (-age).Round(time.Second))
+	}
+	return nil
+}
+
+// verifyWebhookSignature checks a signature header value for payload. For
+// Slack, timestamp is the X-Slack-Request-Timestamp header; Stripe carries
+// it in the signature header.
+func verifyWebhookSignature(provider string, secret []byte, payload, signature, timestamp string, tolerance time.Duration, now time.Time) error {
+	signature = strings.TrimSpace(signature)
+	switch provider {
+	case "stripe":
+		var signed int64 = -1
+		var candidates []string
+		for _, part := range strings.Split(signature, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch name {
+			case "t":
+				parsed, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return fmt.Errorf("malformed signature header: bad t=%q", value)
+				}
+				signed = parsed
+			case "v1":
+				candidates = append(candidates, value)
+			}
+		}
+		if signed < 0 || len(candidates) == 0 {
+			return fmt.Errorf("malformed signature header: expected t=<timestamp>,v1=<signature>")
+		}
+		expected := hmacSHA256Hex(secret, fmt.Sprintf("%d.%s", signed, payload))
+		matched := false
+		// Stripe sends one v1 per active secret while a secret is rolled
+		for _, candidate := range candidates {
+			if signaturesMatch(expected, candidate) {
+				matched = true
+			}
+		}
+		if !matched {
+			return fmt.Errorf("signature mismatch")
+		}
+		return checkTimestamp(signed, tolerance, now)
+	case "slack":
+		signed, err := strconv.ParseInt(strings.TrimSpace(timestamp), 10, 64)
+		if err != nil {
+			return fmt.Errorf("timestamp is required for Slack: pass the X-Slack-Request-Timestamp header")
+		}
+		if !strings.HasPrefix(signature, "v0=") {
+			return fmt.Errorf("malformed signature header: expected v0=<signature>")
+		}
+		if !signaturesMatch(computeWebhookSignature("slack", secret, payload, signed), signature) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return checkTimestamp(signed, tolerance, now)
+	default:
+		if !strings.HasPrefix(signature, "sha256=") {
+			return fmt.Errorf("malformed signature header: expected sha256=<signature>")
+		}
+		if !signaturesMatch(computeWebhookSignature("github", secret, payload, 0), signature) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	}
+}
+
+// webhookVerificationSchema describes the structured result of
+// verify_webhook_signature.
+var webhookVerificationSchema = InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"valid":  {Type: "boolean", Description: "Whether the signature matches the configured secret and, for Stripe and Slack, the timestamp is within tolerance"},
+		"reason": {Type: "string", Description: "Why the signature is invalid, such as signature mismatch or timestamp too old"},
+	},
+	Required: []string{"valid"},
+}
+
+func (s *Server) handleVerifyWebhookSignature(ctx context.Context, args map[string]interface{}) CallToolResult {
+	providerName, _ := args["provider"].(string)
+	payload, _ := args["payload"].(string)
+	signature, _ := args["signature"].(string)
+	timestamp, _ := args["timestamp"].(string)
+	tolerance := defaultWebhookTolerance
+	if seconds, ok := args["tolerance_seconds"].(float64); ok && seconds > 0 {
+		tolerance = time.Duration(seconds * float64(time.Second))
+	}
+
+	provider := webhookProviders[providerName]
+	secret, err := s.signingSecret(provider.Key)
+	if err != nil {
+		return errorFailure(err, codeNotConfigured, keyDetails(provider.Key))
+	}
+
+	verification := map[string]interface{}{"valid": true}
+	text := fmt.Sprintf("%s The %s signature is valid.", s.markers.status(true), providerName)
+	if err := verifyWebhookSignature(providerName, secret, payload, signature, timestamp, tolerance, time.Now()); err != nil {
+		verification = map[string]interface{}{"valid": false, "reason": err.Error()}
+		text = fmt.Sprintf("%s The %s signature is invalid: %v", s.markers.status(false), providerName, err)
+	}
+
+	toolResult := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: text}},
+	}
+	if s.supportsStructuredContent() {
+		toolResult.StructuredContent = verification
+	}
+	return toolResult
+}
+
+func (s *Server) handleComputeWebhookSignature(ctx context.Context, args map[string]interface{}) CallToolResult {
+	providerName, _ := args["provider"].(string)
+	payload, _ := args["payload"].(string)
+	timestamp := time.Now().Unix()
+	if t, ok := args["timestamp"].(float64); ok {
+		timestamp = int64(t)
+	}
+
+	provider := webhookProviders[providerName]
+	secret, err := s.signingSecret(provider.Key)
+	if err != nil {
+		return errorFailure(err, codeNotConfigured, keyDetails(provider.Key))
+	}
+
+	headers := fmt.Sprintf("%s: %s\n", provider.Header, computeWebhookSignature(providerName, secret, payload, timestamp))
+	if providerName == "slack" {
+		headers += fmt.Sprintf("X-Slack-Request-Timestamp: %d\n", timestamp)
+	}
+	result := CallToolResult{
+		Content: []ContentBlock{{Type: "text", Text: headers}},
+	}
+	if s.dryRun {
+		result.Content = append([]ContentBlock{{Type: "text", Text: dryRunNotice}}, result.Content...)
+	}
+	return result
+}
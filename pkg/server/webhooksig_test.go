@@ -0,0 +1,123 @@
+package server_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/testmcp"
+)
+
+// Signing secrets of the webhook fixtures. The GitHub and Slack ones, with
+// their payloads and signatures, are the examples in the providers' docs.
+const (
+	githubWebhookSecret = "It's a Secret to Everybody"
+	slackSigningSecret  = "8f742231b10e8888abcd99yyyzzz85a5"
+	stripeWebhookSecret = "whsec_test_secret0123456789abcdef"
+)
+
+const (
+	slackPayload   = "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+	slackSignature = "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+	stripePayload  = `{"id":"evt_1","type":"charge.succeeded"}`
+	stripeV1       = "2d7a920f7109f285bd0a05a825761e6a28d07f40d6e5e087a8a9c152c0b4c74d"
+)
+
+// forever is a tolerance_seconds that accepts the fixtures' old timestamps.
+const forever = float64(100 * 365 * 24 * 60 * 60)
+
+func TestVerifyWebhookSignatureFixtures(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{
+		"github_webhook_secret": githubWebhookSecret,
+		"slack_signing_secret":  slackSigningSecret,
+		"stripe_webhook":        stripeWebhookSecret,
+	})
+	c := newClient(t)
+
+	for _, test := range []struct {
+		name   string
+		args   map[string]interface{}
+		reason string
+	}{
+		{"github", map[string]interface{}{"provider": "github", "payload": "Hello, World!", "signature": "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"}, ""},
+		{"github tampered", map[string]interface{}{"provider": "github", "payload": "Hello, World?", "signature": "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"}, "signature mismatch"},
+		{"github sha1", map[string]interface{}{"provider": "github", "payload": "Hello, World!", "signature": "sha1=01dc10d0c83e72ed246219cdd91669667fe2ca59"}, "malformed signature header"},
+		{"slack", map[string]interface{}{"provider": "slack", "payload": slackPayload, "signature": slackSignature, "timestamp": "1531420618", "tolerance_seconds": forever}, ""},
+		{"slack too old", map[string]interface{}{"provider": "slack", "payload": slackPayload, "signature": slackSignature, "timestamp": "1531420618"}, "timestamp too old"},
+		{"slack other timestamp", map[string]interface{}{"provider": "slack", "payload": slackPayload, "signature": slackSignature, "timestamp": "1531420619", "tolerance_seconds": forever}, "signature mismatch"},
+		{"slack without timestamp", map[string]interface{}{"provider": "slack", "payload": slackPayload, "signature": slackSignature}, "timestamp is required"},
+		{"stripe", map[string]interface{}{"provider": "stripe", "payload": stripePayload, "signature": "t=1700000000,v1=" + stripeV1, "tolerance_seconds": forever}, ""},
+		{"stripe rolled secret", map[string]interface{}{"provider": "stripe", "payload": stripePayload, "signature": "t=1700000000,v1=" + strings.Repeat("0", 64) + ",v1=" + stripeV1, "tolerance_seconds": forever}, ""},
+		{"stripe too old", map[string]interface{}{"provider": "stripe", "payload": stripePayload, "signature": "t=1700000000,v1=" + stripeV1}, "timestamp too old"},
+		{"stripe other timestamp", map[string]interface{}{"provider": "stripe", "payload": stripePayload, "signature": "t=1700000001,v1=" + stripeV1, "tolerance_seconds": forever}, "signature mismatch"},
+		{"stripe without t", map[string]interface{}{"provider": "stripe", "payload": stripePayload, "signature": "v1=" + stripeV1}, "malformed signature header"},
+	} {
+		result, err := c.CallTool("verify_webhook_signature", test.args)
+		if err != nil || result.IsError {
+			t.Fatalf("%s: verify_webhook_signature = %+v, %v", test.name, result, err)
+		}
+		var verification struct {
+			Valid  bool   `json:"valid"`
+			Reason string `json:"reason"`
+		}
+		data, _ := json.Marshal(result.StructuredContent)
+		if err := json.Unmarshal(data, &verification); err != nil {
+			t.Fatal(err)
+		}
+		if verification.Valid != (test.reason == "") || !strings.Contains(verification.Reason, test.reason) {
+			t.Errorf("%s: verification = %+v, want reason %q", test.name, verification, test.reason)
+		}
+		for _, secret := range []string{githubWebhookSecret, slackSigningSecret, stripeWebhookSecret} {
+			if strings.Contains(testmcp.Text(result), secret) {
+				t.Errorf("%s: the result holds a signing secret", test.name)
+			}
+		}
+	}
+}
+
+func TestComputeWebhookSignatureFixtures(t *testing.T) {
+	testmcp.SetKeys(t, map[string]string{
+		"github_webhook_secret": githubWebhookSecret,
+		"slack_signing_secret":  slackSigningSecret,
+		"stripe_webhook":        stripeWebhookSecret,
+	})
+	c := newClient(t)
+
+	for _, test := range []struct {
+		args map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"provider": "github", "payload": "Hello, World!"}, "X-Hub-Signature-256: sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17\n"},
+		{map[string]interface{}{"provider": "slack", "payload": slackPayload, "timestamp": 1531420618}, "X-Slack-Signature: " + slackSignature + "\nX-Slack-Request-Timestamp: 1531420618\n"},
+		{map[string]interface{}{"provider": "stripe", "payload": stripePayload, "timestamp": 1700000000}, "Stripe-Signature: t=1700000000,v1=" + stripeV1 + "\n"},
+	} {
+		result, err := c.CallTool("compute_webhook_signature", test.args)
+		if err != nil || result.IsError || testmcp.Text(result) != test.want {
+			t.Errorf("compute_webhook_signature %v = %q, %v; want %q", test.args, testmcp.Text(result), err, test.want)
+		}
+	}
+
+	// A signature computed now verifies with the default tolerance
+	now := time.Now().Unix()
+	result, err := c.CallTool("compute_webhook_signature", map[string]interface{}{"provider": "stripe", "payload": stripePayload, "timestamp": now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := strings.TrimSpace(strings.TrimPrefix(testmcp.Text(result), "Stripe-Signature: "))
+	result, err = c.CallTool("verify_webhook_signature", map[string]interface{}{"provider": "stripe", "payload": stripePayload, "signature": signature})
+	if err != nil || !strings.Contains(testmcp.Text(result), "signature is valid") {
+		t.Errorf("a fresh signature %s = %q, %v", signature, testmcp.Text(result), err)
+	}
+
+	// Timestamps too far in the future are refused like old ones
+	result, err = c.CallTool("compute_webhook_signature", map[string]interface{}{"provider": "stripe", "payload": stripePayload, "timestamp": now + 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature = strings.TrimSpace(strings.TrimPrefix(testmcp.Text(result), "Stripe-Signature: "))
+	result, err = c.CallTool("verify_webhook_signature", map[string]interface{}{"provider": "stripe", "payload": stripePayload, "signature": signature})
+	if err != nil || !strings.Contains(testmcp.Text(result), "in the future") {
+		t.Errorf("a signature an hour ahead = %q, %v", testmcp.Text(result), err)
+	}
+}
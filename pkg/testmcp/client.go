@@ -0,0 +1,193 @@
+// Package testmcp runs the API keys server in-process for Go tests. A
+// Client passes JSON-RPC messages straight to the server's dispatcher, so
+// tests need no subprocess or pipes, and the fixtures set up the keys the
+// server sees.
+//
+//	func TestAgent(t *testing.T) {
+//		testmcp.SetKeys(t, map[string]string{"openai": "sk-proj-test0123456789abcdefgh"})
+//		c := testmcp.New()
+//		if _, err := c.Initialize(); err != nil {
+//			t.Fatal(err)
+//		}
+//		result, err := c.CallTool("check_api_key_exists", map[string]interface{}{"key_name": "openai"})
+//		...
+//	}
+package testmcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/server"
+)
+
+// ProtocolVersion is the protocol version Initialize asks for.
+const ProtocolVersion = "2025-06-18"
+
+// Client is an MCP client wired to an in-process server. Its methods may be
+// called from several goroutines.
+type Client struct {
+	// Server is the server the client talks to, for registering tools and
+	// keys before the first call.
+	Server *server.Server
+
+	mu     sync.Mutex
+	nextID int
+	out    *lockedBuffer
+}
+
+// New starts a server with opts and returns a client for it. Like any
+// server, it loads .env from the working directory; use SetKeys or
+// ClearKeys to control what it sees.
+func New(opts ...server.Option) *Client {
+	out := &lockedBuffer{}
+	return &Client{
+		Server: server.New(strings.NewReader(""), out, opts...),
+		out:    out,
+	}
+}
+
+// RPCError is a JSON-RPC error response.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// Call sends a request for method with params and decodes its result into
+// result, unless result is nil. A JSON-RPC error is returned as *RPCError.
+func (c *Client) Call(method string, params, result interface{}) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.mu.Unlock()
+
+	message := map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method}
+	if params != nil {
+		message["params"] = params
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	reply := c.Server.Handle(data)
+	if reply == nil {
+		return fmt.Errorf("%s: no response", method)
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := json.Unmarshal(reply, &response); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", method, err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// Notify sends a notification for method with params.
+func (c *Client) Notify(method string, params interface{}) error {
+	message := map[string]interface{}{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		message["params"] = params
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	c.Server.Handle(data)
+	return nil
+}
+
+// Initialize performs the handshake: initialize, then the initialized
+// notification. Most requests are refused until it has been done.
+func (c *Client) Initialize() (server.InitializeResult, error) {
+	var result server.InitializeResult
+	params := server.InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		ClientInfo:      server.ClientInfo{Name: "testmcp", Version: "1.0.0"},
+	}
+	if err := c.Call("initialize", params, &result); err != nil {
+		return result, err
+	}
+	return result, c.Notify("notifications/initialized", nil)
+}
+
+// ListTools returns every tool the server offers, following pagination.
+func (c *Client) ListTools() ([]server.Tool, error) {
+	var tools []server.Tool
+	cursor := ""
+	for {
+		var page server.ToolsListResult
+		if err := c.Call("tools/list", server.PaginatedParams{Cursor: cursor}, &page); err != nil {
+			return nil, err
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool calls the tool name with args. A tool that fails reports it in
+// the result, with IsError set; the error is for failures of the call
+// itself, such as an unknown tool.
+func (c *Client) CallTool(name string, args map[string]interface{}) (server.CallToolResult, error) {
+	var result server.CallToolResult
+	err := c.Call("tools/call", server.CallToolParams{Name: name, Arguments: args}, &result)
+	return result, err
+}
+
+// Text returns the text of a result's content blocks, joined by newlines.
+func Text(result server.CallToolResult) string {
+	texts := make([]string, 0, len(result.Content))
+	for _, block := range result.Content {
+		texts = append(texts, block.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Notifications returns the messages the server has written to its output
+// so far, such as log and list-changed notifications, one per element.
+func (c *Client) Notifications() []json.RawMessage {
+	var messages []json.RawMessage
+	for _, line := range bytes.Split(c.out.bytes(), []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			messages = append(messages, json.RawMessage(line))
+		}
+	}
+	return messages
+}
+
+// lockedBuffer collects the server's output, which it may write from
+// several goroutines.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
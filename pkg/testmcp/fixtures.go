@@ -0,0 +1,90 @@
+package testmcp
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/yourusername/mcp-api-keys-server/pkg/registry"
+)
+
+// The server reads key values from the environment, so the fixtures stand in
+// for a secrets provider by setting variables for the rest of the test with
+// t.Setenv. Like t.Setenv, they can't be used in parallel tests.
+
+// registered holds the keys registered through Client.RegisterKey on any
+// client, so SetKeys and ClearKeys know their variables too.
+var registered = struct {
+	sync.Mutex
+	keys map[string]registry.APIKeyConfig
+}{keys: map[string]registry.APIKeyConfig{}}
+
+// knownKeys returns the built-in keys and those registered through
+// Client.RegisterKey.
+func knownKeys() map[string]registry.APIKeyConfig {
+	keys := registry.Defaults()
+	registered.Lock()
+	defer registered.Unlock()
+	for name, config := range registered.keys {
+		keys[name] = config
+	}
+	return keys
+}
+
+// keyEnvVars returns every variable config is read from.
+func keyEnvVars(config registry.APIKeyConfig) []string {
+	return append(config.EnvVars(), config.EnvVarAliases...)
+}
+
+// ClearKeys unsets every variable a known key is read from for the rest of
+// the test, so values in the developer's environment don't leak into it.
+func ClearKeys(t testing.TB) {
+	t.Helper()
+	for _, config := range knownKeys() {
+		for _, envVar := range keyEnvVars(config) {
+			t.Setenv(envVar, "")
+			os.Unsetenv(envVar)
+		}
+	}
+}
+
+// SetKeys clears every known key, then sets the ones in values for the rest
+// of the test. Values are given by key name, such as "openai", or, for
+// composite key members, by variable, such as "AZURE_OPENAI_ENDPOINT".
+func SetKeys(t testing.TB, values map[string]string) {
+	t.Helper()
+	ClearKeys(t)
+	keys := knownKeys()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		envVar := name
+		if config, ok := keys[name]; ok {
+			if config.IsComposite() {
+				t.Fatalf("testmcp: %s is a composite key; set its members by variable", name)
+			}
+			envVar = config.EnvVar
+		}
+		t.Setenv(envVar, values[name])
+	}
+}
+
+// RegisterKey registers a key on the client's server and sets its value for
+// the rest of the test, or leaves it unset when value is empty.
+func (c *Client) RegisterKey(t testing.TB, name string, config registry.APIKeyConfig, value string) {
+	t.Helper()
+	if err := c.Server.RegisterKey(name, config); err != nil {
+		t.Fatalf("testmcp: %v", err)
+	}
+	registered.Lock()
+	registered.keys[name] = config
+	registered.Unlock()
+
+	if value != "" && !config.IsComposite() {
+		t.Setenv(config.EnvVar, value)
+	}
+}
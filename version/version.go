@@ -0,0 +1,23 @@
+// Package version holds the build metadata of the server. The variables are
+// set at build time with -ldflags, for example:
+//
+//	go build -ldflags "-X github.com/yourusername/mcp-api-keys-server/version.Version=1.2.0 \
+//		-X github.com/yourusername/mcp-api-keys-server/version.Commit=$(git rev-parse --short HEAD) \
+//		-X github.com/yourusername/mcp-api-keys-server/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import "fmt"
+
+var (
+	// Version is the release version of the server.
+	Version = "1.0.0"
+	// Commit is the git commit the server was built from.
+	Commit = "unknown"
+	// Date is when the server was built, in RFC 3339 format.
+	Date = "unknown"
+)
+
+// String describes the build in one line.
+func String() string {
+	return fmt.Sprintf("%s (commit %s, built %s)", Version, Commit, Date)
+}